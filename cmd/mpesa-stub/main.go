@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"mamlaka/internal/pkg/gateway/mpesa"
+	"net/http"
+	"time"
+)
+
+// Runs a local stand-in for the Daraja API. Point MPESA_BASE_URL at it, e.g.
+//
+//	go run ./cmd/mpesa-stub -addr :9090 -mode cancel
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	mode := flag.String("mode", string(mpesa.StubSucceed), "outcome of every STK Push: succeed, cancel or timeout")
+	delay := flag.Duration("delay", 3*time.Second, "time before a push is resolved and the callback is sent")
+	flag.Parse()
+
+	switch mpesa.StubMode(*mode) {
+	case mpesa.StubSucceed, mpesa.StubCancel, mpesa.StubTimeout:
+	default:
+		log.Fatalf("unknown mode %q", *mode)
+	}
+
+	stub := mpesa.NewStubServer(mpesa.StubMode(*mode), *delay)
+	log.Printf("Daraja stub listening on %s (mode=%s, delay=%s)", *addr, *mode, *delay)
+	if err := http.ListenAndServe(*addr, stub); err != nil {
+		panic(fmt.Sprintf("cannot start stub: %s", err))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mamlaka/internal/app/webhook"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Runs a local webhook endpoint that verifies and prints the events it
+// receives. With APP_ENV=development, register http://localhost:9091/ as an
+// endpoint, then run it with the secret returned on registration, e.g.
+//
+//	go run ./cmd/webhook-receiver -addr :9091 -secret whsec_... -fail-every 3
+func main() {
+	addr := flag.String("addr", ":9091", "address to listen on")
+	secret := flag.String("secret", "", "signing secret of the endpoint")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "maximum age of a signature")
+	failEvery := flag.Int("fail-every", 0, "answer every nth request with 500 to exercise retries; 0 never fails")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("-secret is required")
+	}
+
+	var received atomic.Int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := webhook.Verify(*secret, body, r.Header.Get(webhook.SignatureHeader), *tolerance, time.Now()); err != nil {
+			log.Printf("Rejected delivery %s: %s", r.Header.Get("Mamlaka-Delivery-ID"), err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if n := received.Add(1); *failEvery > 0 && n%int64(*failEvery) == 0 {
+			log.Printf("Failing delivery %s on purpose", r.Header.Get("Mamlaka-Delivery-ID"))
+			http.Error(w, "failing on purpose", http.StatusInternalServerError)
+			return
+		}
+
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, body, "", "  "); err != nil {
+			pretty.Write(body)
+		}
+		log.Printf("Delivery %s: %s\n%s", r.Header.Get("Mamlaka-Delivery-ID"), r.Header.Get("Mamlaka-Event-Type"), pretty.String())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Webhook receiver listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		panic(fmt.Sprintf("cannot start receiver: %s", err))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/payment"
+	"mamlaka/internal/app/webhook"
+	"mamlaka/internal/pkg/database"
+	"mamlaka/internal/pkg/jobs"
+	"mamlaka/internal/pkg/outbox"
+	"mamlaka/internal/pkg/pubsub"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// Runs the background work of the API: the job queue that processes
+// payments, the payment reconciler and authorization sweeper, and webhook
+// delivery, and the outbox relay publishing domain events. Any number of workers can run next to any number of API servers.
+// The vault keys must be configured, since the worker reads cards the API stored.
+func main() {
+	conf := config.ReadConfigFromEnv()
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	db := database.New(conf).GetDB()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	queue := jobs.NewQueue(db, logger, conf.Jobs)
+	if err := payment.RegisterPaymentWorkers(ctx, queue, logger, db, conf); err != nil {
+		panic(fmt.Sprintf("cannot start payment workers: %s", err))
+	}
+	dispatcher := webhook.NewDispatcher(logger, webhook.NewWebhookRepository(db, logger), conf.Webhook)
+	go webhook.RunDispatcher(ctx, logger, dispatcher, conf.Webhook.DispatchInterval)
+
+	// Relay domain events recorded in the outbox to the in-process bus and,
+	// when a broker is configured, to AMQP
+	sinks := []outbox.Sink{outbox.NewMemorySink(pubsub.NewBroker(pubsub.DefaultBuffer))}
+	if conf.Outbox.AMQPURL != "" {
+		amqpSink := outbox.NewAMQPSink(conf.Outbox.AMQPURL, conf.Outbox.AMQPExchange)
+		defer amqpSink.Close()
+		sinks = append(sinks, amqpSink)
+	}
+	go outbox.NewRelay(db, logger, conf.Outbox, sinks...).Run(ctx)
+
+	// Blocks until a signal arrives and running jobs have finished or been released
+	queue.Run(ctx)
+}
@@ -3,11 +3,38 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
+)
+
+// Environments the API can run in, set with APP_ENV. Anything other than
+// development is treated as production.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
 )
 
 type Config struct {
-	Email    EmailConfig
-	Postgres PostgresConfig
+	Environment    string
+	TrustedProxies []string // CIDR ranges of the load balancers in front of the API, whose X-Forwarded-For is trusted
+	Email          EmailConfig
+	Postgres       PostgresConfig
+	Payment        PaymentConfig
+	Mpesa          MpesaConfig
+	Vault          VaultConfig
+	Transfer       TransferConfig
+	Webhook        WebhookConfig
+	Jobs           JobsConfig
+	Outbox         OutboxConfig
+	Risk           RiskConfig
+	Auth           AuthConfig
+	JWT            JWTConfig
+}
+
+// IsDevelopment reports whether the API runs in development, where settings
+// that are unsafe in production, e.g. plain http webhooks, are allowed.
+func (c Config) IsDevelopment() bool {
+	return c.Environment == EnvDevelopment
 }
 
 type EmailConfig struct {
@@ -31,8 +58,135 @@ type PostgresConfig struct {
 	MaxOpenConns int
 }
 
+type PaymentConfig struct {
+	IdempotencyKeyTTL     time.Duration
+	GatewayTimeout        time.Duration
+	PendingReconcileAfter time.Duration
+	ReconcileInterval     time.Duration
+	AuthorizationTTL      time.Duration            // How long an uncaptured authorization is held before it is voided
+	AuthorizationSweep    time.Duration            // How often expired authorizations are looked for
+	SettlementDelay       time.Duration            // How long after capture gateways pay captured funds out
+	SettlementSweep       time.Duration            // How often payments due for settlement are looked for
+	FeeBasisPoints        int                      // Processing fee charged on captures, in hundredths of a percent
+	StreamAllowedOrigins  []string                 // Origin host patterns, besides the API's own, allowed to open the payment stream
+	CVVRetention          time.Duration            // How long a card's CVV is kept waiting for the payment to be processed
+	DuplicateRules        map[string]DuplicateRule // Keyed by payment method
+	SandboxGateway        bool                     // Route payments without a real provider to the sandbox; on by default in development only
+}
+
+// DuplicateRule decides when a new payment repeats an earlier payment of the
+// same user with the same payment method: when both were made within Window
+// of each other and agree on every one of Fields. A zero Window disables
+// the check.
+type DuplicateRule struct {
+	Window time.Duration
+	Fields []string // amount, reference, purpose, card, phone_number or email
+}
+
+// TransferConfig holds the daily peer-to-peer transfer limits per user tier,
+// keyed by currency code, as decimal amounts in major units of that currency.
+// Users may only send money in currencies their tier has a limit for.
+type TransferConfig struct {
+	StandardDailyLimits map[string]string
+	PremiumDailyLimits  map[string]string
+}
+
+// WebhookConfig controls how events are delivered to webhook endpoints.
+// Failed deliveries are retried after RetryBaseDelay, doubling on every
+// attempt up to RetryMaxDelay, until MaxAttempts have been made.
+type WebhookConfig struct {
+	MaxAttempts      int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	RequestTimeout   time.Duration
+	DispatchInterval time.Duration // How often due deliveries are looked for
+	RequireHTTPS     bool          // Set outside development; endpoints must use https
+	AllowPrivate     bool          // Set in development; endpoints may be on loopback and private addresses
+}
+
+// JobsConfig controls the background job workers. A running job is
+// cancelled after Timeout; failed jobs are retried after RetryBaseDelay,
+// doubling on every attempt up to RetryMaxDelay.
+type JobsConfig struct {
+	Workers        int
+	PollInterval   time.Duration // How long an idle worker waits before looking for jobs again
+	Timeout        time.Duration
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// OutboxConfig controls the relay publishing domain events from the outbox.
+// Events are always published to the worker's in-process bus, and to AMQP
+// when AMQPURL is set. Published events are deleted after Retention.
+type OutboxConfig struct {
+	RelayInterval time.Duration
+	BatchSize     int
+	Retention     time.Duration
+	AMQPURL       string
+	AMQPExchange  string
+}
+
+// RiskConfig controls payment risk screening. Rules are read from RulesFile,
+// when set, and from versions saved through the admin API, and reloaded
+// every ReloadInterval.
+type RiskConfig struct {
+	RulesFile      string
+	ReloadInterval time.Duration
+	CountryHeader  string // Request header carrying the client's country, set by the CDN or load balancer
+}
+
+// AuthConfig controls the tokens issued to users and the one-time codes
+// emailed to them. A code expires after CodeTTL or after MaxCodeAttempts
+// wrong guesses. A new code can be requested once every CodeResendInterval,
+// and at most MaxCodesPerHour times an hour.
+type AuthConfig struct {
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration // Lifetime of each refresh token; every use replaces it with a new one
+	CodeTTL            time.Duration
+	MaxCodeAttempts    int
+	CodeResendInterval time.Duration
+	MaxCodesPerHour    int
+	// BootstrapAdminEmail is the email of the user made admin at startup
+	// while there is no admin, so a new deployment can be administered.
+	BootstrapAdminEmail string
+}
+
+// JWTConfig holds the keys access tokens are signed and verified with, as
+// PEM files. The signing key is an RSA (RS256) or Ed25519 (EdDSA) private
+// key. Verification keys are the public keys of other signing keys that are
+// still accepted, and published along with the signing key. To rotate keys
+// without downtime, add the new key as a verification key, then make it the
+// signing key, and drop the old key once the tokens it signed have expired.
+type JWTConfig struct {
+	SigningKeyFile       string
+	VerificationKeyFiles []string
+	Issuer               string // Set as the iss claim and required of tokens, if not empty
+	AllowEphemeralKey    bool   // Set in development; a random signing key is used if none is configured
+}
+
+type MpesaConfig struct {
+	BaseURL        string
+	ConsumerKey    string
+	ConsumerSecret string
+	ShortCode      string
+	PassKey        string
+	CallbackURL    string
+	CallbackToken  string
+}
+
+// VaultConfig holds the card vault keys. They must not be reused for anything else.
+type VaultConfig struct {
+	EncryptionKey      string // base64-encoded 32-byte AES-256 key
+	FingerprintKey     string // base64-encoded 32-byte HMAC key
+	AllowEphemeralKeys bool   // Set in development; random keys are used for keys that are not configured
+}
+
 func ReadConfigFromEnv() Config {
+	environment := getEnv("APP_ENV", EnvProduction)
+
 	return Config{
+		Environment:    environment,
+		TrustedProxies: getEnvAsSlice("TRUSTED_PROXIES"),
 
 		Email: EmailConfig{
 			SMTPServer:  os.Getenv("EMAIL_SMTP_SERVER"),
@@ -54,7 +208,105 @@ func ReadConfigFromEnv() Config {
 			MaxIdleConns: getEnvAsInt("POSTGRES_MAX_IDLE_CONNS", 10),
 			MaxOpenConns: getEnvAsInt("POSTGRES_MAX_OPEN_CONNS", 100),
 		},
+
+		Payment: PaymentConfig{
+			IdempotencyKeyTTL:     getEnvAsDuration("PAYMENT_IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+			GatewayTimeout:        getEnvAsDuration("PAYMENT_GATEWAY_TIMEOUT", 20*time.Second),
+			PendingReconcileAfter: getEnvAsDuration("PAYMENT_PENDING_RECONCILE_AFTER", 2*time.Minute),
+			ReconcileInterval:     getEnvAsDuration("PAYMENT_RECONCILE_INTERVAL", time.Minute),
+			AuthorizationTTL:      getEnvAsDuration("PAYMENT_AUTHORIZATION_TTL", 7*24*time.Hour),
+			AuthorizationSweep:    getEnvAsDuration("PAYMENT_AUTHORIZATION_SWEEP_INTERVAL", 10*time.Minute),
+			SettlementDelay:       getEnvAsDuration("PAYMENT_SETTLEMENT_DELAY", 24*time.Hour),
+			SettlementSweep:       getEnvAsDuration("PAYMENT_SETTLEMENT_SWEEP_INTERVAL", 10*time.Minute),
+			FeeBasisPoints:        getEnvAsInt("PAYMENT_FEE_BPS", 0),
+			StreamAllowedOrigins:  getEnvAsSlice("PAYMENT_STREAM_ALLOWED_ORIGINS"),
+			CVVRetention:          getEnvAsDuration("PAYMENT_CVV_RETENTION", 15*time.Minute),
+			DuplicateRules: map[string]DuplicateRule{
+				"credit_card": getDuplicateRule("CREDIT_CARD", "amount", "card"),
+				"mpesa":       getDuplicateRule("MPESA", "amount", "phone_number"),
+				"e_wallet":    getDuplicateRule("E_WALLET", "amount", "purpose"),
+			},
+			SandboxGateway: getEnvAsBool("PAYMENT_SANDBOX_GATEWAY", environment == EnvDevelopment),
+		},
+
+		Mpesa: MpesaConfig{
+			BaseURL:        getEnv("MPESA_BASE_URL", "https://sandbox.safaricom.co.ke"),
+			ConsumerKey:    os.Getenv("MPESA_CONSUMER_KEY"),
+			ConsumerSecret: os.Getenv("MPESA_CONSUMER_SECRET"),
+			ShortCode:      os.Getenv("MPESA_SHORTCODE"),
+			PassKey:        os.Getenv("MPESA_PASSKEY"),
+			CallbackURL:    os.Getenv("MPESA_CALLBACK_URL"),
+			CallbackToken:  os.Getenv("MPESA_CALLBACK_TOKEN"),
+		},
+
+		JWT: JWTConfig{
+			SigningKeyFile:       os.Getenv("JWT_SIGNING_KEY_FILE"),
+			VerificationKeyFiles: getEnvAsSlice("JWT_VERIFICATION_KEY_FILES"),
+			Issuer:               os.Getenv("JWT_ISSUER"),
+			AllowEphemeralKey:    environment == EnvDevelopment,
+		},
+
+		Vault: VaultConfig{
+			EncryptionKey:      os.Getenv("VAULT_ENCRYPTION_KEY"),
+			FingerprintKey:     os.Getenv("VAULT_FINGERPRINT_KEY"),
+			AllowEphemeralKeys: environment == EnvDevelopment,
+		},
+
+		Transfer: TransferConfig{
+			StandardDailyLimits: getEnvAsMap("TRANSFER_DAILY_LIMITS_STANDARD", "KES:70000"),
+			PremiumDailyLimits:  getEnvAsMap("TRANSFER_DAILY_LIMITS_PREMIUM", "KES:300000"),
+		},
+
+		Webhook: WebhookConfig{
+			MaxAttempts:      getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 10),
+			RetryBaseDelay:   getEnvAsDuration("WEBHOOK_RETRY_BASE_DELAY", 30*time.Second),
+			RetryMaxDelay:    getEnvAsDuration("WEBHOOK_RETRY_MAX_DELAY", 6*time.Hour),
+			RequestTimeout:   getEnvAsDuration("WEBHOOK_REQUEST_TIMEOUT", 10*time.Second),
+			DispatchInterval: getEnvAsDuration("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second),
+			RequireHTTPS:     environment != EnvDevelopment,
+			AllowPrivate:     environment == EnvDevelopment,
+		},
+
+		Jobs: JobsConfig{
+			Workers:        getEnvAsInt("JOB_WORKERS", 4),
+			PollInterval:   getEnvAsDuration("JOB_POLL_INTERVAL", time.Second),
+			Timeout:        getEnvAsDuration("JOB_TIMEOUT", 2*time.Minute),
+			RetryBaseDelay: getEnvAsDuration("JOB_RETRY_BASE_DELAY", 5*time.Second),
+			RetryMaxDelay:  getEnvAsDuration("JOB_RETRY_MAX_DELAY", 10*time.Minute),
+		},
+
+		Outbox: OutboxConfig{
+			RelayInterval: getEnvAsDuration("OUTBOX_RELAY_INTERVAL", time.Second),
+			BatchSize:     getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+			Retention:     getEnvAsDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+			AMQPURL:       os.Getenv("OUTBOX_AMQP_URL"),
+			AMQPExchange:  getEnv("OUTBOX_AMQP_EXCHANGE", "mamlaka.events"),
+		},
+
+		Auth: AuthConfig{
+			AccessTokenTTL:      getEnvAsDuration("AUTH_ACCESS_TOKEN_TTL", time.Hour),
+			RefreshTokenTTL:     getEnvAsDuration("AUTH_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			CodeTTL:             getEnvAsDuration("AUTH_CODE_TTL", 15*time.Minute),
+			MaxCodeAttempts:     getEnvAsInt("AUTH_CODE_MAX_ATTEMPTS", 5),
+			CodeResendInterval:  getEnvAsDuration("AUTH_CODE_RESEND_INTERVAL", time.Minute),
+			MaxCodesPerHour:     getEnvAsInt("AUTH_CODE_MAX_PER_HOUR", 5),
+			BootstrapAdminEmail: os.Getenv("AUTH_BOOTSTRAP_ADMIN_EMAIL"),
+		},
+
+		Risk: RiskConfig{
+			RulesFile:      os.Getenv("RISK_RULES_FILE"),
+			ReloadInterval: getEnvAsDuration("RISK_RULES_RELOAD_INTERVAL", 30*time.Second),
+			CountryHeader:  os.Getenv("RISK_COUNTRY_HEADER"),
+		},
+	}
+}
+
+// Helper function to get environment variable with a default value
+func getEnv(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
 	}
+	return defaultValue
 }
 
 // Helper function to get environment variable as integer
@@ -74,3 +326,51 @@ func getEnvAsBool(name string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+// Helper function to get environment variable as duration (e.g. "30s", "24h")
+func getEnvAsDuration(name string, defaultValue time.Duration) time.Duration {
+	valueStr := os.Getenv(name)
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Helper function to get the duplicate payment rule of a payment method. The
+// window defaults to PAYMENT_DUPLICATE_WINDOW, itself one minute by default.
+func getDuplicateRule(method string, defaultFields ...string) DuplicateRule {
+	window := getEnvAsDuration("PAYMENT_DUPLICATE_WINDOW", time.Minute)
+	fields := getEnvAsSlice("PAYMENT_DUPLICATE_FIELDS_" + method)
+	if len(fields) == 0 {
+		fields = defaultFields
+	}
+	return DuplicateRule{
+		Window: getEnvAsDuration("PAYMENT_DUPLICATE_WINDOW_"+method, window),
+		Fields: fields,
+	}
+}
+
+// Helper function to get a comma-separated environment variable as a slice
+func getEnvAsSlice(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Helper function to get a comma-separated list of KEY:value pairs, e.g.
+// "KES:70000,USD:500", as a map. Keys are upper-cased.
+func getEnvAsMap(name string, defaultValue string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(getEnv(name, defaultValue), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, ":")
+		values[strings.ToUpper(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return values
+}
@@ -1,12 +1,31 @@
 package common
 
 type BaseResponse struct {
-	Status  int         `json:"status"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	Status     int         `json:"status"`
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"` // Set on paginated lists when another page follows
 }
 
+// Error codes set in ErrorResponse.Code for errors that clients handle specially.
+const (
+	CodeInsufficientFunds     = "insufficient_funds"
+	CodeTransferLimitExceeded = "transfer_limit_exceeded"
+	CodeDuplicatePayment      = "duplicate_payment"
+	CodePaymentBlocked        = "payment_blocked"
+	CodeInvalidCode           = "invalid_code"
+	CodeTooManyAttempts       = "too_many_attempts"
+	CodeRateLimited           = "rate_limited"
+)
+
 type ErrorResponse struct {
-	Status int    `json:"status"`
-	Error  string `json:"error"`
+	Status int          `json:"status"`
+	Code   string       `json:"code,omitempty"` // One of the Code constants, when the error has one
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"` // One entry per invalid request field
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
@@ -1,8 +1,65 @@
 package common
 
-import "github.com/go-playground/validator/v10"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
 
 func ValidateModel(r interface{}) error {
 	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
 	return validate.Struct(r)
 }
+
+// FieldErrors converts the error returned by ValidateModel into one FieldError
+// per invalid field, named by its JSON path (e.g. "payment_details.email").
+func FieldErrors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		_, path, _ := strings.Cut(fe.Namespace(), ".")
+		fields = append(fields, FieldError{Field: path, Message: validationMessage(fe)})
+	}
+	return fields
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters", fe.Param())
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "url":
+		return "must be a valid URL"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	default:
+		return fmt.Sprintf("failed %s validation", fe.Tag())
+	}
+}
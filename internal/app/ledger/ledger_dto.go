@@ -0,0 +1,18 @@
+package ledger
+
+import "mamlaka/internal/pkg/money"
+
+// Balance is the sum of an account's postings in one currency: debits less
+// credits. Liability and revenue accounts therefore carry negative balances.
+type Balance struct {
+	Account string      `json:"account"`
+	Kind    AccountKind `json:"kind"`
+	Balance money.Money `json:"balance"`
+}
+
+type PayoutRequestDto struct {
+	Gateway   string `json:"gateway" validate:"required,max=50"`
+	Amount    string `json:"amount" validate:"required"` // Decimal string in major units
+	Currency  string `json:"currency" validate:"required,len=3"`
+	Reference string `json:"reference" validate:"required,max=80"` // Bank or gateway payout reference
+}
@@ -0,0 +1,121 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"mamlaka/internal/pkg/money"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrEmptyEntry      = errors.New("journal entry needs at least two postings")
+	ErrZeroPosting     = errors.New("postings must not be zero")
+	ErrUnbalancedEntry = errors.New("journal entry does not balance")
+)
+
+// Line is one side of an Entry. Debits are positive and credits negative.
+type Line struct {
+	Account  string
+	Amount   int64
+	Currency string
+}
+
+// Debit returns a line debiting amount to account.
+func Debit(account string, amount money.Money) Line {
+	return Line{Account: account, Amount: amount.Amount, Currency: amount.Currency}
+}
+
+// Credit returns a line crediting amount to account.
+func Credit(account string, amount money.Money) Line {
+	return Line{Account: account, Amount: -amount.Amount, Currency: amount.Currency}
+}
+
+// Entry describes a journal entry to be posted.
+type Entry struct {
+	Reference   string
+	Description string
+	Lines       []Line
+}
+
+// Add appends lines, skipping those with a zero amount such as a waived fee.
+func (e *Entry) Add(lines ...Line) {
+	for _, line := range lines {
+		if line.Amount != 0 {
+			e.Lines = append(e.Lines, line)
+		}
+	}
+}
+
+// Validate checks that the entry has a reference and at least two non-zero
+// lines, and that its lines sum to zero in every currency.
+func (e Entry) Validate() error {
+	if e.Reference == "" {
+		return errors.New("journal entry needs a reference")
+	}
+	if len(e.Lines) < 2 {
+		return ErrEmptyEntry
+	}
+
+	sums := make(map[string]int64)
+	for _, line := range e.Lines {
+		if line.Amount == 0 {
+			return ErrZeroPosting
+		}
+		if _, err := money.Exponent(line.Currency); err != nil {
+			return err
+		}
+		sums[line.Currency] += line.Amount
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("%w: %s is off by %d minor units", ErrUnbalancedEntry, currency, sum)
+		}
+	}
+	return nil
+}
+
+// Post writes entry using tx, creating any accounts it refers to. Callers
+// pass their own transaction so that the entry is committed atomically with
+// the change it records.
+func Post(tx *gorm.DB, entry Entry) (*JournalEntry, error) {
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	journal := JournalEntry{Reference: entry.Reference, Description: entry.Description, CreatedAt: now}
+	for _, line := range entry.Lines {
+		account, err := findOrCreateAccount(tx, line.Account)
+		if err != nil {
+			return nil, err
+		}
+		journal.Postings = append(journal.Postings, Posting{
+			AccountID: account.ID,
+			Amount:    line.Amount,
+			Currency:  line.Currency,
+			CreatedAt: now,
+		})
+	}
+
+	if err := tx.Omit("Postings.Account").Create(&journal).Error; err != nil {
+		return nil, err
+	}
+	return &journal, nil
+}
+
+// findOrCreateAccount returns the account with the given code, creating it if needed.
+func findOrCreateAccount(tx *gorm.DB, code string) (*Account, error) {
+	account := Account{Code: code, Kind: kindOf(code)}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, err
+	}
+	if account.ID == 0 {
+		if err := tx.Where("code = ?", code).First(&account).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &account, nil
+}
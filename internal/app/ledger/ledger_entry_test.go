@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"errors"
+	"mamlaka/internal/pkg/money"
+	"testing"
+)
+
+func TestEntryValidate(t *testing.T) {
+	kes := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "KES"} }
+	usd := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "USD"} }
+
+	tests := []struct {
+		name    string
+		entry   Entry
+		wantErr error
+	}{
+		{
+			name:  "balanced",
+			entry: Entry{Reference: "payment:1", Lines: []Line{Debit("assets:gateway", kes(1000)), Credit("liabilities:merchant", kes(1000))}},
+		},
+		{
+			name: "balanced with fee",
+			entry: Entry{Reference: "payment:1", Lines: []Line{
+				Debit("assets:gateway", kes(1000)),
+				Credit("liabilities:merchant", kes(970)),
+				Credit("revenue:fees", kes(30)),
+			}},
+		},
+		{
+			name: "balanced in each currency",
+			entry: Entry{Reference: "fx:1", Lines: []Line{
+				Debit("assets:kes", kes(13000)), Credit("equity:fx", kes(13000)),
+				Debit("equity:fx", usd(100)), Credit("assets:usd", usd(100)),
+			}},
+		},
+		{
+			name:    "unbalanced",
+			entry:   Entry{Reference: "payment:1", Lines: []Line{Debit("assets:gateway", kes(1000)), Credit("liabilities:merchant", kes(999))}},
+			wantErr: ErrUnbalancedEntry,
+		},
+		{
+			name:    "balanced in total but not per currency",
+			entry:   Entry{Reference: "payment:1", Lines: []Line{Debit("assets:gateway", kes(1000)), Credit("liabilities:merchant", usd(1000))}},
+			wantErr: ErrUnbalancedEntry,
+		},
+		{
+			name:    "single line",
+			entry:   Entry{Reference: "payment:1", Lines: []Line{Debit("assets:gateway", kes(1000))}},
+			wantErr: ErrEmptyEntry,
+		},
+		{
+			name:    "zero line",
+			entry:   Entry{Reference: "payment:1", Lines: []Line{Debit("assets:gateway", kes(0)), Credit("liabilities:merchant", kes(0))}},
+			wantErr: ErrZeroPosting,
+		},
+		{
+			name:    "unsupported currency",
+			entry:   Entry{Reference: "payment:1", Lines: []Line{{"assets:gateway", 1000, "XXX"}, {"liabilities:merchant", -1000, "XXX"}}},
+			wantErr: money.ErrUnsupportedCurrency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.entry.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (Entry{Lines: []Line{Debit("a", kes(1)), Credit("b", kes(1))}}).Validate(); err == nil {
+		t.Error("Validate() of an entry without a reference = nil, want an error")
+	}
+}
+
+func TestEntryAddSkipsZeroLines(t *testing.T) {
+	var entry Entry
+	entry.Add(
+		Debit("assets:gateway", money.Money{Amount: 1000, Currency: "KES"}),
+		Credit("revenue:fees", money.Money{Amount: 0, Currency: "KES"}),
+		Credit("liabilities:merchant", money.Money{Amount: 1000, Currency: "KES"}),
+	)
+	if len(entry.Lines) != 2 {
+		t.Errorf("len(Lines) = %d, want 2", len(entry.Lines))
+	}
+}
@@ -0,0 +1,75 @@
+package ledger
+
+import (
+	"log/slog"
+	_ "mamlaka/internal/app/common"
+
+	"github.com/labstack/echo/v4"
+)
+
+type LedgerHandler interface {
+	Balances(c echo.Context) error
+	AccountBalance(c echo.Context) error
+	RecordPayout(c echo.Context) error
+}
+
+type ledgerHandler struct {
+	logger        *slog.Logger
+	ledgerService LedgerService
+}
+
+// Balances godoc
+// @Summary Ledger balances
+// @Description Balance of every ledger account per currency (debits less credits) as of a point in time. Requires the admin role.
+// @Tags Admin
+// @Produce  json
+// @Param   as_of query string false "RFC 3339 timestamp; defaults to now"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/ledger/balances [get]
+func (l ledgerHandler) Balances(c echo.Context) error {
+	return l.ledgerService.GetBalances(c)
+}
+
+// AccountBalance godoc
+// @Summary Ledger account balance
+// @Description Balance of one ledger account in one currency as of a point in time. Requires the admin role.
+// @Tags Admin
+// @Produce  json
+// @Param   code path string true "Account code, e.g. merchant or customer:12"
+// @Param   currency query string true "ISO 4217 currency code"
+// @Param   as_of query string false "RFC 3339 timestamp; defaults to now"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/ledger/accounts/{code}/balance [get]
+func (l ledgerHandler) AccountBalance(c echo.Context) error {
+	return l.ledgerService.GetAccountBalance(c)
+}
+
+// RecordPayout godoc
+// @Summary Record a payout
+// @Description Records a payout from a gateway to the merchant's bank account. Requires the admin role.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param   PayoutRequestDto body PayoutRequestDto true "Payout"
+// @Success 201 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/ledger/payouts [post]
+func (l ledgerHandler) RecordPayout(c echo.Context) error {
+	return l.ledgerService.RecordPayout(c)
+}
+
+func NewLedgerHandler(logger *slog.Logger, ledgerService LedgerService) LedgerHandler {
+	return ledgerHandler{
+		logger:        logger,
+		ledgerService: ledgerService,
+	}
+}
@@ -0,0 +1,32 @@
+package ledger
+
+import "gorm.io/gorm"
+
+// immutabilityTriggers make the database reject changes to journal entries
+// and postings, including those not made through GORM.
+var immutabilityTriggers = []string{
+	`CREATE OR REPLACE FUNCTION ledger_reject_change() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'ledger entries are immutable';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS journal_entries_immutable ON journal_entries`,
+	`CREATE TRIGGER journal_entries_immutable BEFORE UPDATE OR DELETE ON journal_entries
+		FOR EACH ROW EXECUTE FUNCTION ledger_reject_change()`,
+	`DROP TRIGGER IF EXISTS postings_immutable ON postings`,
+	`CREATE TRIGGER postings_immutable BEFORE UPDATE OR DELETE ON postings
+		FOR EACH ROW EXECUTE FUNCTION ledger_reject_change()`,
+}
+
+// Migrate installs the triggers that keep the ledger append-only. It must run
+// after the ledger tables have been migrated.
+func Migrate(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range immutabilityTriggers {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccountKind is the accounting class of an account.
+type AccountKind string
+
+const (
+	Asset     AccountKind = "asset"
+	Liability AccountKind = "liability"
+	Revenue   AccountKind = "revenue"
+	Expense   AccountKind = "expense"
+)
+
+// Codes of the accounts shared by all payments. Customer and gateway clearing
+// accounts are per user and per gateway; see CustomerAccount and
+// GatewayClearingAccount.
+const (
+	MerchantAccount = "merchant" // What is owed to the merchant
+	FeesAccount     = "fees"     // Processing fees earned
+	RefundsAccount  = "refunds"  // Money returned to customers
+	PayoutsAccount  = "payouts"  // Funds gateways have paid out to us
+)
+
+// CustomerAccount is the code of the account tracking a customer's funds.
+func CustomerAccount(userID uint) string {
+	return fmt.Sprintf("customer:%d", userID)
+}
+
+// GatewayClearingAccount is the code of the account holding funds collected
+// by a gateway that it has not paid out yet.
+func GatewayClearingAccount(gateway string) string {
+	return "gateway_clearing:" + gateway
+}
+
+// kindOf returns the kind of the account with the given code.
+func kindOf(code string) AccountKind {
+	prefix, _, _ := strings.Cut(code, ":")
+	switch prefix {
+	case "gateway_clearing", PayoutsAccount:
+		return Asset
+	case FeesAccount:
+		return Revenue
+	case RefundsAccount:
+		return Expense
+	default:
+		return Liability
+	}
+}
+
+// ErrImmutable is returned when a journal entry or posting would be changed.
+var ErrImmutable = errors.New("ledger entries are immutable")
+
+// Account is a ledger account. Accounts are created on first use.
+type Account struct {
+	gorm.Model
+	Code string      `gorm:"size:100;not null;uniqueIndex" json:"code"`
+	Kind AccountKind `gorm:"size:20;not null" json:"kind"`
+}
+
+// JournalEntry is an immutable record of one business event. Its postings
+// always sum to zero in every currency.
+type JournalEntry struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Reference   string    `gorm:"size:100;not null;uniqueIndex" json:"reference"` // Identifies the event, e.g. "payment:12:capture"
+	Description string    `json:"description"`
+	CreatedAt   time.Time `gorm:"not null;index" json:"created_at"`
+	Postings    []Posting `gorm:"foreignKey:JournalEntryID" json:"postings"`
+}
+
+// Posting debits (positive amount) or credits (negative amount) an account.
+type Posting struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	JournalEntryID uint      `gorm:"not null;index" json:"journal_entry_id"`
+	AccountID      uint      `gorm:"not null;index:idx_postings_account_currency_created,priority:1" json:"account_id"`
+	Account        Account   `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	Amount         int64     `gorm:"not null" json:"minor_units"`
+	Currency       string    `gorm:"size:3;not null;index:idx_postings_account_currency_created,priority:2" json:"currency"`
+	CreatedAt      time.Time `gorm:"not null;index:idx_postings_account_currency_created,priority:3" json:"created_at"` // Copied from the entry so balances can be read as of a time
+}
+
+func (JournalEntry) BeforeUpdate(*gorm.DB) error { return ErrImmutable }
+func (JournalEntry) BeforeDelete(*gorm.DB) error { return ErrImmutable }
+func (Posting) BeforeUpdate(*gorm.DB) error      { return ErrImmutable }
+func (Posting) BeforeDelete(*gorm.DB) error      { return ErrImmutable }
@@ -0,0 +1,101 @@
+package ledger
+
+import (
+	"errors"
+	"log/slog"
+	"mamlaka/internal/pkg/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type LedgerRepository interface {
+	Post(entry Entry) (*JournalEntry, error)
+	GetAccountByCode(code string) (*Account, error)
+	GetBalance(account *Account, currency string, asOf time.Time) (money.Money, error)
+	GetBalances(asOf time.Time) ([]Balance, error)
+}
+
+type ledgerRepository struct {
+	DB     *gorm.DB
+	logger *slog.Logger
+}
+
+// Post writes entry in its own transaction.
+func (l ledgerRepository) Post(entry Entry) (*JournalEntry, error) {
+	var journal *JournalEntry
+	err := l.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		journal, err = Post(tx, entry)
+		return err
+	})
+	if err != nil {
+		l.logger.Error("Error posting journal entry", "reference", entry.Reference, "error", err)
+		return nil, err
+	}
+	l.logger.Info("Journal entry posted", "reference", entry.Reference, "entryID", journal.ID)
+	return journal, nil
+}
+
+func (l ledgerRepository) GetAccountByCode(code string) (*Account, error) {
+	var account Account
+	if err := l.DB.Where("code = ?", code).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		l.logger.Error("Error fetching ledger account", "code", code, "error", err)
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetBalance returns the sum of an account's postings in currency made at or before asOf.
+func (l ledgerRepository) GetBalance(account *Account, currency string, asOf time.Time) (money.Money, error) {
+	var sum int64
+	if err := l.DB.Model(&Posting{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ? AND currency = ? AND created_at <= ?", account.ID, currency, asOf).
+		Scan(&sum).Error; err != nil {
+		l.logger.Error("Error fetching account balance", "code", account.Code, "error", err)
+		return money.Money{}, err
+	}
+	return money.Money{Amount: sum, Currency: currency}, nil
+}
+
+// GetBalances returns the balance of every account in every currency it has
+// postings in, as of asOf.
+func (l ledgerRepository) GetBalances(asOf time.Time) ([]Balance, error) {
+	var rows []struct {
+		Code     string
+		Kind     AccountKind
+		Currency string
+		Sum      int64
+	}
+	if err := l.DB.Model(&Posting{}).
+		Select("accounts.code, accounts.kind, postings.currency, SUM(postings.amount) AS sum").
+		Joins("JOIN accounts ON accounts.id = postings.account_id").
+		Where("postings.created_at <= ?", asOf).
+		Group("accounts.code, accounts.kind, postings.currency").
+		Order("accounts.code, postings.currency").
+		Scan(&rows).Error; err != nil {
+		l.logger.Error("Error fetching balances", "error", err)
+		return nil, err
+	}
+
+	balances := make([]Balance, 0, len(rows))
+	for _, row := range rows {
+		balances = append(balances, Balance{
+			Account: row.Code,
+			Kind:    row.Kind,
+			Balance: money.Money{Amount: row.Sum, Currency: row.Currency},
+		})
+	}
+	return balances, nil
+}
+
+func NewLedgerRepository(db *gorm.DB, logger *slog.Logger) LedgerRepository {
+	return ledgerRepository{
+		DB:     db,
+		logger: logger,
+	}
+}
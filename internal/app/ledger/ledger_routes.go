@@ -0,0 +1,24 @@
+package ledger
+
+import (
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"log/slog"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/app/user"
+)
+
+func RegisterLedgerRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB) {
+	ledgerRepository := NewLedgerRepository(db, logger)
+	ledgerService := NewLedgerService(logger, ledgerRepository)
+	ledgerHandler := NewLedgerHandler(logger, ledgerService)
+
+	ledger := e.Group("/admin/ledger")
+	{
+		ledger.Use(middlewares.JWTMiddleware)
+
+		ledger.GET("/balances", ledgerHandler.Balances, middlewares.RequirePermission(user.PermLedgerRead))
+		ledger.GET("/accounts/:code/balance", ledgerHandler.AccountBalance, middlewares.RequirePermission(user.PermLedgerRead))
+		ledger.POST("/payouts", ledgerHandler.RecordPayout, middlewares.RequirePermission(user.PermLedgerWrite))
+	}
+}
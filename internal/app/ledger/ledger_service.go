@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LedgerService exposes ledger balances and payouts to finance.
+type LedgerService interface {
+	GetBalances(c echo.Context) error
+	GetAccountBalance(c echo.Context) error
+	RecordPayout(c echo.Context) error
+}
+
+type ledgerService struct {
+	logger     *slog.Logger
+	repository LedgerRepository
+}
+
+// GetBalances returns the balance of every account as of the requested time.
+func (l ledgerService) GetBalances(c echo.Context) error {
+	asOf, err := l.asOf(c)
+	if err != nil {
+		return l.handleError(c, err, http.StatusBadRequest)
+	}
+
+	balances, err := l.repository.GetBalances(asOf)
+	if err != nil {
+		return l.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Balances as of " + asOf.Format(time.RFC3339),
+		Data:    balances,
+	})
+}
+
+// GetAccountBalance returns one account's balance in one currency as of the requested time.
+func (l ledgerService) GetAccountBalance(c echo.Context) error {
+	asOf, err := l.asOf(c)
+	if err != nil {
+		return l.handleError(c, err, http.StatusBadRequest)
+	}
+	currency := strings.ToUpper(c.QueryParam("currency"))
+	if _, err := money.Exponent(currency); err != nil {
+		return l.handleError(c, fmt.Errorf("currency: %w", err), http.StatusBadRequest)
+	}
+
+	account, err := l.repository.GetAccountByCode(c.Param("code"))
+	if err != nil {
+		return l.handleError(c, err, http.StatusInternalServerError)
+	}
+	if account == nil {
+		return l.handleError(c, errors.New("account not found"), http.StatusNotFound)
+	}
+
+	balance, err := l.repository.GetBalance(account, currency, asOf)
+	if err != nil {
+		return l.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Balance as of " + asOf.Format(time.RFC3339),
+		Data:    Balance{Account: account.Code, Kind: account.Kind, Balance: balance},
+	})
+}
+
+// RecordPayout records money paid out by a gateway to the merchant's bank
+// account, moving it from the gateway's clearing account to the merchant.
+func (l ledgerService) RecordPayout(c echo.Context) error {
+	var request PayoutRequestDto
+	if err := c.Bind(&request); err != nil {
+		return l.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return c.JSON(http.StatusBadRequest, common.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Error:  "request validation failed",
+			Fields: common.FieldErrors(err),
+		})
+	}
+
+	amount, err := money.Parse(request.Amount, request.Currency)
+	if err != nil {
+		return l.handleError(c, fmt.Errorf("amount: %w", err), http.StatusBadRequest)
+	}
+
+	entry := Entry{
+		Reference:   "payout:" + request.Reference,
+		Description: fmt.Sprintf("payout of %s from %s", amount, request.Gateway),
+	}
+	entry.Add(
+		Debit(MerchantAccount, amount),
+		Credit(GatewayClearingAccount(request.Gateway), amount),
+	)
+
+	journal, err := l.repository.Post(entry)
+	if err != nil {
+		return l.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusCreated, common.BaseResponse{
+		Status:  http.StatusCreated,
+		Message: "Payout recorded",
+		Data:    journal,
+	})
+}
+
+// asOf reads the optional as_of query parameter, defaulting to now.
+func (l ledgerService) asOf(c echo.Context) (time.Time, error) {
+	value := c.QueryParam("as_of")
+	if value == "" {
+		return time.Now(), nil
+	}
+	asOf, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("as_of must be an RFC 3339 timestamp")
+	}
+	return asOf, nil
+}
+
+// handleError is a helper function for creating error responses.
+func (l ledgerService) handleError(c echo.Context, err error, status int) error {
+	return c.JSON(status, common.ErrorResponse{
+		Status: status,
+		Error:  err.Error(),
+	})
+}
+
+// NewLedgerService creates a new instance of ledgerService.
+func NewLedgerService(logger *slog.Logger, repository LedgerRepository) LedgerService {
+	return ledgerService{
+		logger:     logger,
+		repository: repository,
+	}
+}
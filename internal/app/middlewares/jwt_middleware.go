@@ -1,12 +1,17 @@
 package middlewares
 
 import (
+	"errors"
 	"github.com/labstack/echo/v4"
 	"mamlaka/internal/pkg/tokens"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
+// claimsContextKey is the echo context key under which JWTMiddleware stores the token claims.
+const claimsContextKey = "claims"
+
 // JWTMiddleware is a middleware for validating JWT access tokens.
 func JWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -20,11 +25,60 @@ func JWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid Authorization Header Format")
 		}
 
-		_, err := tokens.ValidateToken(tokenString, false) // false indicates it's an access token
-		if err != nil {
-			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or Expired Token")
+		return authenticate(c, next, tokenString)
+	}
+}
+
+// WebSocketSubprotocolPrefix prefixes the access token when it is offered as
+// a WebSocket subprotocol, e.g. "bearer.<token>".
+const WebSocketSubprotocolPrefix = "bearer."
+
+// WebSocketJWTMiddleware validates the access token of a WebSocket handshake.
+// Browsers cannot set the Authorization header on a WebSocket, so the token
+// may instead be offered as a "bearer.<token>" subprotocol. Tokens are not
+// accepted in the URL, where they would end up in access logs.
+func WebSocketJWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if strings.HasPrefix(c.Request().Header.Get("Authorization"), "Bearer ") {
+			return JWTMiddleware(next)(c)
 		}
 
-		return next(c)
+		for _, protocol := range strings.Split(c.Request().Header.Get("Sec-WebSocket-Protocol"), ",") {
+			if tokenString, ok := strings.CutPrefix(strings.TrimSpace(protocol), WebSocketSubprotocolPrefix); ok {
+				return authenticate(c, next, tokenString)
+			}
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "Missing Authorization Header")
+	}
+}
+
+// authenticate stores the claims of a valid access token and calls next.
+func authenticate(c echo.Context, next echo.HandlerFunc, tokenString string) error {
+	claims, err := tokens.ValidateToken(tokenString)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or Expired Token")
+	}
+
+	c.Set(claimsContextKey, claims)
+	return next(c)
+}
+
+// GetClaims returns the access token claims stored by JWTMiddleware, or nil
+// if the request did not pass through it.
+func GetClaims(c echo.Context) *tokens.Claims {
+	claims, _ := c.Get(claimsContextKey).(*tokens.Claims)
+	return claims
+}
+
+// CurrentUserID returns the ID of the authenticated user making the request.
+func CurrentUserID(c echo.Context) (uint, error) {
+	claims := GetClaims(c)
+	if claims == nil {
+		return 0, errors.New("request is not authenticated")
+	}
+	id, err := strconv.ParseUint(claims.UserID, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid user id in token")
 	}
+	return uint(id), nil
 }
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// RequirePermission only lets requests through whose access token carries
+// the given permission, e.g. "payments:refund". It must run after
+// JWTMiddleware.
+func RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims := GetClaims(c)
+			if claims == nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Missing Authorization Header")
+			}
+			if !claims.HasPermission(permission) {
+				return echo.NewHTTPError(http.StatusForbidden, "Insufficient Permissions")
+			}
+			return next(c)
+		}
+	}
+}
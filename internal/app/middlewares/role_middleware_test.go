@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"errors"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *tokens.Claims
+		want   int // 0 when the handler runs
+	}{
+		{"no claims", nil, http.StatusUnauthorized},
+		{"no permissions", &tokens.Claims{UserID: "7", Role: "customer"}, http.StatusForbidden},
+		{"other permission", &tokens.Claims{UserID: "7", Role: "support", Permissions: []string{"payments:read_all"}}, http.StatusForbidden},
+		{"permission", &tokens.Claims{UserID: "7", Role: "finance", Permissions: []string{"payments:read_all", "payments:refund"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+			if tt.claims != nil {
+				c.Set("claims", tt.claims)
+			}
+			ran := false
+			handler := RequirePermission("payments:refund")(func(c echo.Context) error {
+				ran = true
+				return nil
+			})
+
+			err := handler(c)
+			var httpErr *echo.HTTPError
+			switch {
+			case tt.want == 0 && (err != nil || !ran):
+				t.Errorf("handler ran = %v, error = %v, want it to run", ran, err)
+			case tt.want != 0 && (!errors.As(err, &httpErr) || httpErr.Code != tt.want || ran):
+				t.Errorf("handler ran = %v, error = %v, want status %d", ran, err, tt.want)
+			}
+		})
+	}
+}
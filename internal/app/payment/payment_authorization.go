@@ -0,0 +1,169 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const expiryBatchSize = 100
+
+// sweeperActor is recorded in the status history for authorizations voided on expiry.
+const sweeperActor = "system:authorization-sweeper"
+
+// CapturePayment captures a payment that was authorized with manual capture.
+// Capturing less than the authorized amount releases the remainder.
+func (p paymentService) CapturePayment(c echo.Context) error {
+	payment, err := p.paymentFromPath(c)
+	if err != nil || payment == nil {
+		return err
+	}
+
+	var request CaptureRequestDto
+	if err := c.Bind(&request); err != nil {
+		p.logger.Error("Error parsing capture request body", "error", err)
+		return p.handleError(c, err, http.StatusBadRequest)
+	}
+
+	if payment.Status != StatusAuthorized {
+		return p.handleError(c, &InvalidTransitionError{PaymentID: payment.ID, From: payment.Status, To: StatusCaptured}, http.StatusConflict)
+	}
+	if payment.HeldForReview {
+		return p.handleError(c, errors.New("payment is held for risk review"), http.StatusConflict)
+	}
+	if expiresAt := payment.AuthorizationExpiresAt; expiresAt != nil && expiresAt.Before(time.Now()) {
+		return p.handleError(c, fmt.Errorf("authorization of payment %d expired at %s", payment.ID, expiresAt.Format(time.RFC3339)), http.StatusConflict)
+	}
+
+	amount := payment.Amount
+	if request.Amount != "" {
+		if amount, err = money.Parse(request.Amount, payment.Amount.Currency); err != nil {
+			return p.handleValidationError(c, []common.FieldError{{Field: "amount", Message: err.Error()}})
+		}
+		if amount.Amount > payment.Amount.Amount {
+			return p.handleValidationError(c, []common.FieldError{{Field: "amount", Message: "must not exceed the authorized amount of " + payment.Amount.String()}})
+		}
+	}
+
+	gw, err := p.gateways.ForPayment(payment)
+	if err != nil {
+		return p.handleError(c, err, http.StatusUnprocessableEntity)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), p.config.Payment.GatewayTimeout)
+	defer cancel()
+
+	if err := p.capturePayment(ctx, gw, payment, amount, actorFromContext(c)); err != nil {
+		var declined *DeclinedError
+		if errors.As(err, &declined) {
+			return p.handleError(c, err, http.StatusPaymentRequired)
+		}
+		return p.handleError(c, err, http.StatusBadGateway)
+	}
+
+	if payment.Status != StatusCaptured {
+		return c.JSON(http.StatusAccepted, common.BaseResponse{
+			Status:  http.StatusAccepted,
+			Message: "Capture is awaiting confirmation",
+			Data:    payment,
+		})
+	}
+
+	p.logger.Info("Payment captured", "paymentID", payment.ID, "amount", amount)
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Payment captured successfully",
+		Data:    payment,
+	})
+}
+
+// VoidPayment releases the hold on an authorized payment without capturing it.
+func (p paymentService) VoidPayment(c echo.Context) error {
+	payment, err := p.paymentFromPath(c)
+	if err != nil || payment == nil {
+		return err
+	}
+
+	if payment.Status != StatusAuthorized {
+		return p.handleError(c, &InvalidTransitionError{PaymentID: payment.ID, From: payment.Status, To: StatusCancelled}, http.StatusConflict)
+	}
+
+	if err := p.voidAuthorization(c.Request().Context(), payment, "authorization voided", actorFromContext(c)); err != nil {
+		var declined *DeclinedError
+		switch {
+		case errors.As(err, &declined):
+			return p.handleError(c, err, http.StatusPaymentRequired)
+		case errors.Is(err, gateway.ErrUnsupported):
+			return p.handleError(c, fmt.Errorf("%s payments cannot be voided", payment.PaymentMethod), http.StatusUnprocessableEntity)
+		}
+		return p.handleError(c, err, http.StatusBadGateway)
+	}
+
+	p.logger.Info("Payment voided", "paymentID", payment.ID)
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Payment voided successfully",
+		Data:    payment,
+	})
+}
+
+// voidAuthorization asks the payment's gateway to release its authorization
+// and cancels the payment once the gateway agrees.
+func (p paymentService) voidAuthorization(ctx context.Context, payment *Payment, reason, actor string) error {
+	gw, err := p.gateways.ForPayment(payment)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Payment.GatewayTimeout)
+	defer cancel()
+
+	result, err := gw.Void(ctx, payment.GatewayReference)
+	if err != nil {
+		p.logger.Error("Error voiding payment", "paymentID", payment.ID, "gateway", gw.Name(), "error", err)
+		return err
+	}
+	if result.Outcome != gateway.Approved {
+		return &DeclinedError{Code: result.Code, Message: result.Message}
+	}
+	return p.transition(payment, StatusCancelled, reason, actor)
+}
+
+// ExpireAuthorizations voids authorized payments that were not captured
+// before their authorization expired. Gateways that cannot void let the hold
+// lapse on their side, so those payments are only cancelled locally.
+func (p paymentService) ExpireAuthorizations(ctx context.Context) error {
+	payments, err := p.repository.GetExpiredAuthorizations(time.Now(), expiryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range payments {
+		payment := &payments[i]
+		err := p.voidAuthorization(ctx, payment, "authorization expired", sweeperActor)
+		if errors.Is(err, gateway.ErrUnsupported) {
+			err = p.transition(payment, StatusCancelled, "authorization expired", sweeperActor)
+		}
+		if err != nil {
+			p.logger.Error("Error expiring authorization", "paymentID", payment.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// RunAuthorizationSweeper expires uncaptured authorizations every interval until ctx is cancelled.
+func RunAuthorizationSweeper(ctx context.Context, logger *slog.Logger, service PaymentService, interval time.Duration) {
+	runEvery(ctx, interval, func() {
+		if err := service.ExpireAuthorizations(ctx); err != nil {
+			logger.Error("Error expiring authorizations", "error", err)
+		}
+	})
+}
@@ -1,22 +1,63 @@
 package payment
 
+import "mamlaka/internal/pkg/money"
+
 type PaymentRequestDto struct {
-	Amount         string            `json:"amount"`
-	Currency       string            `json:"currency"`
-	PaymentMethod  string            `json:"payment_method"` // Ensure this is a string for conversion
+	Amount         string            `json:"amount" validate:"required"` // Decimal string in major units, e.g. "1000.50"
+	Currency       string            `json:"currency" validate:"required,len=3"`
+	PaymentMethod  string            `json:"payment_method" validate:"required,oneof=credit_card e_wallet mpesa"` // Ensure this is a string for conversion
+	Purpose        string            `json:"purpose" validate:"omitempty,oneof=purchase wallet_top_up"`           // Defaults to "purchase"
+	Reference      string            `json:"reference" validate:"max=100"`                                        // Caller's own reference, e.g. an order number
+	CaptureMethod  string            `json:"capture_method" validate:"omitempty,oneof=automatic manual"`          // "manual" only authorizes; defaults to "automatic"
 	PaymentDetails PaymentDetailsDto `json:"payment_details"`
 }
 
+// Money parses the requested amount into minor units of the requested currency.
+func (r PaymentRequestDto) Money() (money.Money, error) {
+	return money.Parse(r.Amount, r.Currency)
+}
+
 type PaymentDetailsDto struct {
-	CardNumber  string `json:"card_number"`
-	ExpiryDate  string `json:"expiry_date"`
+	CardNumber  string `json:"card_number"` // Required for credit_card payments, checked by cards.Validate
+	ExpiryDate  string `json:"expiry_date"` // MM/YY
 	CVV         string `json:"cvv"`
 	PhoneNumber string `json:"phone_number"`
-	Email       string `json:"email"`
+	Email       string `json:"email" validate:"omitempty,email"`
+	Country     string `json:"country" validate:"omitempty,len=2"` // Billing country, ISO 3166-1 alpha-2; used for risk screening
 }
 
 type PaymentResponseDto struct {
+	PaymentID     uint   `json:"payment_id"`
 	TransactionID string `json:"transaction_id"`
 	Status        string `json:"status"`
 	Message       string `json:"message"`
 }
+
+// TransactionListRequestDto holds the query parameters of a transaction listing.
+type TransactionListRequestDto struct {
+	Status        string `query:"status" json:"status" validate:"omitempty,oneof=pending authorized captured settled failed cancelled refunded partially_refunded"`
+	PaymentMethod string `query:"payment_method" json:"payment_method" validate:"omitempty,oneof=credit_card e_wallet mpesa"`
+	Currency      string `query:"currency" json:"currency" validate:"omitempty,len=3"`
+	MinAmount     string `query:"min_amount" json:"min_amount"`     // Decimal string in major units; requires currency
+	MaxAmount     string `query:"max_amount" json:"max_amount"`     // Decimal string in major units; requires currency
+	CreatedFrom   string `query:"created_from" json:"created_from"` // RFC 3339, inclusive
+	CreatedTo     string `query:"created_to" json:"created_to"`     // RFC 3339, exclusive
+	Query         string `query:"q" json:"q" validate:"max=100"`
+	Sort          string `query:"sort" json:"sort" validate:"omitempty,oneof=created_at -created_at amount -amount"`
+	Cursor        string `query:"cursor" json:"cursor"`
+	Limit         int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type ReviewRequestDto struct {
+	Decision string `json:"decision" validate:"required,oneof=approve reject"`
+	Note     string `json:"note" validate:"max=255"`
+}
+
+type CaptureRequestDto struct {
+	Amount string `json:"amount"` // Decimal string in the payment currency; defaults to the authorized amount
+}
+
+type RefundRequestDto struct {
+	Amount string `json:"amount"` // Decimal string in the payment currency; defaults to everything left to refund
+	Reason string `json:"reason" validate:"max=255"`
+}
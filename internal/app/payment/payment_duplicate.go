@@ -0,0 +1,82 @@
+package payment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mamlaka/config"
+	"strings"
+	"time"
+)
+
+// Fields a config.DuplicateRule can compare payments on.
+const (
+	DuplicateFieldAmount      = "amount" // Amount and currency
+	DuplicateFieldReference   = "reference"
+	DuplicateFieldPurpose     = "purpose"
+	DuplicateFieldCard        = "card" // Card fingerprint, so the same card matches whatever its token
+	DuplicateFieldPhoneNumber = "phone_number"
+	DuplicateFieldEmail       = "email"
+)
+
+// DuplicatePaymentError is returned when a payment repeats one the user made
+// within the duplicate window of its payment method. It deliberately names
+// only the earlier payment, never the card or phone number they share.
+type DuplicatePaymentError struct {
+	PaymentID uint // The earlier payment
+	Window    time.Duration
+}
+
+func (e *DuplicatePaymentError) Error() string {
+	return fmt.Sprintf("an identical payment (%d) was made within the last %s", e.PaymentID, e.Window)
+}
+
+// ValidateDuplicateRules reports the first rule comparing payments on a field
+// that does not exist.
+func ValidateDuplicateRules(rules map[string]config.DuplicateRule) error {
+	for method, rule := range rules {
+		for _, field := range rule.Fields {
+			if _, ok := duplicateField(&Payment{}, field); !ok {
+				return fmt.Errorf("duplicate payment rule for %s: unknown field %q", method, field)
+			}
+		}
+	}
+	return nil
+}
+
+// duplicateKey returns the key shared by payment and every payment rule
+// considers a duplicate of it: a hash of the user, payment method and the
+// rule's fields, so card fingerprints and phone numbers are not stored again
+// in the clear. It returns "" when rule disables the check.
+func duplicateKey(payment *Payment, rule config.DuplicateRule) string {
+	if rule.Window <= 0 {
+		return ""
+	}
+	parts := []string{fmt.Sprint(payment.UserID), string(payment.PaymentMethod)}
+	for _, field := range rule.Fields {
+		value, _ := duplicateField(payment, field)
+		parts = append(parts, field+"="+value)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// duplicateField returns the value of payment compared by field, and false
+// if there is no such field.
+func duplicateField(payment *Payment, field string) (string, bool) {
+	switch field {
+	case DuplicateFieldAmount:
+		return fmt.Sprintf("%d %s", payment.Amount.Amount, payment.Amount.Currency), true
+	case DuplicateFieldReference:
+		return payment.Reference, true
+	case DuplicateFieldPurpose:
+		return string(payment.Purpose), true
+	case DuplicateFieldCard:
+		return payment.PaymentDetails.CardFingerprint, true
+	case DuplicateFieldPhoneNumber:
+		return payment.PaymentDetails.PhoneNumber, true
+	case DuplicateFieldEmail:
+		return strings.ToLower(payment.PaymentDetails.Email), true
+	}
+	return "", false
+}
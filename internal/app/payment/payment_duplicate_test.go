@@ -0,0 +1,98 @@
+package payment
+
+import (
+	"encoding/json"
+	"mamlaka/config"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func cardPayment() *Payment {
+	return &Payment{
+		UserID:        7,
+		Amount:        money.Money{Amount: 10000, Currency: "KES"},
+		PaymentMethod: CreditCard,
+		Purpose:       PurposePurchase,
+		Reference:     "ORDER-1",
+		PaymentDetails: PaymentDetails{
+			CardFingerprint: "fp-1",
+			Email:           "jane@example.com",
+		},
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	rule := config.DuplicateRule{Window: time.Minute, Fields: []string{DuplicateFieldAmount, DuplicateFieldCard, DuplicateFieldEmail}}
+	key := duplicateKey(cardPayment(), rule)
+
+	tests := []struct {
+		name   string
+		change func(p *Payment)
+		same   bool
+	}{
+		{"identical", func(p *Payment) {}, true},
+		{"field the rule ignores", func(p *Payment) { p.Reference = "ORDER-2" }, true},
+		{"email in other case", func(p *Payment) { p.PaymentDetails.Email = "Jane@Example.com" }, true},
+		{"other amount", func(p *Payment) { p.Amount.Amount = 10001 }, false},
+		{"other currency", func(p *Payment) { p.Amount.Currency = "USD" }, false},
+		{"other card", func(p *Payment) { p.PaymentDetails.CardFingerprint = "fp-2" }, false},
+		{"other user", func(p *Payment) { p.UserID = 8 }, false},
+		{"other method", func(p *Payment) { p.PaymentMethod = Mpesa }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := cardPayment()
+			tt.change(payment)
+			if got := duplicateKey(payment, rule) == key; got != tt.same {
+				t.Errorf("duplicateKey() matches = %v, want %v", got, tt.same)
+			}
+		})
+	}
+
+	if strings.Contains(key, "fp-1") || strings.Contains(key, "jane") {
+		t.Errorf("duplicateKey() = %q, want the compared values hashed", key)
+	}
+	if got := duplicateKey(cardPayment(), config.DuplicateRule{Fields: rule.Fields}); got != "" {
+		t.Errorf("duplicateKey() without a window = %q, want none", got)
+	}
+}
+
+func TestValidateDuplicateRules(t *testing.T) {
+	valid := map[string]config.DuplicateRule{
+		string(CreditCard): {Window: time.Minute, Fields: []string{DuplicateFieldAmount, DuplicateFieldCard}},
+		string(Mpesa):      {Window: time.Minute, Fields: []string{DuplicateFieldAmount, DuplicateFieldPhoneNumber}},
+	}
+	if err := ValidateDuplicateRules(valid); err != nil {
+		t.Errorf("ValidateDuplicateRules() error = %v", err)
+	}
+
+	invalid := map[string]config.DuplicateRule{string(CreditCard): {Window: time.Minute, Fields: []string{"amount", "pan"}}}
+	if err := ValidateDuplicateRules(invalid); err == nil || !strings.Contains(err.Error(), `"pan"`) {
+		t.Errorf("ValidateDuplicateRules() error = %v, want the unknown field named", err)
+	}
+}
+
+func TestDuplicatePaymentResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+
+	_ = paymentService{}.handleError(c, &DuplicatePaymentError{PaymentID: 12, Window: time.Minute}, http.StatusInternalServerError)
+
+	var response common.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusConflict || response.Code != common.CodeDuplicatePayment {
+		t.Errorf("response = %d %q, want %d %q", rec.Code, response.Code, http.StatusConflict, common.CodeDuplicatePayment)
+	}
+	if !strings.Contains(response.Error, "(12)") {
+		t.Errorf("error = %q, want it to name the earlier payment", response.Error)
+	}
+}
@@ -0,0 +1,131 @@
+package payment
+
+import (
+	"fmt"
+	"mamlaka/internal/app/webhook"
+	"mamlaka/internal/pkg/money"
+	"mamlaka/internal/pkg/outbox"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentEventData is the data of payment.* webhook events and of payment
+// stream messages: the payment as it is once the change the event reports
+// has been made.
+type PaymentEventData struct {
+	ID               uint           `json:"id"`
+	Reference        string         `json:"reference,omitempty"`
+	Status           PaymentStatus  `json:"status"`
+	Reason           string         `json:"reason,omitempty"` // Why the status changed, e.g. the decline message
+	Amount           money.Money    `json:"amount"`
+	Captured         money.Money    `json:"captured"`
+	Refunded         money.Money    `json:"refunded"`
+	PaymentMethod    PaymentMethod  `json:"payment_method"`
+	Purpose          PaymentPurpose `json:"purpose"`
+	CaptureMethod    CaptureMethod  `json:"capture_method"`
+	Gateway          string         `json:"gateway,omitempty"`
+	GatewayReference string         `json:"gateway_reference,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+}
+
+// newPaymentEventData describes payment as it is after moving to status to
+// with the given captured and refunded totals.
+func newPaymentEventData(payment *Payment, to PaymentStatus, reason string, captured, refunded int64) PaymentEventData {
+	return PaymentEventData{
+		ID:               payment.ID,
+		Reference:        payment.Reference,
+		Status:           to,
+		Reason:           reason,
+		Amount:           payment.Amount,
+		Captured:         money.Money{Amount: captured, Currency: payment.Amount.Currency},
+		Refunded:         money.Money{Amount: refunded, Currency: payment.Amount.Currency},
+		PaymentMethod:    payment.PaymentMethod,
+		Purpose:          payment.Purpose,
+		CaptureMethod:    payment.CaptureMethod,
+		Gateway:          payment.Gateway,
+		GatewayReference: payment.GatewayReference,
+		CreatedAt:        payment.CreatedAt,
+	}
+}
+
+// Domain event types recorded in the outbox.
+const (
+	EventPaymentCreated           = "PaymentCreated"
+	EventPaymentAuthorized        = "PaymentAuthorized"
+	EventPaymentCaptured          = "PaymentCaptured"
+	EventPaymentSettled           = "PaymentSettled"
+	EventPaymentFailed            = "PaymentFailed"
+	EventPaymentCancelled         = "PaymentCancelled"
+	EventPaymentRefunded          = "PaymentRefunded"
+	EventPaymentPartiallyRefunded = "PaymentPartiallyRefunded"
+	EventRefundRequested          = "RefundRequested"
+	EventRefundIssued             = "RefundIssued"
+	EventRefundFailed             = "RefundFailed"
+)
+
+// paymentEventTypes maps a payment status to the domain and webhook event
+// types reporting a move to it.
+var paymentEventTypes = map[PaymentStatus][2]string{
+	StatusPending:           {EventPaymentCreated, webhook.EventPaymentCreated},
+	StatusAuthorized:        {EventPaymentAuthorized, webhook.EventPaymentAuthorized},
+	StatusCaptured:          {EventPaymentCaptured, webhook.EventPaymentCaptured},
+	StatusSettled:           {EventPaymentSettled, webhook.EventPaymentSettled},
+	StatusFailed:            {EventPaymentFailed, webhook.EventPaymentFailed},
+	StatusCancelled:         {EventPaymentCancelled, webhook.EventPaymentCancelled},
+	StatusRefunded:          {EventPaymentRefunded, webhook.EventPaymentRefunded},
+	StatusPartiallyRefunded: {EventPaymentPartiallyRefunded, webhook.EventPaymentPartiallyRefunded},
+}
+
+// refundEventTypes maps a refund status to the domain and webhook event
+// types reporting a move to it.
+var refundEventTypes = map[RefundStatus][2]string{
+	RefundPending:   {EventRefundRequested, webhook.EventRefundCreated},
+	RefundSucceeded: {EventRefundIssued, webhook.EventRefundSucceeded},
+	RefundFailed:    {EventRefundFailed, webhook.EventRefundFailed},
+}
+
+// paymentEvent returns the effect recording the domain event and emitting
+// the webhook event for payment moving to status to with the given captured
+// and refunded totals. The domain event is identified by the payment
+// version the move creates.
+func paymentEvent(payment *Payment, to PaymentStatus, reason string, captured, refunded int64) func(tx *gorm.DB) error {
+	data := newPaymentEventData(payment, to, reason, captured, refunded)
+	types := paymentEventTypes[to]
+	eventID := fmt.Sprintf("payment-%d-v%d", payment.ID, payment.Version+1)
+	if to == StatusPending {
+		eventID = fmt.Sprintf("payment-%d-created", payment.ID)
+	}
+	return func(tx *gorm.DB) error {
+		if err := outbox.Record(tx, outbox.Event{
+			ID:            eventID,
+			Type:          types[0],
+			AggregateType: "payment",
+			AggregateID:   payment.ID,
+			Payload:       data,
+		}); err != nil {
+			return err
+		}
+		return webhook.Enqueue(tx, payment.UserID, types[1], data)
+	}
+}
+
+// refundEvent returns the effect recording the domain event and emitting the
+// webhook event for refund reaching its status, to the owner of the refunded
+// payment. The refund is copied so the events report it as it is when the
+// effect is created.
+func refundEvent(userID uint, refund Refund) func(tx *gorm.DB) error {
+	types := refundEventTypes[refund.Status]
+	return func(tx *gorm.DB) error {
+		if err := outbox.Record(tx, outbox.Event{
+			ID:            fmt.Sprintf("refund-%d-%s", refund.ID, refund.Status),
+			Type:          types[0],
+			AggregateType: "refund",
+			AggregateID:   refund.ID,
+			Payload:       refund,
+		}); err != nil {
+			return err
+		}
+		return webhook.Enqueue(tx, userID, types[1], refund)
+	}
+}
@@ -0,0 +1,94 @@
+package payment
+
+import (
+	"fmt"
+	"mamlaka/config"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/gateway/mpesa"
+	"net/url"
+
+	"gorm.io/gorm"
+)
+
+// GatewayRegistry routes each payment method to the gateway that processes it.
+type GatewayRegistry struct {
+	gateways map[PaymentMethod]gateway.Gateway
+}
+
+// NewGatewayRegistry creates an empty registry.
+func NewGatewayRegistry() *GatewayRegistry {
+	return &GatewayRegistry{gateways: make(map[PaymentMethod]gateway.Gateway)}
+}
+
+// Register sets the gateway used for a payment method, replacing any previous one.
+func (r *GatewayRegistry) Register(method PaymentMethod, gw gateway.Gateway) {
+	r.gateways[method] = gw
+}
+
+// Get returns the gateway registered for a payment method.
+func (r *GatewayRegistry) Get(method PaymentMethod) (gateway.Gateway, error) {
+	gw, ok := r.gateways[method]
+	if !ok {
+		return nil, fmt.Errorf("no gateway configured for payment method %s", method)
+	}
+	return gw, nil
+}
+
+// ForPayment returns the gateway that processed an existing payment, failing if
+// the payment's method is now routed to a different gateway.
+func (r *GatewayRegistry) ForPayment(payment *Payment) (gateway.Gateway, error) {
+	gw, err := r.Get(payment.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	if gw.Name() != payment.Gateway {
+		return nil, fmt.Errorf("payment was processed by gateway %s which is no longer configured", payment.Gateway)
+	}
+	return gw, nil
+}
+
+// NewSandboxGatewayRegistry routes card and M-Pesa payments to a sandbox
+// keeping its transactions in store. Wallet payments never reach a gateway.
+func NewSandboxGatewayRegistry(store gateway.SandboxStore) *GatewayRegistry {
+	sandbox := gateway.NewSandboxWithStore("sandbox", store)
+	registry := NewGatewayRegistry()
+	registry.Register(CreditCard, sandbox)
+	registry.Register(Mpesa, sandbox)
+	return registry
+}
+
+// NewGatewayRegistryFromConfig routes payments to the real provider of each
+// method whose credentials are configured. The other methods go to the
+// sandbox if it is enabled, as it is by default in development; otherwise
+// an error is returned, so the API never approves payments no money moved
+// for. The sandbox keeps its transactions in db, so payments authorized by a
+// worker can be captured, voided and refunded through the API.
+func NewGatewayRegistryFromConfig(conf config.Config, db *gorm.DB) (*GatewayRegistry, error) {
+	registry := NewGatewayRegistry()
+	if conf.Payment.SandboxGateway {
+		registry = NewSandboxGatewayRegistry(gateway.NewPostgresSandboxStore(db))
+	}
+
+	if conf.Mpesa.ConsumerKey != "" {
+		callbackURL := conf.Mpesa.CallbackURL
+		if conf.Mpesa.CallbackToken != "" {
+			callbackURL += "?token=" + url.QueryEscape(conf.Mpesa.CallbackToken)
+		}
+		client := mpesa.NewClient(mpesa.Config{
+			BaseURL:        conf.Mpesa.BaseURL,
+			ConsumerKey:    conf.Mpesa.ConsumerKey,
+			ConsumerSecret: conf.Mpesa.ConsumerSecret,
+			ShortCode:      conf.Mpesa.ShortCode,
+			PassKey:        conf.Mpesa.PassKey,
+			CallbackURL:    callbackURL,
+		}, nil)
+		registry.Register(Mpesa, mpesa.NewGateway(client))
+	}
+
+	for _, method := range []PaymentMethod{CreditCard, Mpesa} {
+		if _, err := registry.Get(method); err != nil {
+			return nil, fmt.Errorf("%w; set PAYMENT_SANDBOX_GATEWAY=true to use the sandbox gateway outside development", err)
+		}
+	}
+	return registry, nil
+}
@@ -11,6 +11,14 @@ type PaymentHandler interface {
 	MakePayment(c echo.Context) error
 	GetPaymentDetail(c echo.Context) error
 	Transactions(c echo.Context) error
+	AllTransactions(c echo.Context) error
+	MpesaCallback(c echo.Context) error
+	CreateRefund(c echo.Context) error
+	ListRefunds(c echo.Context) error
+	CapturePayment(c echo.Context) error
+	VoidPayment(c echo.Context) error
+	StreamPayments(c echo.Context) error
+	ReviewPayment(c echo.Context) error
 }
 
 type paymentHandler struct {
@@ -20,14 +28,17 @@ type paymentHandler struct {
 
 // MakePayment godoc
 // @Summary make a payment
-// @Description  makes a single payment transaction
+// @Description  Accepts a single payment transaction as pending and queues it for processing by the worker. Follow its outcome with GET /payments/{id}, the payment stream or webhooks.
 // @Tags Payment
 // @Accept  json
 // @Produce  json
+// @Param   Idempotency-Key header string false "Unique key that makes retries of this request safe"
 // @Param   PaymentRequestDto body PaymentRequestDto true "Make Payment Request"
-// @Success 200 {object} common.BaseResponse
+// @Success 202 {object} PaymentResponseDto
 // @Failure 400 {object} common.ErrorResponse
 // @Failure 401 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Failure 422 {object} common.ErrorResponse
 // @Failure 500 {object} common.ErrorResponse
 // @Router  /payments/payment [post]
 func (p paymentHandler) MakePayment(c echo.Context) error {
@@ -43,6 +54,7 @@ func (p paymentHandler) MakePayment(c echo.Context) error {
 // @Success 200 {object} common.BaseResponse
 // @Failure 400 {object} common.ErrorResponse
 // @Failure 401 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
 // @Failure 500 {object} common.ErrorResponse
 // @Router  /payments/{id} [get]
 func (p paymentHandler) GetPaymentDetail(c echo.Context) error {
@@ -50,19 +62,181 @@ func (p paymentHandler) GetPaymentDetail(c echo.Context) error {
 }
 
 // Transactions godoc
-// @Summary Transactions for all users
-// @Description Gets all Transactions
+// @Summary Transactions of the current user
+// @Description Gets one page of the Transactions made by the authenticated user
 // @Tags Payments
 // @Accept  json
 // @Produce  json
-// @Success 201 {object} common.BaseResponse
+// @Param   status query string false "Payment status"
+// @Param   payment_method query string false "Payment method"
+// @Param   currency query string false "ISO 4217 currency code"
+// @Param   min_amount query string false "Minimum amount in major units; requires currency"
+// @Param   max_amount query string false "Maximum amount in major units; requires currency"
+// @Param   created_from query string false "RFC 3339 timestamp, inclusive"
+// @Param   created_to query string false "RFC 3339 timestamp, exclusive"
+// @Param   q query string false "Search in payment, gateway and receipt references"
+// @Param   sort query string false "created_at, -created_at (default), amount or -amount"
+// @Param   cursor query string false "next_cursor of the previous page"
+// @Param   limit query int false "Page size, 1 to 100 (default 20)"
+// @Success 200 {object} common.BaseResponse
 // @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
 // @Failure 500 {object} common.ErrorResponse
 // @Router  /payments/transactions [get]
 func (p paymentHandler) Transactions(c echo.Context) error {
 	return p.paymentService.GetAllTransactions(c)
 }
 
+// AllTransactions godoc
+// @Summary Transactions for all users
+// @Description Gets one page of the Transactions of every user. Requires the admin role.
+// @Tags Admin
+// @Produce  json
+// @Param   status query string false "Payment status"
+// @Param   payment_method query string false "Payment method"
+// @Param   currency query string false "ISO 4217 currency code"
+// @Param   min_amount query string false "Minimum amount in major units; requires currency"
+// @Param   max_amount query string false "Maximum amount in major units; requires currency"
+// @Param   created_from query string false "RFC 3339 timestamp, inclusive"
+// @Param   created_to query string false "RFC 3339 timestamp, exclusive"
+// @Param   q query string false "Search in payment, gateway and receipt references"
+// @Param   sort query string false "created_at, -created_at (default), amount or -amount"
+// @Param   cursor query string false "next_cursor of the previous page"
+// @Param   limit query int false "Page size, 1 to 100 (default 20)"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/payments [get]
+func (p paymentHandler) AllTransactions(c echo.Context) error {
+	return p.paymentService.GetAllPayments(c)
+}
+
+// ReviewPayment godoc
+// @Summary Review a flagged payment
+// @Description Approves or rejects a payment risk screening flagged for review. Approving a held card payment captures it; rejecting it voids the authorization. Requires the admin role.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "Payment ID"
+// @Param   ReviewRequestDto body ReviewRequestDto true "Review"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 402 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Failure 502 {object} common.ErrorResponse
+// @Router  /admin/payments/{id}/review [post]
+func (p paymentHandler) ReviewPayment(c echo.Context) error {
+	return p.paymentService.ReviewPayment(c)
+}
+
+// MpesaCallback godoc
+// @Summary M-Pesa STK Push callback
+// @Description Receives the result of a Lipa Na M-Pesa Online payment from Daraja
+// @Tags Payments
+// @Accept  json
+// @Produce  json
+// @Param   token query string false "Shared callback token"
+// @Success 200 {object} mpesa.CallbackAcknowledgement
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /payments/mpesa/callback [post]
+func (p paymentHandler) MpesaCallback(c echo.Context) error {
+	return p.paymentService.MpesaCallback(c)
+}
+
+// CapturePayment godoc
+// @Summary Capture an authorized payment
+// @Description Captures a payment made with capture_method "manual". Omit the amount to capture the full authorization.
+// @Tags Payments
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "Payment ID"
+// @Param   CaptureRequestDto body CaptureRequestDto false "Capture Request"
+// @Success 200 {object} common.BaseResponse
+// @Success 202 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 402 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Failure 502 {object} common.ErrorResponse
+// @Router  /payments/{id}/capture [post]
+func (p paymentHandler) CapturePayment(c echo.Context) error {
+	return p.paymentService.CapturePayment(c)
+}
+
+// VoidPayment godoc
+// @Summary Void an authorized payment
+// @Description Releases the hold on an authorized payment that has not been captured
+// @Tags Payments
+// @Produce  json
+// @Param   id path int true "Payment ID"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Failure 422 {object} common.ErrorResponse
+// @Failure 502 {object} common.ErrorResponse
+// @Router  /payments/{id}/void [post]
+func (p paymentHandler) VoidPayment(c echo.Context) error {
+	return p.paymentService.VoidPayment(c)
+}
+
+// StreamPayments godoc
+// @Summary Stream payment status changes
+// @Description Upgrades to a WebSocket speaking the mamlaka.payments.v1 subprotocol that pushes status changes of the caller's payments. Browsers, which cannot set the Authorization header, pass the access token as an extra "bearer.<token>" subprotocol. Follow payments with payment_id query parameters or all=true, or later by sending {"action":"subscribe","payment_ids":[1,2]}; omit payment_ids to follow every payment. Each subscribed payment is answered with its current state.
+// @Tags Payments
+// @Param   payment_id query []int false "Payments to follow" collectionFormat(multi)
+// @Param   all query bool false "Follow every payment of the caller"
+// @Success 101
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Router  /payments/stream [get]
+func (p paymentHandler) StreamPayments(c echo.Context) error {
+	return p.paymentService.StreamPayments(c)
+}
+
+// CreateRefund godoc
+// @Summary Refund a payment
+// @Description Refunds all or part of a captured payment of any user. Omit the amount to refund everything left. Requires the payments:refund permission.
+// @Tags Payments
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "Payment ID"
+// @Param   RefundRequestDto body RefundRequestDto true "Refund Request"
+// @Success 201 {object} common.BaseResponse
+// @Success 202 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 402 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Failure 422 {object} common.ErrorResponse
+// @Failure 502 {object} common.ErrorResponse
+// @Router  /payments/{id}/refunds [post]
+func (p paymentHandler) CreateRefund(c echo.Context) error {
+	return p.paymentService.CreateRefund(c)
+}
+
+// ListRefunds godoc
+// @Summary List refunds of a payment
+// @Description Lists every refund made against a payment, oldest first. Holders of the payments:refund permission may list the refunds of any payment.
+// @Tags Payments
+// @Produce  json
+// @Param   id path int true "Payment ID"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /payments/{id}/refunds [get]
+func (p paymentHandler) ListRefunds(c echo.Context) error {
+	return p.paymentService.ListRefunds(c)
+}
+
 func NewPaymentHandler(logger *slog.Logger, service PaymentService) PaymentHandler {
 	return paymentHandler{logger: logger, paymentService: service}
 }
@@ -0,0 +1,114 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mamlaka/internal/app/middlewares"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header clients use to make retries safe.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a stored key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	errIdempotencyKeyTooLong    = errors.New("idempotency key must be at most 255 characters")
+	errIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request body")
+	errIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// responseRecorder copies everything written to the client so it can be stored.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// withIdempotency runs next at most once per (user, Idempotency-Key). The first
+// response is stored and replayed verbatim for retries carrying the same body;
+// a different body under the same key is rejected. Server errors release the
+// key so that the client can retry.
+func (p paymentService) withIdempotency(c echo.Context, next echo.HandlerFunc) error {
+	keyValue := c.Request().Header.Get(IdempotencyKeyHeader)
+	if keyValue == "" {
+		return next(c)
+	}
+	if len(keyValue) > maxIdempotencyKeyLength {
+		return p.handleError(c, errIdempotencyKeyTooLong, http.StatusBadRequest)
+	}
+
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return p.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		p.logger.Error("Error reading payment request body", "error", err)
+		return p.handleError(c, err, http.StatusBadRequest)
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(c.Request().Method + " " + c.Path() + "\n"))
+	hash.Write(body)
+	requestHash := hex.EncodeToString(hash.Sum(nil))
+
+	key, created, err := p.repository.ReserveIdempotencyKey(&IdempotencyKey{
+		UserID:      userID,
+		Key:         keyValue,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(p.config.Payment.IdempotencyKeyTTL),
+	})
+	if err != nil {
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	if !created {
+		if key.RequestHash != requestHash {
+			return p.handleError(c, errIdempotencyKeyReused, http.StatusUnprocessableEntity)
+		}
+		if key.ResponseStatus == 0 {
+			return p.handleError(c, errIdempotencyKeyInProgress, http.StatusConflict)
+		}
+		p.logger.Info("Replaying idempotent response", "userID", userID, "key", keyValue)
+		c.Response().Header().Set(IdempotentReplayedHeader, "true")
+		return c.Blob(key.ResponseStatus, key.ResponseContent, key.ResponseBody)
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+	c.Response().Writer = recorder
+	err = next(c)
+	c.Response().Writer = recorder.ResponseWriter
+
+	status := c.Response().Status
+	if err != nil || !c.Response().Committed || status >= http.StatusInternalServerError {
+		if delErr := p.repository.DeleteIdempotencyKey(key); delErr != nil {
+			p.logger.Error("Error releasing idempotency key", "key", keyValue, "error", delErr)
+		}
+		return err
+	}
+
+	key.ResponseStatus = status
+	key.ResponseBody = recorder.body.Bytes()
+	key.ResponseContent = c.Response().Header().Get(echo.HeaderContentType)
+	if err := p.repository.SaveIdempotencyResponse(key); err != nil {
+		p.logger.Error("Error storing idempotent response", "key", keyValue, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package payment
+
+import (
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// idempotencyRepository keeps idempotency keys in memory. It implements only
+// the idempotency methods of PaymentRepository.
+type idempotencyRepository struct {
+	PaymentRepository
+	keys map[string]*IdempotencyKey
+}
+
+func newIdempotencyRepository() *idempotencyRepository {
+	return &idempotencyRepository{keys: make(map[string]*IdempotencyKey)}
+}
+
+func (r *idempotencyRepository) ReserveIdempotencyKey(key *IdempotencyKey) (*IdempotencyKey, bool, error) {
+	id := key.Key
+	if stored, ok := r.keys[id]; ok && stored.UserID == key.UserID {
+		found := *stored
+		return &found, false, nil
+	}
+	saved := *key
+	r.keys[id] = &saved
+	return key, true, nil
+}
+
+func (r *idempotencyRepository) SaveIdempotencyResponse(key *IdempotencyKey) error {
+	saved := *key
+	r.keys[key.Key] = &saved
+	return nil
+}
+
+func (r *idempotencyRepository) DeleteIdempotencyKey(key *IdempotencyKey) error {
+	delete(r.keys, key.Key)
+	return nil
+}
+
+// idempotencyTest runs requests through withIdempotency, counting how often
+// the wrapped handler runs.
+type idempotencyTest struct {
+	service paymentService
+	status  int // Returned by the wrapped handler
+	calls   int
+}
+
+func newIdempotencyTest() *idempotencyTest {
+	return &idempotencyTest{
+		service: paymentService{
+			logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+			repository: newIdempotencyRepository(),
+			config:     config.Config{Payment: config.PaymentConfig{IdempotencyKeyTTL: time.Hour}},
+		},
+		status: http.StatusAccepted,
+	}
+}
+
+func (it *idempotencyTest) do(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/payment", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetPath("/api/v1/payments/payment")
+	c.Set("claims", &tokens.Claims{UserID: "7"})
+
+	_ = it.service.withIdempotency(c, func(c echo.Context) error {
+		it.calls++
+		return c.JSON(it.status, map[string]int{"call": it.calls})
+	})
+	return rec
+}
+
+func TestIdempotencyReplaysFirstResponse(t *testing.T) {
+	it := newIdempotencyTest()
+
+	first := it.do("key-1", `{"amount":"100"}`)
+	retry := it.do("key-1", `{"amount":"100"}`)
+
+	if it.calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", it.calls)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s, want %d %s", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("retry is missing the %s header", IdempotentReplayedHeader)
+	}
+	if first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("first response has the %s header", IdempotentReplayedHeader)
+	}
+}
+
+func TestIdempotencyRejectsDifferentBody(t *testing.T) {
+	it := newIdempotencyTest()
+
+	it.do("key-1", `{"amount":"100"}`)
+	rec := it.do("key-1", `{"amount":"200"}`)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if it.calls != 1 {
+		t.Errorf("handler ran %d times, want 1", it.calls)
+	}
+}
+
+func TestIdempotencyRejectsKeyInProgress(t *testing.T) {
+	it := newIdempotencyTest()
+	body := `{"amount":"100"}`
+
+	// Reserve the key the way a request still being processed would have
+	it.do("key-1", body)
+	repository := it.service.repository.(*idempotencyRepository)
+	repository.keys["key-1"].ResponseStatus = 0
+
+	rec := it.do("key-1", body)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestIdempotencyReleasesKeyAfterServerError(t *testing.T) {
+	it := newIdempotencyTest()
+	it.status = http.StatusInternalServerError
+
+	it.do("key-1", `{"amount":"100"}`)
+	it.status = http.StatusAccepted
+	rec := it.do("key-1", `{"amount":"100"}`)
+
+	if it.calls != 2 {
+		t.Errorf("handler ran %d times, want the retry to run it again", it.calls)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("retry status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+}
+
+func TestIdempotencyWithoutKey(t *testing.T) {
+	it := newIdempotencyTest()
+
+	it.do("", `{"amount":"100"}`)
+	it.do("", `{"amount":"100"}`)
+
+	if it.calls != 2 {
+		t.Errorf("handler ran %d times, want 2", it.calls)
+	}
+}
+
+func TestIdempotencyRejectsLongKey(t *testing.T) {
+	it := newIdempotencyTest()
+
+	rec := it.do(strings.Repeat("k", maxIdempotencyKeyLength+1), `{"amount":"100"}`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if it.calls != 0 {
+		t.Errorf("handler ran %d times, want 0", it.calls)
+	}
+}
@@ -0,0 +1,120 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/vault"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/jobs"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobProcessPayment authorizes, and unless capture is manual captures, a
+// payment accepted by MakePayment.
+const JobProcessPayment = "payment.process"
+
+// cvvPurgeInterval is how often CVVs of payments that were never processed are deleted.
+const cvvPurgeInterval = time.Minute
+
+// ProcessPaymentJob is the payload of a JobProcessPayment job.
+type ProcessPaymentJob struct {
+	PaymentID uint   `json:"payment_id"`
+	CVVHandle string `json:"cvv_handle,omitempty"` // Vault handle of the CVV of card payments
+	Actor     string `json:"actor"`
+}
+
+// enqueueProcessing returns the effect queueing payment for processing once it has been stored.
+func enqueueProcessing(payment *Payment, job ProcessPaymentJob) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		job.PaymentID = payment.ID
+		_, err := jobs.Enqueue(tx, JobProcessPayment, job)
+		return err
+	}
+}
+
+// ProcessPayment runs a JobProcessPayment job. Failures before the gateway is
+// called are retried. Once the CVV has been taken from the vault the gateway
+// call cannot be repeated, so later failures are permanent; the payment has
+// then either failed or is pending and left to the reconciler.
+func (p paymentService) ProcessPayment(ctx context.Context, job *jobs.Job) error {
+	var request ProcessPaymentJob
+	if err := job.Decode(&request); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	payment, err := p.repository.GetPaymentByID(request.PaymentID)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return jobs.Permanent(fmt.Errorf("payment %d not found", request.PaymentID))
+	}
+	if payment.Status != StatusPending || payment.Gateway != "" {
+		// Already sent to a gateway by an earlier attempt; the reconciler resolves timeouts
+		p.logger.Info("Payment already processed", "paymentID", payment.ID, "status", payment.Status)
+		return nil
+	}
+
+	var card *gateway.Card
+	if payment.PaymentMethod == CreditCard {
+		number, err := p.vault.Detokenize(payment.PaymentDetails.CardToken)
+		if err != nil {
+			return err
+		}
+		cvv, err := p.vault.TakeCVV(request.CVVHandle)
+		if errors.Is(err, vault.ErrCVVNotFound) {
+			return p.transition(payment, StatusFailed, "card security code expired before the payment was processed", request.Actor)
+		}
+		if err != nil {
+			return err
+		}
+		card = &gateway.Card{Number: number, ExpiryDate: payment.PaymentDetails.CardExpiry, CVV: cvv}
+	}
+
+	err = p.processPayment(ctx, payment, card, request.Actor)
+	switch {
+	case err == nil || payment.Status == StatusFailed:
+		// Declines and gateway errors are recorded on the payment
+		p.logger.Info("Payment processed", "paymentID", payment.ID, "status", payment.Status)
+		return nil
+	case card != nil:
+		return jobs.Permanent(err)
+	default:
+		return err
+	}
+}
+
+// RegisterPaymentWorkers registers the payment job handlers with queue and
+// starts the reconciler, the authorization sweeper and the CVV purge, which
+// run until ctx is cancelled.
+func RegisterPaymentWorkers(ctx context.Context, queue *jobs.Queue, logger *slog.Logger, db *gorm.DB, conf config.Config) error {
+	cardVault, err := vault.NewVaultService(logger, vault.NewVaultRepository(db, logger), conf.Vault)
+	if err != nil {
+		return fmt.Errorf("cannot initialise card vault: %w", err)
+	}
+
+	gateways, err := NewGatewayRegistryFromConfig(conf, db)
+	if err != nil {
+		return fmt.Errorf("cannot configure payment gateways: %w", err)
+	}
+
+	// Status changes reach payment streams through Postgres, so the worker needs no broker of its own
+	paymentService := NewPaymentService(logger, NewPaymentRepository(db, logger), gateways, cardVault, conf, nil, nil)
+
+	queue.Register(JobProcessPayment, paymentService.ProcessPayment)
+
+	go RunReconciler(ctx, logger, paymentService, conf.Payment.ReconcileInterval)
+	go RunAuthorizationSweeper(ctx, logger, paymentService, conf.Payment.AuthorizationSweep)
+	go RunSettlementSweeper(ctx, logger, paymentService, conf.Payment.SettlementSweep)
+	go runEvery(ctx, cvvPurgeInterval, func() {
+		if err := cardVault.PurgeExpiredCVVs(); err != nil {
+			logger.Error("Error purging expired CVVs", "error", err)
+		}
+	})
+	return nil
+}
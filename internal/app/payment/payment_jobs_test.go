@@ -0,0 +1,105 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mamlaka/internal/app/vault"
+	"mamlaka/internal/pkg/jobs"
+	"mamlaka/internal/pkg/money"
+	"testing"
+)
+
+// processingRepository holds one payment and records its status changes.
+type processingRepository struct {
+	PaymentRepository
+	payment *Payment
+	changes []StatusChange
+}
+
+func (r *processingRepository) GetPaymentByID(id uint) (*Payment, error) {
+	if r.payment == nil || id != r.payment.ID {
+		return nil, nil
+	}
+	payment := *r.payment
+	return &payment, nil
+}
+
+func (r *processingRepository) UpdatePaymentStatus(payment *Payment, change StatusChange) error {
+	r.changes = append(r.changes, change)
+	payment.Status = change.To
+	return nil
+}
+
+// expiredCVVVault knows every card but has no CVVs left.
+type expiredCVVVault struct {
+	vault.VaultService
+}
+
+func (expiredCVVVault) Detokenize(string) (string, error) {
+	return "4242424242424242", nil
+}
+
+func (expiredCVVVault) TakeCVV(string) (string, error) {
+	return "", vault.ErrCVVNotFound
+}
+
+func processingJob(t *testing.T, payload ProcessPaymentJob) *jobs.Job {
+	t.Helper()
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &jobs.Job{Type: JobProcessPayment, Payload: encoded}
+}
+
+func newProcessingTest(payment *Payment) (paymentService, *processingRepository) {
+	repository := &processingRepository{payment: payment}
+	return paymentService{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		repository: repository,
+		vault:      expiredCVVVault{},
+	}, repository
+}
+
+func TestProcessPaymentUnknownPaymentIsPermanent(t *testing.T) {
+	service, _ := newProcessingTest(nil)
+
+	err := service.ProcessPayment(context.Background(), processingJob(t, ProcessPaymentJob{PaymentID: 1}))
+	if !jobs.IsPermanent(err) {
+		t.Errorf("ProcessPayment() error = %v, want a permanent error", err)
+	}
+	if err := service.ProcessPayment(context.Background(), &jobs.Job{Payload: []byte(`not json`)}); !jobs.IsPermanent(err) {
+		t.Errorf("ProcessPayment() of invalid payload error = %v, want a permanent error", err)
+	}
+}
+
+func TestProcessPaymentSkipsProcessedPayment(t *testing.T) {
+	service, repository := newProcessingTest(&Payment{ID: 1, Status: StatusPending, PaymentMethod: CreditCard, Gateway: "sandbox"})
+
+	if err := service.ProcessPayment(context.Background(), processingJob(t, ProcessPaymentJob{PaymentID: 1})); err != nil {
+		t.Errorf("ProcessPayment() error = %v", err)
+	}
+	if len(repository.changes) != 0 {
+		t.Errorf("payment changed status to %s, want a retried job to leave it alone", repository.changes[0].To)
+	}
+}
+
+func TestProcessPaymentFailsWhenCVVExpired(t *testing.T) {
+	service, repository := newProcessingTest(&Payment{
+		ID:             1,
+		Amount:         money.Money{Amount: 10000, Currency: "KES"},
+		Status:         StatusPending,
+		PaymentMethod:  CreditCard,
+		PaymentDetails: PaymentDetails{CardToken: "card_1", CardExpiry: "12/30"},
+	})
+
+	err := service.ProcessPayment(context.Background(), processingJob(t, ProcessPaymentJob{PaymentID: 1, CVVHandle: "cvv_1", Actor: "user:7"}))
+	if err != nil {
+		t.Errorf("ProcessPayment() error = %v", err)
+	}
+	if len(repository.changes) != 1 || repository.changes[0].To != StatusFailed {
+		t.Errorf("status changes = %+v, want one to %s", repository.changes, StatusFailed)
+	}
+}
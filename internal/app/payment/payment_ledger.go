@@ -0,0 +1,78 @@
+package payment
+
+import (
+	"fmt"
+	"mamlaka/internal/app/ledger"
+	"mamlaka/internal/pkg/money"
+)
+
+// ledgerEntry returns the journal entry recording a status change whose new
+// captured and refunded totals are given, or nil if the change moves no money.
+//
+// Funds collected by a gateway sit in its clearing account until paid out.
+// They are credited to the customer's account, whose balance is the
+// customer's wallet, and purchases move them on to the merchant, less the
+// processing fee. Once the gateway pays them out on settlement they move to
+// the payouts account. Wallet payments skip the gateway and spend the
+// customer's balance directly. Refunds reverse the path and are charged to
+// the refunds account; refunds of settled payments leave the clearing
+// account short until the gateway deducts them from a later payout.
+func (p paymentService) ledgerEntry(payment *Payment, to PaymentStatus, captured, refunded int64) *ledger.Entry {
+	customer := ledger.CustomerAccount(payment.UserID)
+	clearing := ledger.GatewayClearingAccount(payment.Gateway)
+	viaGateway := payment.PaymentMethod != EWallet
+
+	switch to {
+	case StatusCaptured:
+		amount := money.Money{Amount: captured, Currency: payment.Amount.Currency}
+		entry := &ledger.Entry{
+			Reference:   fmt.Sprintf("payment:%d:capture", payment.ID),
+			Description: fmt.Sprintf("capture of payment %d", payment.ID),
+		}
+		if viaGateway {
+			entry.Add(ledger.Debit(clearing, amount), ledger.Credit(customer, amount))
+		}
+		if payment.Purpose != PurposeWalletTopUp {
+			fee := p.fee(amount)
+			net, _ := amount.Sub(fee)
+			entry.Add(
+				ledger.Debit(customer, amount),
+				ledger.Credit(ledger.MerchantAccount, net),
+				ledger.Credit(ledger.FeesAccount, fee),
+			)
+		}
+		return entry
+
+	case StatusSettled:
+		if !viaGateway {
+			return nil
+		}
+		amount := payment.Captured()
+		entry := &ledger.Entry{
+			Reference:   fmt.Sprintf("payment:%d:settlement", payment.ID),
+			Description: fmt.Sprintf("payout of payment %d by %s", payment.ID, payment.Gateway),
+		}
+		entry.Add(ledger.Debit(ledger.PayoutsAccount, amount), ledger.Credit(clearing, amount))
+		return entry
+
+	case StatusRefunded, StatusPartiallyRefunded:
+		amount := money.Money{Amount: refunded - payment.RefundedAmount, Currency: payment.Amount.Currency}
+		entry := &ledger.Entry{
+			// The version identifies the change as payments are refunded in several steps
+			Reference:   fmt.Sprintf("payment:%d:refund:v%d", payment.ID, payment.Version+1),
+			Description: fmt.Sprintf("refund of %s on payment %d", amount, payment.ID),
+		}
+		entry.Add(ledger.Debit(ledger.RefundsAccount, amount), ledger.Credit(customer, amount))
+		if viaGateway {
+			entry.Add(ledger.Debit(customer, amount), ledger.Credit(clearing, amount))
+		}
+		return entry
+	}
+	return nil
+}
+
+// fee returns the processing fee on amount, rounded half up to a minor unit.
+func (p paymentService) fee(amount money.Money) money.Money {
+	bps := int64(p.config.Payment.FeeBasisPoints)
+	return money.Money{Amount: (amount.Amount*bps + 5000) / 10000, Currency: amount.Currency}
+}
@@ -0,0 +1,216 @@
+package payment
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultPageSize = 20
+
+// PaymentSort is the order in which payments are listed. A leading "-" sorts
+// in descending order.
+type PaymentSort string
+
+const (
+	SortCreatedAtDesc PaymentSort = "-created_at"
+	SortCreatedAtAsc  PaymentSort = "created_at"
+	SortAmountDesc    PaymentSort = "-amount"
+	SortAmountAsc     PaymentSort = "amount"
+)
+
+// column returns the payments column the sort orders by.
+func (s PaymentSort) column() string {
+	return strings.TrimPrefix(string(s), "-")
+}
+
+// descending reports whether the sort is in descending order.
+func (s PaymentSort) descending() bool {
+	return strings.HasPrefix(string(s), "-")
+}
+
+// PaymentFilter selects a page of payments for ListPayments.
+type PaymentFilter struct {
+	UserID      *uint // Nil lists payments of every user
+	Status      PaymentStatus
+	Method      PaymentMethod
+	Currency    string
+	MinAmount   *int64 // Minor units, inclusive
+	MaxAmount   *int64 // Minor units, inclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Query       string // Matched against the payment, gateway and receipt references
+	Sort        PaymentSort
+	After       *PaymentCursor
+	Limit       int
+}
+
+// PaymentCursor marks the last payment of a page. The next page starts after
+// it in the order given by Sort.
+type PaymentCursor struct {
+	Sort      PaymentSort `json:"s"`
+	ID        uint        `json:"i"`
+	CreatedAt time.Time   `json:"c,omitempty"`
+	Amount    int64       `json:"a,omitempty"`
+}
+
+// cursorFor returns the cursor pointing after payment in the given sort.
+func cursorFor(payment Payment, sort PaymentSort) PaymentCursor {
+	return PaymentCursor{Sort: sort, ID: payment.ID, CreatedAt: payment.CreatedAt, Amount: payment.Amount.Amount}
+}
+
+// value returns the cursor's value of the sort column.
+func (c PaymentCursor) value() interface{} {
+	if c.Sort.column() == "amount" {
+		return c.Amount
+	}
+	return c.CreatedAt
+}
+
+// Encode returns the opaque string handed to clients as next_cursor.
+func (c PaymentCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodePaymentCursor parses a cursor produced by Encode.
+func DecodePaymentCursor(s string) (*PaymentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor PaymentCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// GetAllTransactions lists the payments of the authenticated user
+func (p paymentService) GetAllTransactions(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return p.handleError(c, err, http.StatusUnauthorized)
+	}
+	return p.listPayments(c, &userID)
+}
+
+// GetAllPayments lists the payments of every user. It is only routed for admins.
+func (p paymentService) GetAllPayments(c echo.Context) error {
+	return p.listPayments(c, nil)
+}
+
+// listPayments responds with one page of payments matching the query
+// parameters, restricted to userID unless it is nil.
+func (p paymentService) listPayments(c echo.Context, userID *uint) error {
+	var request TransactionListRequestDto
+	if err := c.Bind(&request); err != nil {
+		p.logger.Error("Error parsing transaction list query", "error", err)
+		return p.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return p.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	filter, fields := request.filter()
+	if len(fields) > 0 {
+		return p.handleValidationError(c, fields)
+	}
+	filter.UserID = userID
+
+	// Fetch one extra payment to find out whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	payments, err := p.repository.ListPayments(filter)
+	if err != nil {
+		p.logger.Error("Error fetching payments", "error", err)
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	var nextCursor string
+	if len(payments) > limit {
+		payments = payments[:limit]
+		nextCursor = cursorFor(payments[limit-1], filter.Sort).Encode()
+	}
+
+	p.logger.Info("Payments fetched successfully", "count", len(payments))
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:     http.StatusOK,
+		Message:    "Payments fetched successfully",
+		Data:       payments,
+		NextCursor: nextCursor,
+	})
+}
+
+// filter converts the query parameters into a PaymentFilter, returning one
+// FieldError per parameter that cannot be parsed.
+func (r TransactionListRequestDto) filter() (PaymentFilter, []common.FieldError) {
+	var fields []common.FieldError
+	filter := PaymentFilter{
+		Status:   PaymentStatus(r.Status),
+		Method:   PaymentMethod(r.PaymentMethod),
+		Currency: strings.ToUpper(r.Currency),
+		Query:    strings.TrimSpace(r.Query),
+		Sort:     PaymentSort(r.Sort),
+		Limit:    r.Limit,
+	}
+	if filter.Sort == "" {
+		filter.Sort = SortCreatedAtDesc
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultPageSize
+	}
+
+	parseAmount := func(field, value string) *int64 {
+		if value == "" {
+			return nil
+		}
+		if filter.Currency == "" {
+			fields = append(fields, common.FieldError{Field: field, Message: "requires currency"})
+			return nil
+		}
+		amount, err := money.Parse(value, filter.Currency)
+		if err != nil {
+			fields = append(fields, common.FieldError{Field: field, Message: err.Error()})
+			return nil
+		}
+		return &amount.Amount
+	}
+	filter.MinAmount = parseAmount("min_amount", r.MinAmount)
+	filter.MaxAmount = parseAmount("max_amount", r.MaxAmount)
+
+	parseTime := func(field, value string) *time.Time {
+		if value == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fields = append(fields, common.FieldError{Field: field, Message: "must be an RFC 3339 timestamp"})
+			return nil
+		}
+		return &t
+	}
+	filter.CreatedFrom = parseTime("created_from", r.CreatedFrom)
+	filter.CreatedTo = parseTime("created_to", r.CreatedTo)
+
+	if r.Cursor != "" {
+		cursor, err := DecodePaymentCursor(r.Cursor)
+		switch {
+		case err != nil:
+			fields = append(fields, common.FieldError{Field: "cursor", Message: err.Error()})
+		case cursor.Sort != filter.Sort:
+			fields = append(fields, common.FieldError{Field: "cursor", Message: "was issued for a different sort"})
+		default:
+			filter.After = cursor
+		}
+	}
+	return filter, fields
+}
@@ -0,0 +1,59 @@
+package payment
+
+import (
+	"mamlaka/internal/app/vault"
+
+	"gorm.io/gorm"
+)
+
+// legacyCardColumns held raw card data on payment_details before the card vault existed.
+var legacyCardColumns = []string{"card_number", "expiry_date", "cvv"}
+
+// MigrateLegacyCardData moves card numbers stored in plaintext by earlier
+// versions into the vault, replaces them with tokens and drops the plaintext
+// card number, expiry and CVV columns. It is a no-op once the columns are gone.
+func MigrateLegacyCardData(db *gorm.DB, cardVault vault.VaultService) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&PaymentDetails{}, "card_number") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []struct {
+			ID         uint
+			CardNumber string
+			ExpiryDate string
+		}
+		if err := tx.Table("payment_details").
+			Select("id, card_number, expiry_date").
+			Where("card_number IS NOT NULL AND card_number <> ''").
+			Find(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			card, err := cardVault.Tokenize(row.CardNumber, row.ExpiryDate)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&PaymentDetails{}).Where("id = ?", row.ID).Updates(map[string]interface{}{
+				"card_token":       card.Token,
+				"card_fingerprint": card.Fingerprint,
+				"card_brand":       card.Brand,
+				"card_last4":       card.Last4,
+				"card_expiry":      card.ExpiryDate,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, column := range legacyCardColumns {
+			if tx.Migrator().HasColumn(&PaymentDetails{}, column) {
+				if err := tx.Migrator().DropColumn(&PaymentDetails{}, column); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
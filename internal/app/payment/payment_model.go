@@ -1,6 +1,12 @@
 package payment
 
-import "gorm.io/gorm"
+import (
+	"mamlaka/internal/app/user"
+	"mamlaka/internal/pkg/money"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type PaymentMethod string
 
@@ -10,24 +16,120 @@ const (
 	Mpesa      PaymentMethod = "mpesa"
 )
 
+// PaymentPurpose says what a payment is for.
+type PaymentPurpose string
+
+const (
+	PurposePurchase    PaymentPurpose = "purchase"      // Pays the merchant
+	PurposeWalletTopUp PaymentPurpose = "wallet_top_up" // Adds funds to the payer's wallet
+)
+
+// CaptureMethod controls whether an authorized payment is captured straight
+// away or held until it is captured explicitly.
+type CaptureMethod string
+
+const (
+	CaptureAutomatic CaptureMethod = "automatic"
+	CaptureManual    CaptureMethod = "manual"
+)
+
 // Payment represents a request to process a payment.
 type Payment struct {
 	gorm.Model
-	ID             uint           `gorm:"primaryKey" json:"id"`
-	Amount         string         `json:"amount"`
-	Currency       string         `json:"currency"`
-	PaymentMethod  PaymentMethod  `json:"payment_method"`
-	PaymentDetails PaymentDetails `gorm:"foreignKey:PaymentID" json:"payment_details"` // One-to-One relationship
+	ID                     uint           `gorm:"primaryKey" json:"id"`
+	UserID                 uint           `gorm:"index" json:"user_id"` // Owner of the payment
+	User                   *user.User     `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	Amount                 money.Money    `gorm:"embedded" json:"amount"`
+	PaymentMethod          PaymentMethod  `json:"payment_method"`
+	Purpose                PaymentPurpose `gorm:"size:20;not null;default:purchase" json:"purpose"`
+	Reference              string         `gorm:"size:100;index" json:"reference,omitempty"` // Caller's own reference, e.g. an order number
+	Status                 PaymentStatus  `gorm:"size:32;not null;default:pending;index" json:"status"`
+	Version                int            `gorm:"not null;default:1" json:"-"` // Incremented on every status change for optimistic locking
+	CaptureMethod          CaptureMethod  `gorm:"size:20;not null;default:automatic" json:"capture_method"`
+	AuthorizationExpiresAt *time.Time     `gorm:"index" json:"authorization_expires_at,omitempty"` // When an uncaptured authorization is voided
+	CapturedAmount         int64          `gorm:"not null;default:0" json:"captured_minor_units"`
+	CapturedAt             *time.Time     `gorm:"index" json:"captured_at,omitempty"` // When the payment was captured; it is settled SettlementDelay later
+	RefundedAmount         int64          `gorm:"not null;default:0" json:"refunded_minor_units"`
+	Gateway                string         `gorm:"size:50" json:"gateway"`
+	GatewayReference       string         `gorm:"size:100;index" json:"gateway_reference"`       // Provider transaction ID, e.g. the M-Pesa CheckoutRequestID
+	Receipt                string         `gorm:"size:100" json:"receipt,omitempty"`             // Provider receipt, e.g. the M-Pesa receipt number
+	DuplicateKey           string         `gorm:"size:64;index" json:"-"`                        // Shared with payments the duplicate rule treats as repeats of this one
+	HeldForReview          bool           `gorm:"not null;default:false" json:"held_for_review"` // Authorized but not captured until risk review approves it
+	PaymentDetails         PaymentDetails `gorm:"foreignKey:PaymentID" json:"payment_details"`   // One-to-One relationship
+
+	StatusHistory []PaymentStatusTransition `gorm:"foreignKey:PaymentID" json:"status_history,omitempty"`
+	Refunds       []Refund                  `gorm:"foreignKey:PaymentID" json:"refunds,omitempty"`
+}
+
+// capturesOnAuthorization reports whether the payment is captured as soon
+// as it is authorized.
+func (p *Payment) capturesOnAuthorization() bool {
+	return p.CaptureMethod != CaptureManual && !p.HeldForReview
+}
+
+// Captured returns the captured amount of the payment.
+func (p *Payment) Captured() money.Money {
+	return money.Money{Amount: p.CapturedAmount, Currency: p.Amount.Currency}
+}
+
+// Refundable returns how much of the captured amount has not been refunded yet.
+func (p *Payment) Refundable() money.Money {
+	return money.Money{Amount: p.CapturedAmount - p.RefundedAmount, Currency: p.Amount.Currency}
 }
 
 // PaymentDetails represents detailed payment information.
 type PaymentDetails struct {
 	gorm.Model
-	ID          uint   `gorm:"primaryKey" json:"id"`
-	CardNumber  string `json:"card_number"`
-	ExpiryDate  string `json:"expiry_date"`
-	CVV         string `json:"cvv"`
-	PhoneNumber string `json:"phone_number"`
-	Email       string `json:"email"`
-	PaymentID   uint   `json:"payment_id"` // Foreign key
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	CardToken       string `gorm:"size:64" json:"-"`                          // Vault token; the PAN itself is only stored in the vault
+	CardFingerprint string `gorm:"size:64;index" json:"-"`                    // Keyed hash of the PAN for matching repeat use of a card
+	CardBrand       string `gorm:"size:20;index" json:"card_brand,omitempty"` // Detected from the BIN, kept for reporting
+	CardLast4       string `gorm:"size:4" json:"card_last4,omitempty"`
+	CardExpiry      string `gorm:"size:7" json:"card_expiry,omitempty"` // MM/YY
+	PhoneNumber     string `json:"phone_number"`
+	Email           string `json:"email"`
+	PaymentID       uint   `json:"payment_id"` // Foreign key
+}
+
+// PaymentStatusTransition is an append-only record of a payment status change.
+type PaymentStatusTransition struct {
+	gorm.Model
+	PaymentID  uint          `gorm:"not null;index" json:"payment_id"`
+	FromStatus PaymentStatus `gorm:"size:32" json:"from_status"` // Empty for the initial status
+	ToStatus   PaymentStatus `gorm:"size:32;not null" json:"to_status"`
+	Reason     string        `json:"reason"`
+	Actor      string        `gorm:"size:100" json:"actor"` // "user:<id>" or "system"
+}
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+)
+
+// Refund returns all or part of a captured payment to the customer.
+type Refund struct {
+	gorm.Model
+	PaymentID        uint         `gorm:"not null;index" json:"payment_id"`
+	Amount           money.Money  `gorm:"embedded" json:"amount"`
+	Status           RefundStatus `gorm:"size:20;not null;index" json:"status"`
+	Reason           string       `json:"reason"`
+	FailureReason    string       `json:"failure_reason,omitempty"`
+	GatewayReference string       `gorm:"size:100" json:"gateway_reference,omitempty"`
+	RequestedBy      string       `gorm:"size:100" json:"requested_by"`
+}
+
+// IdempotencyKey records the first response to a request carrying an
+// Idempotency-Key header so that retries of the same request can be replayed.
+type IdempotencyKey struct {
+	gorm.Model
+	UserID          uint      `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Key             string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	RequestHash     string    `gorm:"size:64;not null"`
+	ResponseStatus  int       // Zero while the original request is still being processed
+	ResponseBody    []byte    `gorm:"type:bytea"`
+	ResponseContent string    `gorm:"size:255"`
+	ExpiresAt       time.Time `gorm:"not null;index"`
 }
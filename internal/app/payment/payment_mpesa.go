@@ -0,0 +1,75 @@
+package payment
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"mamlaka/internal/pkg/gateway/mpesa"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// mpesaActor is recorded in the status history for changes reported by M-Pesa.
+const mpesaActor = "gateway:mpesa"
+
+// MpesaCallback applies the result of an STK Push posted by Daraja to the
+// payment it was initiated for. Daraja only needs to know the callback was
+// received, so every well-formed callback is acknowledged, including
+// duplicates and callbacks for payments that are no longer pending.
+func (p paymentService) MpesaCallback(c echo.Context) error {
+	if token := p.config.Mpesa.CallbackToken; token != "" {
+		if subtle.ConstantTimeCompare([]byte(c.QueryParam("token")), []byte(token)) != 1 {
+			p.logger.Warn("Rejected M-Pesa callback with invalid token", "ip", c.RealIP())
+			return p.handleError(c, errors.New("invalid callback token"), http.StatusUnauthorized)
+		}
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return p.handleError(c, err, http.StatusBadRequest)
+	}
+	callback, err := mpesa.ParseCallback(body)
+	if err != nil {
+		p.logger.Error("Invalid M-Pesa callback", "error", err)
+		return p.handleError(c, err, http.StatusBadRequest)
+	}
+
+	payment, err := p.repository.GetPaymentByGatewayReference("mpesa", callback.CheckoutRequestID)
+	if err != nil {
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	accepted := mpesa.CallbackAcknowledgement{ResultCode: 0, ResultDesc: "Accepted"}
+	if payment == nil {
+		p.logger.Warn("M-Pesa callback for unknown payment", "checkoutRequestID", callback.CheckoutRequestID)
+		return c.JSON(http.StatusOK, accepted)
+	}
+	if payment.Status != StatusPending {
+		p.logger.Info("Ignoring M-Pesa callback for settled payment", "paymentID", payment.ID, "status", payment.Status)
+		return c.JSON(http.StatusOK, accepted)
+	}
+
+	if receipt := callback.ReceiptNumber(); receipt != "" {
+		payment.Receipt = receipt
+		if err := p.repository.SaveGatewayDetails(payment); err != nil {
+			return p.handleError(c, err, http.StatusInternalServerError)
+		}
+	}
+
+	result := mpesa.ResultFromCode(callback.CheckoutRequestID, callback.ResultCodeString(), callback.ResultDesc)
+	if err := p.applyAuthorization(payment, result, mpesaActor); err != nil {
+		var declined *DeclinedError
+		if !errors.As(err, &declined) {
+			return p.handleError(c, err, http.StatusInternalServerError)
+		}
+	}
+	if payment.Status == StatusAuthorized {
+		if err := p.transition(payment, StatusCaptured, "M-Pesa receipt "+payment.Receipt, mpesaActor); err != nil {
+			return p.handleError(c, err, http.StatusInternalServerError)
+		}
+	}
+
+	p.logger.Info("M-Pesa callback processed", "paymentID", payment.ID, "status", payment.Status, "resultCode", callback.ResultCode)
+	return c.JSON(http.StatusOK, accepted)
+}
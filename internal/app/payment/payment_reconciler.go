@@ -0,0 +1,204 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/internal/pkg/gateway"
+	"time"
+)
+
+const reconcileBatchSize = 100
+
+// reconcilerActor is recorded in the status history for changes made by the reconciler.
+const reconcilerActor = "system:reconciler"
+
+// ReconcilePendingPayments asks each gateway for the status of payments that
+// have been pending for longer than the configured threshold, e.g. M-Pesa
+// pushes whose callback never arrived or authorizations that timed out, and
+// applies the result.
+func (p paymentService) ReconcilePendingPayments(ctx context.Context) error {
+	payments, err := p.repository.GetStalePendingPayments(time.Now().Add(-p.config.Payment.PendingReconcileAfter), reconcileBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range payments {
+		payment := &payments[i]
+		if err := p.reconcilePayment(ctx, payment); err != nil {
+			p.logger.Error("Error reconciling payment", "paymentID", payment.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (p paymentService) reconcilePayment(ctx context.Context, payment *Payment) error {
+	gw, err := p.gateways.ForPayment(payment)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Payment.GatewayTimeout)
+	defer cancel()
+
+	var result *gateway.Result
+	if payment.GatewayReference == "" {
+		result, err = p.lookupAuthorization(ctx, gw, payment)
+	} else {
+		result, err = gw.Status(ctx, payment.GatewayReference)
+	}
+	if err != nil || result == nil {
+		return err
+	}
+
+	if err := p.applyAuthorization(payment, result, reconcilerActor); err != nil {
+		var declined *DeclinedError
+		if errors.As(err, &declined) {
+			return nil
+		}
+		return err
+	}
+	if payment.Status != StatusAuthorized || !payment.capturesOnAuthorization() {
+		return nil
+	}
+	return p.capturePayment(ctx, gw, payment, payment.Amount, reconcilerActor)
+}
+
+// lookupAuthorization finds the transaction of an authorization that timed
+// out, by the reference it was sent with, and saves its transaction ID. It
+// fails the payment, returning nil, if the authorization never reached the
+// gateway or the gateway cannot look it up: the card details needed to retry
+// it are gone.
+func (p paymentService) lookupAuthorization(ctx context.Context, gw gateway.Gateway, payment *Payment) (*gateway.Result, error) {
+	result, err := gw.Lookup(ctx, paymentReference(payment))
+	switch {
+	case errors.Is(err, gateway.ErrTransactionNotFound):
+		return nil, p.transition(payment, StatusFailed, "authorization timed out and never reached the gateway", reconcilerActor)
+	case errors.Is(err, gateway.ErrUnsupported):
+		p.logger.Warn("Outcome of timed-out authorization is unknown", "paymentID", payment.ID, "gateway", gw.Name())
+		return nil, p.transition(payment, StatusFailed, "authorization timed out and its outcome cannot be looked up", reconcilerActor)
+	case err != nil:
+		return nil, err
+	}
+
+	payment.GatewayReference = result.TransactionID
+	if err := p.repository.SaveGatewayDetails(payment); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReconcilePendingRefunds resolves refunds that have been pending for longer
+// than the configured threshold, so the amounts they hold become refundable
+// again if they failed.
+func (p paymentService) ReconcilePendingRefunds(ctx context.Context) error {
+	refunds, err := p.repository.GetStalePendingRefunds(time.Now().Add(-p.config.Payment.PendingReconcileAfter), reconcileBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range refunds {
+		refund := &refunds[i]
+		if err := p.reconcileRefund(ctx, refund); err != nil {
+			p.logger.Error("Error reconciling refund", "paymentID", refund.PaymentID, "refundID", refund.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// reconcileRefund asks the gateway for the status of a pending refund and
+// applies it. Refunds that never got a transaction ID from the gateway, e.g.
+// because the request timed out, are first looked up by their reference.
+func (p paymentService) reconcileRefund(ctx context.Context, refund *Refund) error {
+	payment, err := p.repository.GetPaymentByID(refund.PaymentID)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return fmt.Errorf("payment %d not found", refund.PaymentID)
+	}
+
+	// Wallet refunds never leave the database, so they can simply be completed
+	if payment.PaymentMethod == EWallet {
+		return p.completeRefund(payment, refund, reconcilerActor)
+	}
+
+	gw, err := p.gateways.ForPayment(payment)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Payment.GatewayTimeout)
+	defer cancel()
+
+	var result *gateway.Result
+	if refund.GatewayReference == "" {
+		result, err = p.lookupRefund(ctx, gw, payment, refund)
+	} else {
+		result, err = gw.Status(ctx, refund.GatewayReference)
+	}
+	if err != nil || result == nil {
+		return err
+	}
+	switch result.Outcome {
+	case gateway.Approved:
+		return p.completeRefund(payment, refund, reconcilerActor)
+	case gateway.Declined:
+		return p.markRefundFailed(payment, refund, result.Message)
+	}
+	return nil
+}
+
+// lookupRefund finds the transaction of a refund whose response never
+// arrived, by the reference it was sent with, and saves its transaction ID.
+// A refund that never reached the gateway is failed, returning nil, so its
+// amount becomes refundable again. If the gateway cannot look refunds up the
+// refund stays pending, since it may have been paid out: it must be resolved
+// with the provider by hand.
+func (p paymentService) lookupRefund(ctx context.Context, gw gateway.Gateway, payment *Payment, refund *Refund) (*gateway.Result, error) {
+	result, err := gw.Lookup(ctx, refundReference(refund))
+	switch {
+	case errors.Is(err, gateway.ErrTransactionNotFound):
+		return nil, p.markRefundFailed(payment, refund, "refund timed out and never reached the gateway")
+	case errors.Is(err, gateway.ErrUnsupported):
+		p.logger.Warn("Outcome of timed-out refund is unknown; check it with the provider", "paymentID", payment.ID, "refundID", refund.ID, "gateway", gw.Name())
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	refund.GatewayReference = result.TransactionID
+	if err := p.repository.UpdateRefund(refund); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunReconciler reconciles stale pending payments and refunds every interval
+// until ctx is cancelled.
+func RunReconciler(ctx context.Context, logger *slog.Logger, service PaymentService, interval time.Duration) {
+	runEvery(ctx, interval, func() {
+		if err := service.ReconcilePendingPayments(ctx); err != nil {
+			logger.Error("Error reconciling pending payments", "error", err)
+		}
+		if err := service.ReconcilePendingRefunds(ctx); err != nil {
+			logger.Error("Error reconciling pending refunds", "error", err)
+		}
+	})
+}
+
+// runEvery calls fn every interval until ctx is cancelled.
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/app/user"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxStatusConflictRetries bounds how often a status change is retried after
+// losing an optimistic-locking race with another request.
+const maxStatusConflictRetries = 3
+
+// CreateRefund refunds all or part of a captured payment through the gateway
+// that captured it. Several partial refunds may be made up to the captured
+// amount; each is stored as its own record. Refunds are issued by staff, so
+// any user's payment can be refunded.
+func (p paymentService) CreateRefund(c echo.Context) error {
+	payment, err := p.anyPaymentFromPath(c)
+	if err != nil || payment == nil {
+		return err
+	}
+
+	var request RefundRequestDto
+	if err := c.Bind(&request); err != nil {
+		p.logger.Error("Error parsing refund request body", "error", err)
+		return p.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return p.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	if payment.Purpose == PurposeWalletTopUp {
+		return p.handleError(c, errors.New("wallet top-ups cannot be refunded"), http.StatusUnprocessableEntity)
+	}
+
+	amount := payment.Refundable()
+	if request.Amount != "" {
+		if amount, err = money.Parse(request.Amount, payment.Amount.Currency); err != nil {
+			return p.handleValidationError(c, []common.FieldError{{Field: "amount", Message: err.Error()}})
+		}
+	}
+
+	actor := actorFromContext(c)
+	refund := &Refund{PaymentID: payment.ID, Amount: amount, Reason: request.Reason, RequestedBy: actor}
+	if payment, err = p.repository.CreateRefund(refund); err != nil {
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	status, err := p.processRefund(c.Request().Context(), payment, refund, actor)
+	if err != nil {
+		return p.handleError(c, err, status)
+	}
+
+	p.logger.Info("Refund processed", "paymentID", payment.ID, "refundID", refund.ID, "status", refund.Status)
+	return c.JSON(status, common.BaseResponse{
+		Status:  status,
+		Message: fmt.Sprintf("Refund %s", refund.Status),
+		Data:    refund,
+	})
+}
+
+// processRefund sends a pending refund to the payment's gateway, or to the
+// wallet for wallet payments, and applies the outcome. It returns the HTTP status describing the result.
+func (p paymentService) processRefund(ctx context.Context, payment *Payment, refund *Refund, actor string) (int, error) {
+	// Wallet payments are refunded straight back into the wallet
+	if payment.PaymentMethod == EWallet {
+		if err := p.completeRefund(payment, refund, actor); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusCreated, nil
+	}
+
+	gw, err := p.gateways.ForPayment(payment)
+	if err != nil {
+		return http.StatusUnprocessableEntity, p.failRefund(payment, refund, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Payment.GatewayTimeout)
+	defer cancel()
+
+	result, err := gw.Refund(ctx, payment.GatewayReference, refundReference(refund), refund.Amount)
+	switch {
+	case errors.Is(err, gateway.ErrTimeout):
+		// The gateway may still have paid the refund out, so it stays pending,
+		// holding its amount, until the reconciler looks it up by reference
+		p.logger.Warn("Gateway refund timed out", "paymentID", payment.ID, "refundID", refund.ID)
+		return http.StatusAccepted, nil
+	case errors.Is(err, gateway.ErrUnsupported):
+		return http.StatusUnprocessableEntity, p.failRefund(payment, refund, fmt.Sprintf("refunds are not supported for %s payments", payment.PaymentMethod))
+	case err != nil:
+		p.logger.Error("Error refunding payment", "paymentID", payment.ID, "refundID", refund.ID, "error", err)
+		return http.StatusBadGateway, p.failRefund(payment, refund, err.Error())
+	}
+
+	refund.GatewayReference = result.TransactionID
+	switch result.Outcome {
+	case gateway.Declined:
+		return http.StatusPaymentRequired, p.failRefund(payment, refund, result.Message)
+	case gateway.Pending:
+		return http.StatusAccepted, p.repository.UpdateRefund(refund)
+	}
+
+	if err := p.completeRefund(payment, refund, actor); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// completeRefund marks a refund as succeeded and moves the payment to
+// refunded or partially_refunded, retrying if the payment changes underneath.
+func (p paymentService) completeRefund(payment *Payment, refund *Refund, actor string) error {
+	for attempt := 1; ; attempt++ {
+		refunded := payment.RefundedAmount + refund.Amount.Amount
+		succeeded := *refund
+		succeeded.Status = RefundSucceeded
+		to := StatusPartiallyRefunded
+		if refunded >= payment.CapturedAmount {
+			to = StatusRefunded
+		}
+
+		err := p.changeStatus(payment, StatusChange{
+			To:      to,
+			Reason:  fmt.Sprintf("refund %d of %s", refund.ID, refund.Amount),
+			Actor:   actor,
+			Updates: map[string]interface{}{"refunded_amount": refunded},
+			Effects: []func(tx *gorm.DB) error{
+				markRefundSucceeded(refund),
+				refundEvent(payment.UserID, succeeded),
+			},
+		})
+		if err == nil {
+			payment.RefundedAmount = refunded
+			refund.Status = RefundSucceeded
+			return nil
+		}
+
+		var conflict *StatusConflictError
+		if !errors.As(err, &conflict) || attempt == maxStatusConflictRetries {
+			return err
+		}
+		if payment, err = p.repository.GetPaymentByID(payment.ID); err != nil {
+			return err
+		}
+	}
+}
+
+// refundReference is the reference sent to gateways for a refund.
+func refundReference(refund *Refund) string {
+	return fmt.Sprintf("REF-%d", refund.ID)
+}
+
+// failRefund records a refund of payment as failed and returns the reason as an error.
+func (p paymentService) failRefund(payment *Payment, refund *Refund, reason string) error {
+	if err := p.markRefundFailed(payment, refund, reason); err != nil {
+		return err
+	}
+	return errors.New(reason)
+}
+
+// markRefundFailed records a refund of payment as failed for reason.
+func (p paymentService) markRefundFailed(payment *Payment, refund *Refund, reason string) error {
+	refund.Status = RefundFailed
+	refund.FailureReason = reason
+	return p.repository.UpdateRefund(refund, refundEvent(payment.UserID, *refund))
+}
+
+// ListRefunds lists the refunds made against a payment. Users see the
+// refunds of their own payments; staff who may refund see those of any
+// payment.
+func (p paymentService) ListRefunds(c echo.Context) error {
+	var payment *Payment
+	var err error
+	if claims := middlewares.GetClaims(c); claims != nil && claims.HasPermission(user.PermPaymentsRefund) {
+		payment, err = p.anyPaymentFromPath(c)
+	} else {
+		payment, err = p.paymentFromPath(c)
+	}
+	if err != nil || payment == nil {
+		return err
+	}
+
+	refunds, err := p.repository.GetRefundsByPaymentID(payment.ID)
+	if err != nil {
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Refunds fetched successfully",
+		Data:    refunds,
+	})
+}
+
+// paymentFromPath loads the payment identified by the :id path parameter if it
+// belongs to the authenticated user. Payments of other users are reported as
+// not found. If it returns a nil payment the error response has already been
+// written and the returned error must be passed back to echo.
+func (p paymentService) paymentFromPath(c echo.Context) (*Payment, error) {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return nil, p.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		p.logger.Error("Error parsing ID", "error", err)
+		return nil, p.handleError(c, errors.New("invalid payment id"), http.StatusBadRequest)
+	}
+
+	payment, err := p.repository.GetUserPaymentByID(userID, uint(id))
+	if err != nil {
+		return nil, p.handleError(c, err, http.StatusInternalServerError)
+	}
+	if payment == nil {
+		return nil, p.handleError(c, errors.New("payment not found"), http.StatusNotFound)
+	}
+	return payment, nil
+}
+
+// anyPaymentFromPath loads the payment identified by the :id path parameter
+// whoever it belongs to, for staff operations. Like paymentFromPath, a nil
+// payment means the error response has already been written.
+func (p paymentService) anyPaymentFromPath(c echo.Context) (*Payment, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, p.handleError(c, errors.New("invalid payment id"), http.StatusBadRequest)
+	}
+
+	payment, err := p.repository.GetPaymentByID(uint(id))
+	if err != nil {
+		return nil, p.handleError(c, err, http.StatusInternalServerError)
+	}
+	if payment == nil {
+		return nil, p.handleError(c, errors.New("payment not found"), http.StatusNotFound)
+	}
+	return payment, nil
+}
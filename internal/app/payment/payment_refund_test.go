@@ -0,0 +1,220 @@
+package payment
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/money"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// refundRepository keeps one payment and its refunds in memory. It
+// implements only the methods refunds and their reconciliation use.
+type refundRepository struct {
+	PaymentRepository
+	payment *Payment
+	refunds []*Refund
+	changes []StatusChange
+}
+
+func (r *refundRepository) GetPaymentByID(id uint) (*Payment, error) {
+	if id != r.payment.ID {
+		return nil, nil
+	}
+	payment := *r.payment
+	return &payment, nil
+}
+
+func (r *refundRepository) CreateRefund(refund *Refund) (*Payment, error) {
+	refund.ID = uint(len(r.refunds) + 1)
+	refund.Status = RefundPending
+	saved := *refund
+	r.refunds = append(r.refunds, &saved)
+	return r.GetPaymentByID(refund.PaymentID)
+}
+
+func (r *refundRepository) UpdateRefund(refund *Refund, _ ...func(tx *gorm.DB) error) error {
+	saved := *refund
+	r.refunds[refund.ID-1] = &saved
+	return nil
+}
+
+func (r *refundRepository) UpdatePaymentStatus(payment *Payment, change StatusChange) error {
+	r.changes = append(r.changes, change)
+	r.payment.Status = change.To
+	return nil
+}
+
+func (r *refundRepository) GetStalePendingRefunds(_ time.Time, _ int) ([]Refund, error) {
+	var refunds []Refund
+	for _, refund := range r.refunds {
+		if refund.Status == RefundPending {
+			refunds = append(refunds, *refund)
+		}
+	}
+	return refunds, nil
+}
+
+// newRefundTest returns a service whose sandbox gateway captured 100.00 KES
+// for payment 1, and the sandbox itself.
+func newRefundTest(t *testing.T) (paymentService, *refundRepository, *gateway.Sandbox) {
+	t.Helper()
+	ctx := context.Background()
+	store := gateway.NewMemorySandboxStore()
+	sandbox := gateway.NewSandboxWithStore("sandbox", store)
+	auth, err := sandbox.Authorize(ctx, gateway.AuthorizeRequest{Reference: "PAY-1", Amount: money.Money{Amount: 10000, Currency: "KES"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sandbox.Capture(ctx, auth.TransactionID, money.Money{Amount: 10000, Currency: "KES"}); err != nil {
+		t.Fatal(err)
+	}
+
+	repository := &refundRepository{payment: &Payment{
+		ID:               1,
+		UserID:           7,
+		Amount:           money.Money{Amount: 10000, Currency: "KES"},
+		PaymentMethod:    CreditCard,
+		Status:           StatusCaptured,
+		CapturedAmount:   10000,
+		Gateway:          "sandbox",
+		GatewayReference: auth.TransactionID,
+	}}
+	service := paymentService{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		repository: repository,
+		gateways:   NewSandboxGatewayRegistry(store),
+		config:     config.Config{Payment: config.PaymentConfig{GatewayTimeout: 20 * time.Millisecond}},
+	}
+	return service, repository, sandbox
+}
+
+func createRefund(t *testing.T, service paymentService, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/1/refunds", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	c.Set("claims", &tokens.Claims{UserID: "2"})
+
+	if err := service.CreateRefund(c); err != nil {
+		t.Fatalf("CreateRefund() error = %v", err)
+	}
+	return rec
+}
+
+func TestRefundSucceeds(t *testing.T) {
+	service, repository, _ := newRefundTest(t)
+
+	rec := createRefund(t, service, `{"amount":"40.00","reason":"damaged"}`)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	if len(repository.changes) != 1 || repository.changes[0].To != StatusPartiallyRefunded {
+		t.Errorf("status changes = %+v, want one to %s", repository.changes, StatusPartiallyRefunded)
+	}
+	if refunded := repository.changes[0].Updates["refunded_amount"]; refunded != int64(4000) {
+		t.Errorf("refunded amount = %v, want 4000", refunded)
+	}
+	if repository.refunds[0].Amount.Amount != 4000 || repository.refunds[0].RequestedBy != "user:2" {
+		t.Errorf("refund = %+v, want 40.00 KES requested by user:2", repository.refunds[0])
+	}
+}
+
+func TestRefundTimeoutStaysPending(t *testing.T) {
+	service, repository, _ := newRefundTest(t)
+
+	// Amounts ending in .04 time out in the sandbox without reaching it
+	rec := createRefund(t, service, `{"amount":"10.04"}`)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	if refund := repository.refunds[0]; refund.Status != RefundPending || refund.GatewayReference != "" {
+		t.Errorf("refund = %s with reference %q, want pending without one", refund.Status, refund.GatewayReference)
+	}
+	if len(repository.changes) != 0 {
+		t.Errorf("payment changed status to %s, want it left alone", repository.changes[0].To)
+	}
+}
+
+func TestReconcileFailsRefundThatNeverReachedGateway(t *testing.T) {
+	service, repository, _ := newRefundTest(t)
+	createRefund(t, service, `{"amount":"10.04"}`)
+
+	if err := service.ReconcilePendingRefunds(context.Background()); err != nil {
+		t.Fatalf("ReconcilePendingRefunds() error = %v", err)
+	}
+
+	refund := repository.refunds[0]
+	if refund.Status != RefundFailed || !strings.Contains(refund.FailureReason, "never reached the gateway") {
+		t.Errorf("refund = %s %q, want failed as never sent", refund.Status, refund.FailureReason)
+	}
+	if len(repository.changes) != 0 {
+		t.Errorf("payment changed status to %s, want it left alone", repository.changes[0].To)
+	}
+}
+
+func TestReconcileCompletesRefundFoundByReference(t *testing.T) {
+	service, repository, sandbox := newRefundTest(t)
+	refund := &Refund{PaymentID: 1, Amount: money.Money{Amount: 3000, Currency: "KES"}}
+	if _, err := repository.CreateRefund(refund); err != nil {
+		t.Fatal(err)
+	}
+
+	// The gateway refunded it, but its response was lost
+	sent, err := sandbox.Refund(context.Background(), repository.payment.GatewayReference, refundReference(refund), refund.Amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ReconcilePendingRefunds(context.Background()); err != nil {
+		t.Fatalf("ReconcilePendingRefunds() error = %v", err)
+	}
+
+	if got := repository.refunds[0].GatewayReference; got != sent.TransactionID {
+		t.Errorf("refund gateway reference = %q, want %q", got, sent.TransactionID)
+	}
+	if len(repository.changes) != 1 || repository.changes[0].To != StatusPartiallyRefunded {
+		t.Errorf("status changes = %+v, want one to %s", repository.changes, StatusPartiallyRefunded)
+	}
+}
+
+// unsupportedLookup is a gateway that cannot look transactions up.
+type unsupportedLookup struct {
+	gateway.Gateway
+}
+
+func (unsupportedLookup) Lookup(context.Context, string) (*gateway.Result, error) {
+	return nil, gateway.ErrUnsupported
+}
+
+func TestReconcileLeavesRefundPendingWithoutLookup(t *testing.T) {
+	service, repository, sandbox := newRefundTest(t)
+	service.gateways = NewGatewayRegistry()
+	service.gateways.Register(CreditCard, unsupportedLookup{sandbox})
+	if _, err := repository.CreateRefund(&Refund{PaymentID: 1, Amount: money.Money{Amount: 3000, Currency: "KES"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ReconcilePendingRefunds(context.Background()); err != nil {
+		t.Fatalf("ReconcilePendingRefunds() error = %v", err)
+	}
+
+	if refund := repository.refunds[0]; refund.Status != RefundPending {
+		t.Errorf("refund = %s, want it left pending", refund.Status)
+	}
+}
@@ -4,15 +4,35 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log/slog"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/pkg/money"
+	"strings"
 	"time"
 )
 
 type PaymentRepository interface {
 	GetPaymentInfoByEmail(email string) (*Payment, error)
 	GetPaymentByID(id uint) (*Payment, error)
-	CreatePayment(payment *Payment) (*Payment, error)
-	GetPayments() ([]Payment, error)
+	GetUserPaymentByID(userID, paymentID uint) (*Payment, error)
+	CreatePayment(payment *Payment, duplicateWindow time.Duration, effects ...func(tx *gorm.DB) error) (*Payment, error)
+	ListPayments(filter PaymentFilter) ([]Payment, error)
+	UpdatePaymentStatus(payment *Payment, change StatusChange) error
+	SaveGatewayDetails(payment *Payment) error
+	ReleaseReviewHold(payment *Payment) error
+	CreateRefund(refund *Refund) (*Payment, error)
+	UpdateRefund(refund *Refund, effects ...func(tx *gorm.DB) error) error
+	GetRefundsByPaymentID(paymentID uint) ([]Refund, error)
+	CheckWalletFunds(userID uint, amount money.Money) error
+	GetPaymentByGatewayReference(gatewayName, reference string) (*Payment, error)
+	GetStalePendingPayments(createdBefore time.Time, limit int) ([]Payment, error)
+	GetExpiredAuthorizations(now time.Time, limit int) ([]Payment, error)
+	GetStalePendingRefunds(createdBefore time.Time, limit int) ([]Refund, error)
+	GetSettleablePayments(capturedBefore time.Time, limit int) ([]Payment, error)
+	ReserveIdempotencyKey(key *IdempotencyKey) (*IdempotencyKey, bool, error)
+	SaveIdempotencyResponse(key *IdempotencyKey) error
+	DeleteIdempotencyKey(key *IdempotencyKey) error
 }
 
 type paymentRepository struct {
@@ -22,41 +42,57 @@ type paymentRepository struct {
 
 //func (p paymentRepository) CreatePayment(payment *Payment) (*Payment, error) {
 //	if err := p.DB.Create(payment).Error; err != nil {
-//		p.logger.Error("Error creating payment", err)
+//		p.logger.Error("Error creating payment", "err", err)
 //		return nil, err
 //	}
 //	p.logger.Info("Payment created successfully", "paymentID", payment.ID)
 //	return payment, nil
 //}
 
-func (p paymentRepository) CreatePayment(payment *Payment) (*Payment, error) {
-	// Define the time range to check for recent payments
-	oneMinuteAgo := time.Now().Add(-1 * time.Minute)
-
-	// Log the time range being used for checking
-	p.logger.Info("Checking for duplicate payments within the last minute", "oneMinuteAgo", oneMinuteAgo)
-
-	// Query to check for existing payments with the same amount, phone number, and card number within the last minute
-	var existingPayment Payment
-	err := p.DB.Joins("JOIN payment_details ON payment_details.payment_id = payments.id").
-		Where("amount = ? AND payment_details.phone_number = ? AND payment_details.card_number = ? AND payments.created_at >= ?",
-			payment.Amount, payment.PaymentDetails.PhoneNumber, payment.PaymentDetails.CardNumber, oneMinuteAgo).
-		First(&existingPayment).Error
-
-	// Log the result of the query
-	if err == nil {
-		// A payment with the same criteria was found within the last minute
-		p.logger.Error("Duplicate payment detected", "amount", payment.Amount, "phone_number", payment.PaymentDetails.PhoneNumber, "card_number", payment.PaymentDetails.CardNumber)
-		return nil, fmt.Errorf("a payment with the amount %s, phone number %s, and card number %s has already been processed recently", payment.Amount, payment.PaymentDetails.PhoneNumber, payment.PaymentDetails.CardNumber)
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		// If there is an error other than "record not found", log and return the error
-		p.logger.Error("Error querying for existing payments", "error", err)
+// CreatePayment stores a new payment unless the same user made a payment
+// with the same DuplicateKey within duplicateWindow, in which case it returns
+// a *DuplicatePaymentError. Payments with the same key are created one at a
+// time under a transaction-scoped advisory lock, so concurrent identical
+// requests cannot both pass the check. The effects are applied in the same
+// transaction, e.g. to queue the payment for processing.
+func (p paymentRepository) CreatePayment(payment *Payment, duplicateWindow time.Duration, effects ...func(tx *gorm.DB) error) (*Payment, error) {
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if payment.DuplicateKey != "" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "payment:"+payment.DuplicateKey).Error; err != nil {
+				return err
+			}
+
+			var existing Payment
+			err := tx.Select("id").
+				Where("user_id = ? AND duplicate_key = ? AND created_at >= ?", payment.UserID, payment.DuplicateKey, time.Now().Add(-duplicateWindow)).
+				Order("created_at DESC").
+				First(&existing).Error
+			if err == nil {
+				return &DuplicatePaymentError{PaymentID: existing.ID, Window: duplicateWindow}
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		effects = append(effects, paymentEvent(payment, payment.Status, "", 0, 0))
+		for _, effect := range effects {
+			if err := effect(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var duplicate *DuplicatePaymentError
+	if errors.As(err, &duplicate) {
+		p.logger.Info("Duplicate payment rejected", "userID", payment.UserID, "duplicateOf", duplicate.PaymentID)
 		return nil, err
 	}
-
-	// Proceed with creating the new payment only if no similar payments were found
-	if err := p.DB.Create(payment).Error; err != nil {
-		p.logger.Error("Error creating payment", err)
+	if err != nil {
+		p.logger.Error("Error creating payment", "err", err)
 		return nil, err
 	}
 	p.logger.Info("Payment created successfully", "paymentID", payment.ID)
@@ -70,40 +106,399 @@ func (p paymentRepository) GetPaymentInfoByEmail(email string) (*Payment, error)
 			p.logger.Info("Payment not found", "email", email)
 			return nil, nil
 		}
-		p.logger.Error("Error fetching payment by email", err)
+		p.logger.Error("Error fetching payment by email", "err", err)
 		return nil, err
 	}
 	p.logger.Info("Payment fetched successfully", "paymentID", payment.ID)
 	return &payment, nil
 }
 
+// GetPaymentByID returns any payment regardless of owner. It is meant for
+// background work and provider callbacks; user requests go through
+// GetUserPaymentByID.
 func (p paymentRepository) GetPaymentByID(paymentID uint) (*Payment, error) {
+	return p.getPayment(p.DB.Where("id = ?", paymentID), paymentID)
+}
+
+// GetUserPaymentByID returns the payment only if it belongs to userID.
+func (p paymentRepository) GetUserPaymentByID(userID, paymentID uint) (*Payment, error) {
+	return p.getPayment(p.DB.Where("id = ? AND user_id = ?", paymentID, userID), paymentID)
+}
+
+func (p paymentRepository) getPayment(query *gorm.DB, paymentID uint) (*Payment, error) {
 	var payment Payment
 	// Use Preload to eagerly load related entities
-	if err := p.DB.Preload("PaymentDetails").
-		Where("id = ?", paymentID).
+	if err := query.Preload("PaymentDetails").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).
+		Preload("Refunds", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).
 		First(&payment).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			p.logger.Info("Payment not found", "paymentID", paymentID)
 			return nil, nil
 		}
-		p.logger.Error("Error fetching payment by ID", err)
+		p.logger.Error("Error fetching payment by ID", "err", err)
 		return nil, err
 	}
 	p.logger.Info("Payment fetched successfully", "paymentID", paymentID)
 	return &payment, nil
 }
 
-func (p paymentRepository) GetPayments() ([]Payment, error) {
-	var payments []Payment // Change to a slice to hold multiple payments
-	if err := p.DB.Find(&payments).Error; err != nil {
-		p.logger.Error("Error fetching payments", err)
+// ListPayments returns the payments matching filter in the order of
+// filter.Sort, starting after filter.After. Ties on the sort column are broken
+// by ID so that pages never overlap or skip payments.
+func (p paymentRepository) ListPayments(filter PaymentFilter) ([]Payment, error) {
+	query := p.DB.Model(&Payment{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Method != "" {
+		query = query.Where("payment_method = ?", filter.Method)
+	}
+	if filter.Currency != "" {
+		query = query.Where("currency = ?", filter.Currency)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	if filter.Query != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Query) + "%"
+		query = query.Where("reference ILIKE ? OR gateway_reference ILIKE ? OR receipt ILIKE ?", pattern, pattern, pattern)
+	}
+
+	column, direction, comparison := filter.Sort.column(), "ASC", ">"
+	if filter.Sort.descending() {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, comparison), filter.After.value(), filter.After.ID)
+	}
+
+	var payments []Payment
+	if err := query.
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(filter.Limit).
+		Find(&payments).Error; err != nil {
+		p.logger.Error("Error listing payments", "error", err)
+		return nil, err
+	}
+	return payments, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user-supplied search text.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// UpdatePaymentStatus applies change to payment and records the transition in
+// a single transaction, together with any extra column updates and effects.
+// The update only succeeds if the stored version still matches
+// payment.Version; otherwise a StatusConflictError is returned and nothing
+// is written.
+func (p paymentRepository) UpdatePaymentStatus(payment *Payment, change StatusChange) error {
+	transition := PaymentStatusTransition{
+		PaymentID:  payment.ID,
+		FromStatus: payment.Status,
+		ToStatus:   change.To,
+		Reason:     change.Reason,
+		Actor:      change.Actor,
+	}
+
+	updates := map[string]interface{}{
+		"status":  change.To,
+		"version": payment.Version + 1,
+	}
+	for column, value := range change.Updates {
+		updates[column] = value
+	}
+
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Payment{}).
+			Where("id = ? AND version = ?", payment.ID, payment.Version).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &StatusConflictError{PaymentID: payment.ID, Expected: payment.Status}
+		}
+		if err := tx.Create(&transition).Error; err != nil {
+			return err
+		}
+		for _, effect := range change.Effects {
+			if err := effect(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		p.logger.Error("Error updating payment status", "paymentID", payment.ID, "from", payment.Status, "to", change.To, "error", err)
+		return err
+	}
+
+	payment.Status = change.To
+	payment.Version++
+	payment.StatusHistory = append(payment.StatusHistory, transition)
+	p.logger.Info("Payment status updated", "paymentID", payment.ID, "from", transition.FromStatus, "to", change.To)
+	return nil
+}
+
+// CreateRefund stores a pending refund after checking, with the payment row
+// locked, that the payment is refundable and that the refund does not exceed
+// the captured amount less refunds already succeeded or in progress. It
+// returns the payment as read under the lock.
+func (p paymentRepository) CreateRefund(refund *Refund) (*Payment, error) {
+	var payment Payment
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("PaymentDetails").
+			First(&payment, refund.PaymentID).Error; err != nil {
+			return err
+		}
+
+		switch payment.Status {
+		case StatusCaptured, StatusSettled, StatusPartiallyRefunded:
+		default:
+			return &InvalidTransitionError{PaymentID: payment.ID, From: payment.Status, To: StatusRefunded}
+		}
+
+		var inProgress int64
+		if err := tx.Model(&Refund{}).
+			Where("payment_id = ? AND status = ?", payment.ID, RefundPending).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&inProgress).Error; err != nil {
+			return err
+		}
+
+		if available := payment.Refundable().Amount - inProgress; refund.Amount.Amount > available {
+			return &RefundExceedsCapturedError{Requested: refund.Amount, Available: money.Money{Amount: available, Currency: payment.Amount.Currency}}
+		}
+
+		refund.Status = RefundPending
+		if err := tx.Create(refund).Error; err != nil {
+			return err
+		}
+		return refundEvent(payment.UserID, *refund)(tx)
+	})
+	if err != nil {
+		p.logger.Error("Error creating refund", "paymentID", refund.PaymentID, "error", err)
+		return nil, err
+	}
+	p.logger.Info("Refund created", "paymentID", payment.ID, "refundID", refund.ID, "amount", refund.Amount.String())
+	return &payment, nil
+}
+
+// UpdateRefund stores the outcome of a refund together with any effects.
+func (p paymentRepository) UpdateRefund(refund *Refund, effects ...func(tx *gorm.DB) error) error {
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(refund).Updates(map[string]interface{}{
+			"status":            refund.Status,
+			"failure_reason":    refund.FailureReason,
+			"gateway_reference": refund.GatewayReference,
+		}).Error; err != nil {
+			return err
+		}
+		for _, effect := range effects {
+			if err := effect(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		p.logger.Error("Error updating refund", "refundID", refund.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// GetRefundsByPaymentID lists the refunds of a payment, oldest first.
+func (p paymentRepository) GetRefundsByPaymentID(paymentID uint) ([]Refund, error) {
+	var refunds []Refund
+	if err := p.DB.Where("payment_id = ?", paymentID).Order("created_at, id").Find(&refunds).Error; err != nil {
+		p.logger.Error("Error fetching refunds", "paymentID", paymentID, "error", err)
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// CheckWalletFunds returns wallet.ErrInsufficientFunds if the user's wallet
+// balance does not cover amount.
+func (p paymentRepository) CheckWalletFunds(userID uint, amount money.Money) error {
+	return wallet.CheckFunds(p.DB, userID, amount)
+}
+
+// SaveGatewayDetails stores the gateway that processed a payment, its transaction ID and receipt.
+func (p paymentRepository) SaveGatewayDetails(payment *Payment) error {
+	if err := p.DB.Model(&Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
+		"gateway":           payment.Gateway,
+		"gateway_reference": payment.GatewayReference,
+		"receipt":           payment.Receipt,
+	}).Error; err != nil {
+		p.logger.Error("Error saving gateway details", "paymentID", payment.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ReleaseReviewHold lets a payment held for risk review be captured.
+func (p paymentRepository) ReleaseReviewHold(payment *Payment) error {
+	if err := p.DB.Model(&Payment{}).Where("id = ?", payment.ID).Update("held_for_review", false).Error; err != nil {
+		p.logger.Error("Error releasing review hold", "paymentID", payment.ID, "error", err)
+		return err
+	}
+	payment.HeldForReview = false
+	return nil
+}
+
+// GetPaymentByGatewayReference finds the payment a gateway knows by the given transaction ID.
+func (p paymentRepository) GetPaymentByGatewayReference(gatewayName, reference string) (*Payment, error) {
+	var payment Payment
+	if err := p.DB.Preload("PaymentDetails").
+		Where("gateway = ? AND gateway_reference = ?", gatewayName, reference).
+		First(&payment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			p.logger.Info("Payment not found", "gateway", gatewayName, "gatewayReference", reference)
+			return nil, nil
+		}
+		p.logger.Error("Error fetching payment by gateway reference", "error", err)
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetStalePendingPayments returns pending payments known to a gateway that were created before the given time.
+func (p paymentRepository) GetStalePendingPayments(createdBefore time.Time, limit int) ([]Payment, error) {
+	var payments []Payment
+	if err := p.DB.Preload("PaymentDetails").
+		Where("status = ? AND gateway <> '' AND created_at < ?", StatusPending, createdBefore).
+		Order("created_at").
+		Limit(limit).
+		Find(&payments).Error; err != nil {
+		p.logger.Error("Error fetching stale pending payments", "error", err)
 		return nil, err
 	}
-	p.logger.Info("Payments fetched successfully", "count", len(payments))
 	return payments, nil
 }
 
+// GetStalePendingRefunds returns refunds created before createdBefore that
+// are still pending, oldest first.
+func (p paymentRepository) GetStalePendingRefunds(createdBefore time.Time, limit int) ([]Refund, error) {
+	var refunds []Refund
+	if err := p.DB.Where("status = ? AND created_at < ?", RefundPending, createdBefore).
+		Order("created_at").
+		Limit(limit).
+		Find(&refunds).Error; err != nil {
+		p.logger.Error("Error fetching stale pending refunds", "error", err)
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// GetExpiredAuthorizations returns authorized payments whose hold expired before now.
+func (p paymentRepository) GetExpiredAuthorizations(now time.Time, limit int) ([]Payment, error) {
+	var payments []Payment
+	if err := p.DB.
+		Where("status = ? AND authorization_expires_at < ?", StatusAuthorized, now).
+		Order("authorization_expires_at").
+		Limit(limit).
+		Find(&payments).Error; err != nil {
+		p.logger.Error("Error fetching expired authorizations", "error", err)
+		return nil, err
+	}
+	return payments, nil
+}
+
+// GetSettleablePayments returns captured payments captured before
+// capturedBefore, oldest first. Payments captured before capture times were
+// recorded count as captured at their last update.
+func (p paymentRepository) GetSettleablePayments(capturedBefore time.Time, limit int) ([]Payment, error) {
+	var payments []Payment
+	if err := p.DB.
+		Where("status = ? AND COALESCE(captured_at, updated_at) < ?", StatusCaptured, capturedBefore).
+		Order("id").
+		Limit(limit).
+		Find(&payments).Error; err != nil {
+		p.logger.Error("Error fetching settleable payments", "error", err)
+		return nil, err
+	}
+	return payments, nil
+}
+
+// ReserveIdempotencyKey inserts key unless a live key with the same user and
+// value already exists. It returns the stored key and whether it was created
+// by this call; expired keys are purged and replaced.
+func (p paymentRepository) ReserveIdempotencyKey(key *IdempotencyKey) (*IdempotencyKey, bool, error) {
+	var stored IdempotencyKey
+	created := false
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("user_id = ? AND key = ? AND expires_at <= ?", key.UserID, key.Key, time.Now()).
+			Delete(&IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			stored, created = *key, true
+			return nil
+		}
+
+		return tx.Where("user_id = ? AND key = ?", key.UserID, key.Key).First(&stored).Error
+	})
+	if err != nil {
+		p.logger.Error("Error reserving idempotency key", "error", err)
+		return nil, false, err
+	}
+	return &stored, created, nil
+}
+
+// SaveIdempotencyResponse stores the response recorded for a reserved key.
+func (p paymentRepository) SaveIdempotencyResponse(key *IdempotencyKey) error {
+	if err := p.DB.Model(key).Updates(map[string]interface{}{
+		"response_status":  key.ResponseStatus,
+		"response_body":    key.ResponseBody,
+		"response_content": key.ResponseContent,
+	}).Error; err != nil {
+		p.logger.Error("Error saving idempotency response", "error", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey releases a key so the request can be retried.
+func (p paymentRepository) DeleteIdempotencyKey(key *IdempotencyKey) error {
+	if err := p.DB.Unscoped().Delete(key).Error; err != nil {
+		p.logger.Error("Error deleting idempotency key", "error", err)
+		return err
+	}
+	return nil
+}
+
+// markRefundSucceeded is a StatusChange effect that records a refund's success
+// together with the payment's new refunded total.
+func markRefundSucceeded(refund *Refund) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Model(refund).Updates(map[string]interface{}{
+			"status":            RefundSucceeded,
+			"gateway_reference": refund.GatewayReference,
+		}).Error
+	}
+}
+
 func NewPaymentRepository(db *gorm.DB, logger *slog.Logger) PaymentRepository {
 	return paymentRepository{
 		DB:     db,
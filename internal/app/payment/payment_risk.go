@@ -0,0 +1,173 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/risk"
+	"mamlaka/internal/pkg/cards"
+	"mamlaka/internal/pkg/gateway"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ErrPaymentBlocked is returned for payments blocked by risk screening. It
+// deliberately does not say which rules matched.
+var ErrPaymentBlocked = errors.New("payment declined by risk screening")
+
+// screenPayment evaluates a payment about to be created with the risk rules.
+// Blocked attempts are saved at once, since no payment is created for them;
+// other decisions are returned to be saved with the payment. Card payments
+// held for review are authorized but not captured until an admin approves
+// them. Payments are not screened when the service has no risk engine.
+func (p paymentService) screenPayment(c echo.Context, payment *Payment, details PaymentDetailsDto) (*risk.Decision, error) {
+	if p.risk == nil {
+		return nil, nil
+	}
+
+	attempt := risk.Attempt{
+		UserID:        payment.UserID,
+		Amount:        payment.Amount,
+		PaymentMethod: string(payment.PaymentMethod),
+		PhoneNumber:   payment.PaymentDetails.PhoneNumber,
+		Email:         payment.PaymentDetails.Email,
+		IP:            c.RealIP(),
+		Country:       details.Country,
+	}
+	if header := p.config.Risk.CountryHeader; header != "" {
+		attempt.IPCountry = c.Request().Header.Get(header)
+	}
+	if payment.PaymentMethod == CreditCard {
+		number := cards.Normalize(details.CardNumber)
+		attempt.CardFingerprint = p.vault.Fingerprint(number)
+		attempt.CardBIN = number[:6] // Validated card numbers have at least 13 digits
+	}
+
+	decision, err := p.risk.Evaluate(attempt)
+	if err != nil {
+		return nil, err
+	}
+	switch decision.Outcome {
+	case risk.OutcomeBlock:
+		if err := p.risk.Save(decision); err != nil {
+			return nil, err
+		}
+	case risk.OutcomeReview:
+		if payment.PaymentMethod == CreditCard {
+			payment.HeldForReview = true
+			decision.Held = true
+		}
+	}
+	return decision, nil
+}
+
+// recordDecision returns the effect saving the risk decision that let
+// payment through, once the payment has an ID.
+func recordDecision(payment *Payment, decision *risk.Decision) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		decision.PaymentID = &payment.ID
+		return risk.Record(tx, decision)
+	}
+}
+
+// ReviewPayment records an admin's review of a payment that risk screening
+// flagged. Approving a held payment captures it, unless the payer chose to
+// capture it themselves; rejecting it voids the authorization. Payments that
+// could not be held were processed as usual, so reviewing them only records
+// the outcome.
+func (p paymentService) ReviewPayment(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return p.handleError(c, errors.New("invalid payment id"), http.StatusBadRequest)
+	}
+
+	var request ReviewRequestDto
+	if err := c.Bind(&request); err != nil {
+		return p.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return p.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	payment, err := p.repository.GetPaymentByID(uint(id))
+	if err != nil {
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+	if payment == nil {
+		return p.handleError(c, errors.New("payment not found"), http.StatusNotFound)
+	}
+
+	if p.risk == nil {
+		return p.handleError(c, errors.New("payment is not awaiting risk review"), http.StatusConflict)
+	}
+	decision, err := p.risk.DecisionForPayment(payment.ID)
+	if err != nil {
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+	if decision == nil || decision.ReviewStatus != risk.ReviewPending {
+		return p.handleError(c, errors.New("payment is not awaiting risk review"), http.StatusConflict)
+	}
+
+	approved := request.Decision == "approve"
+	actor := actorFromContext(c)
+	if payment.HeldForReview {
+		if payment.Status == StatusPending {
+			return p.handleError(c, errors.New("payment is still being authorized; review it once it is authorized"), http.StatusConflict)
+		}
+		if err := p.resolveHold(c.Request().Context(), payment, approved, actor); err != nil {
+			var declined *DeclinedError
+			if errors.As(err, &declined) {
+				return p.handleError(c, err, http.StatusPaymentRequired)
+			}
+			return p.handleError(c, err, http.StatusBadGateway)
+		}
+	}
+
+	if err := p.risk.ResolveReview(decision, approved, actor, request.Note); err != nil {
+		if errors.Is(err, risk.ErrReviewResolved) {
+			return p.handleError(c, err, http.StatusConflict)
+		}
+		return p.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	p.logger.Info("Payment risk review resolved", "paymentID", payment.ID, "decision", request.Decision, "actor", actor)
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Payment review recorded",
+		Data:    payment,
+	})
+}
+
+// resolveHold releases or voids an authorized payment held for review.
+// Payments that already left the authorized status, e.g. because their
+// authorization expired, are left as they are.
+func (p paymentService) resolveHold(ctx context.Context, payment *Payment, approved bool, actor string) error {
+	if !approved {
+		if payment.Status != StatusAuthorized {
+			return nil
+		}
+		err := p.voidAuthorization(ctx, payment, "rejected in risk review", actor)
+		if errors.Is(err, gateway.ErrUnsupported) {
+			err = p.transition(payment, StatusCancelled, "rejected in risk review", actor)
+		}
+		return err
+	}
+
+	if err := p.repository.ReleaseReviewHold(payment); err != nil {
+		return err
+	}
+	if payment.Status != StatusAuthorized || !payment.capturesOnAuthorization() {
+		return nil
+	}
+
+	gw, err := p.gateways.ForPayment(payment)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.config.Payment.GatewayTimeout)
+	defer cancel()
+	return p.capturePayment(ctx, gw, payment, payment.Amount, actor)
+}
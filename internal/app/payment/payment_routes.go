@@ -1,17 +1,43 @@
 package payment
 
 import (
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 	"log/slog"
+	"mamlaka/config"
 	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/app/risk"
+	"mamlaka/internal/app/user"
+	"mamlaka/internal/app/vault"
+	"mamlaka/internal/pkg/pubsub"
 )
 
-func RegisterPaymentRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB) {
+func RegisterPaymentRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB, conf config.Config, events *pubsub.Broker, riskEngine *risk.Engine) {
+	cardVault, err := vault.NewVaultService(logger, vault.NewVaultRepository(db, logger), conf.Vault)
+	if err != nil {
+		panic(fmt.Sprintf("cannot initialise card vault: %s", err))
+	}
+
+	if err := ValidateDuplicateRules(conf.Payment.DuplicateRules); err != nil {
+		panic(fmt.Sprintf("invalid payment configuration: %s", err))
+	}
+
+	gateways, err := NewGatewayRegistryFromConfig(conf, db)
+	if err != nil {
+		panic(fmt.Sprintf("cannot configure payment gateways: %s", err))
+	}
+
 	paymentRepository := NewPaymentRepository(db, logger)
-	paymentService := NewPaymentService(logger, paymentRepository)
+	paymentService := NewPaymentService(logger, paymentRepository, gateways, cardVault, conf, events, riskEngine)
 	paymentHandler := NewPaymentHandler(logger, paymentService)
 
+	// Provider callbacks are authenticated by the provider, not by a user token
+	e.POST("/payments/mpesa/callback", paymentHandler.MpesaCallback)
+
+	// WebSocket clients may authenticate with a subprotocol instead of the Authorization header
+	e.GET("/payments/stream", paymentHandler.StreamPayments, middlewares.WebSocketJWTMiddleware)
+
 	payment := e.Group("/payments")
 	{
 		payment.Use(middlewares.JWTMiddleware)
@@ -19,5 +45,17 @@ func RegisterPaymentRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB) {
 		payment.POST("/payment", paymentHandler.MakePayment)
 		payment.GET("/:id", paymentHandler.GetPaymentDetail)
 		payment.GET("/transactions", paymentHandler.Transactions)
+		payment.POST("/:id/capture", paymentHandler.CapturePayment)
+		payment.POST("/:id/void", paymentHandler.VoidPayment)
+		payment.GET("/:id/refunds", paymentHandler.ListRefunds)
+		payment.POST("/:id/refunds", paymentHandler.CreateRefund, middlewares.RequirePermission(user.PermPaymentsRefund))
+	}
+
+	admin := e.Group("/admin/payments")
+	{
+		admin.Use(middlewares.JWTMiddleware)
+
+		admin.GET("", paymentHandler.AllTransactions, middlewares.RequirePermission(user.PermPaymentsReadAll))
+		admin.POST("/:id/review", paymentHandler.ReviewPayment, middlewares.RequirePermission(user.PermPaymentsReview))
 	}
 }
@@ -1,14 +1,27 @@
 package payment
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"mamlaka/config"
 	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/ledger"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/app/risk"
+	"mamlaka/internal/app/vault"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/pkg/cards"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/jobs"
+	"mamlaka/internal/pkg/money"
+	"mamlaka/internal/pkg/pubsub"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // PaymentService defines the methods available in the payment service.
@@ -16,12 +29,30 @@ type PaymentService interface {
 	MakePayment(c echo.Context) error
 	GetPaymentDetail(c echo.Context) error
 	GetAllTransactions(c echo.Context) error
+	GetAllPayments(c echo.Context) error
+	MpesaCallback(c echo.Context) error
+	CreateRefund(c echo.Context) error
+	ListRefunds(c echo.Context) error
+	CapturePayment(c echo.Context) error
+	VoidPayment(c echo.Context) error
+	StreamPayments(c echo.Context) error
+	ReviewPayment(c echo.Context) error
+	ProcessPayment(ctx context.Context, job *jobs.Job) error
+	ReconcilePendingPayments(ctx context.Context) error
+	ReconcilePendingRefunds(ctx context.Context) error
+	ExpireAuthorizations(ctx context.Context) error
+	SettlePayments(ctx context.Context) error
 }
 
 // paymentService is the implementation of PaymentService.
 type paymentService struct {
 	logger     *slog.Logger
 	repository PaymentRepository
+	gateways   *GatewayRegistry
+	vault      vault.VaultService
+	config     config.Config
+	events     *pubsub.Broker // Payment streams subscribe here to status changes relayed from Postgres
+	risk       *risk.Engine   // Screens new payments; nil where no payments are made, e.g. in the worker
 }
 
 // isValidPaymentMethod checks if the given payment method is valid.
@@ -36,143 +67,404 @@ func isValidPaymentMethod(method PaymentMethod) bool {
 	return exists
 }
 
-// MakePayment handles payment requests
+// MakePayment handles payment requests. Requests carrying an Idempotency-Key
+// header are processed at most once per key.
 func (p paymentService) MakePayment(c echo.Context) error {
+	return p.withIdempotency(c, p.makePayment)
+}
+
+// makePayment validates, processes and stores a single payment request
+func (p paymentService) makePayment(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return p.handleError(c, err, http.StatusUnauthorized)
+	}
+
 	var makePaymentRequest PaymentRequestDto
 	if err := c.Bind(&makePaymentRequest); err != nil {
-		p.logger.Error("Error parsing payment request body", err)
+		p.logger.Error("Error parsing payment request body", "err", err)
 		return p.handleError(c, err, http.StatusBadRequest)
 	}
 
 	// Validate the incoming payment request
 	if err := common.ValidateModel(makePaymentRequest); err != nil {
-		p.logger.Error("Invalid payment request body", err)
-		return p.handleError(c, err, http.StatusBadRequest)
+		p.logger.Error("Invalid payment request body", "err", err)
+		return p.handleValidationError(c, common.FieldErrors(err))
 	}
 
 	// Convert payment method and validate
 	paymentMethod := PaymentMethod(makePaymentRequest.PaymentMethod)
 	if !isValidPaymentMethod(paymentMethod) { // Implement isValidPaymentMethod function
 		err := fmt.Errorf("invalid payment method: %s", makePaymentRequest.PaymentMethod)
-		p.logger.Error("Invalid payment method", err)
+		p.logger.Error("Invalid payment method", "err", err)
 		return p.handleError(c, err, http.StatusBadRequest)
 	}
 
+	// Manual capture holds the funds until the payment is captured or voided
+	captureMethod := CaptureAutomatic
+	if makePaymentRequest.CaptureMethod != "" {
+		captureMethod = CaptureMethod(makePaymentRequest.CaptureMethod)
+	}
+	if captureMethod == CaptureManual && paymentMethod == Mpesa {
+		return p.handleValidationError(c, []common.FieldError{{Field: "capture_method", Message: "M-Pesa payments are always captured automatically"}})
+	}
+	if captureMethod == CaptureManual && paymentMethod == EWallet {
+		return p.handleValidationError(c, []common.FieldError{{Field: "capture_method", Message: "wallet payments are always captured automatically"}})
+	}
+
+	// Top-ups fund the payer's wallet and so cannot be paid from it
+	purpose := PurposePurchase
+	if makePaymentRequest.Purpose != "" {
+		purpose = PaymentPurpose(makePaymentRequest.Purpose)
+	}
+	if purpose == PurposeWalletTopUp && paymentMethod == EWallet {
+		return p.handleValidationError(c, []common.FieldError{{Field: "payment_method", Message: "wallet top-ups must be paid by card or M-Pesa"}})
+	}
+
+	// Parse the amount into minor units of the requested currency
+	amount, err := makePaymentRequest.Money()
+	if err != nil {
+		p.logger.Error("Invalid payment amount", "amount", makePaymentRequest.Amount, "currency", makePaymentRequest.Currency, "error", err)
+		return p.handleValidationError(c, []common.FieldError{{Field: "amount", Message: err.Error()}})
+	}
+
+	// Card payments need a valid card number, expiry and CVV for the detected brand
+	if paymentMethod == CreditCard {
+		details := makePaymentRequest.PaymentDetails
+		if _, cardErrors := cards.Validate(details.CardNumber, details.ExpiryDate, details.CVV, time.Now()); len(cardErrors) > 0 {
+			fields := make([]common.FieldError, 0, len(cardErrors))
+			for _, fe := range cardErrors {
+				fields = append(fields, common.FieldError{Field: "payment_details." + fe.Field, Message: fe.Message})
+			}
+			p.logger.Info("Invalid card details", "fields", len(fields))
+			return p.handleValidationError(c, fields)
+		}
+	}
+
+	// Wallet payments are debited by the worker, but a balance that cannot
+	// cover the amount is refused now rather than failing the payment later
+	if paymentMethod == EWallet {
+		if err := p.repository.CheckWalletFunds(userID, amount); err != nil {
+			if errors.Is(err, wallet.ErrInsufficientFunds) {
+				p.logger.Info("Insufficient wallet funds", "userID", userID, "error", err)
+				return p.handleError(c, err, http.StatusPaymentRequired)
+			}
+			p.logger.Error("Error checking wallet funds", "error", err)
+			return p.handleError(c, err, http.StatusInternalServerError)
+		}
+	}
+
 	// Create and populate the Payment struct
 	payment := &Payment{ // Use a pointer here
-		Amount:        makePaymentRequest.Amount,
-		Currency:      makePaymentRequest.Currency,
+		UserID:        userID,
+		Reference:     makePaymentRequest.Reference,
+		Purpose:       purpose,
+		Amount:        amount,
 		PaymentMethod: paymentMethod,
+		CaptureMethod: captureMethod,
 		PaymentDetails: PaymentDetails{
-			CardNumber:  makePaymentRequest.PaymentDetails.CardNumber,
-			ExpiryDate:  makePaymentRequest.PaymentDetails.ExpiryDate,
-			CVV:         makePaymentRequest.PaymentDetails.CVV,
 			PhoneNumber: makePaymentRequest.PaymentDetails.PhoneNumber,
 			Email:       makePaymentRequest.PaymentDetails.Email,
 		},
 	}
 
-	// Simulate payment processing
-	response, err := p.ProcessPayment(payment) // Pass pointer to ProcessPayment
+	// Screen the payment before anything is stored or sent to a gateway
+	decision, err := p.screenPayment(c, payment, makePaymentRequest.PaymentDetails)
 	if err != nil {
-		p.logger.Error("Error processing payment", err)
-		return p.handleError(c, err, http.StatusInternalServerError)
+		p.logger.Error("Error screening payment", "error", err)
+		return p.handleError(c, errors.New("payment could not be screened"), http.StatusInternalServerError)
+	}
+	if decision != nil && decision.Outcome == risk.OutcomeBlock {
+		p.logger.Warn("Payment blocked by risk screening", "userID", userID, "decisionID", decision.ID, "score", decision.Score)
+		return p.handleError(c, ErrPaymentBlocked, http.StatusForbidden)
 	}
 
-	// Save the payment to the database
-	if _, err := p.repository.CreatePayment(payment); err != nil { // Pass pointer to CreatePayment
-		p.logger.Error("Error creating payment", err)
+	// Exchange the card number for a vault token. Only the token, brand, last
+	// four digits and expiry are stored with the payment. The CVV is stashed
+	// in the vault until the worker authorizes the payment, and deleted then.
+	var job ProcessPaymentJob
+	if details := makePaymentRequest.PaymentDetails; paymentMethod == CreditCard {
+		vaulted, err := p.vault.Tokenize(details.CardNumber, details.ExpiryDate)
+		if err != nil {
+			p.logger.Error("Error tokenizing card", "error", err)
+			return p.handleError(c, errors.New("card could not be stored securely"), http.StatusInternalServerError)
+		}
+		payment.PaymentDetails.CardToken = vaulted.Token
+		payment.PaymentDetails.CardFingerprint = vaulted.Fingerprint
+		payment.PaymentDetails.CardBrand = vaulted.Brand
+		payment.PaymentDetails.CardLast4 = vaulted.Last4
+		payment.PaymentDetails.CardExpiry = vaulted.ExpiryDate
+
+		if job.CVVHandle, err = p.vault.StashCVV(details.CVV, p.config.Payment.CVVRetention); err != nil {
+			p.logger.Error("Error stashing CVV", "error", err)
+			return p.handleError(c, errors.New("card could not be stored securely"), http.StatusInternalServerError)
+		}
+	}
+
+	// Save the payment as pending and queue it for processing in the same
+	// transaction; the worker authorizes and captures it with its gateway
+	actor := actorFromContext(c)
+	job.Actor = actor
+	payment.Status = StatusPending
+	payment.Version = 1
+	payment.StatusHistory = []PaymentStatusTransition{{ToStatus: StatusPending, Reason: "payment created", Actor: actor}}
+	effects := []func(tx *gorm.DB) error{enqueueProcessing(payment, job)}
+	if decision != nil {
+		effects = append(effects, recordDecision(payment, decision))
+	}
+	rule := p.config.Payment.DuplicateRules[string(paymentMethod)]
+	payment.DuplicateKey = duplicateKey(payment, rule)
+	if _, err := p.repository.CreatePayment(payment, rule.Window, effects...); err != nil { // Pass pointer to CreatePayment
+		p.logger.Error("Error creating payment", "err", err)
+		// The worker will never take the CVV of a payment that was not created
+		if job.CVVHandle != "" {
+			if _, cvvErr := p.vault.TakeCVV(job.CVVHandle); cvvErr != nil {
+				p.logger.Warn("Error discarding stashed CVV", "error", cvvErr)
+			}
+		}
 		return p.handleError(c, err, http.StatusInternalServerError)
 	}
 
-	// Log success and return the response
-	p.logger.Info("Payment successful")
-	return c.JSON(http.StatusOK, response) // Return the PaymentResponseDto
+	p.logger.Info("Payment accepted for processing", "paymentID", payment.ID)
+	return c.JSON(http.StatusAccepted, PaymentResponseDto{
+		PaymentID: payment.ID,
+		Status:    string(payment.Status),
+		Message:   "Payment accepted for processing",
+	})
 }
 
-// ProcessPayment simulates payment processing
-func (p paymentService) ProcessPayment(payment *Payment) (*PaymentResponseDto, error) {
-	// Simulate processing delay
-	time.Sleep(2 * time.Second)
-
-	// Here you would integrate with an actual payment gateway
-	// For example purposes, we're just returning a simulated response
+// processPayment authorizes the payment with the gateway registered for its
+// payment method and captures it, moving it through the state machine as the
+// gateway responds. A timed-out or pending authorization leaves the payment
+// pending so the reconciler can resolve it later: from the transaction's
+// status, or for timeouts by looking the authorization up by our reference.
+func (p paymentService) processPayment(ctx context.Context, payment *Payment, card *gateway.Card, actor string) error {
+	if payment.PaymentMethod == EWallet {
+		return p.processWalletPayment(payment, actor)
+	}
 
-	// Check if payment amount is valid
-	if payment.Amount == "" || payment.Currency == "" {
-		return nil, fmt.Errorf("invalid payment details")
+	gw, err := p.gateways.Get(payment.PaymentMethod)
+	if err != nil {
+		return err
 	}
 
-	// Generate a simulated transaction ID
-	transactionID := fmt.Sprintf("TXN-%d", time.Now().UnixNano())
+	ctx, cancel := context.WithTimeout(ctx, p.config.Payment.GatewayTimeout)
+	defer cancel()
 
-	// Create a simulated response
-	response := &PaymentResponseDto{
-		TransactionID: transactionID,
-		Status:        "Success",
-		Message:       "Payment processed successfully",
+	result, err := gw.Authorize(ctx, gateway.AuthorizeRequest{
+		Reference:   paymentReference(payment),
+		Amount:      payment.Amount,
+		Card:        card,
+		PhoneNumber: payment.PaymentDetails.PhoneNumber,
+		Email:       payment.PaymentDetails.Email,
+	})
+	if errors.Is(err, gateway.ErrTimeout) {
+		p.logger.Warn("Gateway authorization timed out", "paymentID", payment.ID, "gateway", gw.Name())
+		// Recording the gateway without a transaction ID hands the payment to the reconciler
+		payment.Gateway = gw.Name()
+		return p.repository.SaveGatewayDetails(payment)
+	}
+	if err != nil {
+		p.logger.Error("Error authorizing payment", "paymentID", payment.ID, "gateway", gw.Name(), "error", err)
+		if tErr := p.transition(payment, StatusFailed, err.Error(), actor); tErr != nil {
+			return tErr
+		}
+		return err
 	}
 
-	return response, nil
+	payment.Gateway = gw.Name()
+	payment.GatewayReference = result.TransactionID
+	if err := p.repository.SaveGatewayDetails(payment); err != nil {
+		return err
+	}
+
+	if err := p.applyAuthorization(payment, result, actor); err != nil || payment.Status != StatusAuthorized {
+		return err
+	}
+	if !payment.capturesOnAuthorization() {
+		return nil
+	}
+	return p.capturePayment(ctx, gw, payment, payment.Amount, actor)
 }
 
-// GetPaymentDetail is a helper function for creating error responses.
-func (p paymentService) GetPaymentDetail(c echo.Context) error {
+// applyAuthorization moves a pending payment according to the gateway's
+// answer to its authorization. Approved authorizations are held until the
+// configured authorization TTL runs out.
+func (p paymentService) applyAuthorization(payment *Payment, result *gateway.Result, actor string) error {
+	switch result.Outcome {
+	case gateway.Approved:
+		expiresAt := time.Now().Add(p.config.Payment.AuthorizationTTL)
+		err := p.changeStatus(payment, StatusChange{
+			To:      StatusAuthorized,
+			Reason:  result.Message,
+			Actor:   actor,
+			Updates: map[string]interface{}{"authorization_expires_at": expiresAt},
+		})
+		if err == nil {
+			payment.AuthorizationExpiresAt = &expiresAt
+		}
+		return err
+	case gateway.Declined:
+		if err := p.transition(payment, StatusFailed, result.Message, actor); err != nil {
+			return err
+		}
+		return &DeclinedError{Code: result.Code, Message: result.Message}
+	default:
+		p.logger.Info("Gateway authorization pending", "paymentID", payment.ID, "code", result.Code)
+		return nil
+	}
+}
 
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32) // Assuming you want a 32-bit unsigned integer
+// capturePayment captures amount, at most the authorized amount, of a payment.
+func (p paymentService) capturePayment(ctx context.Context, gw gateway.Gateway, payment *Payment, amount money.Money, actor string) error {
+	result, err := gw.Capture(ctx, payment.GatewayReference, amount)
 	if err != nil {
-		p.logger.Error("Error parsing ID", err)
-		return p.handleError(c, err, http.StatusBadRequest)
+		p.logger.Error("Error capturing payment", "paymentID", payment.ID, "gateway", gw.Name(), "error", err)
+		return err
 	}
 
-	// Convert id to uint
-	uintID := uint(id)
+	switch result.Outcome {
+	case gateway.Approved:
+		return p.changeStatus(payment, StatusChange{
+			To:      StatusCaptured,
+			Reason:  result.Message,
+			Actor:   actor,
+			Updates: map[string]interface{}{"captured_amount": amount.Amount},
+		})
+	case gateway.Declined:
+		if err := p.transition(payment, StatusFailed, result.Message, actor); err != nil {
+			return err
+		}
+		return &DeclinedError{Code: result.Code, Message: result.Message}
+	default:
+		p.logger.Info("Gateway capture pending", "paymentID", payment.ID, "code", result.Code)
+		return nil
+	}
+}
 
-	// Retrieve all payments from the repository
-	payment, err := p.repository.GetPaymentByID(uintID)
-	if err != nil {
-		p.logger.Error("Error fetching payments", err)
-		return p.handleError(c, err, http.StatusInternalServerError)
+// paymentReference is the reference sent to gateways for a payment.
+func paymentReference(payment *Payment) string {
+	return fmt.Sprintf("PAY-%d", payment.ID)
+}
+
+// transition moves payment to the given status if the state machine allows it,
+// recording who made the change and why.
+func (p paymentService) transition(payment *Payment, to PaymentStatus, reason, actor string) error {
+	return p.changeStatus(payment, StatusChange{To: to, Reason: reason, Actor: actor})
+}
+
+// changeStatus applies a status change if the state machine allows it.
+// Capturing a payment records when it was captured, and the captured amount
+// unless the change sets it.
+// Changes that move money are posted to the ledger in the same transaction,
+// and every change emits a webhook event and is published to payment
+// streams once committed.
+func (p paymentService) changeStatus(payment *Payment, change StatusChange) error {
+	if !payment.Status.CanTransitionTo(change.To) {
+		err := &InvalidTransitionError{PaymentID: payment.ID, From: payment.Status, To: change.To}
+		p.logger.Error("Rejected payment status transition", "error", err)
+		return err
 	}
 
-	p.logger.Info("Payment detail fetched successful")
-	return c.JSON(http.StatusOK, common.BaseResponse{
-		Status:  http.StatusOK,
-		Message: "Payment detail fetched successful",
-		Data:    payment,
-	})
+	captured := payment.CapturedAmount
+	if change.To == StatusCaptured {
+		if change.Updates == nil {
+			change.Updates = map[string]interface{}{}
+		}
+		change.Updates["captured_at"] = time.Now()
+		if amount, ok := change.Updates["captured_amount"].(int64); ok {
+			captured = amount
+		} else {
+			captured = payment.Amount.Amount
+			change.Updates["captured_amount"] = captured
+		}
+	}
+
+	refunded := payment.RefundedAmount
+	if amount, ok := change.Updates["refunded_amount"].(int64); ok {
+		refunded = amount
+	}
+	if effect := walletEffect(payment, change.To, captured, refunded); effect != nil {
+		change.Effects = append(change.Effects, effect)
+	}
+	if entry := p.ledgerEntry(payment, change.To, captured, refunded); entry != nil {
+		change.Effects = append(change.Effects, func(tx *gorm.DB) error {
+			_, err := ledger.Post(tx, *entry)
+			return err
+		})
+	}
+	change.Effects = append(change.Effects,
+		paymentEvent(payment, change.To, change.Reason, captured, refunded),
+		publishUpdate(payment, change.To, change.Reason, captured, refunded),
+	)
+
+	if err := p.repository.UpdatePaymentStatus(payment, change); err != nil {
+		return err
+	}
+	payment.CapturedAmount = captured
+	return nil
 }
 
-// GetAllTransactions handles payment payment requests
-func (p paymentService) GetAllTransactions(c echo.Context) error {
-	// Retrieve all payments from the repository
-	payments, err := p.repository.GetPayments()
-	if err != nil {
-		p.logger.Error("Error fetching payments", err)
-		return p.handleError(c, err, http.StatusInternalServerError)
+// actorFromContext identifies who is acting on a payment for the status history.
+func actorFromContext(c echo.Context) string {
+	if claims := middlewares.GetClaims(c); claims != nil {
+		return "user:" + claims.UserID
 	}
+	return "system"
+}
 
-	// Log the successful retrieval of payments
-	p.logger.Info("Payments fetched successfully", "count", len(payments))
+// GetPaymentDetail returns a payment owned by the authenticated user.
+func (p paymentService) GetPaymentDetail(c echo.Context) error {
+	payment, err := p.paymentFromPath(c)
+	if err != nil || payment == nil {
+		return err
+	}
 
-	// Return a successful response with the fetched payments
+	p.logger.Info("Payment detail fetched successful", "paymentID", payment.ID)
 	return c.JSON(http.StatusOK, common.BaseResponse{
 		Status:  http.StatusOK,
-		Message: "Payments fetched successfully",
-		Data:    payments, // Include the payments in the response data
+		Message: "Payment detail fetched successful",
+		Data:    payment,
 	})
 }
 
 // handleError is a helper function for creating error responses.
 func (p paymentService) handleError(c echo.Context, err error, status int) error {
+	var invalidTransition *InvalidTransitionError
+	var statusConflict *StatusConflictError
+	var refundExceeds *RefundExceedsCapturedError
+	var duplicate *DuplicatePaymentError
+	var code string
+	switch {
+	case errors.As(err, &invalidTransition), errors.As(err, &statusConflict):
+		status = http.StatusConflict
+	case errors.As(err, &refundExceeds):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, wallet.ErrInsufficientFunds):
+		status, code = http.StatusPaymentRequired, common.CodeInsufficientFunds
+	case errors.As(err, &duplicate):
+		status, code = http.StatusConflict, common.CodeDuplicatePayment
+	case errors.Is(err, ErrPaymentBlocked):
+		status, code = http.StatusForbidden, common.CodePaymentBlocked
+	}
+
 	return c.JSON(status, common.ErrorResponse{
 		Status: status,
+		Code:   code,
 		Error:  err.Error(),
 	})
 }
 
+// handleValidationError responds with 400 and one entry per invalid field.
+func (p paymentService) handleValidationError(c echo.Context, fields []common.FieldError) error {
+	return c.JSON(http.StatusBadRequest, common.ErrorResponse{
+		Status: http.StatusBadRequest,
+		Error:  "request validation failed",
+		Fields: fields,
+	})
+}
+
 // NewPaymentService creates a new instance of paymentService.
-func NewPaymentService(logger *slog.Logger, repository PaymentRepository) PaymentService {
-	return paymentService{logger: logger, repository: repository}
+func NewPaymentService(logger *slog.Logger, repository PaymentRepository, gateways *GatewayRegistry, cardVault vault.VaultService, conf config.Config, events *pubsub.Broker, riskEngine *risk.Engine) PaymentService {
+	return paymentService{logger: logger, repository: repository, gateways: gateways, vault: cardVault, config: conf, events: events, risk: riskEngine}
 }
@@ -0,0 +1,47 @@
+package payment
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const settlementBatchSize = 100
+
+// settlementActor is recorded in the status history for payments settled by the sweeper.
+const settlementActor = "system:settlement-sweeper"
+
+// SettlePayments settles payments captured more than the configured
+// settlement delay ago: by then the gateway has paid their funds out, so
+// they leave its clearing account. Wallet payments never reach a gateway and
+// are settled without moving money.
+func (p paymentService) SettlePayments(ctx context.Context) error {
+	payments, err := p.repository.GetSettleablePayments(time.Now().Add(-p.config.Payment.SettlementDelay), settlementBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range payments {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		payment := &payments[i]
+		reason := "captured funds paid out by " + payment.Gateway
+		if payment.PaymentMethod == EWallet {
+			reason = "wallet payments have nothing to pay out"
+		}
+		if err := p.transition(payment, StatusSettled, reason, settlementActor); err != nil {
+			p.logger.Error("Error settling payment", "paymentID", payment.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// RunSettlementSweeper settles captured payments every interval until ctx is cancelled.
+func RunSettlementSweeper(ctx context.Context, logger *slog.Logger, service PaymentService, interval time.Duration) {
+	runEvery(ctx, interval, func() {
+		if err := service.SettlePayments(ctx); err != nil {
+			logger.Error("Error settling payments", "error", err)
+		}
+	})
+}
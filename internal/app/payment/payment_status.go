@@ -0,0 +1,100 @@
+package payment
+
+import (
+	"fmt"
+	"mamlaka/internal/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+type PaymentStatus string
+
+const (
+	StatusPending           PaymentStatus = "pending"
+	StatusAuthorized        PaymentStatus = "authorized"
+	StatusCaptured          PaymentStatus = "captured"
+	StatusSettled           PaymentStatus = "settled"
+	StatusFailed            PaymentStatus = "failed"
+	StatusCancelled         PaymentStatus = "cancelled"
+	StatusRefunded          PaymentStatus = "refunded"
+	StatusPartiallyRefunded PaymentStatus = "partially_refunded"
+)
+
+// transitions lists, for every status, the statuses a payment may move to next.
+// Statuses without an entry are terminal.
+var transitions = map[PaymentStatus][]PaymentStatus{
+	StatusPending:           {StatusAuthorized, StatusFailed, StatusCancelled},
+	StatusAuthorized:        {StatusCaptured, StatusFailed, StatusCancelled},
+	StatusCaptured:          {StatusSettled, StatusRefunded, StatusPartiallyRefunded},
+	StatusSettled:           {StatusRefunded, StatusPartiallyRefunded},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+}
+
+// CanTransitionTo reports whether a payment in status s may move to status to.
+func (s PaymentStatus) CanTransitionTo(to PaymentStatus) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transitions are possible from s.
+func (s PaymentStatus) IsTerminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// StatusChange describes a payment status transition together with the other
+// writes that must be committed atomically with it.
+type StatusChange struct {
+	To      PaymentStatus
+	Reason  string
+	Actor   string
+	Updates map[string]interface{}    // Additional payment columns to update
+	Effects []func(tx *gorm.DB) error // Additional writes in the same transaction
+}
+
+// InvalidTransitionError is returned when a status change is not permitted by
+// the payment state machine.
+type InvalidTransitionError struct {
+	PaymentID uint
+	From      PaymentStatus
+	To        PaymentStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("payment %d cannot move from %s to %s", e.PaymentID, e.From, e.To)
+}
+
+// StatusConflictError is returned when a payment was changed by another
+// request between being read and being updated.
+type StatusConflictError struct {
+	PaymentID uint
+	Expected  PaymentStatus
+}
+
+func (e *StatusConflictError) Error() string {
+	return fmt.Sprintf("payment %d was modified concurrently while %s", e.PaymentID, e.Expected)
+}
+
+// DeclinedError is returned when the gateway declines a payment.
+type DeclinedError struct {
+	Code    string
+	Message string
+}
+
+func (e *DeclinedError) Error() string {
+	return fmt.Sprintf("payment declined: %s (%s)", e.Message, e.Code)
+}
+
+// RefundExceedsCapturedError is returned when a refund is larger than what is
+// left to refund on a payment.
+type RefundExceedsCapturedError struct {
+	Requested money.Money
+	Available money.Money
+}
+
+func (e *RefundExceedsCapturedError) Error() string {
+	return fmt.Sprintf("refund of %s exceeds the %s available to refund", e.Requested, e.Available)
+}
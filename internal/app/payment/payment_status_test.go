@@ -0,0 +1,53 @@
+package payment
+
+import "testing"
+
+func TestCanTransitionTo(t *testing.T) {
+	statuses := []PaymentStatus{
+		StatusPending, StatusAuthorized, StatusCaptured, StatusSettled,
+		StatusFailed, StatusCancelled, StatusRefunded, StatusPartiallyRefunded,
+	}
+	allowed := map[PaymentStatus][]PaymentStatus{
+		StatusPending:           {StatusAuthorized, StatusFailed, StatusCancelled},
+		StatusAuthorized:        {StatusCaptured, StatusFailed, StatusCancelled},
+		StatusCaptured:          {StatusSettled, StatusRefunded, StatusPartiallyRefunded},
+		StatusSettled:           {StatusRefunded, StatusPartiallyRefunded},
+		StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := false
+			for _, next := range allowed[from] {
+				if next == to {
+					want = true
+				}
+			}
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	tests := []struct {
+		status PaymentStatus
+		want   bool
+	}{
+		{StatusPending, false},
+		{StatusAuthorized, false},
+		{StatusCaptured, false},
+		{StatusSettled, false},
+		{StatusPartiallyRefunded, false},
+		{StatusFailed, true},
+		{StatusCancelled, true},
+		{StatusRefunded, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.want {
+			t.Errorf("%s.IsTerminal() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
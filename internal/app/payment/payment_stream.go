@@ -0,0 +1,270 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/pkg/pubsub"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// StreamSubprotocol is the WebSocket subprotocol spoken by the payment stream.
+const StreamSubprotocol = "mamlaka.payments.v1"
+
+const (
+	streamPingInterval = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// Messages sent on the payment stream.
+const (
+	StreamMessageSubscribed   = "subscribed"
+	StreamMessageUnsubscribed = "unsubscribed"
+	StreamMessagePayment      = "payment"
+	StreamMessageError        = "error"
+)
+
+// PaymentUpdate is published to the owner's payments topic whenever a
+// payment changes status.
+type PaymentUpdate struct {
+	From    PaymentStatus    `json:"from"`
+	Payment PaymentEventData `json:"payment"`
+}
+
+// StreamRequest is a message sent by the client on the payment stream.
+// Subscribing without payment IDs subscribes to all of the user's payments.
+type StreamRequest struct {
+	Action     string `json:"action"` // "subscribe" or "unsubscribe"
+	PaymentIDs []uint `json:"payment_ids,omitempty"`
+}
+
+// StreamMessage is a message sent to the client on the payment stream.
+// Subscribing to a payment is answered with its current state as a
+// "payment" message, so no transition can be missed in between.
+type StreamMessage struct {
+	Type       string            `json:"type"`
+	PaymentIDs []uint            `json:"payment_ids,omitempty"` // Payments (un)subscribed to
+	All        bool              `json:"all,omitempty"`         // Subscribed to every payment of the user
+	From       PaymentStatus     `json:"from,omitempty"`        // Previous status, when the message reports a transition
+	Payment    *PaymentEventData `json:"payment,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// paymentsTopic is the pub/sub topic status changes of userID's payments are published to.
+func paymentsTopic(userID uint) string {
+	return fmt.Sprintf("payments:user:%d", userID)
+}
+
+// publishUpdate returns the effect publishing the status change of payment to
+// its owner's payment streams when the transaction commits.
+func publishUpdate(payment *Payment, to PaymentStatus, reason string, captured, refunded int64) func(tx *gorm.DB) error {
+	update := PaymentUpdate{
+		From:    payment.Status,
+		Payment: newPaymentEventData(payment, to, reason, captured, refunded),
+	}
+	return func(tx *gorm.DB) error {
+		return pubsub.Notify(tx, paymentsTopic(payment.UserID), update)
+	}
+}
+
+// paymentStream is the state of one payment stream connection.
+type paymentStream struct {
+	service paymentService
+	conn    *websocket.Conn
+	cancel  context.CancelFunc // Ends the stream
+	userID  uint
+	all     bool
+	ids     map[uint]bool
+}
+
+// StreamPayments upgrades the request to a WebSocket that pushes status
+// changes of the authenticated user's payments. Payments to follow are given
+// as payment_id query parameters, or all=true for every payment, and can be
+// changed later with StreamRequest messages.
+func (p paymentService) StreamPayments(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return p.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	var initial []uint
+	for _, value := range c.QueryParams()["payment_id"] {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return p.handleError(c, errors.New("invalid payment id"), http.StatusBadRequest)
+		}
+		initial = append(initial, uint(id))
+	}
+	all, _ := strconv.ParseBool(c.QueryParam("all"))
+
+	// The server's read and write timeouts would otherwise close the connection
+	controller := http.NewResponseController(c.Response())
+	_ = controller.SetReadDeadline(time.Time{})
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	conn, err := websocket.Accept(c.Response(), c.Request(), &websocket.AcceptOptions{
+		Subprotocols:   []string{StreamSubprotocol},
+		OriginPatterns: p.config.Payment.StreamAllowedOrigins,
+	})
+	if err != nil {
+		// Accept has already written the error response
+		p.logger.Info("Payment stream handshake failed", "userID", userID, "error", err)
+		return nil
+	}
+	defer conn.CloseNow()
+
+	subscription := p.events.Subscribe(paymentsTopic(userID))
+	defer subscription.Close()
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+	stream := &paymentStream{service: p, conn: conn, cancel: cancel, userID: userID, ids: map[uint]bool{}}
+
+	p.logger.Info("Payment stream opened", "userID", userID)
+	if all || len(initial) > 0 {
+		stream.subscribe(ctx, initial)
+	}
+
+	requests := make(chan StreamRequest)
+	go stream.read(ctx, requests)
+	go stream.ping(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("Payment stream closed", "userID", userID)
+			return nil
+		case request := <-requests:
+			stream.handle(ctx, request)
+		case message, ok := <-subscription.C:
+			if !ok {
+				conn.Close(websocket.StatusTryAgainLater, "client is not keeping up")
+				return nil
+			}
+			var update PaymentUpdate
+			if raw, ok := message.(json.RawMessage); !ok || json.Unmarshal(raw, &update) != nil {
+				continue
+			}
+			if stream.follows(update.Payment.ID) {
+				stream.write(ctx, StreamMessage{Type: StreamMessagePayment, From: update.From, Payment: &update.Payment})
+			}
+		}
+	}
+}
+
+// read passes client messages on to requests until the connection fails.
+func (s *paymentStream) read(ctx context.Context, requests chan<- StreamRequest) {
+	defer s.cancel()
+	for {
+		var request StreamRequest
+		if err := wsjson.Read(ctx, s.conn, &request); err != nil {
+			return
+		}
+		select {
+		case requests <- request:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ping keeps the connection alive and notices clients that went away.
+func (s *paymentStream) ping(ctx context.Context) {
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := s.conn.Ping(pingCtx)
+			pingCancel()
+			if err != nil {
+				s.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (s *paymentStream) handle(ctx context.Context, request StreamRequest) {
+	switch request.Action {
+	case "subscribe":
+		s.subscribe(ctx, request.PaymentIDs)
+	case "unsubscribe":
+		s.unsubscribe(ctx, request.PaymentIDs)
+	default:
+		s.write(ctx, StreamMessage{Type: StreamMessageError, Error: fmt.Sprintf("unknown action %q", request.Action)})
+	}
+}
+
+// subscribe follows the given payments, or every payment if ids is empty,
+// and sends the current state of each payment followed by ID.
+func (s *paymentStream) subscribe(ctx context.Context, ids []uint) {
+	if len(ids) == 0 {
+		s.all = true
+		s.write(ctx, StreamMessage{Type: StreamMessageSubscribed, All: true})
+		return
+	}
+
+	var payments []*Payment
+	for _, id := range ids {
+		payment, err := s.service.repository.GetUserPaymentByID(s.userID, id)
+		if err != nil || payment == nil {
+			s.write(ctx, StreamMessage{Type: StreamMessageError, PaymentIDs: []uint{id}, Error: "payment not found"})
+			continue
+		}
+		s.ids[id] = true
+		payments = append(payments, payment)
+	}
+	if len(payments) == 0 {
+		return
+	}
+
+	subscribed := make([]uint, 0, len(payments))
+	for _, payment := range payments {
+		subscribed = append(subscribed, payment.ID)
+	}
+	s.write(ctx, StreamMessage{Type: StreamMessageSubscribed, PaymentIDs: subscribed, All: s.all})
+	for _, payment := range payments {
+		data := newPaymentEventData(payment, payment.Status, "", payment.CapturedAmount, payment.RefundedAmount)
+		s.write(ctx, StreamMessage{Type: StreamMessagePayment, Payment: &data})
+	}
+}
+
+// unsubscribe stops following the given payments, or every payment if ids is empty.
+func (s *paymentStream) unsubscribe(ctx context.Context, ids []uint) {
+	if len(ids) == 0 {
+		s.all = false
+		s.ids = map[uint]bool{}
+	}
+	for _, id := range ids {
+		delete(s.ids, id)
+	}
+	s.write(ctx, StreamMessage{Type: StreamMessageUnsubscribed, PaymentIDs: ids, All: len(ids) == 0})
+}
+
+// follows reports whether changes to a payment are sent to the client.
+func (s *paymentStream) follows(paymentID uint) bool {
+	return s.all || s.ids[paymentID]
+}
+
+// write sends a message, ending the stream if the client cannot take it.
+func (s *paymentStream) write(ctx context.Context, message StreamMessage) {
+	ctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+	defer cancel()
+	if err := wsjson.Write(ctx, s.conn, message); err != nil {
+		s.service.logger.Info("Error writing to payment stream", "userID", s.userID, "error", err)
+		s.cancel()
+	}
+}
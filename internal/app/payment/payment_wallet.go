@@ -0,0 +1,70 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// walletGateway is recorded as the gateway of payments funded from a wallet.
+const walletGateway = "wallet"
+
+// processWalletPayment pays from the user's wallet balance. The wallet is
+// debited in the same transaction that captures the payment, so a balance
+// that no longer covers the amount fails the payment instead of overdrawing.
+func (p paymentService) processWalletPayment(payment *Payment, actor string) error {
+	payment.Gateway = walletGateway
+	payment.GatewayReference = paymentReference(payment)
+	if err := p.repository.SaveGatewayDetails(payment); err != nil {
+		return err
+	}
+
+	if err := p.transition(payment, StatusAuthorized, "wallet payment", actor); err != nil {
+		return err
+	}
+	err := p.transition(payment, StatusCaptured, "paid from wallet", actor)
+	if errors.Is(err, wallet.ErrInsufficientFunds) {
+		if tErr := p.transition(payment, StatusFailed, err.Error(), actor); tErr != nil {
+			return tErr
+		}
+	}
+	return err
+}
+
+// walletEffect returns the wallet change that must be committed with a
+// status change, or nil if the change does not touch a wallet. Top-ups credit
+// the wallet when captured; e_wallet payments debit it when captured and are
+// credited back when refunded.
+func walletEffect(payment *Payment, to PaymentStatus, captured, refunded int64) func(tx *gorm.DB) error {
+	movement := wallet.Movement{
+		UserID:    payment.UserID,
+		Reference: fmt.Sprintf("payment:%d", payment.ID),
+	}
+	apply := wallet.Credit
+
+	switch {
+	case to == StatusCaptured && payment.Purpose == PurposeWalletTopUp:
+		movement.Amount = money.Money{Amount: captured, Currency: payment.Amount.Currency}
+		movement.Type = wallet.EntryTopUp
+		movement.Description = fmt.Sprintf("top-up by %s", payment.PaymentMethod)
+	case to == StatusCaptured && payment.PaymentMethod == EWallet:
+		movement.Amount = money.Money{Amount: captured, Currency: payment.Amount.Currency}
+		movement.Type = wallet.EntryPayment
+		movement.Description = fmt.Sprintf("payment %d", payment.ID)
+		apply = wallet.Debit
+	case (to == StatusRefunded || to == StatusPartiallyRefunded) && payment.PaymentMethod == EWallet:
+		movement.Amount = money.Money{Amount: refunded - payment.RefundedAmount, Currency: payment.Amount.Currency}
+		movement.Type = wallet.EntryRefund
+		movement.Description = fmt.Sprintf("refund of payment %d", payment.ID)
+	default:
+		return nil
+	}
+
+	return func(tx *gorm.DB) error {
+		_, err := apply(tx, movement)
+		return err
+	}
+}
@@ -0,0 +1,107 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// walletRepository records status changes, failing captures of payments
+// larger than the wallet balance the way the wallet debit does.
+type walletRepository struct {
+	PaymentRepository
+	balance int64
+	changes []PaymentStatus
+}
+
+func (r *walletRepository) SaveGatewayDetails(*Payment) error {
+	return nil
+}
+
+func (r *walletRepository) UpdatePaymentStatus(payment *Payment, change StatusChange) error {
+	if change.To == StatusCaptured && payment.Amount.Amount > r.balance {
+		return fmt.Errorf("%w: %d available", wallet.ErrInsufficientFunds, r.balance)
+	}
+	r.changes = append(r.changes, change.To)
+	payment.Status = change.To
+	return nil
+}
+
+func newWalletPayment() *Payment {
+	return &Payment{ID: 1, UserID: 7, Amount: money.Money{Amount: 5000, Currency: "KES"}, PaymentMethod: EWallet, Status: StatusPending}
+}
+
+func TestWalletPaymentCaptured(t *testing.T) {
+	repository := &walletRepository{balance: 5000}
+	service := paymentService{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), repository: repository}
+	payment := newWalletPayment()
+
+	if err := service.processWalletPayment(payment, "user:7"); err != nil {
+		t.Fatalf("processWalletPayment() error = %v", err)
+	}
+	if payment.Status != StatusCaptured || payment.Gateway != walletGateway {
+		t.Errorf("payment = %s through %q, want captured through %q", payment.Status, payment.Gateway, walletGateway)
+	}
+}
+
+func TestWalletPaymentInsufficientFunds(t *testing.T) {
+	repository := &walletRepository{balance: 4999}
+	service := paymentService{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), repository: repository}
+	payment := newWalletPayment()
+
+	err := service.processWalletPayment(payment, "user:7")
+	if !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Fatalf("processWalletPayment() error = %v, want ErrInsufficientFunds", err)
+	}
+	if want := []PaymentStatus{StatusAuthorized, StatusFailed}; fmt.Sprint(repository.changes) != fmt.Sprint(want) {
+		t.Errorf("status changes = %v, want %v", repository.changes, want)
+	}
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	_ = service.handleError(c, err, http.StatusInternalServerError)
+
+	var response common.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusPaymentRequired || response.Code != common.CodeInsufficientFunds {
+		t.Errorf("response = %d %q, want %d %q", rec.Code, response.Code, http.StatusPaymentRequired, common.CodeInsufficientFunds)
+	}
+}
+
+func TestWalletEffect(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  PaymentMethod
+		purpose PaymentPurpose
+		to      PaymentStatus
+		want    bool
+	}{
+		{"top-up captured", CreditCard, PurposeWalletTopUp, StatusCaptured, true},
+		{"wallet payment captured", EWallet, PurposePurchase, StatusCaptured, true},
+		{"wallet payment refunded", EWallet, PurposePurchase, StatusPartiallyRefunded, true},
+		{"card payment captured", CreditCard, PurposePurchase, StatusCaptured, false},
+		{"card payment refunded", CreditCard, PurposePurchase, StatusRefunded, false},
+		{"wallet payment authorized", EWallet, PurposePurchase, StatusAuthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := &Payment{ID: 1, UserID: 7, Amount: money.Money{Amount: 5000, Currency: "KES"}, PaymentMethod: tt.method, Purpose: tt.purpose}
+			if got := walletEffect(payment, tt.to, 5000, 1000) != nil; got != tt.want {
+				t.Errorf("walletEffect() touches the wallet = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
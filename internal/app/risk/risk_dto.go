@@ -0,0 +1,9 @@
+package risk
+
+type DecisionListRequestDto struct {
+	UserID       uint   `query:"user_id" json:"user_id"`
+	Outcome      string `query:"outcome" json:"outcome" validate:"omitempty,oneof=allow review block"`
+	ReviewStatus string `query:"review_status" json:"review_status" validate:"omitempty,oneof=pending approved rejected"`
+	Cursor       string `query:"cursor" json:"cursor"`
+	Limit        int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=100"`
+}
@@ -0,0 +1,181 @@
+package risk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrReviewResolved is returned when resolving a review someone else already resolved.
+var ErrReviewResolved = errors.New("the review was already resolved")
+
+// Engine screens payment attempts with the rules in force. Rules saved by
+// any server, or changed in the rules file, take effect on the next reload.
+type Engine struct {
+	logger     *slog.Logger
+	repository RiskRepository
+	config     config.RiskConfig
+	ruleSet    atomic.Pointer[RuleSet]
+}
+
+// NewEngine creates an engine and loads the rules in force, falling back to
+// DefaultRules until rules are saved.
+func NewEngine(logger *slog.Logger, repository RiskRepository, conf config.RiskConfig) *Engine {
+	e := &Engine{logger: logger, repository: repository, config: conf}
+	e.ruleSet.Store(&RuleSet{Rules: DefaultRules(), Source: "default"})
+	if err := e.Reload(); err != nil {
+		logger.Error("Error loading risk rules, screening with the default rules", "error", err)
+	}
+	return e
+}
+
+// RuleSet returns the rule set in force.
+func (e *Engine) RuleSet() *RuleSet {
+	return e.ruleSet.Load()
+}
+
+// Reload imports the rules file if it changed since it was last imported and
+// switches to the latest saved rule set. A broken rules file is reported
+// without affecting the rules in force.
+func (e *Engine) Reload() error {
+	var fileErr error
+	if e.config.RulesFile != "" {
+		fileErr = e.importFile(e.config.RulesFile)
+	}
+
+	latest, err := e.repository.GetLatestRuleSet()
+	if err != nil {
+		return errors.Join(fileErr, err)
+	}
+	if latest != nil && latest.Version != e.RuleSet().Version {
+		e.ruleSet.Store(latest)
+		e.logger.Info("Risk rules loaded", "version", latest.Version, "source", latest.Source)
+	}
+	return fileErr
+}
+
+// importFile saves the rules in a JSON file as a new version if they changed.
+func (e *Engine) importFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var rules Rules
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if problems := rules.Validate(); len(problems) > 0 {
+		return fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+
+	sum := sha256.Sum256(data)
+	_, err = e.repository.CreateRuleSet(&RuleSet{
+		Rules:     rules,
+		Source:    SourceFile,
+		Checksum:  hex.EncodeToString(sum[:]),
+		CreatedBy: "file:" + path,
+	})
+	return err
+}
+
+// Run reloads the rules every ReloadInterval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Reload(); err != nil {
+				e.logger.Error("Error reloading risk rules", "error", err)
+			}
+		}
+	}
+}
+
+// Evaluate screens attempt with the rules in force and returns the decision,
+// which the caller saves: with the payment it allows, or with Save if the
+// attempt is blocked.
+func (e *Engine) Evaluate(attempt Attempt) (*Decision, error) {
+	ruleSet := e.RuleSet()
+	if len(ruleSet.Rules.NewAccounts) > 0 && attempt.AccountCreatedAt.IsZero() {
+		createdAt, err := e.repository.GetAccountCreatedAt(attempt.UserID)
+		if err != nil {
+			return nil, err
+		}
+		attempt.AccountCreatedAt = createdAt
+	}
+
+	hits, err := ruleSet.Rules.Evaluate(attempt, e.repository.CountAttempts)
+	if err != nil {
+		return nil, err
+	}
+	score := 0
+	for _, hit := range hits {
+		score += hit.Score
+	}
+
+	decision := &Decision{
+		UserID:          attempt.UserID,
+		Outcome:         ruleSet.Rules.Outcome(score),
+		Score:           score,
+		Hits:            append([]Hit{}, hits...),
+		RuleSetVersion:  ruleSet.Version,
+		Amount:          attempt.Amount,
+		PaymentMethod:   attempt.PaymentMethod,
+		CardFingerprint: attempt.CardFingerprint,
+		CardBIN:         attempt.CardBIN,
+		PhoneNumber:     attempt.PhoneNumber,
+		Email:           attempt.Value(KeyEmail),
+		IP:              attempt.IP,
+		Country:         attempt.Value(KeyCountry),
+		IPCountry:       attempt.Value(KeyIPCountry),
+	}
+	if decision.Outcome == OutcomeReview {
+		decision.ReviewStatus = ReviewPending
+	}
+	e.logger.Info("Payment screened", "userID", attempt.UserID, "outcome", decision.Outcome, "score", score, "hits", len(hits))
+	return decision, nil
+}
+
+// Save saves a decision that is not saved with a payment.
+func (e *Engine) Save(decision *Decision) error {
+	return e.repository.CreateDecision(decision)
+}
+
+// DecisionForPayment returns the decision that let a payment through, or nil
+// if it was created without screening.
+func (e *Engine) DecisionForPayment(paymentID uint) (*Decision, error) {
+	return e.repository.GetDecisionByPaymentID(paymentID)
+}
+
+// ResolveReview records an admin's review of a decision pending review.
+func (e *Engine) ResolveReview(decision *Decision, approved bool, actor, note string) error {
+	if decision.ReviewStatus != ReviewPending {
+		return ErrReviewResolved
+	}
+	now := time.Now()
+	decision.ReviewStatus = ReviewRejected
+	if approved {
+		decision.ReviewStatus = ReviewApproved
+	}
+	decision.ReviewedBy = actor
+	decision.ReviewedAt = &now
+	decision.ReviewNote = note
+	return e.repository.UpdateReview(decision)
+}
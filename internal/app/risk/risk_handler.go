@@ -0,0 +1,90 @@
+package risk
+
+import (
+	"log/slog"
+	_ "mamlaka/internal/app/common"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RiskHandler interface {
+	Rules(c echo.Context) error
+	UpdateRules(c echo.Context) error
+	Decisions(c echo.Context) error
+	Decision(c echo.Context) error
+}
+
+type riskHandler struct {
+	logger      *slog.Logger
+	riskService RiskService
+}
+
+// Rules godoc
+// @Summary Risk rules
+// @Description The risk rules payments are screened with, and their version. Requires the admin role.
+// @Tags Admin
+// @Produce  json
+// @Success 200 {object} common.BaseResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Router  /admin/risk/rules [get]
+func (r riskHandler) Rules(c echo.Context) error {
+	return r.riskService.GetRules(c)
+}
+
+// UpdateRules godoc
+// @Summary Replace the risk rules
+// @Description Saves a new version of the risk rules. Every matching rule adds its score to a payment; payments scoring at least review_score are held for review and those scoring at least block_score are blocked. Requires the admin role.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param   Rules body Rules true "Risk rules"
+// @Success 201 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/risk/rules [put]
+func (r riskHandler) UpdateRules(c echo.Context) error {
+	return r.riskService.UpdateRules(c)
+}
+
+// Decisions godoc
+// @Summary List risk decisions
+// @Description Gets one page of risk decisions, newest first. Pass next_cursor from the previous page as cursor to get the next one. Requires the admin role.
+// @Tags Admin
+// @Produce  json
+// @Param   user_id query int false "Only decisions about this user"
+// @Param   outcome query string false "allow, review or block"
+// @Param   review_status query string false "pending, approved or rejected"
+// @Param   cursor query string false "next_cursor of the previous page"
+// @Param   limit query int false "Page size, 1 to 100; defaults to 20"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/risk/decisions [get]
+func (r riskHandler) Decisions(c echo.Context) error {
+	return r.riskService.ListDecisions(c)
+}
+
+// Decision godoc
+// @Summary Get a risk decision
+// @Description Gets a risk decision with the rules that matched. Requires the admin role.
+// @Tags Admin
+// @Produce  json
+// @Param   id path int true "Decision ID"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/risk/decisions/{id} [get]
+func (r riskHandler) Decision(c echo.Context) error {
+	return r.riskService.GetDecision(c)
+}
+
+func NewRiskHandler(logger *slog.Logger, riskService RiskService) RiskHandler {
+	return riskHandler{
+		logger:      logger,
+		riskService: riskService,
+	}
+}
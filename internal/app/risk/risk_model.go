@@ -0,0 +1,123 @@
+package risk
+
+import (
+	"fmt"
+	"mamlaka/internal/pkg/money"
+	"strings"
+	"time"
+)
+
+type Outcome string
+
+const (
+	OutcomeAllow  Outcome = "allow"
+	OutcomeReview Outcome = "review" // Processed, but held until an admin approves it where the payment method allows
+	OutcomeBlock  Outcome = "block"  // Rejected before the payment is created
+)
+
+type ReviewStatus string
+
+const (
+	ReviewPending  ReviewStatus = "pending"
+	ReviewApproved ReviewStatus = "approved"
+	ReviewRejected ReviewStatus = "rejected"
+)
+
+// Hit is a rule that matched a payment attempt.
+type Hit struct {
+	Rule   string `json:"rule"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// Attempt describes a payment being screened.
+type Attempt struct {
+	UserID           uint
+	AccountCreatedAt time.Time
+	Amount           money.Money
+	PaymentMethod    string
+	CardFingerprint  string
+	CardBIN          string // Leading six digits of the card number
+	PhoneNumber      string
+	Email            string
+	IP               string
+	Country          string // Billing country given by the payer, ISO 3166-1 alpha-2
+	IPCountry        string // Country of the IP address, from RiskConfig.CountryHeader
+}
+
+// Value returns the attempt's value of key, normalised for comparison, or ""
+// if the attempt has none.
+func (a Attempt) Value(key Key) string {
+	switch key {
+	case KeyUser:
+		return fmt.Sprint(a.UserID)
+	case KeyCard:
+		return a.CardFingerprint
+	case KeyCardBIN:
+		return a.CardBIN
+	case KeyPhoneNumber:
+		return a.PhoneNumber
+	case KeyEmail:
+		return strings.ToLower(a.Email)
+	case KeyIP:
+		return a.IP
+	case KeyCountry:
+		return strings.ToUpper(a.Country)
+	case KeyIPCountry:
+		return strings.ToUpper(a.IPCountry)
+	}
+	return ""
+}
+
+// Decision is the persisted result of screening a payment attempt, kept for
+// audit and counted by velocity rules.
+type Decision struct {
+	ID              uint        `gorm:"primaryKey" json:"id"`
+	UserID          uint        `gorm:"not null;index" json:"user_id"`
+	PaymentID       *uint       `gorm:"index" json:"payment_id,omitempty"` // Nil for blocked attempts, which create no payment
+	Outcome         Outcome     `gorm:"size:10;not null;index" json:"outcome"`
+	Score           int         `gorm:"not null" json:"score"`
+	Hits            []Hit       `gorm:"type:jsonb;serializer:json" json:"hits"`
+	RuleSetVersion  int         `gorm:"not null" json:"rule_set_version"` // Zero for the default rules
+	Amount          money.Money `gorm:"embedded" json:"amount"`
+	PaymentMethod   string      `gorm:"size:20" json:"payment_method"`
+	CardFingerprint string      `gorm:"size:64;index" json:"card_fingerprint,omitempty"`
+	CardBIN         string      `gorm:"size:8;index" json:"card_bin,omitempty"`
+	PhoneNumber     string      `gorm:"size:20;index" json:"phone_number,omitempty"`
+	Email           string      `gorm:"size:100;index" json:"email,omitempty"`
+	IP              string      `gorm:"size:45;index" json:"ip,omitempty"`
+	Country         string      `gorm:"size:2" json:"country,omitempty"`
+	IPCountry       string      `gorm:"size:2" json:"ip_country,omitempty"`
+	Held            bool        `gorm:"not null;default:false" json:"held"` // Whether the payment waits for review before it is captured
+
+	ReviewStatus ReviewStatus `gorm:"size:10;index" json:"review_status,omitempty"` // Set for review outcomes
+	ReviewedBy   string       `gorm:"size:100" json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time   `json:"reviewed_at,omitempty"`
+	ReviewNote   string       `gorm:"size:255" json:"review_note,omitempty"`
+
+	CreatedAt time.Time `gorm:"not null;index" json:"created_at"`
+}
+
+// RuleSet is one version of the rules. The latest version is in force.
+type RuleSet struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	Version   int       `gorm:"not null;uniqueIndex" json:"version"`
+	Rules     Rules     `gorm:"type:jsonb;serializer:json;not null" json:"rules"`
+	Source    string    `gorm:"size:20;not null" json:"source"` // "file" or "admin"
+	Checksum  string    `gorm:"size:64" json:"-"`               // SHA-256 of the file the rules were loaded from
+	CreatedBy string    `gorm:"size:100" json:"created_by"`     // Actor who saved the rules
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+const (
+	SourceFile  = "file"
+	SourceAdmin = "admin"
+)
+
+func (Decision) TableName() string {
+	return "risk_decisions"
+}
+
+func (RuleSet) TableName() string {
+	return "risk_rule_sets"
+}
@@ -0,0 +1,199 @@
+package risk
+
+import (
+	"errors"
+	"log/slog"
+	"mamlaka/internal/app/user"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RiskRepository interface {
+	GetLatestRuleSet() (*RuleSet, error)
+	CreateRuleSet(ruleSet *RuleSet) (bool, error)
+	CountAttempts(key Key, value string, since time.Time) (int64, error)
+	GetAccountCreatedAt(userID uint) (time.Time, error)
+	CreateDecision(decision *Decision) error
+	GetDecisions(filter DecisionFilter) ([]Decision, error)
+	GetDecisionByID(id uint) (*Decision, error)
+	GetDecisionByPaymentID(paymentID uint) (*Decision, error)
+	UpdateReview(decision *Decision) error
+}
+
+// DecisionFilter selects a page of decisions for GetDecisions.
+type DecisionFilter struct {
+	UserID       uint // Zero lists decisions about every user
+	Outcome      Outcome
+	ReviewStatus ReviewStatus
+	BeforeID     uint // Zero starts at the newest decision
+	Limit        int
+}
+
+type riskRepository struct {
+	DB     *gorm.DB
+	logger *slog.Logger
+}
+
+// GetLatestRuleSet returns the rule set in force, or nil if none was saved.
+func (r riskRepository) GetLatestRuleSet() (*RuleSet, error) {
+	var ruleSet RuleSet
+	if err := r.DB.Order("version DESC").First(&ruleSet).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Error("Error fetching risk rules", "error", err)
+		return nil, err
+	}
+	return &ruleSet, nil
+}
+
+// CreateRuleSet saves ruleSet as the next version and reports whether it did.
+// A rule set loaded from a file is skipped if the latest file version has
+// the same checksum, so servers sharing a file import each change once.
+func (r riskRepository) CreateRuleSet(ruleSet *RuleSet) (bool, error) {
+	created := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Versions are numbered one at a time
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended('risk_rule_sets', 0))").Error; err != nil {
+			return err
+		}
+
+		if ruleSet.Source == SourceFile {
+			var checksum string
+			err := tx.Model(&RuleSet{}).Where("source = ?", SourceFile).Order("version DESC").Limit(1).Pluck("checksum", &checksum).Error
+			if err != nil {
+				return err
+			}
+			if checksum == ruleSet.Checksum {
+				return nil
+			}
+		}
+
+		var latest int
+		if err := tx.Model(&RuleSet{}).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		ruleSet.Version = latest + 1
+		if err := tx.Create(ruleSet).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("Error saving risk rules", "source", ruleSet.Source, "error", err)
+		return false, err
+	}
+	if created {
+		r.logger.Info("Risk rules saved", "version", ruleSet.Version, "source", ruleSet.Source, "createdBy", ruleSet.CreatedBy)
+	}
+	return created, nil
+}
+
+// CountAttempts counts the payment attempts screened since the given time
+// whose key had the given value.
+func (r riskRepository) CountAttempts(key Key, value string, since time.Time) (int64, error) {
+	column, ok := velocityKeys[key]
+	if !ok {
+		return 0, errors.New("attempts cannot be counted by " + string(key))
+	}
+	var count int64
+	if err := r.DB.Model(&Decision{}).Where(column+" = ? AND created_at >= ?", value, since).Count(&count).Error; err != nil {
+		r.logger.Error("Error counting payment attempts", "key", key, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetAccountCreatedAt returns when a user signed up.
+func (r riskRepository) GetAccountCreatedAt(userID uint) (time.Time, error) {
+	var account user.User
+	if err := r.DB.Select("created_at").First(&account, userID).Error; err != nil {
+		r.logger.Error("Error fetching account age", "userID", userID, "error", err)
+		return time.Time{}, err
+	}
+	return account.CreatedAt, nil
+}
+
+func (r riskRepository) CreateDecision(decision *Decision) error {
+	if err := Record(r.DB, decision); err != nil {
+		r.logger.Error("Error saving risk decision", "userID", decision.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (r riskRepository) GetDecisions(filter DecisionFilter) ([]Decision, error) {
+	query := r.DB.Order("id DESC").Limit(filter.Limit)
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.ReviewStatus != "" {
+		query = query.Where("review_status = ?", filter.ReviewStatus)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	var decisions []Decision
+	if err := query.Find(&decisions).Error; err != nil {
+		r.logger.Error("Error fetching risk decisions", "error", err)
+		return nil, err
+	}
+	return decisions, nil
+}
+
+func (r riskRepository) GetDecisionByID(id uint) (*Decision, error) {
+	return r.getDecision(r.DB.Where("id = ?", id))
+}
+
+func (r riskRepository) GetDecisionByPaymentID(paymentID uint) (*Decision, error) {
+	return r.getDecision(r.DB.Where("payment_id = ?", paymentID))
+}
+
+func (r riskRepository) getDecision(query *gorm.DB) (*Decision, error) {
+	var decision Decision
+	if err := query.First(&decision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Error("Error fetching risk decision", "error", err)
+		return nil, err
+	}
+	return &decision, nil
+}
+
+// UpdateReview saves the review fields of a decision that is still pending
+// review, returning ErrReviewResolved if someone else resolved it first.
+func (r riskRepository) UpdateReview(decision *Decision) error {
+	result := r.DB.Model(&Decision{}).
+		Where("id = ? AND review_status = ?", decision.ID, ReviewPending).
+		Updates(map[string]interface{}{
+			"review_status": decision.ReviewStatus,
+			"reviewed_by":   decision.ReviewedBy,
+			"reviewed_at":   decision.ReviewedAt,
+			"review_note":   decision.ReviewNote,
+		})
+	if result.Error != nil {
+		r.logger.Error("Error saving risk review", "decisionID", decision.ID, "error", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReviewResolved
+	}
+	r.logger.Info("Risk review resolved", "decisionID", decision.ID, "status", decision.ReviewStatus, "reviewedBy", decision.ReviewedBy)
+	return nil
+}
+
+// Record saves a decision in tx, e.g. the transaction creating its payment.
+func Record(tx *gorm.DB, decision *Decision) error {
+	return tx.Create(decision).Error
+}
+
+func NewRiskRepository(db *gorm.DB, logger *slog.Logger) RiskRepository {
+	return riskRepository{DB: db, logger: logger}
+}
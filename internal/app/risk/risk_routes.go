@@ -0,0 +1,25 @@
+package risk
+
+import (
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"log/slog"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/app/user"
+)
+
+func RegisterRiskRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB, engine *Engine) {
+	riskRepository := NewRiskRepository(db, logger)
+	riskService := NewRiskService(logger, riskRepository, engine)
+	riskHandler := NewRiskHandler(logger, riskService)
+
+	risk := e.Group("/admin/risk")
+	{
+		risk.Use(middlewares.JWTMiddleware, middlewares.RequirePermission(user.PermRiskManage))
+
+		risk.GET("/rules", riskHandler.Rules)
+		risk.PUT("/rules", riskHandler.UpdateRules)
+		risk.GET("/decisions", riskHandler.Decisions)
+		risk.GET("/decisions/:id", riskHandler.Decision)
+	}
+}
@@ -0,0 +1,306 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"mamlaka/internal/pkg/money"
+	"strings"
+	"time"
+)
+
+// Rules are what payments are screened with. Every rule that matches a
+// payment adds its score, and the total decides the outcome: payments
+// scoring at least BlockScore are blocked, and those scoring at least
+// ReviewScore are held for review.
+type Rules struct {
+	ReviewScore     int                  `json:"review_score"`
+	BlockScore      int                  `json:"block_score"`
+	Velocity        []VelocityRule       `json:"velocity,omitempty"`
+	Amounts         []AmountRule         `json:"amounts,omitempty"`
+	CountryMismatch *CountryMismatchRule `json:"country_mismatch,omitempty"`
+	NewAccounts     []NewAccountRule     `json:"new_accounts,omitempty"`
+	Denylists       []DenylistRule       `json:"denylists,omitempty"`
+}
+
+// VelocityRule matches when more than MaxCount payments were attempted with
+// the same Key value within Window, counting the one being screened.
+type VelocityRule struct {
+	Name     string   `json:"name"`
+	Key      Key      `json:"key"`
+	Window   Duration `json:"window"`
+	MaxCount int      `json:"max_count"`
+	Score    int      `json:"score"`
+}
+
+// AmountRule matches payments in Currency of at least MinAmount.
+type AmountRule struct {
+	Name      string `json:"name"`
+	Currency  string `json:"currency"`
+	MinAmount string `json:"min_amount"` // Decimal string in major units
+	Score     int    `json:"score"`
+}
+
+// CountryMismatchRule matches card payments whose card was issued in another
+// country than the payer's billing country or the country of their IP
+// address. Cards whose BIN is not listed never match.
+type CountryMismatchRule struct {
+	Name  string            `json:"name"`
+	BINs  map[string]string `json:"bins"` // Issuing country by BIN prefix; the longest matching prefix wins
+	Score int               `json:"score"`
+}
+
+// NewAccountRule matches payments in Currency above MaxAmount made by users
+// who signed up less than MaxAge ago.
+type NewAccountRule struct {
+	Name      string   `json:"name"`
+	MaxAge    Duration `json:"max_age"`
+	Currency  string   `json:"currency"`
+	MaxAmount string   `json:"max_amount"` // Decimal string in major units
+	Score     int      `json:"score"`
+}
+
+// DenylistRule matches payments whose Key value is one of Values.
+type DenylistRule struct {
+	Name   string   `json:"name"`
+	Key    Key      `json:"key"`
+	Values []string `json:"values"`
+	Score  int      `json:"score"`
+}
+
+// Key is an attribute of a payment attempt that rules group or match on.
+type Key string
+
+const (
+	KeyUser        Key = "user" // User ID
+	KeyCard        Key = "card" // Card fingerprint, as shown on decisions
+	KeyCardBIN     Key = "card_bin"
+	KeyPhoneNumber Key = "phone_number"
+	KeyEmail       Key = "email"
+	KeyIP          Key = "ip"
+	KeyCountry     Key = "country"    // Billing country given by the payer
+	KeyIPCountry   Key = "ip_country" // Country of the payer's IP address
+)
+
+// velocityKeys are the keys recorded on decisions, which velocity rules count by.
+var velocityKeys = map[Key]string{
+	KeyUser:        "user_id",
+	KeyCard:        "card_fingerprint",
+	KeyCardBIN:     "card_bin",
+	KeyPhoneNumber: "phone_number",
+	KeyEmail:       "email",
+	KeyIP:          "ip",
+}
+
+// denylistKeys are the keys denylists can match on.
+var denylistKeys = map[Key]bool{
+	KeyUser: true, KeyCard: true, KeyCardBIN: true, KeyPhoneNumber: true,
+	KeyEmail: true, KeyIP: true, KeyCountry: true, KeyIPCountry: true,
+}
+
+// Duration is a time.Duration written as a string such as "1h30m" in rules.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultRules are used until rules are loaded from a file or saved through
+// the admin API.
+func DefaultRules() Rules {
+	return Rules{
+		ReviewScore: 50,
+		BlockScore:  100,
+		Velocity: []VelocityRule{
+			{Name: "card-hourly", Key: KeyCard, Window: Duration(time.Hour), MaxCount: 5, Score: 50},
+			{Name: "user-hourly", Key: KeyUser, Window: Duration(time.Hour), MaxCount: 20, Score: 50},
+			{Name: "ip-hourly", Key: KeyIP, Window: Duration(time.Hour), MaxCount: 30, Score: 30},
+		},
+	}
+}
+
+// Validate returns one message per problem with the rules, or nil if they
+// can be used.
+func (r Rules) Validate() []string {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if r.BlockScore <= 0 {
+		addf("block_score must be positive")
+	}
+	if r.ReviewScore <= 0 || r.ReviewScore > r.BlockScore {
+		addf("review_score must be positive and at most block_score")
+	}
+
+	names := map[string]bool{}
+	checkName := func(name string) {
+		switch {
+		case strings.TrimSpace(name) == "":
+			addf("every rule needs a name")
+		case names[name]:
+			addf("rule name %q is used more than once", name)
+		}
+		names[name] = true
+	}
+	checkAmount := func(name, field, amount, currency string) {
+		if _, err := money.Parse(amount, currency); err != nil {
+			addf("%s: %s: %s", name, field, err)
+		}
+	}
+
+	for _, rule := range r.Velocity {
+		checkName(rule.Name)
+		if _, ok := velocityKeys[rule.Key]; !ok {
+			addf("%s: velocity cannot be counted by %q", rule.Name, rule.Key)
+		}
+		if rule.Window <= 0 {
+			addf("%s: window must be positive", rule.Name)
+		}
+		if rule.MaxCount < 0 {
+			addf("%s: max_count must not be negative", rule.Name)
+		}
+	}
+	for _, rule := range r.Amounts {
+		checkName(rule.Name)
+		checkAmount(rule.Name, "min_amount", rule.MinAmount, rule.Currency)
+	}
+	if rule := r.CountryMismatch; rule != nil {
+		checkName(rule.Name)
+		for bin, country := range rule.BINs {
+			if !isDigits(bin) || len(bin) > 8 {
+				addf("%s: %q is not a BIN prefix", rule.Name, bin)
+			}
+			if len(country) != 2 {
+				addf("%s: %q is not a two-letter country code", rule.Name, country)
+			}
+		}
+	}
+	for _, rule := range r.NewAccounts {
+		checkName(rule.Name)
+		if rule.MaxAge <= 0 {
+			addf("%s: max_age must be positive", rule.Name)
+		}
+		checkAmount(rule.Name, "max_amount", rule.MaxAmount, rule.Currency)
+	}
+	for _, rule := range r.Denylists {
+		checkName(rule.Name)
+		if !denylistKeys[rule.Key] {
+			addf("%s: cannot deny by %q", rule.Name, rule.Key)
+		}
+	}
+	return problems
+}
+
+// Evaluate scores attempt against every rule. recentAttempts returns how
+// many payments were attempted with a key's value since a point in time.
+func (r Rules) Evaluate(attempt Attempt, recentAttempts func(key Key, value string, since time.Time) (int64, error)) ([]Hit, error) {
+	var hits []Hit
+	now := time.Now()
+
+	for _, rule := range r.Velocity {
+		value := attempt.Value(rule.Key)
+		if value == "" {
+			continue
+		}
+		count, err := recentAttempts(rule.Key, value, now.Add(-time.Duration(rule.Window)))
+		if err != nil {
+			return nil, err
+		}
+		if count+1 > int64(rule.MaxCount) {
+			hits = append(hits, Hit{Rule: rule.Name, Score: rule.Score,
+				Reason: fmt.Sprintf("%d payments by %s within %s", count+1, rule.Key, time.Duration(rule.Window))})
+		}
+	}
+
+	for _, rule := range r.Amounts {
+		threshold, err := money.Parse(rule.MinAmount, rule.Currency)
+		if err == nil && attempt.Amount.Currency == threshold.Currency && attempt.Amount.Amount >= threshold.Amount {
+			hits = append(hits, Hit{Rule: rule.Name, Score: rule.Score, Reason: "amount of at least " + threshold.String()})
+		}
+	}
+
+	if rule := r.CountryMismatch; rule != nil && attempt.CardBIN != "" {
+		if issuer := rule.issuingCountry(attempt.CardBIN); issuer != "" {
+			for _, country := range []string{attempt.Country, attempt.IPCountry} {
+				if country != "" && !strings.EqualFold(country, issuer) {
+					hits = append(hits, Hit{Rule: rule.Name, Score: rule.Score,
+						Reason: fmt.Sprintf("card issued in %s used from %s", issuer, strings.ToUpper(country))})
+					break
+				}
+			}
+		}
+	}
+
+	for _, rule := range r.NewAccounts {
+		limit, err := money.Parse(rule.MaxAmount, rule.Currency)
+		if err != nil || attempt.AccountCreatedAt.IsZero() || now.Sub(attempt.AccountCreatedAt) >= time.Duration(rule.MaxAge) {
+			continue
+		}
+		if attempt.Amount.Currency == limit.Currency && attempt.Amount.Amount > limit.Amount {
+			hits = append(hits, Hit{Rule: rule.Name, Score: rule.Score,
+				Reason: fmt.Sprintf("account younger than %s paying more than %s", time.Duration(rule.MaxAge), limit)})
+		}
+	}
+
+	for _, rule := range r.Denylists {
+		value := attempt.Value(rule.Key)
+		if value == "" {
+			continue
+		}
+		for _, denied := range rule.Values {
+			if strings.EqualFold(strings.TrimSpace(denied), value) {
+				hits = append(hits, Hit{Rule: rule.Name, Score: rule.Score, Reason: fmt.Sprintf("%s is denylisted", rule.Key)})
+				break
+			}
+		}
+	}
+	return hits, nil
+}
+
+// Outcome returns the outcome of a payment scoring score.
+func (r Rules) Outcome(score int) Outcome {
+	switch {
+	case score >= r.BlockScore:
+		return OutcomeBlock
+	case score >= r.ReviewScore:
+		return OutcomeReview
+	}
+	return OutcomeAllow
+}
+
+// issuingCountry returns the country listed for the longest prefix of bin,
+// or "" if none is listed.
+func (r *CountryMismatchRule) issuingCountry(bin string) string {
+	for n := len(bin); n > 0; n-- {
+		if country, ok := r.BINs[bin[:n]]; ok {
+			return strings.ToUpper(country)
+		}
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package risk
+
+import (
+	"errors"
+	"mamlaka/internal/pkg/money"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRulesValidate(t *testing.T) {
+	valid := func() Rules {
+		return Rules{
+			ReviewScore: 50,
+			BlockScore:  100,
+			Velocity:    []VelocityRule{{Name: "card-hourly", Key: KeyCard, Window: Duration(time.Hour), MaxCount: 5, Score: 50}},
+			Amounts:     []AmountRule{{Name: "large", Currency: "KES", MinAmount: "100000", Score: 30}},
+			CountryMismatch: &CountryMismatchRule{
+				Name: "country", BINs: map[string]string{"424242": "US"}, Score: 40,
+			},
+			NewAccounts: []NewAccountRule{{Name: "new", MaxAge: Duration(24 * time.Hour), Currency: "KES", MaxAmount: "5000", Score: 30}},
+			Denylists:   []DenylistRule{{Name: "denied-emails", Key: KeyEmail, Values: []string{"fraud@example.com"}, Score: 100}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(r *Rules)
+		want   []string // Substrings of the expected problems, in order
+	}{
+		{"valid", func(r *Rules) {}, nil},
+		{"default rules", func(r *Rules) { *r = DefaultRules() }, nil},
+		{"non-positive block score", func(r *Rules) { r.BlockScore = 0 }, []string{"block_score", "review_score"}},
+		{"review score above block score", func(r *Rules) { r.ReviewScore = 150 }, []string{"review_score"}},
+		{"missing name", func(r *Rules) { r.Amounts[0].Name = " " }, []string{"needs a name"}},
+		{"duplicate name", func(r *Rules) { r.Amounts[0].Name = "card-hourly" }, []string{"used more than once"}},
+		{"unknown velocity key", func(r *Rules) { r.Velocity[0].Key = KeyCountry }, []string{"cannot be counted by"}},
+		{"non-positive window", func(r *Rules) { r.Velocity[0].Window = 0 }, []string{"window"}},
+		{"negative max count", func(r *Rules) { r.Velocity[0].MaxCount = -1 }, []string{"max_count"}},
+		{"invalid min amount", func(r *Rules) { r.Amounts[0].MinAmount = "1,000" }, []string{"min_amount"}},
+		{"unsupported currency", func(r *Rules) { r.Amounts[0].Currency = "XXX" }, []string{"min_amount"}},
+		{"invalid BIN", func(r *Rules) { r.CountryMismatch.BINs = map[string]string{"42a": "US"} }, []string{"BIN prefix"}},
+		{"invalid country", func(r *Rules) { r.CountryMismatch.BINs = map[string]string{"4242": "USA"} }, []string{"country code"}},
+		{"non-positive max age", func(r *Rules) { r.NewAccounts[0].MaxAge = 0 }, []string{"max_age"}},
+		{"unknown denylist key", func(r *Rules) { r.Denylists[0].Key = "name" }, []string{"cannot deny by"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := valid()
+			tt.change(&rules)
+			problems := rules.Validate()
+			if len(problems) != len(tt.want) {
+				t.Fatalf("Validate() = %q, want %d problems", problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("problem %d = %q, want it to mention %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRulesEvaluate(t *testing.T) {
+	rules := Rules{
+		ReviewScore: 50,
+		BlockScore:  100,
+		Velocity:    []VelocityRule{{Name: "card-hourly", Key: KeyCard, Window: Duration(time.Hour), MaxCount: 3, Score: 50}},
+		Amounts:     []AmountRule{{Name: "large", Currency: "KES", MinAmount: "100000", Score: 30}},
+		CountryMismatch: &CountryMismatchRule{
+			Name: "country", BINs: map[string]string{"4": "GB", "424242": "US"}, Score: 40,
+		},
+		NewAccounts: []NewAccountRule{{Name: "new", MaxAge: Duration(24 * time.Hour), Currency: "KES", MaxAmount: "5000", Score: 20}},
+		Denylists:   []DenylistRule{{Name: "denied-emails", Key: KeyEmail, Values: []string{" Fraud@Example.com "}, Score: 100}},
+	}
+	kes := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "KES"} }
+	old := time.Now().Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		attempt  Attempt
+		previous int64 // Payments already attempted with the card within the window
+		want     []string
+	}{
+		{"clean", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000), CardFingerprint: "fp"}, 0, nil},
+		{"velocity at limit", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000), CardFingerprint: "fp"}, 2, nil},
+		{"velocity over limit", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000), CardFingerprint: "fp"}, 3, []string{"card-hourly"}},
+		{"velocity without a card", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000)}, 10, nil},
+		{"amount at threshold", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(10000000)}, 0, []string{"large"}},
+		{"amount in other currency", Attempt{UserID: 1, AccountCreatedAt: old, Amount: money.Money{Amount: 10000000, Currency: "USD"}}, 0, nil},
+		{"card from another country", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000), CardBIN: "424242", Country: "ke"}, 0, []string{"country"}},
+		{"longest BIN prefix wins", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000), CardBIN: "424242", Country: "us", IPCountry: "US"}, 0, nil},
+		{"unlisted BIN", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000), CardBIN: "555555", Country: "KE"}, 0, nil},
+		{"new account over limit", Attempt{UserID: 1, AccountCreatedAt: time.Now().Add(-time.Hour), Amount: kes(500001)}, 0, []string{"new"}},
+		{"new account at limit", Attempt{UserID: 1, AccountCreatedAt: time.Now().Add(-time.Hour), Amount: kes(500000)}, 0, nil},
+		{"denylisted email", Attempt{UserID: 1, AccountCreatedAt: old, Amount: kes(1000), Email: "FRAUD@example.com"}, 0, []string{"denied-emails"}},
+		{
+			"several rules",
+			Attempt{UserID: 1, AccountCreatedAt: time.Now(), Amount: kes(10000000), CardFingerprint: "fp", CardBIN: "424242", IPCountry: "NG"},
+			5,
+			[]string{"card-hourly", "large", "country", "new"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recent := func(key Key, value string, since time.Time) (int64, error) {
+				if key != KeyCard || value != tt.attempt.CardFingerprint {
+					t.Errorf("recentAttempts(%s, %q) called unexpectedly", key, value)
+				}
+				return tt.previous, nil
+			}
+			hits, err := rules.Evaluate(tt.attempt, recent)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			var got []string
+			for _, hit := range hits {
+				got = append(got, hit.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() hit %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesEvaluateCountError(t *testing.T) {
+	rules := DefaultRules()
+	failure := errors.New("database unavailable")
+	_, err := rules.Evaluate(Attempt{UserID: 1, CardFingerprint: "fp"}, func(Key, string, time.Time) (int64, error) {
+		return 0, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Evaluate() error = %v, want %v", err, failure)
+	}
+}
+
+func TestRulesOutcome(t *testing.T) {
+	rules := Rules{ReviewScore: 50, BlockScore: 100}
+
+	tests := []struct {
+		score int
+		want  Outcome
+	}{
+		{0, OutcomeAllow},
+		{49, OutcomeAllow},
+		{50, OutcomeReview},
+		{99, OutcomeReview},
+		{100, OutcomeBlock},
+		{250, OutcomeBlock},
+	}
+
+	for _, tt := range tests {
+		if got := rules.Outcome(tt.score); got != tt.want {
+			t.Errorf("Outcome(%d) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultDecisionPageSize = 20
+
+// RiskService lets admins manage the risk rules and audit risk decisions.
+type RiskService interface {
+	GetRules(c echo.Context) error
+	UpdateRules(c echo.Context) error
+	ListDecisions(c echo.Context) error
+	GetDecision(c echo.Context) error
+}
+
+type riskService struct {
+	logger     *slog.Logger
+	repository RiskRepository
+	engine     *Engine
+}
+
+// GetRules returns the rule set in force.
+func (r riskService) GetRules(c echo.Context) error {
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Risk rules fetched successfully",
+		Data:    r.engine.RuleSet(),
+	})
+}
+
+// UpdateRules saves the rules in the request body as a new version, which
+// takes effect on this server at once and on others at their next reload.
+func (r riskService) UpdateRules(c echo.Context) error {
+	var rules Rules
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return r.handleError(c, err, http.StatusBadRequest)
+	}
+	if problems := rules.Validate(); len(problems) > 0 {
+		fields := make([]common.FieldError, 0, len(problems))
+		for _, problem := range problems {
+			fields = append(fields, common.FieldError{Field: "rules", Message: problem})
+		}
+		return r.handleValidationError(c, fields)
+	}
+
+	createdBy := "system"
+	if claims := middlewares.GetClaims(c); claims != nil {
+		createdBy = "user:" + claims.UserID
+	}
+	ruleSet := &RuleSet{Rules: rules, Source: SourceAdmin, CreatedBy: createdBy}
+	if _, err := r.repository.CreateRuleSet(ruleSet); err != nil {
+		return r.handleError(c, err, http.StatusInternalServerError)
+	}
+	if err := r.engine.Reload(); err != nil {
+		r.logger.Error("Error reloading risk rules", "error", err)
+	}
+
+	return c.JSON(http.StatusCreated, common.BaseResponse{
+		Status:  http.StatusCreated,
+		Message: "Risk rules saved",
+		Data:    ruleSet,
+	})
+}
+
+// ListDecisions lists one page of risk decisions, newest first.
+func (r riskService) ListDecisions(c echo.Context) error {
+	var request DecisionListRequestDto
+	if err := c.Bind(&request); err != nil {
+		return r.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return r.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	filter := DecisionFilter{
+		UserID:       request.UserID,
+		Outcome:      Outcome(request.Outcome),
+		ReviewStatus: ReviewStatus(request.ReviewStatus),
+		Limit:        request.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultDecisionPageSize
+	}
+	if request.Cursor != "" {
+		beforeID, err := strconv.ParseUint(request.Cursor, 10, 32)
+		if err != nil {
+			return r.handleValidationError(c, []common.FieldError{{Field: "cursor", Message: "invalid cursor"}})
+		}
+		filter.BeforeID = uint(beforeID)
+	}
+
+	// Fetch one extra decision to find out whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	decisions, err := r.repository.GetDecisions(filter)
+	if err != nil {
+		return r.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	var nextCursor string
+	if len(decisions) > limit {
+		decisions = decisions[:limit]
+		nextCursor = strconv.FormatUint(uint64(decisions[limit-1].ID), 10)
+	}
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:     http.StatusOK,
+		Message:    "Risk decisions fetched successfully",
+		Data:       decisions,
+		NextCursor: nextCursor,
+	})
+}
+
+// GetDecision returns one risk decision.
+func (r riskService) GetDecision(c echo.Context) error {
+	decisionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return r.handleError(c, errors.New("invalid decision ID"), http.StatusBadRequest)
+	}
+
+	decision, err := r.repository.GetDecisionByID(uint(decisionID))
+	if err != nil {
+		return r.handleError(c, err, http.StatusInternalServerError)
+	}
+	if decision == nil {
+		return r.handleError(c, errors.New("risk decision not found"), http.StatusNotFound)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Risk decision fetched successfully",
+		Data:    decision,
+	})
+}
+
+// handleError is a helper function for creating error responses.
+func (r riskService) handleError(c echo.Context, err error, status int) error {
+	return c.JSON(status, common.ErrorResponse{
+		Status: status,
+		Error:  err.Error(),
+	})
+}
+
+// handleValidationError responds with 400 and one entry per invalid field.
+func (r riskService) handleValidationError(c echo.Context, fields []common.FieldError) error {
+	return c.JSON(http.StatusBadRequest, common.ErrorResponse{
+		Status: http.StatusBadRequest,
+		Error:  "request validation failed",
+		Fields: fields,
+	})
+}
+
+// NewRiskService creates a new instance of riskService.
+func NewRiskService(logger *slog.Logger, repository RiskRepository, engine *Engine) RiskService {
+	return riskService{
+		logger:     logger,
+		repository: repository,
+		engine:     engine,
+	}
+}
@@ -0,0 +1,27 @@
+package transfer
+
+import (
+	"mamlaka/internal/pkg/money"
+	"time"
+)
+
+type TransferRequestDto struct {
+	Recipient string `json:"recipient" validate:"required"` // Email address or phone number of the recipient
+	Amount    string `json:"amount" validate:"required"`    // Decimal string in major units
+	Currency  string `json:"currency" validate:"required,len=3"`
+	Note      string `json:"note" validate:"max=140"`
+}
+
+type TransferDto struct {
+	ID           uint        `json:"id"`
+	Direction    string      `json:"direction"` // "sent" or "received", from the caller's point of view
+	Counterparty string      `json:"counterparty"`
+	Amount       money.Money `json:"amount"`
+	Note         string      `json:"note,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+type TransferListRequestDto struct {
+	Cursor string `query:"cursor" json:"cursor"`
+	Limit  int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=100"`
+}
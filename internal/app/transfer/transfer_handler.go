@@ -0,0 +1,60 @@
+package transfer
+
+import (
+	"log/slog"
+	_ "mamlaka/internal/app/common"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TransferHandler interface {
+	MakeTransfer(c echo.Context) error
+	Transfers(c echo.Context) error
+}
+
+type transferHandler struct {
+	logger          *slog.Logger
+	transferService TransferService
+}
+
+// MakeTransfer godoc
+// @Summary Send money to another user
+// @Description Moves money from the caller's wallet to the wallet of the user with the given email address or phone number. Daily limits depend on the sender's tier.
+// @Tags Transfers
+// @Accept  json
+// @Produce  json
+// @Param   TransferRequestDto body TransferRequestDto true "Transfer Request"
+// @Success 201 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 402 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 422 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /transfers [post]
+func (t transferHandler) MakeTransfer(c echo.Context) error {
+	return t.transferService.MakeTransfer(c)
+}
+
+// Transfers godoc
+// @Summary List transfers
+// @Description Lists the transfers the caller sent or received, newest first
+// @Tags Transfers
+// @Produce  json
+// @Param   cursor query string false "next_cursor of the previous page"
+// @Param   limit query int false "Page size, 1 to 100 (default 20)"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /transfers [get]
+func (t transferHandler) Transfers(c echo.Context) error {
+	return t.transferService.ListTransfers(c)
+}
+
+func NewTransferHandler(logger *slog.Logger, transferService TransferService) TransferHandler {
+	return transferHandler{
+		logger:          logger,
+		transferService: transferService,
+	}
+}
@@ -0,0 +1,36 @@
+package transfer
+
+import (
+	"fmt"
+	"mamlaka/internal/app/user"
+	"mamlaka/internal/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// Transfer moves money from one user's wallet to another's.
+type Transfer struct {
+	gorm.Model
+	SenderID    uint        `gorm:"not null;index:idx_transfers_sender_currency_created,priority:1" json:"sender_id"`
+	Sender      *user.User  `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	RecipientID uint        `gorm:"not null;index" json:"recipient_id"`
+	Recipient   *user.User  `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	Amount      money.Money `gorm:"embedded" json:"amount"`
+	Note        string      `gorm:"size:140" json:"note,omitempty"`
+}
+
+// reference identifies the transfer in wallet statements and the ledger.
+func (t *Transfer) reference() string {
+	return fmt.Sprintf("transfer:%d", t.ID)
+}
+
+// LimitExceededError is returned when a transfer would take the sender over
+// their daily limit in the transfer currency.
+type LimitExceededError struct {
+	Limit money.Money
+	Used  money.Money
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("transfer exceeds the daily limit of %s; %s already sent today", e.Limit, e.Used)
+}
@@ -0,0 +1,43 @@
+package transfer
+
+import (
+	"mamlaka/internal/app/user"
+	"mamlaka/internal/pkg/email"
+
+	"github.com/matcornic/hermes/v2"
+)
+
+// notify emails the sender and the recipient of a transfer. Failures are
+// logged; the transfer itself has already completed.
+func (t transferService) notify(sender, recipient *user.User, transfer *Transfer) {
+	details := []hermes.Entry{
+		{Key: "Amount", Value: transfer.Amount.String()},
+		{Key: "Reference", Value: transfer.reference()},
+	}
+	if transfer.Note != "" {
+		details = append(details, hermes.Entry{Key: "Note", Value: transfer.Note})
+	}
+
+	t.send(sender, "You sent "+transfer.Amount.String(), hermes.Body{
+		Name:       sender.FullName,
+		Intros:     []string{"You sent " + transfer.Amount.String() + " to " + recipient.FullName + "."},
+		Dictionary: details,
+		Outros:     []string{"If you did not make this transfer, contact support immediately."},
+	})
+	t.send(recipient, "You received "+transfer.Amount.String(), hermes.Body{
+		Name:       recipient.FullName,
+		Intros:     []string{sender.FullName + " sent you " + transfer.Amount.String() + ". It is now in your wallet."},
+		Dictionary: details,
+	})
+}
+
+func (t transferService) send(to *user.User, subject string, body hermes.Body) {
+	html, err := t.hermes.GenerateHTML(hermes.Email{Body: body})
+	if err != nil {
+		t.logger.Error("Error rendering transfer email", "userID", to.ID, "error", err)
+		return
+	}
+	if err := email.SendEmail(email.EmailMessage{To: to.Email, Subject: subject, Body: html}, t.config.Email); err != nil {
+		t.logger.Error("Error sending transfer email", "userID", to.ID, "error", err)
+	}
+}
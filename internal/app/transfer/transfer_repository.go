@@ -0,0 +1,87 @@
+package transfer
+
+import (
+	"log/slog"
+	"mamlaka/internal/app/ledger"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/pkg/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TransferRepository interface {
+	CreateTransfer(transfer *Transfer, dailyLimit money.Money) error
+	GetTransfersByUserID(userID uint, beforeID uint, limit int) ([]Transfer, error)
+}
+
+type transferRepository struct {
+	DB     *gorm.DB
+	logger *slog.Logger
+}
+
+// CreateTransfer records a transfer, moves the money between the two wallets
+// and posts it to the ledger in one transaction. Once the wallets are locked
+// the sender's transfers in the currency since midnight UTC are summed, so
+// concurrent transfers cannot exceed dailyLimit together.
+func (t transferRepository) CreateTransfer(transfer *Transfer, dailyLimit money.Money) error {
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Sender", "Recipient").Create(transfer).Error; err != nil {
+			return err
+		}
+
+		if err := wallet.Transfer(tx, transfer.SenderID, transfer.RecipientID, transfer.Amount, transfer.reference(), transfer.Note); err != nil {
+			return err
+		}
+
+		var used int64
+		startOfDay := time.Now().UTC().Truncate(24 * time.Hour)
+		if err := tx.Model(&Transfer{}).
+			Select("COALESCE(SUM(amount), 0)").
+			Where("sender_id = ? AND currency = ? AND created_at >= ? AND id <> ?", transfer.SenderID, transfer.Amount.Currency, startOfDay, transfer.ID).
+			Scan(&used).Error; err != nil {
+			return err
+		}
+		if used+transfer.Amount.Amount > dailyLimit.Amount {
+			return &LimitExceededError{Limit: dailyLimit, Used: money.Money{Amount: used, Currency: dailyLimit.Currency}}
+		}
+
+		entry := ledger.Entry{Reference: transfer.reference(), Description: "peer-to-peer transfer"}
+		entry.Add(
+			ledger.Debit(ledger.CustomerAccount(transfer.SenderID), transfer.Amount),
+			ledger.Credit(ledger.CustomerAccount(transfer.RecipientID), transfer.Amount),
+		)
+		_, err := ledger.Post(tx, entry)
+		return err
+	})
+	if err != nil {
+		t.logger.Error("Error creating transfer", "senderID", transfer.SenderID, "recipientID", transfer.RecipientID, "error", err)
+		return err
+	}
+	t.logger.Info("Transfer created successfully", "transferID", transfer.ID)
+	return nil
+}
+
+// GetTransfersByUserID returns up to limit transfers sent or received by a
+// user, newest first, starting below beforeID when it is not zero.
+func (t transferRepository) GetTransfersByUserID(userID uint, beforeID uint, limit int) ([]Transfer, error) {
+	query := t.DB.Preload("Sender").Preload("Recipient").
+		Where("sender_id = ? OR recipient_id = ?", userID, userID)
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var transfers []Transfer
+	if err := query.Order("id DESC").Limit(limit).Find(&transfers).Error; err != nil {
+		t.logger.Error("Error fetching transfers", "userID", userID, "error", err)
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func NewTransferRepository(db *gorm.DB, logger *slog.Logger) TransferRepository {
+	return transferRepository{
+		DB:     db,
+		logger: logger,
+	}
+}
@@ -0,0 +1,30 @@
+package transfer
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
+	"gorm.io/gorm"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/app/user"
+)
+
+func RegisterTransferRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB, conf config.Config, h *hermes.Hermes) {
+	if err := ValidateDailyLimits(conf.Transfer); err != nil {
+		panic(fmt.Sprintf("invalid transfer configuration: %s", err))
+	}
+
+	transferRepository := NewTransferRepository(db, logger)
+	transferService := NewTransferService(logger, transferRepository, user.NewUserRepository(db, logger), conf, h)
+	transferHandler := NewTransferHandler(logger, transferService)
+
+	transfers := e.Group("/transfers")
+	{
+		transfers.Use(middlewares.JWTMiddleware)
+
+		transfers.POST("", transferHandler.MakeTransfer)
+		transfers.GET("", transferHandler.Transfers)
+	}
+}
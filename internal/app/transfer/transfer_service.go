@@ -0,0 +1,246 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/app/user"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
+)
+
+const defaultTransferPageSize = 20
+
+// TransferService sends money between users' wallets.
+type TransferService interface {
+	MakeTransfer(c echo.Context) error
+	ListTransfers(c echo.Context) error
+}
+
+type transferService struct {
+	logger     *slog.Logger
+	repository TransferRepository
+	users      user.UserRepository
+	config     config.Config
+	hermes     *hermes.Hermes
+}
+
+// MakeTransfer sends money from the authenticated user's wallet to the user
+// with the given email address or phone number, and notifies both of them.
+func (t transferService) MakeTransfer(c echo.Context) error {
+	senderID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return t.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	var request TransferRequestDto
+	if err := c.Bind(&request); err != nil {
+		t.logger.Error("Error parsing transfer request body", "error", err)
+		return t.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return t.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	amount, err := money.Parse(request.Amount, request.Currency)
+	if err != nil {
+		return t.handleValidationError(c, []common.FieldError{{Field: "amount", Message: err.Error()}})
+	}
+
+	sender, err := t.users.GetUserByID(senderID)
+	if err != nil {
+		return t.handleError(c, err, http.StatusInternalServerError)
+	}
+	if sender == nil {
+		return t.handleError(c, errors.New("user not found"), http.StatusUnauthorized)
+	}
+
+	recipient, err := t.findRecipient(request.Recipient)
+	if err != nil {
+		return t.handleError(c, err, http.StatusInternalServerError)
+	}
+	if recipient == nil || !recipient.IsActive {
+		return t.handleError(c, errors.New("recipient not found"), http.StatusNotFound)
+	}
+	if recipient.ID == sender.ID {
+		return t.handleValidationError(c, []common.FieldError{{Field: "recipient", Message: "must be another user"}})
+	}
+
+	limit, ok := t.dailyLimit(sender, amount.Currency)
+	if !ok {
+		return t.handleError(c, errors.New("transfers are not available in "+amount.Currency), http.StatusUnprocessableEntity)
+	}
+
+	transfer := &Transfer{
+		SenderID:    sender.ID,
+		RecipientID: recipient.ID,
+		Amount:      amount,
+		Note:        request.Note,
+	}
+	if err := t.repository.CreateTransfer(transfer, limit); err != nil {
+		return t.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	go t.notify(sender, recipient, transfer)
+
+	return c.JSON(http.StatusCreated, common.BaseResponse{
+		Status:  http.StatusCreated,
+		Message: "Transfer sent successfully",
+		Data:    toTransferDto(*transfer, sender, recipient, sender.ID),
+	})
+}
+
+// findRecipient looks a user up by email address, or by phone number if the
+// identifier is not an email address.
+func (t transferService) findRecipient(identifier string) (*user.User, error) {
+	identifier = strings.TrimSpace(identifier)
+	if strings.Contains(identifier, "@") {
+		return t.users.GetUserByEmail(identifier)
+	}
+	return t.users.GetUserByPhoneNumber(identifier)
+}
+
+// dailyLimit returns how much a user of the sender's tier may send per day in
+// currency, and false if the tier has no limit, and so no transfers, in it.
+func (t transferService) dailyLimit(sender *user.User, currency string) (money.Money, bool) {
+	limits := t.config.Transfer.StandardDailyLimits
+	if sender.Tier == user.TierPremium {
+		limits = t.config.Transfer.PremiumDailyLimits
+	}
+	amount, ok := limits[currency]
+	if !ok {
+		return money.Money{}, false
+	}
+	limit, err := money.Parse(amount, currency)
+	return limit, err == nil
+}
+
+// ValidateDailyLimits reports a daily limit that is not a valid
+// amount of its currency.
+func ValidateDailyLimits(conf config.TransferConfig) error {
+	tiers := map[string]map[string]string{user.TierStandard: conf.StandardDailyLimits, user.TierPremium: conf.PremiumDailyLimits}
+	for tier, limits := range tiers {
+		for currency, amount := range limits {
+			if _, err := money.Parse(amount, currency); err != nil {
+				return fmt.Errorf("%s daily transfer limit in %s: %w", tier, currency, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ListTransfers lists the transfers the authenticated user sent or received, newest first.
+func (t transferService) ListTransfers(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return t.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	var request TransferListRequestDto
+	if err := c.Bind(&request); err != nil {
+		return t.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return t.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	var beforeID uint64
+	if request.Cursor != "" {
+		if beforeID, err = strconv.ParseUint(request.Cursor, 10, 32); err != nil {
+			return t.handleValidationError(c, []common.FieldError{{Field: "cursor", Message: "invalid cursor"}})
+		}
+	}
+	limit := request.Limit
+	if limit == 0 {
+		limit = defaultTransferPageSize
+	}
+
+	transfers, err := t.repository.GetTransfersByUserID(userID, uint(beforeID), limit+1)
+	if err != nil {
+		return t.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	var nextCursor string
+	if len(transfers) > limit {
+		transfers = transfers[:limit]
+		nextCursor = strconv.FormatUint(uint64(transfers[limit-1].ID), 10)
+	}
+
+	data := make([]TransferDto, 0, len(transfers))
+	for _, transfer := range transfers {
+		data = append(data, toTransferDto(transfer, transfer.Sender, transfer.Recipient, userID))
+	}
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:     http.StatusOK,
+		Message:    "Transfers fetched successfully",
+		Data:       data,
+		NextCursor: nextCursor,
+	})
+}
+
+// toTransferDto describes a transfer from the point of view of viewerID.
+func toTransferDto(transfer Transfer, sender, recipient *user.User, viewerID uint) TransferDto {
+	dto := TransferDto{
+		ID:        transfer.ID,
+		Direction: "sent",
+		Amount:    transfer.Amount,
+		Note:      transfer.Note,
+		CreatedAt: transfer.CreatedAt,
+	}
+	counterparty := recipient
+	if transfer.SenderID != viewerID {
+		dto.Direction = "received"
+		counterparty = sender
+	}
+	if counterparty != nil {
+		dto.Counterparty = counterparty.FullName
+	}
+	return dto
+}
+
+// handleError is a helper function for creating error responses.
+func (t transferService) handleError(c echo.Context, err error, status int) error {
+	var limitExceeded *LimitExceededError
+	var code string
+	switch {
+	case errors.Is(err, wallet.ErrInsufficientFunds):
+		status, code = http.StatusPaymentRequired, common.CodeInsufficientFunds
+	case errors.As(err, &limitExceeded):
+		status, code = http.StatusUnprocessableEntity, common.CodeTransferLimitExceeded
+	}
+
+	return c.JSON(status, common.ErrorResponse{
+		Status: status,
+		Code:   code,
+		Error:  err.Error(),
+	})
+}
+
+// handleValidationError responds with 400 and one entry per invalid field.
+func (t transferService) handleValidationError(c echo.Context, fields []common.FieldError) error {
+	return c.JSON(http.StatusBadRequest, common.ErrorResponse{
+		Status: http.StatusBadRequest,
+		Error:  "request validation failed",
+		Fields: fields,
+	})
+}
+
+// NewTransferService creates a new instance of transferService.
+func NewTransferService(logger *slog.Logger, repository TransferRepository, users user.UserRepository, conf config.Config, h *hermes.Hermes) TransferService {
+	return transferService{
+		logger:     logger,
+		repository: repository,
+		users:      users,
+		config:     conf,
+		hermes:     h,
+	}
+}
@@ -0,0 +1,187 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/user"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/pkg/money"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+var testLimits = config.TransferConfig{
+	StandardDailyLimits: map[string]string{"KES": "70000"},
+	PremiumDailyLimits:  map[string]string{"KES": "300000", "USD": "2500"},
+}
+
+func TestDailyLimit(t *testing.T) {
+	service := transferService{config: config.Config{Transfer: testLimits}}
+
+	tests := []struct {
+		name     string
+		tier     string
+		currency string
+		want     money.Money
+		wantOK   bool
+	}{
+		{"standard", user.TierStandard, "KES", money.Money{Amount: 7000000, Currency: "KES"}, true},
+		{"premium", user.TierPremium, "KES", money.Money{Amount: 30000000, Currency: "KES"}, true},
+		{"premium only currency", user.TierPremium, "USD", money.Money{Amount: 250000, Currency: "USD"}, true},
+		{"no standard limit in currency", user.TierStandard, "USD", money.Money{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := service.dailyLimit(&user.User{Tier: tt.tier}, tt.currency)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("dailyLimit() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateDailyLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.TransferConfig
+		wantErr bool
+	}{
+		{"valid", testLimits, false},
+		{"invalid amount", config.TransferConfig{StandardDailyLimits: map[string]string{"KES": "lots"}}, true},
+		{"unknown currency", config.TransferConfig{PremiumDailyLimits: map[string]string{"XYZ": "100"}}, true},
+		{"too many decimals", config.TransferConfig{StandardDailyLimits: map[string]string{"KES": "10.001"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateDailyLimits(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDailyLimits() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// memoryUsers is a UserRepository finding users in a fixed list.
+type memoryUsers struct {
+	user.UserRepository
+	users []*user.User
+}
+
+func (m memoryUsers) find(match func(*user.User) bool) (*user.User, error) {
+	for _, u := range m.users {
+		if match(u) {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m memoryUsers) GetUserByID(userID uint) (*user.User, error) {
+	return m.find(func(u *user.User) bool { return u.ID == userID })
+}
+
+func (m memoryUsers) GetUserByEmail(email string) (*user.User, error) {
+	return m.find(func(u *user.User) bool { return u.Email == email })
+}
+
+func (m memoryUsers) GetUserByPhoneNumber(phoneNumber string) (*user.User, error) {
+	return m.find(func(u *user.User) bool { return u.PhoneNumber == phoneNumber })
+}
+
+// limitedRepository records the daily limit transfers are created with and
+// rejects them with err.
+type limitedRepository struct {
+	TransferRepository
+	limit money.Money
+	err   error
+}
+
+func (r *limitedRepository) CreateTransfer(_ *Transfer, dailyLimit money.Money) error {
+	r.limit = dailyLimit
+	return r.err
+}
+
+func newTransferTest(senderTier string, err error) (TransferService, *limitedRepository) {
+	sender := &user.User{FullName: "Sender", Email: "sender@example.com", IsActive: true, Tier: senderTier}
+	sender.ID = 7
+	recipient := &user.User{FullName: "Recipient", Email: "recipient@example.com", PhoneNumber: "254712345678", IsActive: true}
+	recipient.ID = 8
+	inactive := &user.User{FullName: "Inactive", Email: "inactive@example.com"}
+	inactive.ID = 9
+
+	repository := &limitedRepository{err: err}
+	service := NewTransferService(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		repository,
+		memoryUsers{users: []*user.User{sender, recipient, inactive}},
+		config.Config{Transfer: testLimits},
+		nil,
+	)
+	return service, repository
+}
+
+func makeTransfer(t *testing.T, service TransferService, body string) (*httptest.ResponseRecorder, common.ErrorResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transfers", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("claims", &tokens.Claims{UserID: "7"})
+
+	if err := service.MakeTransfer(c); err != nil {
+		t.Fatalf("MakeTransfer() error = %v", err)
+	}
+	var response common.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return rec, response
+}
+
+func TestMakeTransferUsesTierLimit(t *testing.T) {
+	exceeded := &LimitExceededError{Limit: money.Money{Amount: 30000000, Currency: "KES"}, Used: money.Money{Amount: 29990000, Currency: "KES"}}
+	service, repository := newTransferTest(user.TierPremium, exceeded)
+
+	rec, response := makeTransfer(t, service, `{"recipient":"recipient@example.com","amount":"500","currency":"KES"}`)
+
+	if repository.limit != (money.Money{Amount: 30000000, Currency: "KES"}) {
+		t.Errorf("transfer created with limit %v, want the premium limit", repository.limit)
+	}
+	if rec.Code != http.StatusUnprocessableEntity || response.Code != common.CodeTransferLimitExceeded {
+		t.Errorf("response = %d %q, want %d %q", rec.Code, response.Code, http.StatusUnprocessableEntity, common.CodeTransferLimitExceeded)
+	}
+}
+
+func TestMakeTransferRejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		err      error // Returned by CreateTransfer
+		want     int
+		wantCode string
+	}{
+		{"insufficient funds", `{"recipient":"254712345678","amount":"500","currency":"KES"}`, fmt.Errorf("%w: KES 10.00 available", wallet.ErrInsufficientFunds), http.StatusPaymentRequired, common.CodeInsufficientFunds},
+		{"no limit in currency", `{"recipient":"recipient@example.com","amount":"5","currency":"USD"}`, nil, http.StatusUnprocessableEntity, ""},
+		{"to self", `{"recipient":"sender@example.com","amount":"5","currency":"KES"}`, nil, http.StatusBadRequest, ""},
+		{"unknown recipient", `{"recipient":"nobody@example.com","amount":"5","currency":"KES"}`, nil, http.StatusNotFound, ""},
+		{"inactive recipient", `{"recipient":"inactive@example.com","amount":"5","currency":"KES"}`, nil, http.StatusNotFound, ""},
+		{"invalid amount", `{"recipient":"recipient@example.com","amount":"5.001","currency":"KES"}`, nil, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newTransferTest(user.TierStandard, tt.err)
+			rec, response := makeTransfer(t, service, tt.body)
+			if rec.Code != tt.want || response.Code != tt.wantCode {
+				t.Errorf("response = %d %q, want %d %q", rec.Code, response.Code, tt.want, tt.wantCode)
+			}
+		})
+	}
+}
@@ -3,15 +3,42 @@ package user
 import (
 	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log/slog"
+	"mamlaka/internal/pkg/tokens"
+	"time"
 )
 
 type UserRepository interface {
 	GetUserByEmail(email string) (*User, error)
+	GetUserByID(userID uint) (*User, error)
+	GetUserByPhoneNumber(phoneNumber string) (*User, error)
 	UpdateUser(userID uint, user *User) (*User, error)
 	CreateUser(user *User) (*User, error)
 	DeactivateUser(userID uint) (*User, error)
 	DeleteUserByEmail(email string) error
+	CreateOneTimeCode(code *OneTimeCode) error
+	GetRecentOneTimeCodes(userID uint, purpose CodePurpose, since time.Time) ([]OneTimeCode, error)
+	GetActiveOneTimeCode(userID uint, purpose CodePurpose) (*OneTimeCode, error)
+	RecordCodeAttempt(code *OneTimeCode, maxAttempts int) (bool, error)
+	ConsumeOneTimeCode(code *OneTimeCode, effects ...func(tx *gorm.DB) error) error
+	ChangeAccess(userID uint, change func(user *User) (*AccessChange, error)) (*User, error)
+	GetAccessChanges(userID uint) ([]AccessChange, error)
+	tokens.RefreshStore
+}
+
+// ErrCodeConsumed is returned when consuming a one-time code that was
+// consumed in the meantime.
+var ErrCodeConsumed = errors.New("code already used")
+
+// AccessUnchangedError is returned by the change passed to ChangeAccess when
+// it would not change the user's access, e.g. granting a role they hold.
+type AccessUnchangedError struct {
+	Reason string
+}
+
+func (e *AccessUnchangedError) Error() string {
+	return e.Reason
 }
 
 type userRepository struct {
@@ -21,7 +48,7 @@ type userRepository struct {
 
 func (u userRepository) CreateUser(user *User) (*User, error) {
 	if err := u.DB.Create(user).Error; err != nil {
-		u.logger.Error("Error creating user", err)
+		u.logger.Error("Error creating user", "err", err)
 		return nil, err
 	}
 	u.logger.Info("User created successfully", "userID", user.ID)
@@ -35,7 +62,7 @@ func (u userRepository) GetUserByEmail(email string) (*User, error) {
 			u.logger.Info("User not found", "email", email)
 			return nil, nil
 		}
-		u.logger.Error("Error fetching user by email", err)
+		u.logger.Error("Error fetching user by email", "err", err)
 		return nil, err
 	}
 	u.logger.Info("User fetched successfully", "userID", user.ID)
@@ -44,7 +71,7 @@ func (u userRepository) GetUserByEmail(email string) (*User, error) {
 
 func (u userRepository) UpdateUser(userID uint, user *User) (*User, error) {
 	if err := u.DB.Model(&User{}).Where("id = ?", userID).Updates(user).Error; err != nil {
-		u.logger.Error("Error updating user", err)
+		u.logger.Error("Error updating user", "err", err)
 		return nil, err
 	}
 	u.logger.Info("User updated successfully", "userID", userID)
@@ -65,7 +92,7 @@ func (u userRepository) DeactivateUser(userID uint) (*User, error) {
 
 func (u userRepository) DeleteUserByEmail(email string) error {
 	if err := u.DB.Where("email = ?", email).Delete(&User{}).Error; err != nil {
-		u.logger.Error("Error deleting user by email", err)
+		u.logger.Error("Error deleting user by email", "err", err)
 		return err
 	}
 	u.logger.Info("User deleted successfully", "email", email)
@@ -79,13 +106,221 @@ func (u userRepository) GetUserByID(userID uint) (*User, error) {
 			u.logger.Info("User not found", "userID", userID)
 			return nil, nil
 		}
-		u.logger.Error("Error fetching user by ID", err)
+		u.logger.Error("Error fetching user by ID", "err", err)
 		return nil, err
 	}
 	u.logger.Info("User fetched successfully", "userID", userID)
 	return &user, nil
 }
 
+func (u userRepository) GetUserByPhoneNumber(phoneNumber string) (*User, error) {
+	var user User
+	if err := u.DB.Where("phone_number = ?", phoneNumber).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			u.logger.Info("User not found by phone number")
+			return nil, nil
+		}
+		u.logger.Error("Error fetching user by phone number", "err", err)
+		return nil, err
+	}
+	u.logger.Info("User fetched successfully", "userID", user.ID)
+	return &user, nil
+}
+
+// CreateOneTimeCode stores a new code and consumes the user's earlier codes
+// with the same purpose, so only the latest code works.
+func (u userRepository) CreateOneTimeCode(code *OneTimeCode) error {
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&OneTimeCode{}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", code.UserID, code.Purpose).
+			Update("consumed_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+	if err != nil {
+		u.logger.Error("Error creating one-time code", "userID", code.UserID, "purpose", code.Purpose, "err", err)
+		return err
+	}
+	return nil
+}
+
+// GetRecentOneTimeCodes returns the codes issued to a user for a purpose
+// since the given time, newest first.
+func (u userRepository) GetRecentOneTimeCodes(userID uint, purpose CodePurpose, since time.Time) ([]OneTimeCode, error) {
+	var codes []OneTimeCode
+	if err := u.DB.Where("user_id = ? AND purpose = ? AND created_at >= ?", userID, purpose, since).
+		Order("created_at DESC").
+		Find(&codes).Error; err != nil {
+		u.logger.Error("Error fetching one-time codes", "userID", userID, "purpose", purpose, "err", err)
+		return nil, err
+	}
+	return codes, nil
+}
+
+// GetActiveOneTimeCode returns the user's unconsumed, unexpired code for a
+// purpose, or nil if there is none.
+func (u userRepository) GetActiveOneTimeCode(userID uint, purpose CodePurpose) (*OneTimeCode, error) {
+	var code OneTimeCode
+	if err := u.DB.Where("user_id = ? AND purpose = ? AND consumed_at IS NULL AND expires_at > ?", userID, purpose, time.Now()).
+		Order("created_at DESC").
+		First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		u.logger.Error("Error fetching one-time code", "userID", userID, "purpose", purpose, "err", err)
+		return nil, err
+	}
+	return &code, nil
+}
+
+// RecordCodeAttempt counts a guess of code and reports whether the guess may
+// be checked, i.e. fewer than maxAttempts guesses were made before it.
+// Concurrent guesses are counted atomically, so they cannot exceed the limit.
+func (u userRepository) RecordCodeAttempt(code *OneTimeCode, maxAttempts int) (bool, error) {
+	result := u.DB.Model(&OneTimeCode{}).
+		Where("id = ? AND consumed_at IS NULL AND attempts < ?", code.ID, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		u.logger.Error("Error recording one-time code attempt", "codeID", code.ID, "err", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ConsumeOneTimeCode marks code used and applies the effects of using it in
+// the same transaction, returning ErrCodeConsumed if it was already used.
+func (u userRepository) ConsumeOneTimeCode(code *OneTimeCode, effects ...func(tx *gorm.DB) error) error {
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&OneTimeCode{}).
+			Where("id = ? AND consumed_at IS NULL", code.ID).
+			Update("consumed_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCodeConsumed
+		}
+		for _, effect := range effects {
+			if err := effect(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrCodeConsumed) {
+		u.logger.Error("Error consuming one-time code", "codeID", code.ID, "err", err)
+	}
+	return err
+}
+
+// ChangeAccess applies change to the user's role and permissions and records
+// the AccessChange it returns, in one transaction. The user is locked while
+// change runs, so concurrent changes cannot overwrite each other. It returns
+// nil if there is no such user.
+func (u userRepository) ChangeAccess(userID uint, change func(user *User) (*AccessChange, error)) (*User, error) {
+	var user User
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		record, err := change(&user)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Select("role", "permissions").Updates(&user).Error; err != nil {
+			return err
+		}
+		record.UserID = user.ID
+		return tx.Create(record).Error
+	})
+	var unchanged *AccessUnchangedError
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if !errors.As(err, &unchanged) {
+			u.logger.Error("Error changing user access", "userID", userID, "err", err)
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetAccessChanges returns the changes made to a user's access, newest first.
+func (u userRepository) GetAccessChanges(userID uint) ([]AccessChange, error) {
+	var changes []AccessChange
+	if err := u.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&changes).Error; err != nil {
+		u.logger.Error("Error fetching access changes", "userID", userID, "err", err)
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (u userRepository) CreateRefreshToken(token *tokens.RefreshToken) error {
+	if err := u.DB.Create(token).Error; err != nil {
+		u.logger.Error("Error creating refresh token", "userID", token.UserID, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (u userRepository) GetRefreshToken(tokenHash string) (*tokens.RefreshToken, error) {
+	var token tokens.RefreshToken
+	if err := u.DB.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		u.logger.Error("Error fetching refresh token", "err", err)
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken marks current used and saves next in one transaction.
+// Concurrent rotations of the same token are serialised by the conditional
+// update: only one of them succeeds, the others get ErrRefreshTokenReused.
+func (u userRepository) RotateRefreshToken(current, next *tokens.RefreshToken) error {
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&tokens.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", current.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tokens.ErrRefreshTokenReused
+		}
+		return tx.Create(next).Error
+	})
+	if err != nil && !errors.Is(err, tokens.ErrRefreshTokenReused) {
+		u.logger.Error("Error rotating refresh token", "tokenID", current.ID, "err", err)
+	}
+	return err
+}
+
+func (u userRepository) RevokeRefreshTokenFamily(familyID, reason string) error {
+	if err := u.DB.Model(&tokens.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error; err != nil {
+		u.logger.Error("Error revoking refresh token family", "familyID", familyID, "err", err)
+		return err
+	}
+	u.logger.Info("Refresh token family revoked", "familyID", familyID, "reason", reason)
+	return nil
+}
+
+func (u userRepository) RevokeUserRefreshTokens(userID uint, reason string) error {
+	if err := u.DB.Model(&tokens.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error; err != nil {
+		u.logger.Error("Error revoking user refresh tokens", "userID", userID, "err", err)
+		return err
+	}
+	u.logger.Info("User refresh tokens revoked", "userID", userID, "reason", reason)
+	return nil
+}
+
 func NewUserRepository(db *gorm.DB, logger *slog.Logger) UserRepository {
 	return userRepository{
 		DB:     db,
@@ -0,0 +1,165 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GrantRole gives a user a role, replacing the one they hold. Like every
+// access change, it reaches the user's access tokens on their next refresh.
+func (u userService) GrantRole(c echo.Context) error {
+	var request GrantRoleRequest
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+
+	return u.changeAccess(c, func(user *User) (*AccessChange, error) {
+		if user.Role == request.Role {
+			return nil, &AccessUnchangedError{Reason: fmt.Sprintf("user already holds the %s role", request.Role)}
+		}
+		previous := user.Role
+		user.Role = request.Role
+		return &AccessChange{Action: AccessRoleGranted, Value: request.Role, Previous: previous}, nil
+	})
+}
+
+// RevokeRole takes a role away from a user, who is left a customer.
+func (u userService) RevokeRole(c echo.Context) error {
+	role := c.Param("role")
+	if !IsRole(role) {
+		return u.handleError(c, fmt.Errorf("unknown role %q", role), http.StatusBadRequest)
+	}
+
+	return u.changeAccess(c, func(user *User) (*AccessChange, error) {
+		if user.Role != role {
+			return nil, &AccessUnchangedError{Reason: fmt.Sprintf("user does not hold the %s role", role)}
+		}
+		if role == RoleCustomer {
+			return nil, &AccessUnchangedError{Reason: "the customer role cannot be revoked; grant another role instead"}
+		}
+		user.Role = RoleCustomer
+		return &AccessChange{Action: AccessRoleRevoked, Value: role, Previous: role}, nil
+	})
+}
+
+// GrantPermission gives a user a permission on top of their role's.
+func (u userService) GrantPermission(c echo.Context) error {
+	var request GrantPermissionRequest
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if !IsPermission(request.Permission) {
+		return u.handleError(c, fmt.Errorf("unknown permission %q", request.Permission), http.StatusBadRequest)
+	}
+
+	return u.changeAccess(c, func(user *User) (*AccessChange, error) {
+		for _, p := range user.Permissions {
+			if p == request.Permission {
+				return nil, &AccessUnchangedError{Reason: fmt.Sprintf("user already holds the %s permission", request.Permission)}
+			}
+		}
+		user.Permissions = append(user.Permissions, request.Permission)
+		return &AccessChange{Action: AccessPermissionGranted, Value: request.Permission}, nil
+	})
+}
+
+// RevokePermission takes away a permission granted directly to a user.
+// Permissions that come with the user's role are revoked by changing role.
+func (u userService) RevokePermission(c echo.Context) error {
+	permission := c.Param("permission")
+
+	return u.changeAccess(c, func(user *User) (*AccessChange, error) {
+		for i, p := range user.Permissions {
+			if p == permission {
+				user.Permissions = append(user.Permissions[:i:i], user.Permissions[i+1:]...)
+				return &AccessChange{Action: AccessPermissionRevoked, Value: permission}, nil
+			}
+		}
+		return nil, &AccessUnchangedError{Reason: fmt.Sprintf("the %s permission was not granted directly to the user", permission)}
+	})
+}
+
+// AccessChanges lists the changes made to a user's access, newest first.
+func (u userService) AccessChanges(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return u.handleError(c, errors.New("invalid user id"), http.StatusBadRequest)
+	}
+
+	changes, err := u.repository.GetAccessChanges(uint(userID))
+	if err != nil {
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Access changes fetched successfully",
+		Data:    changes,
+	})
+}
+
+// changeAccess applies change to the access of the user in the path and
+// records who made it. Admins cannot change their own access, so they cannot
+// lock themselves out or widen their own access.
+func (u userService) changeAccess(c echo.Context, change func(user *User) (*AccessChange, error)) error {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return u.handleError(c, errors.New("invalid user id"), http.StatusBadRequest)
+	}
+	actorID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return u.handleError(c, err, http.StatusUnauthorized)
+	}
+	if actorID == uint(userID) {
+		return u.handleError(c, errors.New("you cannot change your own access"), http.StatusForbidden)
+	}
+
+	actor := fmt.Sprintf("user:%d", actorID)
+	user, err := u.repository.ChangeAccess(uint(userID), func(user *User) (*AccessChange, error) {
+		record, err := change(user)
+		if err != nil {
+			return nil, err
+		}
+		record.Actor = actor
+		return record, nil
+	})
+	if err != nil {
+		var unchanged *AccessUnchangedError
+		if errors.As(err, &unchanged) {
+			return u.handleError(c, err, http.StatusConflict)
+		}
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+	if user == nil {
+		return u.handleError(c, errors.New("user not found"), http.StatusNotFound)
+	}
+
+	u.logger.Info("User access changed", "userID", user.ID, "role", user.Role, "actor", actor)
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "User access updated successfully",
+		Data: UserDto{
+			ID:          user.ID,
+			FullName:    user.FullName,
+			Email:       user.Email,
+			PhoneNumber: user.PhoneNumber,
+			IsActive:    user.IsActive,
+			IsVerified:  user.IsVerified,
+			Role:        user.Role,
+			Permissions: user.EffectivePermissions(),
+			Tier:        user.Tier,
+		},
+	})
+}
@@ -0,0 +1,178 @@
+package user
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestEffectivePermissions(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		want []string
+	}{
+		{"customer", User{Role: RoleCustomer}, nil},
+		{"support", User{Role: RoleSupport}, []string{PermPaymentsReadAll}},
+		{"direct grant", User{Role: RoleSupport, Permissions: []string{PermLedgerRead}}, []string{PermLedgerRead, PermPaymentsReadAll}},
+		{"grant the role has", User{Role: RoleSupport, Permissions: []string{PermPaymentsReadAll}}, []string{PermPaymentsReadAll}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.EffectivePermissions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EffectivePermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyStaffMayRefund(t *testing.T) {
+	for role, permissions := range RolePermissions {
+		may := false
+		for _, p := range permissions {
+			may = may || p == PermPaymentsRefund
+		}
+		if want := role == RoleFinance || role == RoleAdmin; may != want {
+			t.Errorf("%s may refund = %v, want %v", role, may, want)
+		}
+	}
+}
+
+// accessRepository keeps users in memory and records changes to their access.
+type accessRepository struct {
+	UserRepository
+	users   map[uint]*User
+	changes []AccessChange
+}
+
+func (r *accessRepository) ChangeAccess(userID uint, change func(user *User) (*AccessChange, error)) (*User, error) {
+	stored, ok := r.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	user := *stored
+	user.Permissions = append([]string{}, stored.Permissions...)
+	record, err := change(&user)
+	if err != nil {
+		return nil, err
+	}
+	record.UserID = userID
+	r.changes = append(r.changes, *record)
+	r.users[userID] = &user
+	return &user, nil
+}
+
+// changeAccessOf runs handler as admin user 1 on the access of the user
+// with the given ID. param is an optional path parameter name and value.
+func changeAccessOf(t *testing.T, handler echo.HandlerFunc, userID, body string, param ...string) (*httptest.ResponseRecorder, UserDto) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(userID)
+	if len(param) == 2 {
+		c.SetParamNames("id", param[0])
+		c.SetParamValues(userID, param[1])
+	}
+	c.Set("claims", &tokens.Claims{UserID: "1", Role: RoleAdmin})
+
+	if err := handler(c); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	var response struct {
+		Data UserDto `json:"data"`
+	}
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, response.Data
+}
+
+func newAccessTest() (userService, *accessRepository) {
+	repository := &accessRepository{users: map[uint]*User{
+		1: {Role: RoleAdmin},
+		7: {Role: RoleSupport, Permissions: []string{PermLedgerRead}},
+	}}
+	return userService{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), repository: repository}, repository
+}
+
+func TestGrantRole(t *testing.T) {
+	service, repository := newAccessTest()
+
+	rec, user := changeAccessOf(t, service.GrantRole, "7", `{"role":"finance"}`)
+	if rec.Code != http.StatusOK || user.Role != RoleFinance {
+		t.Fatalf("GrantRole() = %d %+v, want the finance role", rec.Code, user)
+	}
+	if want := (&User{Role: RoleFinance}).EffectivePermissions(); !reflect.DeepEqual(user.Permissions, want) {
+		t.Errorf("permissions = %v, want the finance role's %v", user.Permissions, want)
+	}
+	want := AccessChange{UserID: 7, Action: AccessRoleGranted, Value: RoleFinance, Previous: RoleSupport, Actor: "user:1"}
+	if len(repository.changes) != 1 || repository.changes[0] != want {
+		t.Errorf("access changes = %+v, want %+v", repository.changes, want)
+	}
+
+	if rec, _ := changeAccessOf(t, service.GrantRole, "7", `{"role":"finance"}`); rec.Code != http.StatusConflict {
+		t.Errorf("granting a held role = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec, _ := changeAccessOf(t, service.GrantRole, "7", `{"role":"owner"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("granting an unknown role = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRevokeRole(t *testing.T) {
+	service, repository := newAccessTest()
+
+	if rec, user := changeAccessOf(t, service.RevokeRole, "7", "", "role", RoleSupport); rec.Code != http.StatusOK || user.Role != RoleCustomer {
+		t.Fatalf("RevokeRole() = %d %+v, want the user left a customer", rec.Code, user)
+	}
+	if rec, _ := changeAccessOf(t, service.RevokeRole, "7", "", "role", RoleCustomer); rec.Code != http.StatusConflict {
+		t.Errorf("revoking the customer role = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if len(repository.changes) != 1 {
+		t.Errorf("recorded %d access changes, want 1", len(repository.changes))
+	}
+}
+
+func TestPermissionGrants(t *testing.T) {
+	service, repository := newAccessTest()
+
+	if rec, user := changeAccessOf(t, service.GrantPermission, "7", `{"permission":"payments:review"}`); rec.Code != http.StatusOK || !reflect.DeepEqual(repository.users[7].Permissions, []string{PermLedgerRead, PermPaymentsReview}) {
+		t.Errorf("GrantPermission() = %d %+v, want payments:review granted", rec.Code, user)
+	}
+	if rec, _ := changeAccessOf(t, service.GrantPermission, "7", `{"permission":"payments:everything"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("granting an unknown permission = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec, _ := changeAccessOf(t, service.RevokePermission, "7", "", "permission", PermLedgerRead); rec.Code != http.StatusOK || !reflect.DeepEqual(repository.users[7].Permissions, []string{PermPaymentsReview}) {
+		t.Errorf("RevokePermission() = %d, permissions %v, want only payments:review left", rec.Code, repository.users[7].Permissions)
+	}
+	// Permissions of the role are not granted directly, so cannot be revoked on their own
+	if rec, _ := changeAccessOf(t, service.RevokePermission, "7", "", "permission", PermPaymentsReadAll); rec.Code != http.StatusConflict {
+		t.Errorf("revoking a permission of the role = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestChangeAccessRejections(t *testing.T) {
+	service, repository := newAccessTest()
+
+	if rec, _ := changeAccessOf(t, service.GrantRole, "1", `{"role":"customer"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("changing your own access = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec, _ := changeAccessOf(t, service.GrantRole, "99", `{"role":"admin"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("changing an unknown user's access = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if len(repository.changes) != 0 {
+		t.Errorf("recorded access changes %+v, want none", repository.changes)
+	}
+}
@@ -0,0 +1,59 @@
+package user
+
+import (
+	"errors"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// bootstrapActor is recorded as the actor of the access change made by BootstrapAdmin.
+const bootstrapActor = "system:bootstrap"
+
+// BootstrapAdmin makes the user registered with email an admin while no user
+// holds the admin role, so a fresh deployment has someone to grant roles
+// through the API. The user must have registered and verified their email
+// first; until then a warning is logged and the next start tries again. It
+// does nothing if email is empty or an admin already exists.
+func BootstrapAdmin(db *gorm.DB, logger *slog.Logger, email string) error {
+	if email == "" {
+		return nil
+	}
+
+	var admins int64
+	if err := db.Model(&User{}).Where("role = ?", RoleAdmin).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	repository := NewUserRepository(db, logger)
+	user, err := repository.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.IsActive || !user.IsVerified {
+		logger.Warn("No admin exists and the bootstrap admin has not registered and verified their email yet", "email", email)
+		return nil
+	}
+
+	_, err = repository.ChangeAccess(user.ID, func(user *User) (*AccessChange, error) {
+		if user.Role == RoleAdmin {
+			return nil, &AccessUnchangedError{Reason: "user already holds the admin role"}
+		}
+		previous := user.Role
+		user.Role = RoleAdmin
+		return &AccessChange{Action: AccessRoleGranted, Value: RoleAdmin, Previous: previous, Actor: bootstrapActor}, nil
+	})
+	var unchanged *AccessUnchangedError
+	if errors.As(err, &unchanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Bootstrap admin granted the admin role", "userID", user.ID)
+	return nil
+}
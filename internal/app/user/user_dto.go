@@ -27,23 +27,45 @@ type SignInRequest struct {
 	Provider ProviderType `json:"provider" validate:"required,oneof=email"`
 }
 
+type VerifyAccountRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required"`
+}
+
+type ResendCodeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
 type InitiateResetPasswordRequest struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
 type ResetPasswordRequest struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"` // bcrypt ignores anything past 72 bytes
 	Otp      string `json:"otp" validate:"required"`
 }
 
 type UserDto struct {
-	ID          uint   `json:"id"`
-	FullName    string `json:"full_name"`
-	Email       string `json:"email" gorm:"uniqueIndex"`
-	PhoneNumber string `json:"phone_number"`
-	IsActive    bool   `json:"is_active"`
-	IsVerified  bool   `json:"is_verified"`
+	ID          uint     `json:"id"`
+	FullName    string   `json:"full_name"`
+	Email       string   `json:"email" gorm:"uniqueIndex"`
+	PhoneNumber string   `json:"phone_number"`
+	IsActive    bool     `json:"is_active"`
+	IsVerified  bool     `json:"is_verified"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"` // Effective permissions, from the role and direct grants
+	Tier        string   `json:"tier"`
+}
+
+// GrantRoleRequest gives a user a role, replacing the role they hold.
+type GrantRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=customer merchant support finance admin"`
+}
+
+// GrantPermissionRequest gives a user a permission on top of their role's.
+type GrantPermissionRequest struct {
+	Permission string `json:"permission" validate:"required"`
 }
 
 type RefreshTokenResponse struct {
@@ -52,7 +74,7 @@ type RefreshTokenResponse struct {
 }
 
 type RefreshToken struct {
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 type LoginResponse struct {
@@ -11,6 +11,17 @@ type UserHandler interface {
 	Login(c echo.Context) error
 	Register(c echo.Context) error
 	RefreshToken(c echo.Context) error
+	VerifyAccount(c echo.Context) error
+	ResendVerificationCode(c echo.Context) error
+	SendResetToken(c echo.Context) error
+	ResetPassword(c echo.Context) error
+	Logout(c echo.Context) error
+	LogoutAll(c echo.Context) error
+	GrantRole(c echo.Context) error
+	RevokeRole(c echo.Context) error
+	GrantPermission(c echo.Context) error
+	RevokePermission(c echo.Context) error
+	AccessChanges(c echo.Context) error
 }
 
 type userHandler struct {
@@ -20,12 +31,12 @@ type userHandler struct {
 
 // RefreshToken godoc
 // @Summary Refresh the user's authentication token
-// @Description Generates a new authentication token using the refresh token
+// @Description Exchanges a refresh token for a new access token and a new refresh token. Each refresh token works once; reusing one revokes the session.
 // @Tags Users
 // @Accept  json
 // @Produce  json
-// @Param   user body RefreshToken true "Update Profile Request"
-// @Success 200 {object} common.BaseResponse
+// @Param   user body RefreshToken true "Refresh Token Request"
+// @Success 200 {object} common.BaseResponse{data=RefreshTokenResponse}
 // @Failure 400 {object} common.ErrorResponse
 // @Failure 401 {object} common.ErrorResponse
 // @Failure 500 {object} common.ErrorResponse
@@ -65,6 +76,178 @@ func (u userHandler) Register(c echo.Context) error {
 	return u.userService.RegisterUser(c)
 }
 
+// VerifyAccount godoc
+// @Summary Verify a new account
+// @Description Verifies the account's email address with the code emailed at registration. A code works once, expires after a few minutes, and stops working after a few wrong guesses.
+// @Tags Authentication
+// @Accept  json
+// @Produce  json
+// @Param   VerifyAccountRequest body VerifyAccountRequest true "Verification"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 429 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /auth/verify [post]
+func (u userHandler) VerifyAccount(c echo.Context) error {
+	return u.userService.VerifyAccount(c)
+}
+
+// ResendVerificationCode godoc
+// @Summary Resend the verification code
+// @Description Emails a new verification code to an account awaiting verification, replacing the previous code. Codes are sent at most once a minute and a few times an hour. The response is the same whether or not the account exists.
+// @Tags Authentication
+// @Accept  json
+// @Produce  json
+// @Param   ResendCodeRequest body ResendCodeRequest true "Account email"
+// @Success 202 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Router  /auth/verify/resend [post]
+func (u userHandler) ResendVerificationCode(c echo.Context) error {
+	return u.userService.ResendVerificationCode(c)
+}
+
+// SendResetToken godoc
+// @Summary Request a password reset code
+// @Description Emails a password reset code to the account with the given email. The response is the same whether or not the account exists.
+// @Tags Authentication
+// @Accept  json
+// @Produce  json
+// @Param   InitiateResetPasswordRequest body InitiateResetPasswordRequest true "Account email"
+// @Success 202 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Router  /auth/initiate-reset [post]
+func (u userHandler) SendResetToken(c echo.Context) error {
+	return u.userService.SendResetToken(c)
+}
+
+// ResetPassword godoc
+// @Summary Reset the password
+// @Description Sets a new password using the emailed reset code and signs the user out of every device
+// @Tags Authentication
+// @Accept  json
+// @Produce  json
+// @Param   ResetPasswordRequest body ResetPasswordRequest true "Reset Password Request"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 429 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /auth/reset-password [post]
+func (u userHandler) ResetPassword(c echo.Context) error {
+	return u.userService.ResetPassword(c)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revokes the session of the given refresh token. Access tokens already issued stay valid until they expire.
+// @Tags Authentication
+// @Accept  json
+// @Produce  json
+// @Param   RefreshToken body RefreshToken true "Refresh token of the session"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /auth/logout [post]
+func (u userHandler) Logout(c echo.Context) error {
+	return u.userService.Logout(c)
+}
+
+// LogoutAll godoc
+// @Summary Log out everywhere
+// @Description Revokes every session of the authenticated user
+// @Tags Authentication
+// @Produce  json
+// @Success 200 {object} common.BaseResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /auth/logout-all [post]
+func (u userHandler) LogoutAll(c echo.Context) error {
+	return u.userService.LogoutAll(c)
+}
+
+// GrantRole godoc
+// @Summary Grant a role to a user
+// @Description Gives a user a role, replacing the role they hold. The change is audited and reaches the user's access tokens on their next refresh.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "User ID"
+// @Param   GrantRoleRequest body GrantRoleRequest true "Role to grant"
+// @Success 200 {object} common.BaseResponse{data=UserDto}
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Router  /admin/users/{id}/roles [post]
+func (u userHandler) GrantRole(c echo.Context) error {
+	return u.userService.GrantRole(c)
+}
+
+// RevokeRole godoc
+// @Summary Revoke a role from a user
+// @Description Takes a role away from a user, who is left a customer. The change is audited.
+// @Tags Admin
+// @Produce  json
+// @Param   id path int true "User ID"
+// @Param   role path string true "Role to revoke"
+// @Success 200 {object} common.BaseResponse{data=UserDto}
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Router  /admin/users/{id}/roles/{role} [delete]
+func (u userHandler) RevokeRole(c echo.Context) error {
+	return u.userService.RevokeRole(c)
+}
+
+// GrantPermission godoc
+// @Summary Grant a permission to a user
+// @Description Gives a user a permission on top of those of their role. The change is audited.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "User ID"
+// @Param   GrantPermissionRequest body GrantPermissionRequest true "Permission to grant"
+// @Success 200 {object} common.BaseResponse{data=UserDto}
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Router  /admin/users/{id}/permissions [post]
+func (u userHandler) GrantPermission(c echo.Context) error {
+	return u.userService.GrantPermission(c)
+}
+
+// RevokePermission godoc
+// @Summary Revoke a permission from a user
+// @Description Takes away a permission granted directly to a user. The change is audited.
+// @Tags Admin
+// @Produce  json
+// @Param   id path int true "User ID"
+// @Param   permission path string true "Permission to revoke"
+// @Success 200 {object} common.BaseResponse{data=UserDto}
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 403 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Router  /admin/users/{id}/permissions/{permission} [delete]
+func (u userHandler) RevokePermission(c echo.Context) error {
+	return u.userService.RevokePermission(c)
+}
+
+// AccessChanges godoc
+// @Summary List a user's access changes
+// @Description Lists the audited changes to a user's role and permissions, newest first
+// @Tags Admin
+// @Produce  json
+// @Param   id path int true "User ID"
+// @Success 200 {object} common.BaseResponse{data=[]AccessChange}
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /admin/users/{id}/access-changes [get]
+func (u userHandler) AccessChanges(c echo.Context) error {
+	return u.userService.AccessChanges(c)
+}
+
 func NewUserHandler(logger *slog.Logger, service UserService) UserHandler {
 	return userHandler{logger: logger, userService: service}
 }
@@ -0,0 +1,12 @@
+package user
+
+import "gorm.io/gorm"
+
+// legacyRoleUser is the role every user held before roles were introduced.
+const legacyRoleUser = "user"
+
+// Migrate moves users still holding the legacy "user" role to the customer
+// role. It must run after the users table has been migrated.
+func Migrate(db *gorm.DB) error {
+	return db.Model(&User{}).Where("role = ?", legacyRoleUser).Update("role", RoleCustomer).Error
+}
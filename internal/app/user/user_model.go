@@ -1,16 +1,88 @@
 package user
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Roles a user can hold, one at a time. The role and the permissions it
+// grants are embedded in access tokens at login; see RolePermissions.
+const (
+	RoleCustomer = "customer"
+	RoleMerchant = "merchant"
+	RoleSupport  = "support"
+	RoleFinance  = "finance"
+	RoleAdmin    = "admin"
+)
+
+// Tiers decide a user's transfer limits.
+const (
+	TierStandard = "standard"
+	TierPremium  = "premium"
+)
+
 // User represents a user in the system
 type User struct {
 	gorm.Model
-	FullName    string `json:"full_name" gorm:"size:255;not null"`
-	Email       string `json:"email" gorm:"size:100;uniqueIndex;not null"`
-	PhoneNumber string `json:"phone_number"`
-	Password    string `json:"-" gorm:"size:255;not null"`
-	IsActive    bool   `json:"is_active" gorm:"default:true"`
-	IsVerified  bool   `json:"is_verified" gorm:"default:false"`
+	FullName    string   `json:"full_name" gorm:"size:255;not null"`
+	Email       string   `json:"email" gorm:"size:100;uniqueIndex;not null"`
+	PhoneNumber string   `json:"phone_number"`
+	Password    string   `json:"-" gorm:"size:255;not null"`
+	IsActive    bool     `json:"is_active" gorm:"default:true"`
+	IsVerified  bool     `json:"is_verified" gorm:"default:false"`
+	Role        string   `json:"role" gorm:"size:20;not null;default:customer"`
+	Permissions []string `json:"permissions" gorm:"type:jsonb;serializer:json"` // Granted directly, on top of the role's permissions
+	Tier        string   `json:"tier" gorm:"size:20;not null;default:standard"`
+
+	TokensValidAfter *time.Time `json:"-"` // Refresh tokens issued before this are rejected, e.g. after a password reset
+}
+
+// CodePurpose is what a one-time code emailed to a user proves.
+type CodePurpose string
+
+const (
+	CodeEmailVerification CodePurpose = "email_verification"
+	CodePasswordReset     CodePurpose = "password_reset"
+)
+
+// OneTimeCode is a short code emailed to a user, stored hashed. A code is
+// consumed by its first successful use or when a newer code with the same
+// purpose is issued, and stops working after too many wrong guesses.
+type OneTimeCode struct {
+	ID         uint        `gorm:"primaryKey"`
+	UserID     uint        `gorm:"not null;index:idx_user_one_time_codes_user,priority:1"`
+	Purpose    CodePurpose `gorm:"size:30;not null;index:idx_user_one_time_codes_user,priority:2"`
+	CodeHash   string      `gorm:"size:100;not null"`
+	Attempts   int         `gorm:"not null;default:0"` // Wrong and right guesses made so far
+	ExpiresAt  time.Time   `gorm:"not null"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time `gorm:"not null;index:idx_user_one_time_codes_user,priority:3"`
+}
+
+func (OneTimeCode) TableName() string {
+	return "user_one_time_codes"
+}
+
+// Changes to a user's access recorded in AccessChange.
+const (
+	AccessRoleGranted       = "role_granted"
+	AccessRoleRevoked       = "role_revoked"
+	AccessPermissionGranted = "permission_granted"
+	AccessPermissionRevoked = "permission_revoked"
+)
+
+// AccessChange is an audit record of a change to a user's role or permissions.
+type AccessChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Action    string    `gorm:"size:30;not null" json:"action"`
+	Value     string    `gorm:"size:50;not null" json:"value"`     // The role or permission granted or revoked
+	Previous  string    `gorm:"size:20" json:"previous,omitempty"` // The role held before a role change
+	Actor     string    `gorm:"size:100;not null" json:"actor"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+func (AccessChange) TableName() string {
+	return "user_access_changes"
 }
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"fmt"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/pkg/auth"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
+	"gorm.io/gorm"
+)
+
+// SendResetToken emails a password reset code to the account with the
+// requested email. The response is the same whether or not the account
+// exists, and the code is issued and sent in the background so the response
+// time does not tell either.
+func (u userService) SendResetToken(c echo.Context) error {
+	var request InitiateResetPasswordRequest
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+
+	go u.sendPasswordResetCode(request.Email)
+
+	return c.JSON(http.StatusAccepted, common.BaseResponse{
+		Status:  http.StatusAccepted,
+		Message: "If an account exists for this email, a password reset code has been sent to it",
+	})
+}
+
+// sendPasswordResetCode issues a password reset code to the account with the
+// given email, if there is one, and emails it. Failures, including requests
+// over the rate limit, are only logged.
+func (u userService) sendPasswordResetCode(email string) {
+	user, err := u.repository.GetUserByEmail(email)
+	if err != nil || user == nil {
+		return
+	}
+
+	code, err := u.issueCode(user, CodePasswordReset)
+	if err != nil {
+		u.logger.Warn("Password reset code not issued", "userID", user.ID, "err", err)
+		return
+	}
+	_ = u.sendEmail(user, "Reset your Mamlaka password", hermes.Body{
+		Name:   user.FullName,
+		Intros: []string{"We received a request to reset the password of your Mamlaka account."},
+		Actions: []hermes.Action{{
+			Instructions: "Enter this code to choose a new password:",
+			InviteCode:   code,
+		}},
+		Outros: []string{fmt.Sprintf("The code expires in %s. If you did not ask to reset your password, you can ignore this email; your password has not changed.", u.config.Auth.CodeTTL)},
+	})
+}
+
+// ResetPassword sets a new password if the request carries the latest
+// password reset code emailed to the account. Every refresh token issued
+// before the reset stops working, and the user is told their password changed.
+func (u userService) ResetPassword(c echo.Context) error {
+	var request ResetPasswordRequest
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+
+	// The password is hashed before the account is looked up so that
+	// requests for unknown accounts take as long as the others
+	hash, err := auth.HashPassword(request.Password)
+	if err != nil {
+		u.logger.Error("Error hashing password", "err", err)
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	user, err := u.repository.GetUserByEmail(request.Email)
+	if err != nil {
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+	if user == nil {
+		return u.handleCodeError(c, rejectCode(request.Otp))
+	}
+	setPassword := func(tx *gorm.DB) error {
+		return tx.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"password":           hash,
+			"tokens_valid_after": time.Now(),
+		}).Error
+	}
+	if err := u.checkCode(user, CodePasswordReset, request.Otp, setPassword); err != nil {
+		return u.handleCodeError(c, err)
+	}
+
+	u.logger.Info("Password reset", "userID", user.ID)
+	// tokens_valid_after already stops the old sessions; revoking them keeps
+	// the session records accurate.
+	if err := u.repository.RevokeUserRefreshTokens(user.ID, tokens.RevokedPasswordReset); err != nil {
+		u.logger.Error("Error revoking sessions after password reset", "userID", user.ID, "err", err)
+	}
+	go u.sendEmail(user, "Your Mamlaka password was changed", hermes.Body{
+		Name:   user.FullName,
+		Intros: []string{"The password of your Mamlaka account was just changed, and you have been signed out of every device."},
+		Outros: []string{"If you did not change your password, contact support immediately."},
+	})
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Password reset successfully. Log in with your new password",
+	})
+}
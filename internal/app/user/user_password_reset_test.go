@@ -0,0 +1,102 @@
+package user
+
+import (
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type revocation struct {
+	userID uint
+	reason string
+}
+
+// resetRepository is a codeRepository that records whose refresh tokens
+// are revoked.
+type resetRepository struct {
+	*codeRepository
+	revoked []revocation
+}
+
+func (r *resetRepository) RevokeUserRefreshTokens(userID uint, reason string) error {
+	r.revoked = append(r.revoked, revocation{userID: userID, reason: reason})
+	return nil
+}
+
+func newResetTest() (userService, *resetRepository, *User) {
+	service, codes, jane := newCodeTest()
+	repository := &resetRepository{codeRepository: codes}
+	service.repository = repository
+	return service, repository, jane
+}
+
+func TestResetPassword(t *testing.T) {
+	service, repository, jane := newResetTest()
+	code := repository.addCode(t, jane, CodePasswordReset, "123456")
+
+	rec, _ := post(t, service.ResetPassword, `{"email":"jane@example.com","password":"new-password","otp":"123456"}`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if code.ConsumedAt == nil {
+		t.Error("code was not consumed")
+	}
+	if want := (revocation{userID: jane.ID, reason: tokens.RevokedPasswordReset}); len(repository.revoked) != 1 || repository.revoked[0] != want {
+		t.Errorf("revoked sessions = %+v, want only %+v", repository.revoked, want)
+	}
+}
+
+func TestResetPasswordRejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     int
+		wantCode string
+	}{
+		{"wrong code", `{"email":"jane@example.com","password":"new-password","otp":"654321"}`, http.StatusBadRequest, common.CodeInvalidCode},
+		{"unknown account", `{"email":"nobody@example.com","password":"new-password","otp":"654321"}`, http.StatusBadRequest, common.CodeInvalidCode},
+		{"verification code", `{"email":"jane@example.com","password":"new-password","otp":"111111"}`, http.StatusBadRequest, common.CodeInvalidCode},
+		{"short password", `{"email":"jane@example.com","password":"short","otp":"123456"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repository, jane := newResetTest()
+			repository.addCode(t, jane, CodePasswordReset, "123456")
+			repository.addCode(t, jane, CodeEmailVerification, "111111")
+
+			rec, response := post(t, service.ResetPassword, tt.body)
+			if rec.Code != tt.want || response.Code != tt.wantCode {
+				t.Errorf("response = %d %q, want %d %q", rec.Code, response.Code, tt.want, tt.wantCode)
+			}
+			if len(repository.revoked) != 0 {
+				t.Error("sessions were revoked without a password reset")
+			}
+		})
+	}
+}
+
+func TestSendResetTokenAlwaysAccepted(t *testing.T) {
+	service, repository, _ := newResetTest()
+
+	known, _ := post(t, service.SendResetToken, `{"email":"jane@example.com"}`)
+	unknown, _ := post(t, service.SendResetToken, `{"email":"nobody@example.com"}`)
+
+	if known.Code != http.StatusAccepted || unknown.Body.String() != known.Body.String() {
+		t.Errorf("responses = %d %s and %d %s, want the same 202", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		active, _ := repository.GetActiveOneTimeCode(7, CodePasswordReset)
+		if active != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no password reset code was issued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,68 @@
+package user
+
+import (
+	"mamlaka/internal/pkg/tokens"
+	"sort"
+)
+
+// Permissions checked by middlewares.RequirePermission.
+const (
+	PermPaymentsRefund    = "payments:refund"     // Refund payments
+	PermPaymentsReadAll   = "payments:read_all"   // List every user's payments
+	PermPaymentsReview    = "payments:review"     // Approve or reject payments flagged by risk screening
+	PermRiskManage        = "risk:manage"         // Read and change the risk rules and decisions
+	PermLedgerRead        = "ledger:read"         // Read ledger balances
+	PermLedgerWrite       = "ledger:write"        // Record payouts in the ledger
+	PermUsersManageAccess = "users:manage_access" // Grant and revoke roles and permissions
+)
+
+// RolePermissions lists the permissions each role grants. Refunds are issued
+// by finance and admins; customers and merchants ask them for one.
+var RolePermissions = map[string][]string{
+	RoleCustomer: {},
+	RoleMerchant: {},
+	RoleSupport:  {PermPaymentsReadAll},
+	RoleFinance:  {PermPaymentsRefund, PermPaymentsReadAll, PermPaymentsReview, PermLedgerRead, PermLedgerWrite},
+	RoleAdmin: {
+		PermPaymentsRefund, PermPaymentsReadAll, PermPaymentsReview, PermRiskManage,
+		PermLedgerRead, PermLedgerWrite, PermUsersManageAccess,
+	},
+}
+
+// IsRole reports whether role is one of the roles a user can hold.
+func IsRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// IsPermission reports whether permission is one any role grants.
+func IsPermission(permission string) bool {
+	for _, permissions := range RolePermissions {
+		for _, p := range permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EffectivePermissions returns the permissions of the user's role and those
+// granted directly, sorted and without duplicates.
+func (u *User) EffectivePermissions() []string {
+	seen := make(map[string]bool)
+	var permissions []string
+	for _, p := range append(append([]string{}, RolePermissions[u.Role]...), u.Permissions...) {
+		if !seen[p] {
+			seen[p] = true
+			permissions = append(permissions, p)
+		}
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// subject returns what access tokens issued to the user carry.
+func (u *User) subject() tokens.Subject {
+	return tokens.Subject{UserID: u.ID, Role: u.Role, Permissions: u.EffectivePermissions()}
+}
@@ -2,22 +2,39 @@ package user
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
 	"gorm.io/gorm"
 	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/middlewares"
 )
 
-func RegisterUserRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB) {
+func RegisterUserRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB, conf config.Config, h *hermes.Hermes) {
 	userRepository := NewUserRepository(db, logger)
-	userService := NewUserService(logger, userRepository)
+	userService := NewUserService(logger, userRepository, conf, h)
 	userHandler := NewUserHandler(logger, userService)
 
 	auth := e.Group("/auth")
 	{
 		auth.POST("/login", userHandler.Login)
 		auth.POST("/register", userHandler.Register)
-		//auth.POST("/verify", userHandler.VerifyAccount)
-		//auth.POST("/initiate-reset", userHandler.SendResetToken)
-		//auth.POST("/reset-password", userHandler.ResetPassword)
+		auth.POST("/verify", userHandler.VerifyAccount)
+		auth.POST("/verify/resend", userHandler.ResendVerificationCode)
+		auth.POST("/initiate-reset", userHandler.SendResetToken)
+		auth.POST("/reset-password", userHandler.ResetPassword)
+		auth.POST("/logout", userHandler.Logout)
+		auth.POST("/logout-all", userHandler.LogoutAll, middlewares.JWTMiddleware)
+	}
+
+	admin := e.Group("/admin/users")
+	{
+		admin.Use(middlewares.JWTMiddleware, middlewares.RequirePermission(PermUsersManageAccess))
+
+		admin.POST("/:id/roles", userHandler.GrantRole)
+		admin.DELETE("/:id/roles/:role", userHandler.RevokeRole)
+		admin.POST("/:id/permissions", userHandler.GrantPermission)
+		admin.DELETE("/:id/permissions/:permission", userHandler.RevokePermission)
+		admin.GET("/:id/access-changes", userHandler.AccessChanges)
 	}
 
 	profile := e.Group("/user")
@@ -3,14 +3,14 @@ package user
 import (
 	"errors"
 	"log/slog"
+	"mamlaka/config"
 	"mamlaka/internal/app/common"
 	"mamlaka/internal/pkg/auth"
 	"mamlaka/internal/pkg/tokens"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
 )
 
 // UserService defines the methods available in the user service.
@@ -18,12 +18,25 @@ type UserService interface {
 	LoginUser(c echo.Context) error
 	RegisterUser(c echo.Context) error
 	RefreshToken(c echo.Context) error
+	VerifyAccount(c echo.Context) error
+	ResendVerificationCode(c echo.Context) error
+	SendResetToken(c echo.Context) error
+	ResetPassword(c echo.Context) error
+	Logout(c echo.Context) error
+	LogoutAll(c echo.Context) error
+	GrantRole(c echo.Context) error
+	RevokeRole(c echo.Context) error
+	GrantPermission(c echo.Context) error
+	RevokePermission(c echo.Context) error
+	AccessChanges(c echo.Context) error
 }
 
 // userService is the implementation of UserService.
 type userService struct {
 	logger     *slog.Logger
 	repository UserRepository
+	config     config.Config
+	hermes     *hermes.Hermes
 }
 
 // LoginUser handles user login requests by validating credentials, checking user status, and generating tokens.
@@ -31,13 +44,13 @@ func (u userService) LoginUser(c echo.Context) error {
 	// Retrieve and parse the request body into a LoginRequest structure
 	var loginRequest SignInRequest
 	if err := c.Bind(&loginRequest); err != nil {
-		u.logger.Error("Error parsing login request body", err)
+		u.logger.Error("Error parsing login request body", "err", err)
 		return u.handleError(c, err, http.StatusBadRequest)
 	}
 
 	// Validate the login request body
 	if err := common.ValidateModel(loginRequest); err != nil {
-		u.logger.Error("Invalid login request body", err)
+		u.logger.Error("Invalid login request body", "err", err)
 		return u.handleError(c, err, http.StatusBadRequest)
 	}
 
@@ -68,7 +81,7 @@ func (u userService) LoginUser(c echo.Context) error {
 	}
 
 	if err != nil {
-		u.logger.Error("Error retrieving user from repository", err)
+		u.logger.Error("Error retrieving user from repository", "err", err)
 		return u.handleError(c, err, http.StatusInternalServerError)
 	}
 
@@ -92,17 +105,10 @@ func (u userService) LoginUser(c echo.Context) error {
 		return u.handleError(c, errors.New("account is not verified"), http.StatusUnauthorized)
 	}
 
-	// Generate access and refresh tokens
-	accessToken, err := tokens.GenerateAccessToken(strconv.Itoa(int(user.ID)), time.Minute*60)
+	// Start a new session with access and refresh tokens
+	pair, err := tokens.IssueTokens(u.repository, user.subject(), u.config.Auth)
 	if err != nil {
-		u.logger.Error("Error generating access tokens", err)
-		return u.handleError(c, err, http.StatusInternalServerError)
-	}
-
-	// Generate refresh tokens
-	refreshToken, err := tokens.GenerateRefreshToken(strconv.Itoa(int(user.ID)), time.Minute*60)
-	if err != nil {
-		u.logger.Error("Error generating refresh tokens", err)
+		u.logger.Error("Error generating tokens", "err", err)
 		return u.handleError(c, err, http.StatusInternalServerError)
 	}
 
@@ -115,20 +121,23 @@ func (u userService) LoginUser(c echo.Context) error {
 			PhoneNumber: user.PhoneNumber,
 			IsActive:    user.IsActive,
 			IsVerified:  user.IsVerified,
+			Role:        user.Role,
+			Permissions: user.EffectivePermissions(),
+			Tier:        user.Tier,
 		},
 		Token: RefreshTokenResponse{
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
+			AccessToken:  pair.AccessToken,
+			RefreshToken: pair.RefreshToken,
 		},
 	}
 
 	_, err = u.repository.UpdateUser(user.ID, user)
 	if err != nil {
-		u.logger.Error("Error updating user", err)
+		u.logger.Error("Error updating user", "err", err)
 		return u.handleError(c, err, http.StatusInternalServerError)
 	}
 
-	u.logger.Info("User login successful", user)
+	u.logger.Info("User login successful", "userID", user.ID)
 	return c.JSON(http.StatusOK, common.BaseResponse{
 		Status:  http.StatusOK,
 		Message: "Login successful",
@@ -167,12 +176,12 @@ func (u userService) RegisterUser(c echo.Context) error {
 	var signUpRequest SignUpRequest
 
 	if err := c.Bind(&signUpRequest); err != nil {
-		u.logger.Error("Error parsing request body", err)
+		u.logger.Error("Error parsing request body", "err", err)
 		return u.handleError(c, err, http.StatusBadRequest)
 	}
 
 	if err := common.ValidateModel(signUpRequest); err != nil {
-		u.logger.Error("Error validating request body", err)
+		u.logger.Error("Error validating request body", "err", err)
 		return u.handleError(c, err, http.StatusBadRequest)
 	}
 
@@ -185,7 +194,7 @@ func (u userService) RegisterUser(c echo.Context) error {
 		var err error
 		user, err = u.getProfileDetails(signUpRequest.Provider, signUpRequest.Token)
 		if err != nil {
-			u.logger.Error("Error getting profile details", err)
+			u.logger.Error("Error getting profile details", "err", err)
 			return u.handleError(c, err, http.StatusBadRequest)
 		}
 	} else {
@@ -200,7 +209,7 @@ func (u userService) RegisterUser(c echo.Context) error {
 		}
 		hash, err := auth.HashPassword(signUpRequest.Password)
 		if err != nil {
-			u.logger.Error("Error hashing password", err)
+			u.logger.Error("Error hashing password", "err", err)
 			return u.handleError(c, err, http.StatusInternalServerError)
 		}
 		user = &User{
@@ -209,6 +218,7 @@ func (u userService) RegisterUser(c echo.Context) error {
 			Password:   hash,
 			IsActive:   false,
 			IsVerified: false,
+			Role:       RoleCustomer,
 		}
 	}
 
@@ -217,25 +227,26 @@ func (u userService) RegisterUser(c echo.Context) error {
 	}
 
 	if _, err := u.repository.CreateUser(user); err != nil {
-		u.logger.Error("Error creating user", err)
+		u.logger.Error("Error creating user", "err", err)
 		return u.handleError(c, err, http.StatusInternalServerError)
 	}
 
-	u.logger.Info("User account created successfully", user)
+	// The account cannot log in until it is verified. A failed email is not
+	// fatal: the user can ask for the code to be sent again.
+	message := "User account successfully created. Enter the code sent to your email to verify it"
+	if err := u.sendVerificationCode(user); err != nil {
+		u.logger.Error("Error sending verification code", "userID", user.ID, "err", err)
+		message = "User account successfully created, but the verification email could not be sent. Request a new code to verify it"
+	}
+
+	u.logger.Info("User account created successfully", "userID", user.ID)
 	return c.JSON(http.StatusCreated, common.BaseResponse{
 		Status:  http.StatusCreated,
-		Message: "User account successfully created",
+		Message: message,
 		Data:    user,
 	})
 }
 
-func (u userService) RefreshToken(c echo.Context) error {
-	return c.JSON(http.StatusNotImplemented, common.BaseResponse{
-		Status:  http.StatusNotImplemented,
-		Message: "Not Implemented",
-	})
-}
-
 func (u userService) GetUserAccountProfile(c echo.Context) error {
 	return c.JSON(http.StatusNotImplemented, common.BaseResponse{
 		Status:  http.StatusNotImplemented,
@@ -272,9 +283,11 @@ func (u userService) CreateUserAccountPreferences(c echo.Context) error {
 }
 
 // NewUserService creates a new instance of userService.
-func NewUserService(logger *slog.Logger, repository UserRepository) UserService {
+func NewUserService(logger *slog.Logger, repository UserRepository, conf config.Config, h *hermes.Hermes) UserService {
 	return userService{
 		logger:     logger,
 		repository: repository,
+		config:     conf,
+		hermes:     h,
 	}
 }
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"errors"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RefreshToken exchanges a refresh token for a new access token and the next
+// refresh token of the session. Each refresh token works once: presenting
+// one again revokes the whole session, since it means the token leaked.
+func (u userService) RefreshToken(c echo.Context) error {
+	var request RefreshToken
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+
+	pair, err := tokens.RefreshAccessToken(u.repository, request.RefreshToken, u.config.Auth, u.sessionSubject)
+	if err != nil {
+		if errors.Is(err, tokens.ErrRefreshTokenReused) {
+			u.logger.Warn("Refresh token reused, session revoked", "err", err)
+			return u.handleError(c, tokens.ErrRefreshTokenReused, http.StatusUnauthorized)
+		}
+		if errors.Is(err, tokens.ErrInvalidRefreshToken) {
+			return u.handleError(c, err, http.StatusUnauthorized)
+		}
+		u.logger.Error("Error refreshing tokens", "err", err)
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Token refreshed successfully",
+		Data: RefreshTokenResponse{
+			AccessToken:  pair.AccessToken,
+			RefreshToken: pair.RefreshToken,
+		},
+	})
+}
+
+// sessionSubject returns who the session of a refresh token now issues
+// tokens to, with their current role and permissions, so access changes take
+// effect on the next refresh. Sessions of deactivated users, and sessions
+// started before the user's tokens were invalidated by a password reset,
+// cannot be renewed.
+func (u userService) sessionSubject(token *tokens.RefreshToken) (*tokens.Subject, error) {
+	user, err := u.repository.GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, tokens.ErrInvalidRefreshToken
+	}
+	if user.TokensValidAfter != nil && token.AuthenticatedAt.Before(*user.TokensValidAfter) {
+		return nil, tokens.ErrInvalidRefreshToken
+	}
+	subject := user.subject()
+	return &subject, nil
+}
+
+// Logout revokes the session of the given refresh token. Access tokens
+// already issued to the session stay valid until they expire.
+func (u userService) Logout(c echo.Context) error {
+	var request RefreshToken
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+
+	if err := tokens.RevokeSession(u.repository, request.RefreshToken); err != nil {
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Logged out successfully",
+	})
+}
+
+// LogoutAll revokes every session of the authenticated user.
+func (u userService) LogoutAll(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return u.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	if err := u.repository.RevokeUserRefreshTokens(userID, tokens.RevokedLogoutAll); err != nil {
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Logged out of all sessions successfully",
+	})
+}
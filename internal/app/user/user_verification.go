@@ -0,0 +1,243 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/pkg/auth"
+	"mamlaka/internal/pkg/email"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidCode     = errors.New("invalid or expired code")
+	errTooManyAttempts = errors.New("too many wrong codes; request a new one")
+)
+
+// decoyCodeHash is checked against codes that have no real code to be checked
+// against, e.g. codes sent for unknown accounts, so that rejecting them takes
+// as long as rejecting a wrong code.
+var decoyCodeHash = sync.OnceValue(func() string {
+	hash, _ := auth.HashVerificationCode("decoy")
+	return hash
+})
+
+// CodeRateLimitError is returned when a user asks for a new code too soon.
+type CodeRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CodeRateLimitError) Error() string {
+	return fmt.Sprintf("a new code can be requested in %s", e.RetryAfter.Round(time.Second))
+}
+
+// VerifyAccount marks the account verified if the request carries the
+// latest verification code emailed to it. Unknown and already verified
+// accounts get the same response as a wrong code, so the response does not
+// tell whether an account exists.
+func (u userService) VerifyAccount(c echo.Context) error {
+	var request VerifyAccountRequest
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+
+	user, err := u.repository.GetUserByEmail(request.Email)
+	if err != nil {
+		return u.handleError(c, err, http.StatusInternalServerError)
+	}
+	if user == nil || user.IsVerified {
+		return u.handleCodeError(c, rejectCode(request.Code))
+	}
+
+	markVerified := func(tx *gorm.DB) error {
+		return tx.Model(&User{}).Where("id = ?", user.ID).Update("is_verified", true).Error
+	}
+	if err := u.checkCode(user, CodeEmailVerification, request.Code, markVerified); err != nil {
+		return u.handleCodeError(c, err)
+	}
+
+	u.logger.Info("User account verified", "userID", user.ID)
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Account verified successfully",
+	})
+}
+
+// ResendVerificationCode emails a new verification code, replacing the
+// previous one. The response does not say whether the email belongs to an
+// account awaiting verification: the code is issued and sent in the
+// background, so neither failures nor the response time tell either.
+func (u userService) ResendVerificationCode(c echo.Context) error {
+	var request ResendCodeRequest
+	if err := c.Bind(&request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return u.handleError(c, err, http.StatusBadRequest)
+	}
+
+	go u.resendVerificationCode(request.Email)
+
+	return c.JSON(http.StatusAccepted, common.BaseResponse{
+		Status:  http.StatusAccepted,
+		Message: "If the account is awaiting verification, a new code has been sent",
+	})
+}
+
+// resendVerificationCode issues a verification code to the account with the
+// given email, if it is awaiting verification, and emails it. Failures,
+// including requests over the rate limit, are only logged.
+func (u userService) resendVerificationCode(email string) {
+	user, err := u.repository.GetUserByEmail(email)
+	if err != nil || user == nil || user.IsVerified {
+		return
+	}
+	if err := u.sendVerificationCode(user); err != nil {
+		u.logger.Warn("Verification code not resent", "userID", user.ID, "err", err)
+	}
+}
+
+// sendVerificationCode issues a verification code and emails it to user.
+func (u userService) sendVerificationCode(user *User) error {
+	code, err := u.issueCode(user, CodeEmailVerification)
+	if err != nil {
+		return err
+	}
+	return u.sendEmail(user, "Verify your Mamlaka account", hermes.Body{
+		Name:   user.FullName,
+		Intros: []string{"Welcome to Mamlaka! Enter the code below to verify your email address."},
+		Actions: []hermes.Action{{
+			Instructions: "Your verification code is:",
+			InviteCode:   code,
+		}},
+		Outros: []string{fmt.Sprintf("The code expires in %s. If you did not create an account, you can ignore this email.", u.config.Auth.CodeTTL)},
+	})
+}
+
+// issueCode creates a new one-time code for user, replacing any earlier code
+// with the same purpose, and returns it. Only its hash is stored. Codes are
+// issued at most once every CodeResendInterval and MaxCodesPerHour times an
+// hour per purpose.
+func (u userService) issueCode(user *User, purpose CodePurpose) (string, error) {
+	now := time.Now()
+	recent, err := u.repository.GetRecentOneTimeCodes(user.ID, purpose, now.Add(-time.Hour))
+	if err != nil {
+		return "", err
+	}
+	if len(recent) > 0 {
+		if wait := recent[0].CreatedAt.Add(u.config.Auth.CodeResendInterval).Sub(now); wait > 0 {
+			return "", &CodeRateLimitError{RetryAfter: wait}
+		}
+	}
+	if len(recent) >= u.config.Auth.MaxCodesPerHour {
+		oldest := recent[len(recent)-1]
+		return "", &CodeRateLimitError{RetryAfter: oldest.CreatedAt.Add(time.Hour).Sub(now)}
+	}
+
+	code, err := auth.GenerateVerificationCode()
+	if err != nil {
+		return "", err
+	}
+	hash, err := auth.HashVerificationCode(code)
+	if err != nil {
+		return "", err
+	}
+	if err := u.repository.CreateOneTimeCode(&OneTimeCode{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		CodeHash:  hash,
+		ExpiresAt: now.Add(u.config.Auth.CodeTTL),
+	}); err != nil {
+		return "", err
+	}
+	u.logger.Info("One-time code issued", "userID", user.ID, "purpose", purpose)
+	return code, nil
+}
+
+// checkCode consumes user's active code for purpose if code matches it,
+// applying the effects of using it in the same transaction. Every guess
+// counts towards MaxCodeAttempts, after which the code stops working.
+func (u userService) checkCode(user *User, purpose CodePurpose, code string, effects ...func(tx *gorm.DB) error) error {
+	active, err := u.repository.GetActiveOneTimeCode(user.ID, purpose)
+	if err != nil {
+		return err
+	}
+	if active == nil {
+		return rejectCode(code)
+	}
+
+	allowed, err := u.repository.RecordCodeAttempt(active, u.config.Auth.MaxCodeAttempts)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		u.logger.Warn("One-time code attempts exhausted", "userID", user.ID, "purpose", purpose)
+		return errTooManyAttempts
+	}
+	if !auth.CheckVerificationCode(strings.TrimSpace(code), active.CodeHash) {
+		return errInvalidCode
+	}
+
+	if err := u.repository.ConsumeOneTimeCode(active, effects...); err != nil {
+		if errors.Is(err, ErrCodeConsumed) {
+			return errInvalidCode
+		}
+		return err
+	}
+	return nil
+}
+
+// rejectCode checks code against decoyCodeHash and returns errInvalidCode.
+func rejectCode(code string) error {
+	auth.CheckVerificationCode(strings.TrimSpace(code), decoyCodeHash())
+	return errInvalidCode
+}
+
+// sendEmail renders body with the product's email template and sends it to user.
+func (u userService) sendEmail(user *User, subject string, body hermes.Body) error {
+	html, err := u.hermes.GenerateHTML(hermes.Email{Body: body})
+	if err != nil {
+		u.logger.Error("Error rendering email", "userID", user.ID, "err", err)
+		return err
+	}
+	if err := email.SendEmail(email.EmailMessage{To: user.Email, Subject: subject, Body: html}, u.config.Email); err != nil {
+		u.logger.Error("Error sending email", "userID", user.ID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// handleCodeError responds to a failed one-time code operation.
+func (u userService) handleCodeError(c echo.Context, err error) error {
+	var rateLimited *CodeRateLimitError
+	switch {
+	case errors.Is(err, errInvalidCode):
+		return u.handleCodedError(c, err, http.StatusBadRequest, common.CodeInvalidCode)
+	case errors.Is(err, errTooManyAttempts):
+		return u.handleCodedError(c, err, http.StatusTooManyRequests, common.CodeTooManyAttempts)
+	case errors.As(err, &rateLimited):
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(rateLimited.RetryAfter.Seconds())+1))
+		return u.handleCodedError(c, err, http.StatusTooManyRequests, common.CodeRateLimited)
+	}
+	return u.handleError(c, err, http.StatusInternalServerError)
+}
+
+// handleCodedError responds with an error carrying one of the common error codes.
+func (u userService) handleCodedError(c echo.Context, err error, status int, code string) error {
+	return c.JSON(status, common.ErrorResponse{
+		Status: status,
+		Code:   code,
+		Error:  err.Error(),
+	})
+}
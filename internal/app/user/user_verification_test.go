@@ -0,0 +1,246 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/pkg/auth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
+	"gorm.io/gorm"
+)
+
+// codeRepository keeps users and their one-time codes in memory. It
+// implements only the methods one-time codes use. Codes are issued in the
+// background, so it is safe for concurrent use.
+type codeRepository struct {
+	UserRepository
+	mu    sync.Mutex
+	users []*User
+	codes []*OneTimeCode
+}
+
+func (r *codeRepository) GetUserByEmail(email string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *codeRepository) CreateOneTimeCode(code *OneTimeCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, earlier := range r.codes {
+		if earlier.UserID == code.UserID && earlier.Purpose == code.Purpose && earlier.ConsumedAt == nil {
+			earlier.ConsumedAt = &now
+		}
+	}
+	code.ID = uint(len(r.codes) + 1)
+	code.CreatedAt = now
+	r.codes = append(r.codes, code)
+	return nil
+}
+
+func (r *codeRepository) GetRecentOneTimeCodes(userID uint, purpose CodePurpose, since time.Time) ([]OneTimeCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var recent []OneTimeCode
+	for i := len(r.codes) - 1; i >= 0; i-- {
+		if code := r.codes[i]; code.UserID == userID && code.Purpose == purpose && code.CreatedAt.After(since) {
+			recent = append(recent, *code)
+		}
+	}
+	return recent, nil
+}
+
+func (r *codeRepository) GetActiveOneTimeCode(userID uint, purpose CodePurpose) (*OneTimeCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.codes {
+		if code.UserID == userID && code.Purpose == purpose && code.ConsumedAt == nil && code.ExpiresAt.After(time.Now()) {
+			return code, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *codeRepository) RecordCodeAttempt(code *OneTimeCode, maxAttempts int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if code.Attempts >= maxAttempts {
+		return false, nil
+	}
+	code.Attempts++
+	return true, nil
+}
+
+func (r *codeRepository) ConsumeOneTimeCode(code *OneTimeCode, _ ...func(tx *gorm.DB) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if code.ConsumedAt != nil {
+		return ErrCodeConsumed
+	}
+	now := time.Now()
+	code.ConsumedAt = &now
+	return nil
+}
+
+// addCode stores a code for user as issueCode would.
+func (r *codeRepository) addCode(t *testing.T, user *User, purpose CodePurpose, code string) *OneTimeCode {
+	t.Helper()
+	hash, err := auth.HashVerificationCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &OneTimeCode{UserID: user.ID, Purpose: purpose, CodeHash: hash, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := r.CreateOneTimeCode(stored); err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+// newCodeTest returns a service whose repository holds an unverified user,
+// jane@example.com. Emails it sends fail, as no mail server is listening.
+func newCodeTest() (userService, *codeRepository, *User) {
+	jane := &User{FullName: "Jane", Email: "jane@example.com", IsActive: true}
+	jane.ID = 7
+	repository := &codeRepository{users: []*User{jane}}
+	return userService{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		repository: repository,
+		config: config.Config{
+			Auth: config.AuthConfig{
+				CodeTTL:            15 * time.Minute,
+				MaxCodeAttempts:    3,
+				CodeResendInterval: time.Minute,
+				MaxCodesPerHour:    5,
+			},
+			Email: config.EmailConfig{SMTPServer: "127.0.0.1", SMTPPort: 1},
+		},
+		hermes: &hermes.Hermes{},
+	}, repository, jane
+}
+
+func post(t *testing.T, handler echo.HandlerFunc, body string) (*httptest.ResponseRecorder, common.ErrorResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	var response common.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return rec, response
+}
+
+func TestVerifyAccount(t *testing.T) {
+	service, repository, jane := newCodeTest()
+	code := repository.addCode(t, jane, CodeEmailVerification, "123456")
+
+	if rec, _ := post(t, service.VerifyAccount, `{"email":"jane@example.com","code":" 123456 "}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if code.ConsumedAt == nil {
+		t.Error("code was not consumed")
+	}
+	if rec, response := post(t, service.VerifyAccount, `{"email":"jane@example.com","code":"123456"}`); rec.Code != http.StatusBadRequest || response.Code != common.CodeInvalidCode {
+		t.Errorf("reusing the code = %d %q, want %d %q", rec.Code, response.Code, http.StatusBadRequest, common.CodeInvalidCode)
+	}
+}
+
+func TestVerifyAccountUnknownAccountLooksLikeWrongCode(t *testing.T) {
+	service, repository, jane := newCodeTest()
+	repository.addCode(t, jane, CodeEmailVerification, "123456")
+
+	wrongRec, wrong := post(t, service.VerifyAccount, `{"email":"jane@example.com","code":"654321"}`)
+	unknownRec, unknown := post(t, service.VerifyAccount, `{"email":"nobody@example.com","code":"654321"}`)
+
+	if wrongRec.Code != http.StatusBadRequest || wrong.Code != common.CodeInvalidCode {
+		t.Errorf("wrong code = %d %q, want %d %q", wrongRec.Code, wrong.Code, http.StatusBadRequest, common.CodeInvalidCode)
+	}
+	if unknownRec.Code != wrongRec.Code || unknownRec.Body.String() != wrongRec.Body.String() {
+		t.Errorf("unknown account = %d %+v, want the wrong code response %d %+v", unknownRec.Code, unknown, wrongRec.Code, wrong)
+	}
+}
+
+func TestVerifyAccountLimitsAttempts(t *testing.T) {
+	service, repository, jane := newCodeTest()
+	repository.addCode(t, jane, CodeEmailVerification, "123456")
+
+	for i := 0; i < service.config.Auth.MaxCodeAttempts; i++ {
+		post(t, service.VerifyAccount, `{"email":"jane@example.com","code":"000000"}`)
+	}
+	rec, response := post(t, service.VerifyAccount, `{"email":"jane@example.com","code":"123456"}`)
+	if rec.Code != http.StatusTooManyRequests || response.Code != common.CodeTooManyAttempts {
+		t.Errorf("right code after too many wrong ones = %d %q, want %d %q", rec.Code, response.Code, http.StatusTooManyRequests, common.CodeTooManyAttempts)
+	}
+}
+
+func TestIssueCodeRateLimits(t *testing.T) {
+	service, repository, jane := newCodeTest()
+
+	if _, err := service.issueCode(jane, CodeEmailVerification); err != nil {
+		t.Fatalf("issueCode() error = %v", err)
+	}
+	var rateLimited *CodeRateLimitError
+	if _, err := service.issueCode(jane, CodeEmailVerification); !errors.As(err, &rateLimited) || rateLimited.RetryAfter <= 0 {
+		t.Errorf("issueCode() within the resend interval error = %v, want a rate limit", err)
+	}
+	if _, err := service.issueCode(jane, CodePasswordReset); err != nil {
+		t.Errorf("issueCode() for another purpose error = %v", err)
+	}
+
+	// Once the interval has passed, codes are limited per hour
+	service.config.Auth.CodeResendInterval = 0
+	for len(repository.codes) < 1+service.config.Auth.MaxCodesPerHour {
+		if _, err := service.issueCode(jane, CodeEmailVerification); err != nil {
+			t.Fatalf("issueCode() error = %v", err)
+		}
+	}
+	if _, err := service.issueCode(jane, CodeEmailVerification); !errors.As(err, &rateLimited) {
+		t.Errorf("issueCode() over the hourly limit error = %v, want a rate limit", err)
+	}
+}
+
+func TestResendVerificationCodeAlwaysAccepted(t *testing.T) {
+	service, repository, _ := newCodeTest()
+
+	for _, email := range []string{"jane@example.com", "nobody@example.com"} {
+		if rec, _ := post(t, service.ResendVerificationCode, `{"email":"`+email+`"}`); rec.Code != http.StatusAccepted {
+			t.Errorf("resending to %s = %d, want %d", email, rec.Code, http.StatusAccepted)
+		}
+	}
+
+	// The code is issued in the background even though it cannot be emailed
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		active, _ := repository.GetActiveOneTimeCode(7, CodeEmailVerification)
+		if active != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no verification code was issued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
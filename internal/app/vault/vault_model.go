@@ -0,0 +1,34 @@
+package vault
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// VaultedCard holds an encrypted card number behind an opaque token. It is the
+// only place a PAN is stored; everything else references the card by Token.
+type VaultedCard struct {
+	gorm.Model
+	Token        string `gorm:"size:64;uniqueIndex;not null"`
+	Fingerprint  string `gorm:"size:64;index;not null"` // Keyed hash of the PAN for matching cards without decrypting
+	EncryptedPAN []byte `gorm:"type:bytea;not null"`    // AES-256-GCM nonce + ciphertext, bound to Token
+	Brand        string `gorm:"size:20"`
+	Last4        string `gorm:"size:4"`
+	ExpiryDate   string `gorm:"size:7"` // MM/YY
+}
+
+// StashedCVV holds a card security code between accepting a payment and
+// authorizing it in the background. It is deleted, not soft-deleted, as soon
+// as it is read or expires: a CVV must not be kept after authorization.
+type StashedCVV struct {
+	ID           uint      `gorm:"primaryKey"`
+	Handle       string    `gorm:"size:64;uniqueIndex;not null"`
+	EncryptedCVV []byte    `gorm:"type:bytea;not null"` // AES-256-GCM nonce + ciphertext, bound to Handle
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+func (StashedCVV) TableName() string {
+	return "vault_cvvs"
+}
@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log/slog"
+	"time"
+)
+
+type VaultRepository interface {
+	CreateCard(card *VaultedCard) (*VaultedCard, error)
+	GetCardByToken(token string) (*VaultedCard, error)
+	GetCardByFingerprint(fingerprint, expiryDate string) (*VaultedCard, error)
+	CreateCVV(cvv *StashedCVV) error
+	TakeCVV(handle string, now time.Time) (*StashedCVV, error)
+	DeleteExpiredCVVs(now time.Time) (int64, error)
+}
+
+type vaultRepository struct {
+	DB     *gorm.DB
+	logger *slog.Logger
+}
+
+func (v vaultRepository) CreateCard(card *VaultedCard) (*VaultedCard, error) {
+	if err := v.DB.Create(card).Error; err != nil {
+		v.logger.Error("Error storing vaulted card", "error", err)
+		return nil, err
+	}
+	v.logger.Info("Card vaulted successfully", "cardID", card.ID, "brand", card.Brand, "last4", card.Last4)
+	return card, nil
+}
+
+func (v vaultRepository) GetCardByToken(token string) (*VaultedCard, error) {
+	var card VaultedCard
+	if err := v.DB.Where("token = ?", token).First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		v.logger.Error("Error fetching vaulted card by token", "error", err)
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (v vaultRepository) GetCardByFingerprint(fingerprint, expiryDate string) (*VaultedCard, error) {
+	var card VaultedCard
+	if err := v.DB.Where("fingerprint = ? AND expiry_date = ?", fingerprint, expiryDate).First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		v.logger.Error("Error fetching vaulted card by fingerprint", "error", err)
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (v vaultRepository) CreateCVV(cvv *StashedCVV) error {
+	if err := v.DB.Create(cvv).Error; err != nil {
+		v.logger.Error("Error stashing CVV", "error", err)
+		return err
+	}
+	return nil
+}
+
+// TakeCVV deletes a stashed CVV and returns it, or nil if there is none
+// under handle or it expired. Deleting and reading in one statement means a
+// CVV can be taken only once.
+func (v vaultRepository) TakeCVV(handle string, now time.Time) (*StashedCVV, error) {
+	var cvvs []StashedCVV
+	if err := v.DB.Clauses(clause.Returning{}).
+		Where("handle = ?", handle).
+		Delete(&cvvs).Error; err != nil {
+		v.logger.Error("Error taking stashed CVV", "error", err)
+		return nil, err
+	}
+	if len(cvvs) == 0 || cvvs[0].ExpiresAt.Before(now) {
+		return nil, nil
+	}
+	return &cvvs[0], nil
+}
+
+// DeleteExpiredCVVs deletes stashed CVVs that expired before now.
+func (v vaultRepository) DeleteExpiredCVVs(now time.Time) (int64, error) {
+	result := v.DB.Where("expires_at < ?", now).Delete(&StashedCVV{})
+	if result.Error != nil {
+		v.logger.Error("Error deleting expired CVVs", "error", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+func NewVaultRepository(db *gorm.DB, logger *slog.Logger) VaultRepository {
+	return vaultRepository{
+		DB:     db,
+		logger: logger,
+	}
+}
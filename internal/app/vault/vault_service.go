@@ -0,0 +1,266 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/pkg/cards"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCardNotFound = errors.New("card not found in vault")
+	ErrCVVNotFound  = errors.New("CVV not found in vault or expired")
+)
+
+// Card is a tokenized card as exposed outside the vault: it never carries the PAN.
+type Card struct {
+	Token       string
+	Fingerprint string
+	Brand       string
+	Last4       string
+	ExpiryDate  string
+}
+
+// VaultService exchanges card numbers for opaque tokens and back.
+type VaultService interface {
+	// Tokenize encrypts and stores a card number, returning its token. The
+	// same card number and expiry always yield the same token.
+	Tokenize(number, expiryDate string) (*Card, error)
+	// Detokenize returns the card number behind a token. Only gateway
+	// adapters that must send the PAN to a processor should call it.
+	Detokenize(token string) (string, error)
+	// StashCVV encrypts and stores a card security code for up to ttl,
+	// returning a handle to take it back with.
+	StashCVV(cvv string, ttl time.Duration) (string, error)
+	// TakeCVV returns a stashed CVV and deletes it, so it can be taken once.
+	TakeCVV(handle string) (string, error)
+	// PurgeExpiredCVVs deletes stashed CVVs that were never taken.
+	PurgeExpiredCVVs() error
+	// Fingerprint returns the fingerprint Tokenize would give a card number,
+	// without storing it.
+	Fingerprint(number string) string
+}
+
+type vaultService struct {
+	logger         *slog.Logger
+	repository     VaultRepository
+	aead           cipher.AEAD
+	fingerprintKey []byte
+}
+
+func (v vaultService) Tokenize(number, expiryDate string) (*Card, error) {
+	number = cards.Normalize(number)
+	fingerprint := v.fingerprint(number)
+
+	existing, err := v.repository.GetCardByFingerprint(fingerprint, expiryDate)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return toCard(existing), nil
+	}
+
+	token, err := newToken("card_")
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := v.seal([]byte(number), token)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := v.repository.CreateCard(&VaultedCard{
+		Token:        token,
+		Fingerprint:  fingerprint,
+		EncryptedPAN: encrypted,
+		Brand:        string(cards.DetectBrand(number)),
+		Last4:        cards.Last4(number),
+		ExpiryDate:   expiryDate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toCard(card), nil
+}
+
+func (v vaultService) Detokenize(token string) (string, error) {
+	card, err := v.repository.GetCardByToken(token)
+	if err != nil {
+		return "", err
+	}
+	if card == nil {
+		return "", ErrCardNotFound
+	}
+
+	pan, err := v.open(card.EncryptedPAN, token)
+	if err != nil {
+		v.logger.Error("Error decrypting vaulted card", "cardID", card.ID, "error", err)
+		return "", errors.New("vaulted card could not be decrypted")
+	}
+	return string(pan), nil
+}
+
+func (v vaultService) StashCVV(cvv string, ttl time.Duration) (string, error) {
+	handle, err := newToken("cvv_")
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := v.seal([]byte(cvv), handle)
+	if err != nil {
+		return "", err
+	}
+
+	if err := v.repository.CreateCVV(&StashedCVV{
+		Handle:       handle,
+		EncryptedCVV: encrypted,
+		ExpiresAt:    time.Now().Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return handle, nil
+}
+
+func (v vaultService) TakeCVV(handle string) (string, error) {
+	stashed, err := v.repository.TakeCVV(handle, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if stashed == nil {
+		return "", ErrCVVNotFound
+	}
+
+	cvv, err := v.open(stashed.EncryptedCVV, handle)
+	if err != nil {
+		v.logger.Error("Error decrypting stashed CVV", "cvvID", stashed.ID, "error", err)
+		return "", errors.New("stashed CVV could not be decrypted")
+	}
+	return string(cvv), nil
+}
+
+func (v vaultService) PurgeExpiredCVVs() error {
+	deleted, err := v.repository.DeleteExpiredCVVs(time.Now())
+	if err == nil && deleted > 0 {
+		v.logger.Info("Expired CVVs purged", "count", deleted)
+	}
+	return err
+}
+
+// seal encrypts plaintext with a random nonce, bound to the given
+// additional data, and returns the nonce followed by the ciphertext.
+func (v vaultService) seal(plaintext []byte, additionalData string) ([]byte, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return v.aead.Seal(nonce, nonce, plaintext, []byte(additionalData)), nil
+}
+
+// open decrypts the output of seal.
+func (v vaultService) open(sealed []byte, additionalData string) ([]byte, error) {
+	nonceSize := v.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("ciphertext is too short")
+	}
+	return v.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(additionalData))
+}
+
+func (v vaultService) Fingerprint(number string) string {
+	return v.fingerprint(cards.Normalize(number))
+}
+
+// fingerprint is a keyed hash of the PAN, so equal cards can be matched
+// without decrypting and without the hash being brute-forceable offline.
+func (v vaultService) fingerprint(number string) string {
+	mac := hmac.New(sha256.New, v.fingerprintKey)
+	mac.Write([]byte(number))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func toCard(card *VaultedCard) *Card {
+	return &Card{
+		Token:       card.Token,
+		Fingerprint: card.Fingerprint,
+		Brand:       card.Brand,
+		Last4:       card.Last4,
+		ExpiryDate:  card.ExpiryDate,
+	}
+}
+
+func newToken(prefix string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+var (
+	ephemeralKeysMu sync.Mutex
+	ephemeralKeys   = make(map[string][]byte)
+)
+
+// loadKey decodes a base64 256-bit key. When no key is configured and
+// allowEphemeral is set, as it is in development, a random key is generated
+// once per process, so vaulted cards only remain readable until restart.
+func loadKey(logger *slog.Logger, name, encoded string, allowEphemeral bool) ([]byte, error) {
+	if encoded == "" {
+		if !allowEphemeral {
+			return nil, fmt.Errorf("%s must be set outside development", name)
+		}
+		ephemeralKeysMu.Lock()
+		defer ephemeralKeysMu.Unlock()
+		if _, ok := ephemeralKeys[name]; !ok {
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, fmt.Errorf("cannot generate ephemeral %s: %w", name, err)
+			}
+			ephemeralKeys[name] = key
+		}
+		logger.Warn("Vault key not configured, using an ephemeral key", "key", name)
+		return ephemeralKeys[name], nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s must be a base64-encoded 32-byte key", name)
+	}
+	return key, nil
+}
+
+// NewVaultService creates a vault using the encryption and fingerprint keys from conf.
+func NewVaultService(logger *slog.Logger, repository VaultRepository, conf config.VaultConfig) (VaultService, error) {
+	encryptionKey, err := loadKey(logger, "VAULT_ENCRYPTION_KEY", conf.EncryptionKey, conf.AllowEphemeralKeys)
+	if err != nil {
+		return nil, err
+	}
+	fingerprintKey, err := loadKey(logger, "VAULT_FINGERPRINT_KEY", conf.FingerprintKey, conf.AllowEphemeralKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return vaultService{
+		logger:         logger,
+		repository:     repository,
+		aead:           aead,
+		fingerprintKey: fingerprintKey,
+	}, nil
+}
@@ -0,0 +1,232 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryRepository is a VaultRepository keeping cards and CVVs in memory.
+type memoryRepository struct {
+	cards []*VaultedCard
+	cvvs  map[string]*StashedCVV
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{cvvs: make(map[string]*StashedCVV)}
+}
+
+func (m *memoryRepository) CreateCard(card *VaultedCard) (*VaultedCard, error) {
+	card.ID = uint(len(m.cards) + 1)
+	m.cards = append(m.cards, card)
+	return card, nil
+}
+
+func (m *memoryRepository) GetCardByToken(token string) (*VaultedCard, error) {
+	for _, card := range m.cards {
+		if card.Token == token {
+			return card, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepository) GetCardByFingerprint(fingerprint, expiryDate string) (*VaultedCard, error) {
+	for _, card := range m.cards {
+		if card.Fingerprint == fingerprint && card.ExpiryDate == expiryDate {
+			return card, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepository) CreateCVV(cvv *StashedCVV) error {
+	m.cvvs[cvv.Handle] = cvv
+	return nil
+}
+
+func (m *memoryRepository) TakeCVV(handle string, now time.Time) (*StashedCVV, error) {
+	cvv, ok := m.cvvs[handle]
+	if !ok || !cvv.ExpiresAt.After(now) {
+		return nil, nil
+	}
+	delete(m.cvvs, handle)
+	return cvv, nil
+}
+
+func (m *memoryRepository) DeleteExpiredCVVs(now time.Time) (int64, error) {
+	var deleted int64
+	for handle, cvv := range m.cvvs {
+		if !cvv.ExpiresAt.After(now) {
+			delete(m.cvvs, handle)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func randomKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestVault(t *testing.T, repository VaultRepository) VaultService {
+	t.Helper()
+	v, err := NewVaultService(slog.New(slog.NewTextHandler(io.Discard, nil)), repository, config.VaultConfig{
+		EncryptionKey:  randomKey(t),
+		FingerprintKey: randomKey(t),
+	})
+	if err != nil {
+		t.Fatalf("NewVaultService() error = %v", err)
+	}
+	return v
+}
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	repository := newMemoryRepository()
+	v := newTestVault(t, repository)
+
+	card, err := v.Tokenize("4242 4242 4242 4242", "12/30")
+	if err != nil {
+		t.Fatalf("Tokenize() error = %v", err)
+	}
+	if !strings.HasPrefix(card.Token, "card_") || card.Last4 != "4242" || card.Brand == "" {
+		t.Errorf("Tokenize() = %+v", card)
+	}
+	if stored := repository.cards[0]; bytes.Contains(stored.EncryptedPAN, []byte("4242424242424242")) {
+		t.Error("the card number is stored in the clear")
+	}
+
+	pan, err := v.Detokenize(card.Token)
+	if err != nil || pan != "4242424242424242" {
+		t.Errorf("Detokenize() = %q, %v, want the normalized card number", pan, err)
+	}
+	if _, err := v.Detokenize("card_unknown"); !errors.Is(err, ErrCardNotFound) {
+		t.Errorf("Detokenize() of unknown token error = %v, want ErrCardNotFound", err)
+	}
+}
+
+func TestTokenizeReusesToken(t *testing.T) {
+	repository := newMemoryRepository()
+	v := newTestVault(t, repository)
+
+	first, _ := v.Tokenize("4242424242424242", "12/30")
+	again, _ := v.Tokenize("4242-4242-4242-4242", "12/30")
+	renewed, _ := v.Tokenize("4242424242424242", "01/31")
+
+	if again.Token != first.Token {
+		t.Errorf("same card got token %s, want %s", again.Token, first.Token)
+	}
+	if renewed.Token == first.Token {
+		t.Error("card with a new expiry date got the same token")
+	}
+	if renewed.Fingerprint != first.Fingerprint || v.Fingerprint("4242 4242 4242 4242") != first.Fingerprint {
+		t.Error("fingerprints of the same card number differ")
+	}
+	if len(repository.cards) != 2 {
+		t.Errorf("vault holds %d cards, want 2", len(repository.cards))
+	}
+}
+
+func TestDetokenizeRejectsSwappedCiphertext(t *testing.T) {
+	repository := newMemoryRepository()
+	v := newTestVault(t, repository)
+	first, _ := v.Tokenize("4242424242424242", "12/30")
+	second, _ := v.Tokenize("5555555555554444", "12/30")
+
+	// Ciphertexts are bound to their token, so moving one to another row fails
+	repository.cards[1].EncryptedPAN = repository.cards[0].EncryptedPAN
+	if _, err := v.Detokenize(second.Token); err == nil {
+		t.Error("Detokenize() decrypted a card number moved from another token")
+	}
+	if _, err := v.Detokenize(first.Token); err != nil {
+		t.Errorf("Detokenize() of untouched card error = %v", err)
+	}
+}
+
+func TestFingerprintDependsOnKey(t *testing.T) {
+	a := newTestVault(t, newMemoryRepository())
+	b := newTestVault(t, newMemoryRepository())
+
+	if a.Fingerprint("4242424242424242") == b.Fingerprint("4242424242424242") {
+		t.Error("vaults with different fingerprint keys give the same fingerprint")
+	}
+}
+
+func TestStashedCVVCanBeTakenOnce(t *testing.T) {
+	v := newTestVault(t, newMemoryRepository())
+
+	handle, err := v.StashCVV("123", time.Minute)
+	if err != nil {
+		t.Fatalf("StashCVV() error = %v", err)
+	}
+	if cvv, err := v.TakeCVV(handle); err != nil || cvv != "123" {
+		t.Errorf("TakeCVV() = %q, %v, want 123", cvv, err)
+	}
+	if _, err := v.TakeCVV(handle); !errors.Is(err, ErrCVVNotFound) {
+		t.Errorf("second TakeCVV() error = %v, want ErrCVVNotFound", err)
+	}
+}
+
+func TestExpiredCVVsArePurged(t *testing.T) {
+	repository := newMemoryRepository()
+	v := newTestVault(t, repository)
+
+	expired, _ := v.StashCVV("123", -time.Second)
+	live, _ := v.StashCVV("456", time.Minute)
+
+	if _, err := v.TakeCVV(expired); !errors.Is(err, ErrCVVNotFound) {
+		t.Errorf("TakeCVV() of expired CVV error = %v, want ErrCVVNotFound", err)
+	}
+	if err := v.PurgeExpiredCVVs(); err != nil {
+		t.Fatalf("PurgeExpiredCVVs() error = %v", err)
+	}
+	if _, ok := repository.cvvs[expired]; ok {
+		t.Error("expired CVV was not purged")
+	}
+	if _, ok := repository.cvvs[live]; !ok {
+		t.Error("live CVV was purged")
+	}
+}
+
+func TestNewVaultServiceKeys(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tests := []struct {
+		name    string
+		conf    config.VaultConfig
+		wantErr string
+	}{
+		{"missing keys outside development", config.VaultConfig{}, "VAULT_ENCRYPTION_KEY must be set"},
+		{"missing fingerprint key", config.VaultConfig{EncryptionKey: randomKey(t)}, "VAULT_FINGERPRINT_KEY must be set"},
+		{"short key", config.VaultConfig{EncryptionKey: base64.StdEncoding.EncodeToString([]byte("short")), FingerprintKey: randomKey(t)}, "32-byte key"},
+		{"not base64", config.VaultConfig{EncryptionKey: "not base64!", FingerprintKey: randomKey(t)}, "32-byte key"},
+		{"ephemeral keys in development", config.VaultConfig{AllowEphemeralKeys: true}, ""},
+		{"configured keys", config.VaultConfig{EncryptionKey: randomKey(t), FingerprintKey: randomKey(t)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVaultService(logger, newMemoryRepository(), tt.conf)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("NewVaultService() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewVaultService() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
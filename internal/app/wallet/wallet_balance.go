@@ -0,0 +1,125 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"mamlaka/internal/pkg/money"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInsufficientFunds is returned when a debit is larger than the wallet balance.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// Movement is a change to a user's wallet balance.
+type Movement struct {
+	UserID      uint
+	Amount      money.Money // Always positive; Credit and Debit give it its sign
+	Type        EntryType
+	Reference   string
+	Description string
+}
+
+// Credit adds a movement to the user's wallet in its currency, creating the
+// wallet if needed. Callers pass their own transaction so that the change is
+// committed atomically with what caused it.
+func Credit(tx *gorm.DB, movement Movement) (*Entry, error) {
+	return apply(tx, movement, movement.Amount.Amount)
+}
+
+// Debit takes a movement from the user's wallet. The wallet row stays locked
+// until tx ends, so concurrent debits cannot overspend; ErrInsufficientFunds
+// is returned if the balance does not cover the amount.
+func Debit(tx *gorm.DB, movement Movement) (*Entry, error) {
+	return apply(tx, movement, -movement.Amount.Amount)
+}
+
+// Transfer moves amount from one user's wallet to another's in tx. Both
+// wallets are locked in user ID order first so that transfers in opposite
+// directions cannot deadlock.
+func Transfer(tx *gorm.DB, fromUserID, toUserID uint, amount money.Money, reference, description string) error {
+	first, second := fromUserID, toUserID
+	if second < first {
+		first, second = second, first
+	}
+	for _, userID := range []uint{first, second} {
+		if _, err := lockWallet(tx, userID, amount.Currency); err != nil {
+			return err
+		}
+	}
+
+	if _, err := Debit(tx, Movement{UserID: fromUserID, Amount: amount, Type: EntryTransferOut, Reference: reference, Description: description}); err != nil {
+		return err
+	}
+	_, err := Credit(tx, Movement{UserID: toUserID, Amount: amount, Type: EntryTransferIn, Reference: reference, Description: description})
+	return err
+}
+
+// CheckFunds returns ErrInsufficientFunds if the user's wallet balance does
+// not cover amount. It does not hold the balance, so a later Debit can still
+// fail; it lets callers refuse payments that cannot succeed up front.
+func CheckFunds(db *gorm.DB, userID uint, amount money.Money) error {
+	var wallet Wallet
+	err := db.Where("user_id = ? AND currency = ?", userID, amount.Currency).First(&wallet).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if wallet.Balance < amount.Amount {
+		available := money.Money{Amount: wallet.Balance, Currency: amount.Currency}
+		return fmt.Errorf("%w: %s available", ErrInsufficientFunds, available)
+	}
+	return nil
+}
+
+func apply(tx *gorm.DB, movement Movement, delta int64) (*Entry, error) {
+	if !movement.Amount.IsPositive() {
+		return nil, money.ErrNonPositiveAmount
+	}
+
+	wallet, err := lockWallet(tx, movement.UserID, movement.Amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if wallet.Balance+delta < 0 {
+		available := money.Money{Amount: wallet.Balance, Currency: wallet.Currency}
+		return nil, fmt.Errorf("%w: %s available", ErrInsufficientFunds, available)
+	}
+
+	wallet.Balance += delta
+	if err := tx.Model(wallet).Update("balance", wallet.Balance).Error; err != nil {
+		return nil, err
+	}
+
+	entry := Entry{
+		WalletID:     wallet.ID,
+		Type:         movement.Type,
+		Amount:       delta,
+		BalanceAfter: wallet.Balance,
+		Reference:    movement.Reference,
+		Description:  movement.Description,
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// lockWallet returns the user's wallet in currency, creating it if needed,
+// with its row locked FOR UPDATE.
+func lockWallet(tx *gorm.DB, userID uint, currency string) (*Wallet, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Wallet{UserID: userID, Currency: currency}).Error; err != nil {
+		return nil, err
+	}
+
+	var wallet Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND currency = ?", userID, currency).
+		First(&wallet).Error; err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
@@ -0,0 +1,47 @@
+package wallet
+
+import (
+	"mamlaka/internal/pkg/money"
+	"time"
+)
+
+type WalletDto struct {
+	ID       uint        `json:"id"`
+	Currency string      `json:"currency"`
+	Balance  money.Money `json:"balance"`
+}
+
+func toWalletDto(wallet Wallet) WalletDto {
+	return WalletDto{
+		ID:       wallet.ID,
+		Currency: wallet.Currency,
+		Balance:  money.Money{Amount: wallet.Balance, Currency: wallet.Currency},
+	}
+}
+
+type StatementEntryDto struct {
+	ID           uint        `json:"id"`
+	Type         EntryType   `json:"type"`
+	Amount       money.Money `json:"amount"` // Negative for debits
+	BalanceAfter money.Money `json:"balance_after"`
+	Reference    string      `json:"reference"`
+	Description  string      `json:"description"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+func toStatementEntryDto(entry Entry, currency string) StatementEntryDto {
+	return StatementEntryDto{
+		ID:           entry.ID,
+		Type:         entry.Type,
+		Amount:       money.Money{Amount: entry.Amount, Currency: currency},
+		BalanceAfter: money.Money{Amount: entry.BalanceAfter, Currency: currency},
+		Reference:    entry.Reference,
+		Description:  entry.Description,
+		CreatedAt:    entry.CreatedAt,
+	}
+}
+
+type StatementRequestDto struct {
+	Cursor string `query:"cursor" json:"cursor"`
+	Limit  int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=100"`
+}
@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"log/slog"
+	_ "mamlaka/internal/app/common"
+
+	"github.com/labstack/echo/v4"
+)
+
+type WalletHandler interface {
+	Wallets(c echo.Context) error
+	Statement(c echo.Context) error
+}
+
+type walletHandler struct {
+	logger        *slog.Logger
+	walletService WalletService
+}
+
+// Wallets godoc
+// @Summary List wallets
+// @Description Lists the authenticated user's wallets and their balances. Top up a wallet with a payment whose purpose is wallet_top_up.
+// @Tags Wallets
+// @Produce  json
+// @Success 200 {object} common.BaseResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /wallets [get]
+func (w walletHandler) Wallets(c echo.Context) error {
+	return w.walletService.ListWallets(c)
+}
+
+// Statement godoc
+// @Summary Wallet statement
+// @Description Lists the movements of the wallet in a currency, newest first
+// @Tags Wallets
+// @Produce  json
+// @Param   currency path string true "ISO 4217 currency code"
+// @Param   cursor query string false "next_cursor of the previous page"
+// @Param   limit query int false "Page size, 1 to 100 (default 50)"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /wallets/{currency}/statement [get]
+func (w walletHandler) Statement(c echo.Context) error {
+	return w.walletService.GetStatement(c)
+}
+
+func NewWalletHandler(logger *slog.Logger, walletService WalletService) WalletHandler {
+	return walletHandler{
+		logger:        logger,
+		walletService: walletService,
+	}
+}
@@ -0,0 +1,44 @@
+package wallet
+
+import (
+	"mamlaka/internal/app/user"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EntryType describes why a wallet balance changed.
+type EntryType string
+
+const (
+	EntryTopUp       EntryType = "top_up"
+	EntryPayment     EntryType = "payment"
+	EntryRefund      EntryType = "refund"
+	EntryTransferIn  EntryType = "transfer_in"
+	EntryTransferOut EntryType = "transfer_out"
+)
+
+// Wallet holds a user's balance in one currency.
+type Wallet struct {
+	gorm.Model
+	UserID   uint       `gorm:"not null;uniqueIndex:idx_wallets_user_currency"`
+	User     *user.User `gorm:"constraint:OnDelete:RESTRICT"`
+	Currency string     `gorm:"size:3;not null;uniqueIndex:idx_wallets_user_currency"`
+	Balance  int64      `gorm:"not null;default:0;check:chk_wallets_balance_non_negative,balance >= 0"` // Minor units
+}
+
+// Entry is a line of a wallet statement. Entries are never changed.
+type Entry struct {
+	ID           uint      `gorm:"primaryKey"`
+	WalletID     uint      `gorm:"not null;index"`
+	Type         EntryType `gorm:"size:20;not null"`
+	Amount       int64     `gorm:"not null"` // Minor units; credits are positive, debits negative
+	BalanceAfter int64     `gorm:"not null"`
+	Reference    string    `gorm:"size:100;not null;index"` // What caused the change, e.g. "payment:12"
+	Description  string
+	CreatedAt    time.Time `gorm:"not null"`
+}
+
+func (Entry) TableName() string {
+	return "wallet_entries"
+}
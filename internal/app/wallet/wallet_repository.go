@@ -0,0 +1,63 @@
+package wallet
+
+import (
+	"errors"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+type WalletRepository interface {
+	GetWalletsByUserID(userID uint) ([]Wallet, error)
+	GetWallet(userID uint, currency string) (*Wallet, error)
+	GetEntries(walletID uint, beforeID uint, limit int) ([]Entry, error)
+}
+
+type walletRepository struct {
+	DB     *gorm.DB
+	logger *slog.Logger
+}
+
+func (w walletRepository) GetWalletsByUserID(userID uint) ([]Wallet, error) {
+	var wallets []Wallet
+	if err := w.DB.Where("user_id = ?", userID).Order("currency").Find(&wallets).Error; err != nil {
+		w.logger.Error("Error fetching wallets", "userID", userID, "error", err)
+		return nil, err
+	}
+	return wallets, nil
+}
+
+func (w walletRepository) GetWallet(userID uint, currency string) (*Wallet, error) {
+	var wallet Wallet
+	if err := w.DB.Where("user_id = ? AND currency = ?", userID, currency).First(&wallet).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		w.logger.Error("Error fetching wallet", "userID", userID, "currency", currency, "error", err)
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// GetEntries returns up to limit statement entries of a wallet, newest first,
+// starting below beforeID when it is not zero.
+func (w walletRepository) GetEntries(walletID uint, beforeID uint, limit int) ([]Entry, error) {
+	query := w.DB.Where("wallet_id = ?", walletID)
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var entries []Entry
+	if err := query.Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		w.logger.Error("Error fetching wallet entries", "walletID", walletID, "error", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+func NewWalletRepository(db *gorm.DB, logger *slog.Logger) WalletRepository {
+	return walletRepository{
+		DB:     db,
+		logger: logger,
+	}
+}
@@ -0,0 +1,22 @@
+package wallet
+
+import (
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"log/slog"
+	"mamlaka/internal/app/middlewares"
+)
+
+func RegisterWalletRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB) {
+	walletRepository := NewWalletRepository(db, logger)
+	walletService := NewWalletService(logger, walletRepository)
+	walletHandler := NewWalletHandler(logger, walletService)
+
+	wallets := e.Group("/wallets")
+	{
+		wallets.Use(middlewares.JWTMiddleware)
+
+		wallets.GET("", walletHandler.Wallets)
+		wallets.GET("/:currency/statement", walletHandler.Statement)
+	}
+}
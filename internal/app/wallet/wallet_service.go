@@ -0,0 +1,135 @@
+package wallet
+
+import (
+	"errors"
+	"log/slog"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultStatementSize = 50
+
+// WalletService lets users see their wallet balances and statements. Wallets
+// are funded by payments with the wallet_top_up purpose and spent by e_wallet
+// payments.
+type WalletService interface {
+	ListWallets(c echo.Context) error
+	GetStatement(c echo.Context) error
+}
+
+type walletService struct {
+	logger     *slog.Logger
+	repository WalletRepository
+}
+
+// ListWallets returns the authenticated user's wallets with their balances.
+func (w walletService) ListWallets(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return w.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	wallets, err := w.repository.GetWalletsByUserID(userID)
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	data := make([]WalletDto, 0, len(wallets))
+	for _, wallet := range wallets {
+		data = append(data, toWalletDto(wallet))
+	}
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Wallets fetched successfully",
+		Data:    data,
+	})
+}
+
+// GetStatement returns the movements of the user's wallet in the currency
+// given in the path, newest first.
+func (w walletService) GetStatement(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return w.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	var request StatementRequestDto
+	if err := c.Bind(&request); err != nil {
+		return w.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return c.JSON(http.StatusBadRequest, common.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Error:  "request validation failed",
+			Fields: common.FieldErrors(err),
+		})
+	}
+
+	currency := strings.ToUpper(c.Param("currency"))
+	if _, err := money.Exponent(currency); err != nil {
+		return w.handleError(c, err, http.StatusBadRequest)
+	}
+
+	var beforeID uint64
+	if request.Cursor != "" {
+		if beforeID, err = strconv.ParseUint(request.Cursor, 10, 32); err != nil {
+			return w.handleError(c, errors.New("invalid cursor"), http.StatusBadRequest)
+		}
+	}
+	limit := request.Limit
+	if limit == 0 {
+		limit = defaultStatementSize
+	}
+
+	wallet, err := w.repository.GetWallet(userID, currency)
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+	if wallet == nil {
+		return w.handleError(c, errors.New("wallet not found"), http.StatusNotFound)
+	}
+
+	entries, err := w.repository.GetEntries(wallet.ID, uint(beforeID), limit+1)
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	var nextCursor string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		nextCursor = strconv.FormatUint(uint64(entries[limit-1].ID), 10)
+	}
+
+	data := make([]StatementEntryDto, 0, len(entries))
+	for _, entry := range entries {
+		data = append(data, toStatementEntryDto(entry, wallet.Currency))
+	}
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:     http.StatusOK,
+		Message:    "Wallet statement fetched successfully",
+		Data:       data,
+		NextCursor: nextCursor,
+	})
+}
+
+// handleError is a helper function for creating error responses.
+func (w walletService) handleError(c echo.Context, err error, status int) error {
+	return c.JSON(status, common.ErrorResponse{
+		Status: status,
+		Error:  err.Error(),
+	})
+}
+
+// NewWalletService creates a new instance of walletService.
+func NewWalletService(logger *slog.Logger, repository WalletRepository) WalletService {
+	return walletService{
+		logger:     logger,
+		repository: repository,
+	}
+}
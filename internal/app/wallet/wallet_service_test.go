@@ -0,0 +1,158 @@
+package wallet
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mamlaka/internal/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// memoryRepository keeps wallets and their entries, oldest first, in memory.
+type memoryRepository struct {
+	wallets []Wallet
+	entries []Entry
+}
+
+func (m *memoryRepository) GetWalletsByUserID(userID uint) ([]Wallet, error) {
+	var wallets []Wallet
+	for _, wallet := range m.wallets {
+		if wallet.UserID == userID {
+			wallets = append(wallets, wallet)
+		}
+	}
+	return wallets, nil
+}
+
+func (m *memoryRepository) GetWallet(userID uint, currency string) (*Wallet, error) {
+	for _, wallet := range m.wallets {
+		if wallet.UserID == userID && wallet.Currency == currency {
+			return &wallet, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepository) GetEntries(walletID uint, beforeID uint, limit int) ([]Entry, error) {
+	var entries []Entry
+	for i := len(m.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		entry := m.entries[i]
+		if entry.WalletID == walletID && (beforeID == 0 || entry.ID < beforeID) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// newStatementRepository returns user 7's KES wallet with five top-ups of
+// 10.00 and user 8's wallet with one.
+func newStatementRepository() *memoryRepository {
+	m := &memoryRepository{}
+	m.wallets = append(m.wallets, Wallet{UserID: 7, Currency: "KES", Balance: 5000}, Wallet{UserID: 8, Currency: "KES", Balance: 1000})
+	m.wallets[0].ID, m.wallets[1].ID = 1, 2
+	for i := 1; i <= 5; i++ {
+		m.entries = append(m.entries, Entry{ID: uint(i), WalletID: 1, Type: EntryTopUp, Amount: 1000, BalanceAfter: int64(i) * 1000})
+	}
+	m.entries = append(m.entries, Entry{ID: 6, WalletID: 2, Type: EntryTopUp, Amount: 1000, BalanceAfter: 1000})
+	return m
+}
+
+type statementResponse struct {
+	Data       []StatementEntryDto `json:"data"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+func getStatement(t *testing.T, service WalletService, currency, query string) (*httptest.ResponseRecorder, statementResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+currency+"/statement?"+query, nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("currency")
+	c.SetParamValues(currency)
+	c.Set("claims", &tokens.Claims{UserID: "7"})
+
+	if err := service.GetStatement(c); err != nil {
+		t.Fatalf("GetStatement() error = %v", err)
+	}
+	var response statementResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, response
+}
+
+func newTestService(repository WalletRepository) WalletService {
+	return NewWalletService(slog.New(slog.NewTextHandler(io.Discard, nil)), repository)
+}
+
+func TestStatementPages(t *testing.T) {
+	service := newTestService(newStatementRepository())
+
+	_, first := getStatement(t, service, "kes", "limit=2")
+	if len(first.Data) != 2 || first.Data[0].ID != 5 || first.Data[1].ID != 4 || first.NextCursor != "4" {
+		t.Fatalf("first page = %+v, want entries 5 and 4 and cursor 4", first)
+	}
+	if got := first.Data[0].BalanceAfter; got.Amount != 5000 || got.Currency != "KES" {
+		t.Errorf("balance after = %v, want 50.00 KES", got)
+	}
+
+	_, second := getStatement(t, service, "KES", "limit=2&cursor="+first.NextCursor)
+	if len(second.Data) != 2 || second.Data[0].ID != 3 || second.NextCursor != "2" {
+		t.Errorf("second page = %+v, want entries 3 and 2 and cursor 2", second)
+	}
+
+	_, last := getStatement(t, service, "KES", "limit=2&cursor="+second.NextCursor)
+	if len(last.Data) != 1 || last.Data[0].ID != 1 || last.NextCursor != "" {
+		t.Errorf("last page = %+v, want entry 1 and no cursor", last)
+	}
+}
+
+func TestStatementErrors(t *testing.T) {
+	service := newTestService(newStatementRepository())
+
+	tests := []struct {
+		name     string
+		currency string
+		query    string
+		want     int
+	}{
+		{"unknown currency", "XYZ", "", http.StatusBadRequest},
+		{"no wallet in currency", "USD", "", http.StatusNotFound},
+		{"invalid cursor", "KES", "cursor=abc", http.StatusBadRequest},
+		{"limit too large", "KES", "limit=101", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec, _ := getStatement(t, service, tt.currency, tt.query); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestListWalletsShowsOwnWallets(t *testing.T) {
+	service := newTestService(newStatementRepository())
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/wallets", nil), rec)
+	c.Set("claims", &tokens.Claims{UserID: "7"})
+
+	if err := service.ListWallets(c); err != nil {
+		t.Fatalf("ListWallets() error = %v", err)
+	}
+
+	var response struct {
+		Data []WalletDto `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 1 || response.Data[0].ID != 1 || response.Data[0].Balance.Amount != 5000 {
+		t.Errorf("wallets = %+v, want only wallet 1 with 50.00 KES", response.Data)
+	}
+}
@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const dispatchBatchSize = 50
+
+// maxResponseBytes bounds how much of an endpoint's response is read.
+const maxResponseBytes = 1 << 10
+
+// Dispatcher sends due deliveries to their endpoints and schedules retries
+// for the ones that fail.
+type Dispatcher struct {
+	logger     *slog.Logger
+	repository WebhookRepository
+	client     *http.Client
+	config     config.WebhookConfig
+}
+
+// DispatchDue sends every delivery that is due. Deliveries of a batch are
+// sent concurrently so one slow endpoint does not hold up the others.
+func (d *Dispatcher) DispatchDue(ctx context.Context) error {
+	for {
+		// Claims outlive the request timeout so a delivery is not sent twice at once
+		deliveries, err := d.repository.ClaimDueDeliveries(time.Now(), d.config.RequestTimeout+time.Minute, dispatchBatchSize)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(delivery *Delivery) {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+
+		if len(deliveries) < dispatchBatchSize || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// deliver makes one attempt at a delivery and records its outcome.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *Delivery) {
+	attempt := &DeliveryAttempt{DeliveryID: delivery.ID}
+	started := time.Now()
+
+	if delivery.Endpoint.DeletedAt.Valid {
+		attempt.Error = "endpoint deleted"
+	} else {
+		attempt.StatusCode, attempt.Error = d.send(ctx, delivery)
+	}
+	attempt.DurationMS = time.Since(started).Milliseconds()
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+	switch {
+	case attempt.Error == "":
+		delivery.Status = DeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= d.config.MaxAttempts || delivery.Endpoint.DeletedAt.Valid:
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(d.backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := d.repository.RecordAttempt(delivery, attempt); err != nil {
+		return
+	}
+	d.logger.Info("Webhook delivery attempted", "deliveryID", delivery.ID, "endpointID", delivery.EndpointID,
+		"attempt", delivery.Attempts, "status", delivery.Status, "statusCode", attempt.StatusCode, "error", attempt.Error)
+}
+
+// send posts the delivery's event to its endpoint. It returns the response
+// status code and, unless the endpoint answered with a 2xx status, why the
+// attempt failed.
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) (int, string) {
+	body, err := delivery.Event.payload()
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.config.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	// Endpoints registered before https was required are not sent to
+	if d.config.RequireHTTPS && req.URL.Scheme != "https" {
+		return 0, "endpoint URL must use https"
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mamlaka-Webhooks/1.0")
+	req.Header.Set("Mamlaka-Event-Type", delivery.Event.Type)
+	req.Header.Set("Mamlaka-Delivery-ID", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Endpoint.Secret, body, time.Now()))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Sprintf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, ""
+}
+
+// backoff returns how long to wait before retrying a delivery that has
+// failed attempts times.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.RetryBaseDelay
+	for i := 1; i < attempts && delay < d.config.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.config.RetryMaxDelay {
+		delay = d.config.RetryMaxDelay
+	}
+	return delay
+}
+
+// NewDispatcher creates a dispatcher. Redirects are not followed: endpoints
+// must answer at the registered URL. Connections to internal addresses are
+// refused outside development, and no proxy is used, so the check applies to
+// every connection.
+func NewDispatcher(logger *slog.Logger, repository WebhookRepository, conf config.WebhookConfig) *Dispatcher {
+	return &Dispatcher{
+		logger:     logger,
+		repository: repository,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 nil,
+				DialContext:           newTargetDialer(conf.AllowPrivate).DialContext,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		config: conf,
+	}
+}
+
+// RunDispatcher sends due deliveries every interval until ctx is cancelled.
+func RunDispatcher(ctx context.Context, logger *slog.Logger, dispatcher *Dispatcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dispatcher.DispatchDue(ctx); err != nil {
+				logger.Error("Error dispatching webhooks", "error", err)
+			}
+		}
+	}
+}
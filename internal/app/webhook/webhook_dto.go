@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"strings"
+	"time"
+)
+
+type EndpointRequestDto struct {
+	URL        string   `json:"url" validate:"required,url,max=2048"`
+	EventTypes []string `json:"event_types"` // Empty subscribes to every event type
+}
+
+type EndpointDto struct {
+	ID         uint      `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"` // Only returned when the endpoint is created
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type DeliveryListRequestDto struct {
+	EndpointID uint   `query:"endpoint_id" json:"endpoint_id"`
+	Status     string `query:"status" json:"status" validate:"omitempty,oneof=pending succeeded failed"`
+	Cursor     string `query:"cursor" json:"cursor"`
+	Limit      int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+func toEndpointDto(endpoint Endpoint) EndpointDto {
+	eventTypes := []string{}
+	if endpoint.EventTypes != "" {
+		eventTypes = strings.Split(endpoint.EventTypes, ",")
+	}
+	return EndpointDto{
+		ID:         endpoint.ID,
+		URL:        endpoint.URL,
+		EventTypes: eventTypes,
+		CreatedAt:  endpoint.CreatedAt,
+	}
+}
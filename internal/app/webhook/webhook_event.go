@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event types delivered to endpoints.
+const (
+	EventPaymentCreated           = "payment.created"
+	EventPaymentAuthorized        = "payment.authorized"
+	EventPaymentCaptured          = "payment.captured"
+	EventPaymentSettled           = "payment.settled"
+	EventPaymentFailed            = "payment.failed"
+	EventPaymentCancelled         = "payment.cancelled"
+	EventPaymentRefunded          = "payment.refunded"
+	EventPaymentPartiallyRefunded = "payment.partially_refunded"
+	EventRefundCreated            = "refund.created"
+	EventRefundSucceeded          = "refund.succeeded"
+	EventRefundFailed             = "refund.failed"
+)
+
+// EventTypes lists every event type endpoints can subscribe to.
+var EventTypes = []string{
+	EventPaymentCreated,
+	EventPaymentAuthorized,
+	EventPaymentCaptured,
+	EventPaymentSettled,
+	EventPaymentFailed,
+	EventPaymentCancelled,
+	EventPaymentRefunded,
+	EventPaymentPartiallyRefunded,
+	EventRefundCreated,
+	EventRefundSucceeded,
+	EventRefundFailed,
+}
+
+// IsEventType reports whether t is one of EventTypes.
+func IsEventType(t string) bool {
+	for _, eventType := range EventTypes {
+		if eventType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body posted to endpoints.
+type Payload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// payload returns the body delivered for the event.
+func (e *Event) payload() ([]byte, error) {
+	return json.Marshal(Payload{
+		ID:        fmt.Sprintf("evt_%d", e.ID),
+		Type:      e.Type,
+		CreatedAt: e.CreatedAt,
+		Data:      e.Data,
+	})
+}
+
+// Enqueue records an event for userID and schedules a delivery to each of the
+// user's endpoints subscribed to its type. It is meant to run in the
+// transaction that makes the change the event describes, so an event is
+// emitted exactly when the change is committed.
+func Enqueue(tx *gorm.DB, userID uint, eventType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var endpoints []Endpoint
+	if err := tx.Where("user_id = ?", userID).Find(&endpoints).Error; err != nil {
+		return err
+	}
+
+	var deliveries []Delivery
+	now := time.Now()
+	for _, endpoint := range endpoints {
+		if endpoint.Subscribes(eventType) {
+			deliveries = append(deliveries, Delivery{EndpointID: endpoint.ID, Status: DeliveryPending, NextAttemptAt: &now})
+		}
+	}
+	if len(deliveries) == 0 {
+		// Nobody is listening, so there is nothing worth keeping
+		return nil
+	}
+
+	event := Event{UserID: userID, Type: eventType, Data: encoded}
+	if err := tx.Create(&event).Error; err != nil {
+		return err
+	}
+	for i := range deliveries {
+		deliveries[i].EventID = event.ID
+	}
+	return tx.Omit("Event", "Endpoint").Create(&deliveries).Error
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"log/slog"
+	_ "mamlaka/internal/app/common"
+
+	"github.com/labstack/echo/v4"
+)
+
+type WebhookHandler interface {
+	CreateEndpoint(c echo.Context) error
+	Endpoints(c echo.Context) error
+	DeleteEndpoint(c echo.Context) error
+	Deliveries(c echo.Context) error
+	Delivery(c echo.Context) error
+	Redeliver(c echo.Context) error
+}
+
+type webhookHandler struct {
+	logger         *slog.Logger
+	webhookService WebhookService
+}
+
+// CreateEndpoint godoc
+// @Summary Register a webhook endpoint
+// @Description Registers a URL that payment and refund events are posted to. Each request carries a Mamlaka-Signature header of the form "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">" keyed with the endpoint secret, which is only returned by this call.
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param   EndpointRequestDto body EndpointRequestDto true "Endpoint Request"
+// @Success 201 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /webhooks/endpoints [post]
+func (w webhookHandler) CreateEndpoint(c echo.Context) error {
+	return w.webhookService.CreateEndpoint(c)
+}
+
+// Endpoints godoc
+// @Summary List webhook endpoints
+// @Description Lists the caller's webhook endpoints
+// @Tags Webhooks
+// @Produce  json
+// @Success 200 {object} common.BaseResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /webhooks/endpoints [get]
+func (w webhookHandler) Endpoints(c echo.Context) error {
+	return w.webhookService.ListEndpoints(c)
+}
+
+// DeleteEndpoint godoc
+// @Summary Delete a webhook endpoint
+// @Description Stops sending events to the endpoint and gives up on its pending deliveries
+// @Tags Webhooks
+// @Produce  json
+// @Param   id path int true "Endpoint ID"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /webhooks/endpoints/{id} [delete]
+func (w webhookHandler) DeleteEndpoint(c echo.Context) error {
+	return w.webhookService.DeleteEndpoint(c)
+}
+
+// Deliveries godoc
+// @Summary List webhook deliveries
+// @Description Lists deliveries to the caller's endpoints, newest first
+// @Tags Webhooks
+// @Produce  json
+// @Param   endpoint_id query int false "Only deliveries to this endpoint"
+// @Param   status query string false "pending, succeeded or failed"
+// @Param   cursor query string false "next_cursor of the previous page"
+// @Param   limit query int false "Page size, 1 to 100 (default 20)"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /webhooks/deliveries [get]
+func (w webhookHandler) Deliveries(c echo.Context) error {
+	return w.webhookService.ListDeliveries(c)
+}
+
+// Delivery godoc
+// @Summary Get a webhook delivery
+// @Description Returns a delivery with its event and the log of every attempt made
+// @Tags Webhooks
+// @Produce  json
+// @Param   id path int true "Delivery ID"
+// @Success 200 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /webhooks/deliveries/{id} [get]
+func (w webhookHandler) Delivery(c echo.Context) error {
+	return w.webhookService.GetDelivery(c)
+}
+
+// Redeliver godoc
+// @Summary Redeliver a webhook event
+// @Description Sends the delivery's event to its endpoint again as a new delivery
+// @Tags Webhooks
+// @Produce  json
+// @Param   id path int true "Delivery ID"
+// @Success 202 {object} common.BaseResponse
+// @Failure 400 {object} common.ErrorResponse
+// @Failure 401 {object} common.ErrorResponse
+// @Failure 404 {object} common.ErrorResponse
+// @Failure 409 {object} common.ErrorResponse
+// @Failure 500 {object} common.ErrorResponse
+// @Router  /webhooks/deliveries/{id}/redeliver [post]
+func (w webhookHandler) Redeliver(c echo.Context) error {
+	return w.webhookService.Redeliver(c)
+}
+
+func NewWebhookHandler(logger *slog.Logger, webhookService WebhookService) WebhookHandler {
+	return webhookHandler{
+		logger:         logger,
+		webhookService: webhookService,
+	}
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"encoding/json"
+	"mamlaka/internal/app/user"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed" // Gave up after the maximum number of attempts
+)
+
+// Endpoint is a URL a user registered to receive events.
+type Endpoint struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	User       *user.User `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	URL        string     `gorm:"size:2048;not null" json:"url"`
+	Secret     string     `gorm:"size:100;not null" json:"-"` // Signs deliveries; only shown when the endpoint is created
+	EventTypes string     `gorm:"size:1000" json:"-"`         // Comma-separated; empty subscribes to every event
+}
+
+// Subscribes reports whether the endpoint wants events of the given type.
+func (e *Endpoint) Subscribes(eventType string) bool {
+	if e.EventTypes == "" {
+		return true
+	}
+	for _, t := range strings.Split(e.EventTypes, ",") {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something that happened to a user's resources, e.g. a payment
+// being captured. Events are delivered to every subscribed endpoint.
+type Event struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	UserID    uint            `gorm:"not null;index" json:"user_id"`
+	Type      string          `gorm:"size:50;not null" json:"type"`
+	Data      json.RawMessage `gorm:"type:jsonb;not null" json:"data"`
+	CreatedAt time.Time       `gorm:"not null" json:"created_at"`
+}
+
+// Delivery tracks sending one event to one endpoint, including retries.
+type Delivery struct {
+	gorm.Model
+	EventID        uint           `gorm:"not null;index" json:"event_id"`
+	Event          Event          `json:"event"`
+	EndpointID     uint           `gorm:"not null;index" json:"endpoint_id"`
+	Endpoint       Endpoint       `json:"-"`
+	Status         DeliveryStatus `gorm:"size:20;not null;index:idx_webhook_deliveries_due,priority:1" json:"status"`
+	Attempts       int            `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time     `gorm:"index:idx_webhook_deliveries_due,priority:2" json:"next_attempt_at,omitempty"`
+	LastStatusCode int            `json:"last_status_code,omitempty"`
+	LastError      string         `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+
+	AttemptLog []DeliveryAttempt `gorm:"foreignKey:DeliveryID" json:"attempt_log,omitempty"`
+}
+
+// DeliveryAttempt records one HTTP request made for a delivery.
+type DeliveryAttempt struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	DeliveryID uint      `gorm:"not null;index" json:"delivery_id"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Endpoint) TableName() string {
+	return "webhook_endpoints"
+}
+
+func (Event) TableName() string {
+	return "webhook_events"
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+func (DeliveryAttempt) TableName() string {
+	return "webhook_delivery_attempts"
+}
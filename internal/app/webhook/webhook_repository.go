@@ -0,0 +1,211 @@
+package webhook
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository interface {
+	CreateEndpoint(endpoint *Endpoint) error
+	GetEndpointsByUserID(userID uint) ([]Endpoint, error)
+	GetUserEndpoint(userID, endpointID uint) (*Endpoint, error)
+	DeleteEndpoint(endpoint *Endpoint) error
+	GetDeliveries(userID uint, filter DeliveryFilter) ([]Delivery, error)
+	GetUserDelivery(userID, deliveryID uint) (*Delivery, error)
+	CreateDelivery(delivery *Delivery) error
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	RecordAttempt(delivery *Delivery, attempt *DeliveryAttempt) error
+}
+
+// DeliveryFilter selects a page of deliveries for GetDeliveries.
+type DeliveryFilter struct {
+	EndpointID uint // Zero lists deliveries to every endpoint
+	Status     DeliveryStatus
+	BeforeID   uint // Zero starts at the newest delivery
+	Limit      int
+}
+
+type webhookRepository struct {
+	DB     *gorm.DB
+	logger *slog.Logger
+}
+
+func (w webhookRepository) CreateEndpoint(endpoint *Endpoint) error {
+	if err := w.DB.Omit("User").Create(endpoint).Error; err != nil {
+		w.logger.Error("Error creating webhook endpoint", "userID", endpoint.UserID, "error", err)
+		return err
+	}
+	w.logger.Info("Webhook endpoint created", "endpointID", endpoint.ID, "userID", endpoint.UserID)
+	return nil
+}
+
+func (w webhookRepository) GetEndpointsByUserID(userID uint) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	if err := w.DB.Where("user_id = ?", userID).Order("id").Find(&endpoints).Error; err != nil {
+		w.logger.Error("Error fetching webhook endpoints", "userID", userID, "error", err)
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// GetUserEndpoint returns an endpoint if it belongs to userID, or nil otherwise.
+func (w webhookRepository) GetUserEndpoint(userID, endpointID uint) (*Endpoint, error) {
+	var endpoint Endpoint
+	if err := w.DB.Where("id = ? AND user_id = ?", endpointID, userID).First(&endpoint).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		w.logger.Error("Error fetching webhook endpoint", "endpointID", endpointID, "error", err)
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// DeleteEndpoint removes an endpoint and gives up on its pending deliveries.
+// The endpoint is soft-deleted so its delivery log stays readable.
+func (w webhookRepository) DeleteEndpoint(endpoint *Endpoint) error {
+	err := w.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Delivery{}).
+			Where("endpoint_id = ? AND status = ?", endpoint.ID, DeliveryPending).
+			Updates(map[string]interface{}{"status": DeliveryFailed, "next_attempt_at": nil, "last_error": "endpoint deleted"}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(endpoint).Error
+	})
+	if err != nil {
+		w.logger.Error("Error deleting webhook endpoint", "endpointID", endpoint.ID, "error", err)
+		return err
+	}
+	w.logger.Info("Webhook endpoint deleted", "endpointID", endpoint.ID)
+	return nil
+}
+
+// GetDeliveries returns deliveries to userID's endpoints, newest first.
+func (w webhookRepository) GetDeliveries(userID uint, filter DeliveryFilter) ([]Delivery, error) {
+	query := w.DB.Select("webhook_deliveries.*").
+		Preload("Event").
+		Joins("JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id").
+		Where("webhook_endpoints.user_id = ?", userID)
+	if filter.EndpointID != 0 {
+		query = query.Where("webhook_deliveries.endpoint_id = ?", filter.EndpointID)
+	}
+	if filter.Status != "" {
+		query = query.Where("webhook_deliveries.status = ?", filter.Status)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("webhook_deliveries.id < ?", filter.BeforeID)
+	}
+
+	var deliveries []Delivery
+	if err := query.Order("webhook_deliveries.id DESC").Limit(filter.Limit).Find(&deliveries).Error; err != nil {
+		w.logger.Error("Error fetching webhook deliveries", "userID", userID, "error", err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// GetUserDelivery returns a delivery with its attempts if it was made to one
+// of userID's endpoints, or nil otherwise.
+func (w webhookRepository) GetUserDelivery(userID, deliveryID uint) (*Delivery, error) {
+	var delivery Delivery
+	err := w.DB.Select("webhook_deliveries.*").
+		Preload("Event").
+		Preload("AttemptLog", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Joins("JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id").
+		Where("webhook_deliveries.id = ? AND webhook_endpoints.user_id = ?", deliveryID, userID).
+		First(&delivery).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		w.logger.Error("Error fetching webhook delivery", "deliveryID", deliveryID, "error", err)
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (w webhookRepository) CreateDelivery(delivery *Delivery) error {
+	if err := w.DB.Omit("Event", "Endpoint").Create(delivery).Error; err != nil {
+		w.logger.Error("Error creating webhook delivery", "eventID", delivery.EventID, "endpointID", delivery.EndpointID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next
+// attempt is due, with their event and endpoint. Claimed deliveries are
+// pushed lease into the future so that other dispatchers skip them while they
+// are being sent; if this one dies mid-send they become due again afterwards.
+func (w webhookRepository) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := w.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(deliveries))
+		for i, delivery := range deliveries {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&Delivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		w.logger.Error("Error claiming webhook deliveries", "error", err)
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	// Endpoints deleted after the claim are loaded too; the dispatcher fails their deliveries
+	for i := range deliveries {
+		if err := w.DB.Unscoped().First(&deliveries[i].Endpoint, deliveries[i].EndpointID).Error; err != nil {
+			return nil, err
+		}
+		if err := w.DB.First(&deliveries[i].Event, deliveries[i].EventID).Error; err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt stores the outcome of an attempt together with the updated
+// state of its delivery.
+func (w webhookRepository) RecordAttempt(delivery *Delivery, attempt *DeliveryAttempt) error {
+	err := w.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(delivery).Updates(map[string]interface{}{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+		}).Error
+	})
+	if err != nil {
+		w.logger.Error("Error recording webhook attempt", "deliveryID", delivery.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func NewWebhookRepository(db *gorm.DB, logger *slog.Logger) WebhookRepository {
+	return webhookRepository{
+		DB:     db,
+		logger: logger,
+	}
+}
@@ -0,0 +1,27 @@
+package webhook
+
+import (
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/middlewares"
+)
+
+func RegisterWebhookRoutes(e *echo.Group, logger *slog.Logger, db *gorm.DB, conf config.Config) {
+	webhookRepository := NewWebhookRepository(db, logger)
+	webhookService := NewWebhookService(logger, webhookRepository, conf.Webhook)
+	webhookHandler := NewWebhookHandler(logger, webhookService)
+
+	webhooks := e.Group("/webhooks")
+	{
+		webhooks.Use(middlewares.JWTMiddleware)
+
+		webhooks.POST("/endpoints", webhookHandler.CreateEndpoint)
+		webhooks.GET("/endpoints", webhookHandler.Endpoints)
+		webhooks.DELETE("/endpoints/:id", webhookHandler.DeleteEndpoint)
+		webhooks.GET("/deliveries", webhookHandler.Deliveries)
+		webhooks.GET("/deliveries/:id", webhookHandler.Delivery)
+		webhooks.POST("/deliveries/:id/redeliver", webhookHandler.Redeliver)
+	}
+}
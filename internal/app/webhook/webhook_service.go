@@ -0,0 +1,301 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/app/common"
+	"mamlaka/internal/app/middlewares"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultDeliveryPageSize = 20
+
+// WebhookService manages the webhook endpoints of users and their deliveries.
+type WebhookService interface {
+	CreateEndpoint(c echo.Context) error
+	ListEndpoints(c echo.Context) error
+	DeleteEndpoint(c echo.Context) error
+	ListDeliveries(c echo.Context) error
+	GetDelivery(c echo.Context) error
+	Redeliver(c echo.Context) error
+}
+
+type webhookService struct {
+	logger     *slog.Logger
+	repository WebhookRepository
+	config     config.WebhookConfig
+}
+
+// CreateEndpoint registers a URL to receive the authenticated user's events.
+// The signing secret is only returned in this response.
+func (w webhookService) CreateEndpoint(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return w.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	var request EndpointRequestDto
+	if err := c.Bind(&request); err != nil {
+		w.logger.Error("Error parsing webhook endpoint request body", "error", err)
+		return w.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return w.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	var fields []common.FieldError
+	if err := validateTargetURL(c.Request().Context(), request.URL, w.config.RequireHTTPS, w.config.AllowPrivate); err != nil {
+		w.logger.Info("Webhook endpoint URL rejected", "userID", userID, "error", err)
+		fields = append(fields, common.FieldError{Field: "url", Message: err.Error()})
+	}
+	for _, eventType := range request.EventTypes {
+		if !IsEventType(eventType) {
+			fields = append(fields, common.FieldError{Field: "event_types", Message: "must be one of: " + strings.Join(EventTypes, " ")})
+			break
+		}
+	}
+	if len(fields) > 0 {
+		return w.handleValidationError(c, fields)
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+	endpoint := &Endpoint{
+		UserID:     userID,
+		URL:        request.URL,
+		Secret:     secret,
+		EventTypes: strings.Join(request.EventTypes, ","),
+	}
+	if err := w.repository.CreateEndpoint(endpoint); err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	data := toEndpointDto(*endpoint)
+	data.Secret = endpoint.Secret
+	return c.JSON(http.StatusCreated, common.BaseResponse{
+		Status:  http.StatusCreated,
+		Message: "Webhook endpoint created successfully",
+		Data:    data,
+	})
+}
+
+// ListEndpoints lists the authenticated user's webhook endpoints.
+func (w webhookService) ListEndpoints(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return w.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	endpoints, err := w.repository.GetEndpointsByUserID(userID)
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	data := make([]EndpointDto, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		data = append(data, toEndpointDto(endpoint))
+	}
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Webhook endpoints fetched successfully",
+		Data:    data,
+	})
+}
+
+// DeleteEndpoint stops sending events to one of the authenticated user's endpoints.
+func (w webhookService) DeleteEndpoint(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return w.handleError(c, err, http.StatusUnauthorized)
+	}
+	endpointID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return w.handleError(c, errors.New("invalid endpoint ID"), http.StatusBadRequest)
+	}
+
+	endpoint, err := w.repository.GetUserEndpoint(userID, uint(endpointID))
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+	if endpoint == nil {
+		return w.handleError(c, errors.New("webhook endpoint not found"), http.StatusNotFound)
+	}
+	if err := w.repository.DeleteEndpoint(endpoint); err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Webhook endpoint deleted successfully",
+	})
+}
+
+// ListDeliveries lists deliveries to the authenticated user's endpoints, newest first.
+func (w webhookService) ListDeliveries(c echo.Context) error {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return w.handleError(c, err, http.StatusUnauthorized)
+	}
+
+	var request DeliveryListRequestDto
+	if err := c.Bind(&request); err != nil {
+		return w.handleError(c, err, http.StatusBadRequest)
+	}
+	if err := common.ValidateModel(request); err != nil {
+		return w.handleValidationError(c, common.FieldErrors(err))
+	}
+
+	filter := DeliveryFilter{
+		EndpointID: request.EndpointID,
+		Status:     DeliveryStatus(request.Status),
+		Limit:      request.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultDeliveryPageSize
+	}
+	if request.Cursor != "" {
+		beforeID, err := strconv.ParseUint(request.Cursor, 10, 32)
+		if err != nil {
+			return w.handleValidationError(c, []common.FieldError{{Field: "cursor", Message: "invalid cursor"}})
+		}
+		filter.BeforeID = uint(beforeID)
+	}
+
+	// Fetch one extra delivery to find out whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	deliveries, err := w.repository.GetDeliveries(userID, filter)
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+
+	var nextCursor string
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		nextCursor = strconv.FormatUint(uint64(deliveries[limit-1].ID), 10)
+	}
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:     http.StatusOK,
+		Message:    "Webhook deliveries fetched successfully",
+		Data:       deliveries,
+		NextCursor: nextCursor,
+	})
+}
+
+// GetDelivery returns a delivery with the log of its attempts.
+func (w webhookService) GetDelivery(c echo.Context) error {
+	delivery, err := w.deliveryFromPath(c)
+	if err != nil || delivery == nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, common.BaseResponse{
+		Status:  http.StatusOK,
+		Message: "Webhook delivery fetched successfully",
+		Data:    delivery,
+	})
+}
+
+// Redeliver sends a delivery's event to its endpoint again as a new
+// delivery, whatever the outcome of the original one.
+func (w webhookService) Redeliver(c echo.Context) error {
+	original, err := w.deliveryFromPath(c)
+	if err != nil || original == nil {
+		return err
+	}
+
+	endpoint, err := w.repository.GetUserEndpoint(original.Event.UserID, original.EndpointID)
+	if err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+	if endpoint == nil {
+		return w.handleError(c, errors.New("the webhook endpoint was deleted"), http.StatusConflict)
+	}
+
+	now := time.Now()
+	delivery := &Delivery{
+		EventID:       original.EventID,
+		EndpointID:    original.EndpointID,
+		Status:        DeliveryPending,
+		NextAttemptAt: &now,
+	}
+	if err := w.repository.CreateDelivery(delivery); err != nil {
+		return w.handleError(c, err, http.StatusInternalServerError)
+	}
+	delivery.Event = original.Event
+
+	w.logger.Info("Webhook redelivery scheduled", "deliveryID", delivery.ID, "originalDeliveryID", original.ID)
+	return c.JSON(http.StatusAccepted, common.BaseResponse{
+		Status:  http.StatusAccepted,
+		Message: "Webhook redelivery scheduled",
+		Data:    delivery,
+	})
+}
+
+// deliveryFromPath loads the delivery named by the :id path parameter if it
+// was made to one of the authenticated user's endpoints. It writes the error
+// response itself and returns a nil delivery when the request cannot continue.
+func (w webhookService) deliveryFromPath(c echo.Context) (*Delivery, error) {
+	userID, err := middlewares.CurrentUserID(c)
+	if err != nil {
+		return nil, w.handleError(c, err, http.StatusUnauthorized)
+	}
+	deliveryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, w.handleError(c, errors.New("invalid delivery ID"), http.StatusBadRequest)
+	}
+
+	delivery, err := w.repository.GetUserDelivery(userID, uint(deliveryID))
+	if err != nil {
+		return nil, w.handleError(c, err, http.StatusInternalServerError)
+	}
+	if delivery == nil {
+		return nil, w.handleError(c, errors.New("webhook delivery not found"), http.StatusNotFound)
+	}
+	return delivery, nil
+}
+
+// generateSecret returns a new random endpoint signing secret.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// handleError is a helper function for creating error responses.
+func (w webhookService) handleError(c echo.Context, err error, status int) error {
+	return c.JSON(status, common.ErrorResponse{
+		Status: status,
+		Error:  err.Error(),
+	})
+}
+
+// handleValidationError responds with 400 and one entry per invalid field.
+func (w webhookService) handleValidationError(c echo.Context, fields []common.FieldError) error {
+	return c.JSON(http.StatusBadRequest, common.ErrorResponse{
+		Status: http.StatusBadRequest,
+		Error:  "request validation failed",
+		Fields: fields,
+	})
+}
+
+// NewWebhookService creates a new instance of webhookService.
+func NewWebhookService(logger *slog.Logger, repository WebhookRepository, conf config.WebhookConfig) WebhookService {
+	return webhookService{
+		logger:     logger,
+		repository: repository,
+		config:     conf,
+	}
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the signature of a delivery.
+const SignatureHeader = "Mamlaka-Signature"
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleSignature   = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// Sign returns the signature header value for body sent at time t:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Including the
+// timestamp in the signed content lets receivers reject replayed deliveries.
+func Sign(secret string, body []byte, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, computeSignature(secret, timestamp, body))
+}
+
+// Verify checks a signature header produced by Sign and rejects it if its
+// timestamp is more than tolerance away from now.
+func Verify(secret string, body []byte, header string, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleSignature
+	}
+
+	expected := computeSignature(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func computeSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
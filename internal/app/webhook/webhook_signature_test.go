@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"type":"payment.captured"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign(secret, body, signedAt)
+
+	tests := []struct {
+		name    string
+		secret  string
+		body    []byte
+		header  string
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", secret, body, header, signedAt, nil},
+		{"within tolerance", secret, body, header, signedAt.Add(5 * time.Minute), nil},
+		{"clock behind within tolerance", secret, body, header, signedAt.Add(-5 * time.Minute), nil},
+		{"too old", secret, body, header, signedAt.Add(5*time.Minute + time.Second), ErrStaleSignature},
+		{"from the future", secret, body, header, signedAt.Add(-5*time.Minute - time.Second), ErrStaleSignature},
+		{"wrong secret", "whsec_other", body, header, signedAt, ErrInvalidSignature},
+		{"tampered body", secret, []byte(`{"type":"payment.refunded"}`), header, signedAt, ErrInvalidSignature},
+		{"rolled secret among several signatures", secret, body, header + ",v1=deadbeef", signedAt, nil},
+		{"missing timestamp", secret, body, "v1=deadbeef", signedAt, ErrInvalidSignature},
+		{"missing signature", secret, body, "t=1700000000", signedAt, ErrInvalidSignature},
+		{"empty header", secret, body, "", signedAt, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.body, tt.header, 5*time.Minute, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplayedTimestamp(t *testing.T) {
+	body := []byte(`{}`)
+	header := Sign("secret", body, time.Unix(1700000000, 0))
+	// Moving the signature to a fresh timestamp invalidates it
+	replayed := "t=1700000600" + header[len("t=1700000000"):]
+	if err := Verify("secret", body, replayed, 5*time.Minute, time.Unix(1700000600, 0)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() = %v, want %v", err, ErrInvalidSignature)
+	}
+}
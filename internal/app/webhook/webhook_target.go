@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned for webhook URLs that resolve to addresses
+// inside our own network, so endpoints cannot be used to reach internal
+// services or cloud metadata.
+var ErrForbiddenTarget = errors.New("webhook URL must resolve to a public address")
+
+// forbiddenPrefixes are the address ranges webhooks may not be sent to:
+// unspecified, loopback, private, shared (CGNAT), link-local (which holds
+// the 169.254.169.254 metadata service), benchmarking, multicast and
+// reserved addresses. fc00::/7 covers the fd00:ec2::254 metadata service.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// checkAddress returns ErrForbiddenTarget if webhooks may not be sent to addr.
+func checkAddress(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s is not public", ErrForbiddenTarget, addr)
+		}
+	}
+	return nil
+}
+
+// validateTargetURL checks a webhook URL when an endpoint is registered: it
+// must be absolute, use https unless requireHTTPS is false, and unless
+// allowPrivate is set every address its host resolves to must be public. The
+// addresses are checked again on every delivery, since DNS can change after
+// registration.
+func validateTargetURL(ctx context.Context, rawURL string, requireHTTPS, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return errors.New("must be an absolute URL")
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && !requireHTTPS:
+	case requireHTTPS:
+		return errors.New("must be an https URL")
+	default:
+		return errors.New("must be an http or https URL")
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("host %s cannot be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if err := checkAddress(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTargetDialer returns a dialer that refuses to connect to forbidden
+// addresses unless allowPrivate is set. The check runs on the resolved
+// address of each connection, so hosts that resolve to a public address at
+// registration and to an internal one later are still refused.
+func newTargetDialer(allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if allowPrivate {
+		return dialer
+	}
+	dialer.Control = func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return err
+		}
+		return checkAddress(addr)
+	}
+	return dialer
+}
@@ -1,17 +1,39 @@
 package auth
 
 import (
+	"crypto/rand"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
-	"math/rand"
-	"time"
+	"math/big"
 )
 
-// GenerateVerificationCode generates a random 5-digit verification code
-func GenerateVerificationCode() int {
-	seed := rand.NewSource(time.Now().UnixNano()) // Properly seed random generator
-	r := rand.New(seed)
-	return r.Intn(90000) + 10000 // Generate code between 10000 and 99999
+// VerificationCodeLength is the number of digits in a verification code.
+const VerificationCodeLength = 6
+
+// GenerateVerificationCode generates a random 6-digit verification code from
+// a cryptographically secure source. Leading zeros are kept, so every code
+// has exactly VerificationCodeLength digits.
+func GenerateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate verification code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", VerificationCodeLength, n.Int64()), nil
+}
+
+// HashVerificationCode hashes a verification code for storage, so codes
+// cannot be read back from the database.
+func HashVerificationCode(code string) (string, error) {
+	hashedCode, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash verification code: %w", err)
+	}
+	return string(hashedCode), nil
+}
+
+// CheckVerificationCode compares a verification code with its hashed version.
+func CheckVerificationCode(code, hashedCode string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hashedCode), []byte(code)) == nil
 }
 
 // HashPassword hashes the password using bcrypt.
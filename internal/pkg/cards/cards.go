@@ -0,0 +1,112 @@
+package cards
+
+import (
+	"strings"
+)
+
+// Brand is a card network.
+type Brand string
+
+const (
+	Visa       Brand = "visa"
+	Mastercard Brand = "mastercard"
+	Amex       Brand = "amex"
+	Discover   Brand = "discover"
+	Diners     Brand = "diners"
+	JCB        Brand = "jcb"
+	UnionPay   Brand = "unionpay"
+	Unknown    Brand = "unknown"
+)
+
+// brandRule describes a card network's BIN ranges and number format.
+type brandRule struct {
+	brand     Brand
+	prefixes  []prefixRange
+	lengths   []int
+	cvvLength int
+}
+
+// prefixRange matches card numbers whose first len(low) digits lie in [low, high].
+type prefixRange struct {
+	low, high string
+}
+
+func prefix(p string) prefixRange          { return prefixRange{p, p} }
+func between(low, high string) prefixRange { return prefixRange{low, high} }
+
+// brandRules are checked in order, so narrower ranges come before broader ones.
+var brandRules = []brandRule{
+	{Amex, []prefixRange{prefix("34"), prefix("37")}, []int{15}, 4},
+	{Diners, []prefixRange{between("300", "305"), prefix("36"), prefix("38"), prefix("39")}, []int{14, 15, 16, 17, 18, 19}, 3},
+	{JCB, []prefixRange{between("3528", "3589")}, []int{16, 17, 18, 19}, 3},
+	{Discover, []prefixRange{prefix("6011"), between("644", "649"), prefix("65")}, []int{16, 17, 18, 19}, 3},
+	{UnionPay, []prefixRange{prefix("62")}, []int{16, 17, 18, 19}, 3},
+	{Mastercard, []prefixRange{between("51", "55"), between("2221", "2720")}, []int{16}, 3},
+	{Visa, []prefixRange{prefix("4")}, []int{13, 16, 19}, 3},
+}
+
+// Normalize strips the spaces and dashes customers commonly type in card numbers.
+func Normalize(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// DetectBrand identifies the card network from the BIN (leading digits) of a card number.
+func DetectBrand(number string) Brand {
+	if rule := ruleFor(Normalize(number)); rule != nil {
+		return rule.brand
+	}
+	return Unknown
+}
+
+// Last4 returns the last four digits of a card number.
+func Last4(number string) string {
+	number = Normalize(number)
+	if len(number) < 4 {
+		return number
+	}
+	return number[len(number)-4:]
+}
+
+// Luhn reports whether number passes the Luhn (mod 10) checksum.
+func Luhn(number string) bool {
+	if len(number) == 0 || !isDigits(number) {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func ruleFor(number string) *brandRule {
+	for i := range brandRules {
+		for _, r := range brandRules[i].prefixes {
+			if len(number) < len(r.low) {
+				continue
+			}
+			if head := number[:len(r.low)]; head >= r.low && head <= r.high {
+				return &brandRules[i]
+			}
+		}
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
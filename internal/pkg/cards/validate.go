@@ -0,0 +1,99 @@
+package cards
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// FieldError describes why a single card field is invalid.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Card field names used in FieldError.
+const (
+	FieldNumber = "card_number"
+	FieldExpiry = "expiry_date"
+	FieldCVV    = "cvv"
+)
+
+// ParseExpiry parses an MM/YY expiry date into its month and four-digit year.
+func ParseExpiry(expiry string) (time.Month, int, error) {
+	if len(expiry) != 5 || expiry[2] != '/' || !isDigits(expiry[:2]) || !isDigits(expiry[3:]) {
+		return 0, 0, fmt.Errorf("expiry date must be in MM/YY format")
+	}
+	month, _ := strconv.Atoi(expiry[:2])
+	year, _ := strconv.Atoi(expiry[3:])
+	if month < 1 || month > 12 {
+		return 0, 0, fmt.Errorf("expiry month must be between 01 and 12")
+	}
+	return time.Month(month), 2000 + year, nil
+}
+
+// Validate checks a card number, MM/YY expiry and CVV against the rules of
+// the card's brand and returns the detected brand and one error per invalid
+// field. Cards remain valid until the end of their expiry month.
+func Validate(number, expiry, cvv string, now time.Time) (Brand, []FieldError) {
+	var errs []FieldError
+	number = Normalize(number)
+
+	rule := ruleFor(number)
+	brand := Unknown
+	switch {
+	case number == "":
+		errs = append(errs, FieldError{FieldNumber, "card number is required"})
+	case !isDigits(number):
+		errs = append(errs, FieldError{FieldNumber, "card number must contain only digits"})
+	case rule == nil:
+		errs = append(errs, FieldError{FieldNumber, "card brand is not supported"})
+	default:
+		brand = rule.brand
+		if !containsInt(rule.lengths, len(number)) {
+			errs = append(errs, FieldError{FieldNumber, fmt.Sprintf("%s card numbers must be %s digits long", brand, joinInts(rule.lengths))})
+		} else if !Luhn(number) {
+			errs = append(errs, FieldError{FieldNumber, "card number is invalid"})
+		}
+	}
+
+	if month, year, err := ParseExpiry(expiry); err != nil {
+		errs = append(errs, FieldError{FieldExpiry, err.Error()})
+	} else if endOfMonth := time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC); !now.UTC().Before(endOfMonth) {
+		errs = append(errs, FieldError{FieldExpiry, "card has expired"})
+	}
+
+	cvvLength := 3
+	if rule != nil {
+		cvvLength = rule.cvvLength
+	}
+	if len(cvv) != cvvLength || !isDigits(cvv) {
+		errs = append(errs, FieldError{FieldCVV, fmt.Sprintf("cvv must be %d digits", cvvLength)})
+	}
+
+	return brand, errs
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(values []int) string {
+	s := ""
+	for i, v := range values {
+		switch {
+		case i == 0:
+		case i == len(values)-1:
+			s += " or "
+		default:
+			s += ", "
+		}
+		s += strconv.Itoa(v)
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package cards
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4242424242424242", true},
+		{"4242424242424241", false},
+		{"378282246310005", true},
+		{"5555555555554444", true},
+		{"5555555555554440", false},
+		{"0", true},
+		{"1", false},
+	}
+
+	for _, tt := range tests {
+		if got := Luhn(tt.number); got != tt.want {
+			t.Errorf("Luhn(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		number     string
+		expiry     string
+		cvv        string
+		wantBrand  Brand
+		wantFields []string
+	}{
+		{"valid visa", "4242424242424242", "12/27", "123", Visa, nil},
+		{"spaces and dashes", "4242 4242-4242 4242", "12/27", "123", Visa, nil},
+		{"valid amex with four digit cvv", "378282246310005", "12/27", "1234", Amex, nil},
+		{"valid mastercard 2-series", "2223003122003222", "12/27", "123", Mastercard, nil},
+		{"expires at end of current month", "4242424242424242", "06/25", "123", Visa, nil},
+		{"expired last month", "4242424242424242", "05/25", "123", Visa, []string{FieldExpiry}},
+		{"failed luhn", "4242424242424241", "12/27", "123", Visa, []string{FieldNumber}},
+		{"wrong length for brand", "424242424242", "12/27", "123", Visa, []string{FieldNumber}},
+		{"unsupported brand", "9999999999999995", "12/27", "123", Unknown, []string{FieldNumber}},
+		{"letters in number", "4242abcd42424242", "12/27", "123", Unknown, []string{FieldNumber}},
+		{"missing number", "", "12/27", "123", Unknown, []string{FieldNumber}},
+		{"bad expiry format", "4242424242424242", "1227", "123", Visa, []string{FieldExpiry}},
+		{"bad expiry month", "4242424242424242", "13/27", "123", Visa, []string{FieldExpiry}},
+		{"amex with three digit cvv", "378282246310005", "12/27", "123", Amex, []string{FieldCVV}},
+		{"visa with four digit cvv", "4242424242424242", "12/27", "1234", Visa, []string{FieldCVV}},
+		{"every field invalid", "4242424242424241", "01/20", "12a", Visa, []string{FieldNumber, FieldExpiry, FieldCVV}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brand, errs := Validate(tt.number, tt.expiry, tt.cvv, now)
+			if brand != tt.wantBrand {
+				t.Errorf("brand = %s, want %s", brand, tt.wantBrand)
+			}
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("errors = %+v, want errors for %v", errs, tt.wantFields)
+			}
+			for i, field := range tt.wantFields {
+				if errs[i].Field != field {
+					t.Errorf("errors[%d].Field = %s, want %s", i, errs[i].Field, field)
+				}
+			}
+		})
+	}
+}
@@ -4,9 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"mamlaka/config"
+	"mamlaka/internal/app/ledger"
 	"mamlaka/internal/app/payment"
+	"mamlaka/internal/app/risk"
+	"mamlaka/internal/app/transfer"
 	"mamlaka/internal/app/user"
+	"mamlaka/internal/app/vault"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/app/webhook"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/jobs"
+	"mamlaka/internal/pkg/outbox"
+	"mamlaka/internal/pkg/tokens"
 	"strconv"
 	"time"
 
@@ -47,10 +58,7 @@ func New(conf config.Config) Service {
 		return dbInstance
 	}
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
-		conf.Postgres.Host, conf.Postgres.User, conf.Postgres.Password, conf.Postgres.DBName, conf.Postgres.Port, "disable", "Africa/Nairobi")
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(DSN(conf)), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
@@ -60,17 +68,64 @@ func New(conf config.Config) Service {
 	}
 	//Automatically Migrate
 	err = db.AutoMigrate(
-		user.User{},              // User model
-		payment.Payment{},        // Payment model
-		payment.PaymentDetails{}, // PaymentDetails model
+		user.User{},                       // User model
+		user.OneTimeCode{},                // Hashed codes emailed to users, e.g. to verify their email
+		user.AccessChange{},               // Audit log of role and permission changes
+		tokens.RefreshToken{},             // Hashed refresh tokens, grouped into login sessions
+		payment.Payment{},                 // Payment model
+		payment.PaymentDetails{},          // PaymentDetails model
+		payment.PaymentStatusTransition{}, // Payment status history
+		payment.Refund{},                  // Refunds against payments
+		payment.IdempotencyKey{},          // Stored responses for Idempotency-Key retries
+		vault.VaultedCard{},               // Encrypted card numbers
+		ledger.Account{},                  // Ledger accounts
+		ledger.JournalEntry{},             // Immutable journal entries
+		ledger.Posting{},                  // Debits and credits of journal entries
+		wallet.Wallet{},                   // Wallet balances per user and currency
+		wallet.Entry{},                    // Wallet statements
+		transfer.Transfer{},               // Peer-to-peer transfers
+		webhook.Endpoint{},                // Webhook endpoints registered by users
+		webhook.Event{},                   // Events delivered to webhook endpoints
+		webhook.Delivery{},                // Deliveries of events to endpoints, with retry state
+		webhook.DeliveryAttempt{},         // Log of every delivery attempt
+		jobs.Job{},                        // Background job queue
+		vault.StashedCVV{},                // CVVs awaiting authorization
+		outbox.Message{},                  // Domain events awaiting relay
+		risk.RuleSet{},                    // Versions of the risk rules
+		risk.Decision{},                   // Risk screening decisions, for audit and velocity rules
+		gateway.SandboxTransaction{},      // Transactions of the sandbox gateway
 	)
 	if err != nil {
 		log.Fatalf("failed to auto migrate: %v", err)
 	}
+	if err := user.Migrate(db); err != nil {
+		log.Fatalf("failed to migrate user roles: %v", err)
+	}
+	if err := user.BootstrapAdmin(db, slog.Default(), conf.Auth.BootstrapAdminEmail); err != nil {
+		log.Fatalf("failed to bootstrap admin: %v", err)
+	}
+	if err := ledger.Migrate(db); err != nil {
+		log.Fatalf("failed to migrate ledger: %v", err)
+	}
+
+	// Move any plaintext card data left by earlier versions into the vault
+	cardVault, err := vault.NewVaultService(slog.Default(), vault.NewVaultRepository(db, slog.Default()), conf.Vault)
+	if err != nil {
+		log.Fatalf("failed to initialise card vault: %v", err)
+	}
+	if err := payment.MigrateLegacyCardData(db, cardVault); err != nil {
+		log.Fatalf("failed to migrate legacy card data: %v", err)
+	}
 
 	return dbInstance
 }
 
+// DSN returns the connection string of the configured database.
+func DSN(conf config.Config) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+		conf.Postgres.Host, conf.Postgres.User, conf.Postgres.Password, conf.Postgres.DBName, conf.Postgres.Port, "disable", "Africa/Nairobi")
+}
+
 // Health checks the health of the database connection by pinging the database.
 // It returns a map with keys indicating various health statistics.
 func (s *service) Health() map[string]string {
@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"mamlaka/internal/pkg/money"
+)
+
+var (
+	// ErrTimeout means the provider did not answer in time; the outcome of the
+	// operation is unknown and must be resolved later with Status.
+	ErrTimeout = errors.New("gateway timed out")
+	// ErrUnsupported means the provider does not offer the requested operation.
+	ErrUnsupported = errors.New("operation not supported by gateway")
+	// ErrTransactionNotFound means the provider has no record of the transaction.
+	ErrTransactionNotFound = errors.New("transaction not found at gateway")
+)
+
+// Outcome is the provider's answer to an operation.
+type Outcome string
+
+const (
+	Approved Outcome = "approved"
+	Declined Outcome = "declined"
+	Pending  Outcome = "pending" // Accepted but not final, e.g. awaiting customer action
+)
+
+// Card holds the card data needed to authorize a card payment. It must never be persisted.
+type Card struct {
+	Number     string
+	ExpiryDate string // MM/YY
+	CVV        string
+}
+
+// AuthorizeRequest describes a payment to be authorized by a provider.
+type AuthorizeRequest struct {
+	Reference   string // Our own reference for the payment, echoed back by most providers
+	Amount      money.Money
+	Card        *Card
+	PhoneNumber string
+	Email       string
+}
+
+// Result is the provider's response to an operation.
+type Result struct {
+	TransactionID string  // Provider reference for the transaction
+	Outcome       Outcome // Approved, Declined or Pending
+	Code          string  // Provider decline or status code, if any
+	Message       string
+}
+
+// Gateway is implemented by every payment provider adapter.
+type Gateway interface {
+	// Name identifies the provider, e.g. "sandbox" or "mpesa".
+	Name() string
+	// Authorize places a hold for the requested amount.
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	// Capture collects up to the authorized amount of a transaction.
+	Capture(ctx context.Context, transactionID string, amount money.Money) (*Result, error)
+	// Void releases an authorization that has not been captured.
+	Void(ctx context.Context, transactionID string) (*Result, error)
+	// Refund returns captured funds of a transaction to the customer. The
+	// reference identifies the refund, so a refund retried with the same
+	// reference is made only once and can be found with Lookup.
+	Refund(ctx context.Context, transactionID, reference string, amount money.Money) (*Result, error)
+	// Status fetches the current state of a transaction from the provider.
+	Status(ctx context.Context, transactionID string) (*Result, error)
+	// Lookup fetches the transaction created by an authorization or refund
+	// with our reference, for operations whose response never arrived. It
+	// returns ErrTransactionNotFound if the operation never reached the
+	// provider.
+	Lookup(ctx context.Context, reference string) (*Result, error)
+}
@@ -0,0 +1,67 @@
+package mpesa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Callback is the body Daraja posts to the CallBackURL of an STK Push.
+type Callback struct {
+	Body struct {
+		STKCallback STKCallback `json:"stkCallback"`
+	} `json:"Body"`
+}
+
+// STKCallback carries the final result of an STK Push.
+type STKCallback struct {
+	MerchantRequestID string `json:"MerchantRequestID"`
+	CheckoutRequestID string `json:"CheckoutRequestID"`
+	ResultCode        int    `json:"ResultCode"`
+	ResultDesc        string `json:"ResultDesc"`
+	CallbackMetadata  *struct {
+		Item []CallbackItem `json:"Item"`
+	} `json:"CallbackMetadata,omitempty"`
+}
+
+// CallbackItem is a single name/value pair of callback metadata.
+type CallbackItem struct {
+	Name  string      `json:"Name"`
+	Value interface{} `json:"Value,omitempty"`
+}
+
+// CallbackAcknowledgement is the response Daraja expects from a callback endpoint.
+type CallbackAcknowledgement struct {
+	ResultCode int    `json:"ResultCode"`
+	ResultDesc string `json:"ResultDesc"`
+}
+
+// ParseCallback decodes an STK Push callback body.
+func ParseCallback(body []byte) (*STKCallback, error) {
+	var callback Callback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, fmt.Errorf("invalid M-Pesa callback: %w", err)
+	}
+	if callback.Body.STKCallback.CheckoutRequestID == "" {
+		return nil, errors.New("invalid M-Pesa callback: missing CheckoutRequestID")
+	}
+	return &callback.Body.STKCallback, nil
+}
+
+// ResultCodeString returns the result code in the string form used by the query API.
+func (c *STKCallback) ResultCodeString() string {
+	return fmt.Sprint(c.ResultCode)
+}
+
+// ReceiptNumber returns the M-Pesa receipt number of a successful payment.
+func (c *STKCallback) ReceiptNumber() string {
+	if c.CallbackMetadata == nil {
+		return ""
+	}
+	for _, item := range c.CallbackMetadata.Item {
+		if item.Name == "MpesaReceiptNumber" {
+			return fmt.Sprint(item.Value)
+		}
+	}
+	return ""
+}
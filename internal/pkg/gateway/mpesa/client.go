@@ -0,0 +1,240 @@
+package mpesa
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Daraja result codes reported for an STK Push.
+const (
+	ResultSuccess           = "0"
+	ResultInsufficientFunds = "1"
+	ResultCancelledByUser   = "1032"
+	ResultUnreachable       = "1037" // The customer's phone could not be reached or did not answer in time
+	ResultWrongPIN          = "2001"
+
+	// errorCodeProcessing is returned by the STK query API while the customer
+	// has not yet completed the prompt.
+	errorCodeProcessing = "500.001.1001"
+)
+
+var eat = time.FixedZone("EAT", 3*60*60)
+
+// Config holds the Daraja credentials and Lipa Na M-Pesa Online settings.
+type Config struct {
+	BaseURL        string // e.g. https://sandbox.safaricom.co.ke
+	ConsumerKey    string
+	ConsumerSecret string
+	ShortCode      string
+	PassKey        string
+	CallbackURL    string
+}
+
+// Client is a minimal Daraja API client covering STK Push and STK query.
+type Client struct {
+	config     Config
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewClient creates a Daraja client. A nil httpClient uses a client with a 30s timeout.
+func NewClient(config Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{config: config, httpClient: httpClient}
+}
+
+// APIError is an error body returned by Daraja.
+type APIError struct {
+	StatusCode   int    `json:"-"`
+	RequestID    string `json:"requestId"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("daraja error %s (HTTP %d): %s", e.ErrorCode, e.StatusCode, e.ErrorMessage)
+}
+
+// STKPushRequest is the body of a Lipa Na M-Pesa Online payment request.
+type STKPushRequest struct {
+	BusinessShortCode string `json:"BusinessShortCode"`
+	Password          string `json:"Password"`
+	Timestamp         string `json:"Timestamp"`
+	TransactionType   string `json:"TransactionType"`
+	Amount            int64  `json:"Amount"`
+	PartyA            string `json:"PartyA"`
+	PartyB            string `json:"PartyB"`
+	PhoneNumber       string `json:"PhoneNumber"`
+	CallBackURL       string `json:"CallBackURL"`
+	AccountReference  string `json:"AccountReference"`
+	TransactionDesc   string `json:"TransactionDesc"`
+}
+
+// STKPushResponse is Daraja's acknowledgement of an STK Push.
+type STKPushResponse struct {
+	MerchantRequestID   string `json:"MerchantRequestID"`
+	CheckoutRequestID   string `json:"CheckoutRequestID"`
+	ResponseCode        string `json:"ResponseCode"`
+	ResponseDescription string `json:"ResponseDescription"`
+	CustomerMessage     string `json:"CustomerMessage"`
+}
+
+// STKQueryRequest asks for the result of an STK Push.
+type STKQueryRequest struct {
+	BusinessShortCode string `json:"BusinessShortCode"`
+	Password          string `json:"Password"`
+	Timestamp         string `json:"Timestamp"`
+	CheckoutRequestID string `json:"CheckoutRequestID"`
+}
+
+// STKQueryResponse is the result of an STK Push as reported by the query API.
+type STKQueryResponse struct {
+	ResponseCode        string `json:"ResponseCode"`
+	ResponseDescription string `json:"ResponseDescription"`
+	MerchantRequestID   string `json:"MerchantRequestID"`
+	CheckoutRequestID   string `json:"CheckoutRequestID"`
+	ResultCode          string `json:"ResultCode"`
+	ResultDesc          string `json:"ResultDesc"`
+}
+
+// STKPush prompts the customer's phone to approve a payment to the configured short code.
+func (c *Client) STKPush(ctx context.Context, phoneNumber string, amount int64, accountReference, description string) (*STKPushResponse, error) {
+	timestamp, password := c.password(time.Now())
+	req := STKPushRequest{
+		BusinessShortCode: c.config.ShortCode,
+		Password:          password,
+		Timestamp:         timestamp,
+		TransactionType:   "CustomerPayBillOnline",
+		Amount:            amount,
+		PartyA:            phoneNumber,
+		PartyB:            c.config.ShortCode,
+		PhoneNumber:       phoneNumber,
+		CallBackURL:       c.config.CallbackURL,
+		AccountReference:  truncate(accountReference, 12),
+		TransactionDesc:   truncate(description, 13),
+	}
+
+	var resp STKPushResponse
+	if err := c.post(ctx, "/mpesa/stkpush/v1/processrequest", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// STKQuery fetches the result of an STK Push. It returns ErrProcessing while
+// the customer has not yet responded to the prompt.
+func (c *Client) STKQuery(ctx context.Context, checkoutRequestID string) (*STKQueryResponse, error) {
+	timestamp, password := c.password(time.Now())
+	req := STKQueryRequest{
+		BusinessShortCode: c.config.ShortCode,
+		Password:          password,
+		Timestamp:         timestamp,
+		CheckoutRequestID: checkoutRequestID,
+	}
+
+	var resp STKQueryResponse
+	if err := c.post(ctx, "/mpesa/stkpushquery/v1/query", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// IsProcessing reports whether err means the STK Push is still awaiting the customer.
+func IsProcessing(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.ErrorCode == errorCodeProcessing
+}
+
+// password builds the Lipa Na M-Pesa password: base64(shortcode + passkey + timestamp).
+func (c *Client) password(now time.Time) (string, string) {
+	timestamp := now.In(eat).Format("20060102150405")
+	raw := c.config.ShortCode + c.config.PassKey + timestamp
+	return timestamp, base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+// token returns a cached OAuth access token, fetching a new one when it is about to expire.
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken != "" && time.Now().Before(c.expiresAt) {
+		return c.accessToken, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.BaseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.config.ConsumerKey, c.config.ConsumerSecret)
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := c.do(req, &body); err != nil {
+		return "", fmt.Errorf("daraja authentication failed: %w", err)
+	}
+
+	expiresIn, err := strconv.Atoi(body.ExpiresIn)
+	if err != nil {
+		expiresIn = 3599
+	}
+	c.accessToken = body.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute)
+	return c.accessToken, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, in, out interface{}) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, out)
+}
+
+func (c *Client) do(req *http.Request, out interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil {
+			apiErr.ErrorMessage = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
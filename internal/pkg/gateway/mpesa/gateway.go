@@ -0,0 +1,116 @@
+package mpesa
+
+import (
+	"context"
+	"errors"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/money"
+	"net"
+	"strings"
+)
+
+var _ gateway.Gateway = (*Gateway)(nil)
+
+// Gateway adapts Lipa Na M-Pesa Online (STK Push) to gateway.Gateway.
+//
+// An STK Push is a single-step payment: Authorize prompts the customer and
+// returns a pending result keyed by the CheckoutRequestID, and the funds are
+// collected once the customer enters their PIN. Capture therefore only
+// acknowledges a completed push. Voids and refunds go through Daraja's
+// reversal API, which is not supported by this adapter.
+type Gateway struct {
+	client *Client
+}
+
+// NewGateway creates an M-Pesa gateway backed by the given Daraja client.
+func NewGateway(client *Client) *Gateway {
+	return &Gateway{client: client}
+}
+
+func (g *Gateway) Name() string {
+	return "mpesa"
+}
+
+func (g *Gateway) Authorize(ctx context.Context, req gateway.AuthorizeRequest) (*gateway.Result, error) {
+	if req.Amount.Currency != "KES" || req.Amount.Amount%100 != 0 {
+		return &gateway.Result{Outcome: gateway.Declined, Code: "invalid_amount", Message: "M-Pesa payments must be whole Kenyan shillings"}, nil
+	}
+	phoneNumber, ok := NormalizePhoneNumber(req.PhoneNumber)
+	if !ok {
+		return &gateway.Result{Outcome: gateway.Declined, Code: "invalid_phone_number", Message: "A valid Safaricom phone number is required"}, nil
+	}
+
+	resp, err := g.client.STKPush(ctx, phoneNumber, req.Amount.Amount/100, req.Reference, "Payment "+req.Reference)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if resp.ResponseCode != ResultSuccess {
+		return &gateway.Result{TransactionID: resp.CheckoutRequestID, Outcome: gateway.Declined, Code: resp.ResponseCode, Message: resp.ResponseDescription}, nil
+	}
+	return &gateway.Result{TransactionID: resp.CheckoutRequestID, Outcome: gateway.Pending, Code: resp.ResponseCode, Message: resp.CustomerMessage}, nil
+}
+
+func (g *Gateway) Capture(ctx context.Context, transactionID string, _ money.Money) (*gateway.Result, error) {
+	return g.Status(ctx, transactionID)
+}
+
+func (g *Gateway) Void(context.Context, string) (*gateway.Result, error) {
+	return nil, gateway.ErrUnsupported
+}
+
+func (g *Gateway) Refund(context.Context, string, string, money.Money) (*gateway.Result, error) {
+	return nil, gateway.ErrUnsupported
+}
+
+// Lookup is not supported: STK pushes can only be queried by the checkout
+// request ID Daraja returns.
+func (g *Gateway) Lookup(context.Context, string) (*gateway.Result, error) {
+	return nil, gateway.ErrUnsupported
+}
+
+func (g *Gateway) Status(ctx context.Context, transactionID string) (*gateway.Result, error) {
+	resp, err := g.client.STKQuery(ctx, transactionID)
+	if IsProcessing(err) {
+		return &gateway.Result{TransactionID: transactionID, Outcome: gateway.Pending, Message: "Awaiting customer confirmation"}, nil
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return ResultFromCode(transactionID, resp.ResultCode, resp.ResultDesc), nil
+}
+
+// ResultFromCode maps an STK Push result code to a gateway result.
+func ResultFromCode(checkoutRequestID, resultCode, resultDesc string) *gateway.Result {
+	outcome := gateway.Declined
+	if resultCode == ResultSuccess {
+		outcome = gateway.Approved
+	}
+	return &gateway.Result{TransactionID: checkoutRequestID, Outcome: outcome, Code: resultCode, Message: resultDesc}
+}
+
+// NormalizePhoneNumber converts 07XXXXXXXX, 01XXXXXXXX, +2547XXXXXXXX and
+// 2547XXXXXXXX formats to the 2547XXXXXXXX form Daraja expects.
+func NormalizePhoneNumber(phoneNumber string) (string, bool) {
+	phoneNumber = strings.NewReplacer(" ", "", "-", "").Replace(phoneNumber)
+	phoneNumber = strings.TrimPrefix(phoneNumber, "+")
+	if strings.HasPrefix(phoneNumber, "0") {
+		phoneNumber = "254" + phoneNumber[1:]
+	}
+	if len(phoneNumber) != 12 || !strings.HasPrefix(phoneNumber, "254") {
+		return "", false
+	}
+	for _, r := range phoneNumber {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return phoneNumber, phoneNumber[3] == '7' || phoneNumber[3] == '1'
+}
+
+func translateError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return gateway.ErrTimeout
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package mpesa
+
+import (
+	"context"
+	"io"
+	"mamlaka/internal/pkg/gateway"
+	"mamlaka/internal/pkg/money"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"0712345678", "254712345678", true},
+		{"0112345678", "254112345678", true},
+		{"+254712345678", "254712345678", true},
+		{"254 712-345-678", "254712345678", true},
+		{"0812345678", "254812345678", false}, // Not a Safaricom prefix
+		{"071234567", "", false},
+		{"07123456789", "", false},
+		{"07123a5678", "", false},
+		{"255712345678", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NormalizePhoneNumber(tt.in)
+		if ok != tt.wantOK || (tt.wantOK && got != tt.want) {
+			t.Errorf("NormalizePhoneNumber(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseCallback(t *testing.T) {
+	body := `{"Body":{"stkCallback":{"MerchantRequestID":"m-1","CheckoutRequestID":"ws_CO_1","ResultCode":0,"ResultDesc":"ok",
+		"CallbackMetadata":{"Item":[{"Name":"Amount","Value":100},{"Name":"MpesaReceiptNumber","Value":"NLJ7RT61SV"}]}}}}`
+
+	callback, err := ParseCallback([]byte(body))
+	if err != nil {
+		t.Fatalf("ParseCallback() error = %v", err)
+	}
+	if callback.CheckoutRequestID != "ws_CO_1" || callback.ResultCodeString() != ResultSuccess {
+		t.Errorf("ParseCallback() = %+v", callback)
+	}
+	if got := callback.ReceiptNumber(); got != "NLJ7RT61SV" {
+		t.Errorf("ReceiptNumber() = %q, want %q", got, "NLJ7RT61SV")
+	}
+
+	for _, invalid := range []string{`not json`, `{"Body":{"stkCallback":{"ResultCode":0}}}`} {
+		if _, err := ParseCallback([]byte(invalid)); err == nil {
+			t.Errorf("ParseCallback(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+// newStubGateway returns a gateway talking to a stub Daraja server in mode,
+// and a channel receiving the bodies of the callbacks it sends.
+func newStubGateway(t *testing.T, mode StubMode) (*Gateway, <-chan []byte) {
+	t.Helper()
+	callbacks := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		callbacks <- body
+	}))
+	t.Cleanup(receiver.Close)
+
+	daraja := httptest.NewServer(NewStubServer(mode, 20*time.Millisecond))
+	t.Cleanup(daraja.Close)
+
+	client := NewClient(Config{
+		BaseURL:        daraja.URL,
+		ConsumerKey:    "key",
+		ConsumerSecret: "secret",
+		ShortCode:      "174379",
+		PassKey:        "passkey",
+		CallbackURL:    receiver.URL,
+	}, nil)
+	return NewGateway(client), callbacks
+}
+
+func authorize(t *testing.T, gw *Gateway) *gateway.Result {
+	t.Helper()
+	result, err := gw.Authorize(context.Background(), gateway.AuthorizeRequest{
+		Reference:   "PAY-1",
+		Amount:      money.Money{Amount: 10000, Currency: "KES"},
+		PhoneNumber: "0712345678",
+	})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if result.Outcome != gateway.Pending || result.TransactionID == "" {
+		t.Fatalf("Authorize() = %+v, want pending with a checkout request ID", result)
+	}
+	return result
+}
+
+func awaitCallback(t *testing.T, callbacks <-chan []byte) *STKCallback {
+	t.Helper()
+	select {
+	case body := <-callbacks:
+		callback, err := ParseCallback(body)
+		if err != nil {
+			t.Fatalf("ParseCallback() error = %v", err)
+		}
+		return callback
+	case <-time.After(2 * time.Second):
+		t.Fatal("no callback received")
+		return nil
+	}
+}
+
+func TestGatewaySucceeded(t *testing.T) {
+	gw, callbacks := newStubGateway(t, StubSucceed)
+	auth := authorize(t, gw)
+
+	if result, err := gw.Status(context.Background(), auth.TransactionID); err != nil || result.Outcome != gateway.Pending {
+		t.Errorf("Status() before the customer answers = %+v, %v, want pending", result, err)
+	}
+
+	callback := awaitCallback(t, callbacks)
+	if callback.CheckoutRequestID != auth.TransactionID || callback.ReceiptNumber() == "" {
+		t.Errorf("callback = %+v, want a receipt for %s", callback, auth.TransactionID)
+	}
+	result, err := gw.Capture(context.Background(), auth.TransactionID, money.Money{Amount: 10000, Currency: "KES"})
+	if err != nil || result.Outcome != gateway.Approved {
+		t.Errorf("Capture() = %+v, %v, want approved", result, err)
+	}
+}
+
+func TestGatewayCancelled(t *testing.T) {
+	gw, callbacks := newStubGateway(t, StubCancel)
+	auth := authorize(t, gw)
+
+	callback := awaitCallback(t, callbacks)
+	if callback.ResultCodeString() != ResultCancelledByUser {
+		t.Errorf("callback result code = %s, want %s", callback.ResultCodeString(), ResultCancelledByUser)
+	}
+	result, err := gw.Status(context.Background(), auth.TransactionID)
+	if err != nil || result.Outcome != gateway.Declined || result.Code != ResultCancelledByUser {
+		t.Errorf("Status() = %+v, %v, want declined with %s", result, err, ResultCancelledByUser)
+	}
+}
+
+func TestGatewayDeclinesInvalidRequests(t *testing.T) {
+	gw, _ := newStubGateway(t, StubSucceed)
+
+	tests := []struct {
+		name     string
+		amount   money.Money
+		phone    string
+		wantCode string
+	}{
+		{"cents", money.Money{Amount: 10050, Currency: "KES"}, "0712345678", "invalid_amount"},
+		{"other currency", money.Money{Amount: 10000, Currency: "USD"}, "0712345678", "invalid_amount"},
+		{"invalid phone number", money.Money{Amount: 10000, Currency: "KES"}, "12345", "invalid_phone_number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := gw.Authorize(context.Background(), gateway.AuthorizeRequest{Reference: "PAY-1", Amount: tt.amount, PhoneNumber: tt.phone})
+			if err != nil || result.Outcome != gateway.Declined || result.Code != tt.wantCode {
+				t.Errorf("Authorize() = %+v, %v, want declined with %s", result, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestGatewayUnsupportedOperations(t *testing.T) {
+	gw, _ := newStubGateway(t, StubSucceed)
+	ctx := context.Background()
+
+	if _, err := gw.Void(ctx, "ws_CO_1"); err != gateway.ErrUnsupported {
+		t.Errorf("Void() error = %v, want ErrUnsupported", err)
+	}
+	if _, err := gw.Refund(ctx, "ws_CO_1", "REF-1", money.Money{Amount: 100, Currency: "KES"}); err != gateway.ErrUnsupported {
+		t.Errorf("Refund() error = %v, want ErrUnsupported", err)
+	}
+	if _, err := gw.Lookup(ctx, "PAY-1"); err != gateway.ErrUnsupported {
+		t.Errorf("Lookup() error = %v, want ErrUnsupported", err)
+	}
+}
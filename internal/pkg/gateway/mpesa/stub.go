@@ -0,0 +1,173 @@
+package mpesa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StubMode selects how the stub Daraja server resolves STK Pushes.
+type StubMode string
+
+const (
+	StubSucceed StubMode = "succeed" // The customer enters their PIN
+	StubCancel  StubMode = "cancel"  // The customer dismisses the prompt
+	StubTimeout StubMode = "timeout" // The customer never answers; no callback is sent
+)
+
+type stubPush struct {
+	request  STKPushRequest
+	receipt  string
+	resolved bool
+	code     string
+	desc     string
+}
+
+// StubServer is a local stand-in for the Daraja API. It accepts any
+// credentials, acknowledges STK Pushes, and after CallbackDelay resolves them
+// according to Mode, posting the callback to the request's CallBackURL. The
+// query API reports the same outcome. In StubTimeout mode no callback is
+// sent and queries report result code 1037 once the delay has passed.
+type StubServer struct {
+	Mode          StubMode
+	CallbackDelay time.Duration
+	HTTPClient    *http.Client
+
+	mu     sync.Mutex
+	seq    int
+	pushes map[string]*stubPush
+}
+
+// NewStubServer creates a stub Daraja server.
+func NewStubServer(mode StubMode, callbackDelay time.Duration) *StubServer {
+	return &StubServer{
+		Mode:          mode,
+		CallbackDelay: callbackDelay,
+		HTTPClient:    &http.Client{Timeout: 10 * time.Second},
+		pushes:        make(map[string]*stubPush),
+	}
+}
+
+func (s *StubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/oauth/v1/generate":
+		writeJSON(w, http.StatusOK, map[string]string{"access_token": "stub-access-token", "expires_in": "3599"})
+	case "/mpesa/stkpush/v1/processrequest":
+		s.handlePush(w, r)
+	case "/mpesa/stkpushquery/v1/query":
+		s.handleQuery(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, APIError{ErrorCode: "404.001.01", ErrorMessage: "Resource not found"})
+	}
+}
+
+func (s *StubServer) handlePush(w http.ResponseWriter, r *http.Request) {
+	var req STKPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 || req.PhoneNumber == "" {
+		writeJSON(w, http.StatusBadRequest, APIError{ErrorCode: "400.002.02", ErrorMessage: "Bad Request - Invalid request"})
+		return
+	}
+
+	s.mu.Lock()
+	s.seq++
+	checkoutRequestID := fmt.Sprintf("ws_CO_%s_%06d", time.Now().Format("02012006150405"), s.seq)
+	merchantRequestID := fmt.Sprintf("stub-%06d", s.seq)
+	s.pushes[checkoutRequestID] = &stubPush{request: req, receipt: fmt.Sprintf("STB%07d", s.seq)}
+	s.mu.Unlock()
+
+	time.AfterFunc(s.CallbackDelay, func() { s.resolve(checkoutRequestID, merchantRequestID) })
+
+	writeJSON(w, http.StatusOK, STKPushResponse{
+		MerchantRequestID:   merchantRequestID,
+		CheckoutRequestID:   checkoutRequestID,
+		ResponseCode:        ResultSuccess,
+		ResponseDescription: "Success. Request accepted for processing",
+		CustomerMessage:     "Success. Request accepted for processing",
+	})
+}
+
+func (s *StubServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var req STKQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIError{ErrorCode: "400.002.02", ErrorMessage: "Bad Request - Invalid request"})
+		return
+	}
+
+	s.mu.Lock()
+	push, ok := s.pushes[req.CheckoutRequestID]
+	var resolved bool
+	var code, desc string
+	if ok {
+		resolved, code, desc = push.resolved, push.code, push.desc
+	}
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		writeJSON(w, http.StatusInternalServerError, APIError{ErrorCode: "500.001.1001", ErrorMessage: "The transaction does not exist"})
+	case !resolved:
+		writeJSON(w, http.StatusInternalServerError, APIError{ErrorCode: errorCodeProcessing, ErrorMessage: "The transaction is being processed"})
+	default:
+		writeJSON(w, http.StatusOK, STKQueryResponse{
+			ResponseCode:        ResultSuccess,
+			ResponseDescription: "The service request has been accepted successsfully",
+			CheckoutRequestID:   req.CheckoutRequestID,
+			ResultCode:          code,
+			ResultDesc:          desc,
+		})
+	}
+}
+
+// resolve settles a push according to Mode and sends the callback.
+func (s *StubServer) resolve(checkoutRequestID, merchantRequestID string) {
+	s.mu.Lock()
+	push := s.pushes[checkoutRequestID]
+	push.resolved = true
+	switch s.Mode {
+	case StubCancel:
+		push.code, push.desc = ResultCancelledByUser, "Request cancelled by user"
+	case StubTimeout:
+		push.code, push.desc = ResultUnreachable, "DS timeout user cannot be reached"
+	default:
+		push.code, push.desc = ResultSuccess, "The service request is processed successfully."
+	}
+	request, receipt, code, desc := push.request, push.receipt, push.code, push.desc
+	s.mu.Unlock()
+
+	if s.Mode == StubTimeout {
+		return
+	}
+
+	var callback Callback
+	callback.Body.STKCallback = STKCallback{
+		MerchantRequestID: merchantRequestID,
+		CheckoutRequestID: checkoutRequestID,
+		ResultDesc:        desc,
+	}
+	fmt.Sscan(code, &callback.Body.STKCallback.ResultCode)
+	if code == ResultSuccess {
+		callback.Body.STKCallback.CallbackMetadata = &struct {
+			Item []CallbackItem `json:"Item"`
+		}{Item: []CallbackItem{
+			{Name: "Amount", Value: request.Amount},
+			{Name: "MpesaReceiptNumber", Value: receipt},
+			{Name: "TransactionDate", Value: time.Now().In(eat).Format("20060102150405")},
+			{Name: "PhoneNumber", Value: request.PhoneNumber},
+		}}
+	}
+
+	body, _ := json.Marshal(callback)
+	resp, err := s.HTTPClient.Post(request.CallBackURL, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mamlaka/internal/pkg/money"
+)
+
+// Sandbox card numbers with a fixed outcome. Any other number is approved.
+const (
+	SandboxCardDeclined          = "4000000000000002"
+	SandboxCardInsufficientFunds = "4000000000009995"
+	SandboxCardExpired           = "4000000000000069"
+	SandboxCardPending           = "4000000000003220"
+	SandboxCardTimeout           = "4000000000000119"
+)
+
+// Sandbox amounts with a fixed outcome, matched on the last two digits of the
+// amount in minor units (e.g. 10.01 KES declines, 10.04 KES times out).
+// Refunds of an amount ending in SandboxAmountTimeout time out too, without
+// reaching the sandbox.
+const (
+	SandboxAmountDeclined          = 1
+	SandboxAmountInsufficientFunds = 2
+	SandboxAmountPending           = 3
+	SandboxAmountTimeout           = 4
+)
+
+var _ Gateway = (*Sandbox)(nil)
+
+// Sandbox is a deterministic gateway for development and testing. Outcomes
+// depend only on the request, so the same magic card number or amount always
+// produces the same response. Pending transactions are approved on the first
+// Status call. Transactions are kept in a SandboxStore; processes that share
+// a store, e.g. API servers and workers on the same database, see each
+// other's transactions.
+type Sandbox struct {
+	name  string
+	store SandboxStore
+}
+
+// NewSandbox creates a sandbox gateway reporting the given provider name,
+// keeping its transactions in memory.
+func NewSandbox(name string) *Sandbox {
+	return NewSandboxWithStore(name, NewMemorySandboxStore())
+}
+
+// NewSandboxWithStore creates a sandbox gateway keeping its transactions in store.
+func NewSandboxWithStore(name string, store SandboxStore) *Sandbox {
+	return &Sandbox{name: name, store: store}
+}
+
+func (s *Sandbox) Name() string {
+	return s.name
+}
+
+func (s *Sandbox) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	cardNumber := ""
+	if req.Card != nil {
+		cardNumber = req.Card.Number
+	}
+	cents := req.Amount.Amount % 100
+
+	if cardNumber == SandboxCardTimeout || cents == SandboxAmountTimeout {
+		<-ctx.Done()
+		return nil, ErrTimeout
+	}
+
+	result := &Result{TransactionID: s.transactionID(req.Reference), Outcome: Approved, Code: "00", Message: "Approved"}
+	switch {
+	case cardNumber == SandboxCardDeclined || cents == SandboxAmountDeclined:
+		result.Outcome, result.Code, result.Message = Declined, "card_declined", "Do not honour"
+	case cardNumber == SandboxCardInsufficientFunds || cents == SandboxAmountInsufficientFunds:
+		result.Outcome, result.Code, result.Message = Declined, "insufficient_funds", "Insufficient funds"
+	case cardNumber == SandboxCardExpired:
+		result.Outcome, result.Code, result.Message = Declined, "expired_card", "Expired card"
+	case cardNumber == SandboxCardPending || cents == SandboxAmountPending:
+		result.Outcome, result.Code, result.Message = Pending, "pending", "Awaiting confirmation"
+	}
+
+	if err := s.store.Create(&SandboxTransaction{ID: result.TransactionID, Authorized: req.Amount, Outcome: result.Outcome}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Sandbox) Capture(_ context.Context, transactionID string, amount money.Money) (*Result, error) {
+	var result *Result
+	err := s.store.Update(transactionID, func(txn *SandboxTransaction) {
+		switch {
+		case txn.Outcome != Approved || txn.Voided || txn.Captured > 0:
+			result = &Result{TransactionID: transactionID, Outcome: Declined, Code: "invalid_state", Message: "Transaction cannot be captured"}
+		case amount.Currency != txn.Authorized.Currency || amount.Amount > txn.Authorized.Amount:
+			result = &Result{TransactionID: transactionID, Outcome: Declined, Code: "amount_exceeded", Message: "Capture exceeds authorized amount"}
+		default:
+			txn.Captured = amount.Amount
+			result = &Result{TransactionID: transactionID, Outcome: Approved, Code: "00", Message: "Captured"}
+		}
+	})
+	return result, err
+}
+
+func (s *Sandbox) Void(_ context.Context, transactionID string) (*Result, error) {
+	var result *Result
+	err := s.store.Update(transactionID, func(txn *SandboxTransaction) {
+		if txn.Captured > 0 {
+			result = &Result{TransactionID: transactionID, Outcome: Declined, Code: "invalid_state", Message: "Captured transactions cannot be voided"}
+			return
+		}
+		txn.Voided = true
+		result = &Result{TransactionID: transactionID, Outcome: Approved, Code: "00", Message: "Voided"}
+	})
+	return result, err
+}
+
+// Refund records each refund as a transaction of its own, with an ID derived
+// from its reference, so a retried refund returns the first one's result
+// and Lookup finds refunds whose response was lost.
+func (s *Sandbox) Refund(ctx context.Context, transactionID, reference string, amount money.Money) (*Result, error) {
+	if amount.Amount%100 == SandboxAmountTimeout {
+		<-ctx.Done()
+		return nil, ErrTimeout
+	}
+
+	refundID := s.transactionID(reference)
+	if result, err := s.Status(ctx, refundID); !errors.Is(err, ErrTransactionNotFound) {
+		return result, err
+	}
+
+	result := &Result{TransactionID: refundID, Outcome: Approved, Code: "00", Message: fmt.Sprintf("Refunded %s", amount)}
+	err := s.store.Update(transactionID, func(txn *SandboxTransaction) {
+		if amount.Currency != txn.Authorized.Currency || txn.Refunded+amount.Amount > txn.Captured {
+			result.Outcome, result.Code, result.Message = Declined, "amount_exceeded", "Refund exceeds captured amount"
+			return
+		}
+		txn.Refunded += amount.Amount
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Create(&SandboxTransaction{ID: refundID, Authorized: amount, Outcome: result.Outcome}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// transactionID derives the ID of the transaction authorized or refunded
+// with reference, so retried operations and Lookup find the same transaction.
+func (s *Sandbox) transactionID(reference string) string {
+	sum := sha256.Sum256([]byte(s.name + ":" + reference))
+	return "sbx_" + hex.EncodeToString(sum[:12])
+}
+
+func (s *Sandbox) Lookup(ctx context.Context, reference string) (*Result, error) {
+	return s.Status(ctx, s.transactionID(reference))
+}
+
+func (s *Sandbox) Status(_ context.Context, transactionID string) (*Result, error) {
+	var result *Result
+	err := s.store.Update(transactionID, func(txn *SandboxTransaction) {
+		if txn.Outcome == Pending {
+			txn.Outcome = Approved
+		}
+		result = &Result{TransactionID: transactionID, Outcome: txn.Outcome, Message: "Status retrieved"}
+	})
+	return result, err
+}
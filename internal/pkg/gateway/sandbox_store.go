@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"errors"
+	"mamlaka/internal/pkg/money"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SandboxTransaction is the sandbox's record of a transaction.
+type SandboxTransaction struct {
+	ID         string      `gorm:"primaryKey;size:40"`
+	Authorized money.Money `gorm:"embedded"`
+	Captured   int64       `gorm:"not null;default:0"`
+	Refunded   int64       `gorm:"not null;default:0"`
+	Outcome    Outcome     `gorm:"size:10;not null"`
+	Voided     bool        `gorm:"not null;default:false"`
+}
+
+func (SandboxTransaction) TableName() string {
+	return "sandbox_transactions"
+}
+
+// SandboxStore keeps the transactions of sandbox gateways.
+type SandboxStore interface {
+	// Create saves a new transaction, replacing any with the same ID.
+	Create(txn *SandboxTransaction) error
+	// Update applies change to a transaction and saves it, with no other
+	// change to the transaction in between. It returns
+	// ErrTransactionNotFound if there is no such transaction.
+	Update(id string, change func(txn *SandboxTransaction)) error
+}
+
+// MemorySandboxStore keeps sandbox transactions in memory, visible only to
+// the process that created them.
+type MemorySandboxStore struct {
+	mu           sync.Mutex
+	transactions map[string]*SandboxTransaction
+}
+
+// NewMemorySandboxStore creates an empty in-memory store.
+func NewMemorySandboxStore() *MemorySandboxStore {
+	return &MemorySandboxStore{transactions: make(map[string]*SandboxTransaction)}
+}
+
+func (m *MemorySandboxStore) Create(txn *SandboxTransaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *txn
+	m.transactions[txn.ID] = &saved
+	return nil
+}
+
+func (m *MemorySandboxStore) Update(id string, change func(txn *SandboxTransaction)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	txn, ok := m.transactions[id]
+	if !ok {
+		return ErrTransactionNotFound
+	}
+	change(txn)
+	return nil
+}
+
+// PostgresSandboxStore keeps sandbox transactions in the sandbox_transactions
+// table, so every API server and worker sees the same transactions.
+type PostgresSandboxStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresSandboxStore creates a store on db.
+func NewPostgresSandboxStore(db *gorm.DB) *PostgresSandboxStore {
+	return &PostgresSandboxStore{db: db}
+}
+
+func (p *PostgresSandboxStore) Create(txn *SandboxTransaction) error {
+	return p.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(txn).Error
+}
+
+// Update locks the transaction's row while change runs, so concurrent
+// operations on a transaction are applied one at a time.
+func (p *PostgresSandboxStore) Update(id string, change func(txn *SandboxTransaction)) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		var txn SandboxTransaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&txn).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTransactionNotFound
+			}
+			return err
+		}
+		change(&txn)
+		return tx.Save(&txn).Error
+	})
+}
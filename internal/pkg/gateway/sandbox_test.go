@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"mamlaka/internal/pkg/money"
+	"testing"
+	"time"
+)
+
+func kes(amount int64) money.Money {
+	return money.Money{Amount: amount, Currency: "KES"}
+}
+
+func TestSandboxAuthorizeOutcomes(t *testing.T) {
+	tests := []struct {
+		name     string
+		card     string
+		amount   int64
+		want     Outcome
+		wantCode string
+	}{
+		{"approved", "4242424242424242", 10000, Approved, "00"},
+		{"declined card", SandboxCardDeclined, 10000, Declined, "card_declined"},
+		{"insufficient funds card", SandboxCardInsufficientFunds, 10000, Declined, "insufficient_funds"},
+		{"expired card", SandboxCardExpired, 10000, Declined, "expired_card"},
+		{"pending card", SandboxCardPending, 10000, Pending, "pending"},
+		{"declined amount", "4242424242424242", 1001, Declined, "card_declined"},
+		{"insufficient funds amount", "4242424242424242", 1002, Declined, "insufficient_funds"},
+		{"pending amount", "4242424242424242", 1003, Pending, "pending"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewSandbox("sandbox").Authorize(context.Background(), AuthorizeRequest{
+				Reference: "PAY-1",
+				Amount:    kes(tt.amount),
+				Card:      &Card{Number: tt.card, ExpiryDate: "12/30", CVV: "123"},
+			})
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+			if result.Outcome != tt.want || result.Code != tt.wantCode {
+				t.Errorf("Authorize() = %s %q, want %s %q", result.Outcome, result.Code, tt.want, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSandboxAuthorizeTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := NewSandbox("sandbox").Authorize(ctx, AuthorizeRequest{Reference: "PAY-1", Amount: kes(1004)})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Authorize() error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestSandboxCapture(t *testing.T) {
+	ctx := context.Background()
+	sandbox := NewSandbox("sandbox")
+	auth, err := sandbox.Authorize(ctx, AuthorizeRequest{Reference: "PAY-1", Amount: kes(10000)})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	if result, _ := sandbox.Capture(ctx, auth.TransactionID, kes(20000)); result.Outcome != Declined {
+		t.Errorf("capturing more than authorized = %s, want declined", result.Outcome)
+	}
+	if result, _ := sandbox.Capture(ctx, auth.TransactionID, kes(8000)); result.Outcome != Approved {
+		t.Fatalf("Capture() = %s, want approved", result.Outcome)
+	}
+	if result, _ := sandbox.Capture(ctx, auth.TransactionID, kes(8000)); result.Outcome != Declined {
+		t.Errorf("second capture = %s, want declined", result.Outcome)
+	}
+	if result, _ := sandbox.Void(ctx, auth.TransactionID); result.Outcome != Declined {
+		t.Errorf("voiding a captured transaction = %s, want declined", result.Outcome)
+	}
+}
+
+func TestSandboxVoid(t *testing.T) {
+	ctx := context.Background()
+	sandbox := NewSandbox("sandbox")
+	auth, _ := sandbox.Authorize(ctx, AuthorizeRequest{Reference: "PAY-1", Amount: kes(10000)})
+
+	if result, _ := sandbox.Void(ctx, auth.TransactionID); result.Outcome != Approved {
+		t.Fatalf("Void() = %s, want approved", result.Outcome)
+	}
+	if result, _ := sandbox.Capture(ctx, auth.TransactionID, kes(10000)); result.Outcome != Declined {
+		t.Errorf("capturing a voided transaction = %s, want declined", result.Outcome)
+	}
+}
+
+func TestSandboxStatusApprovesPending(t *testing.T) {
+	ctx := context.Background()
+	sandbox := NewSandbox("sandbox")
+	auth, _ := sandbox.Authorize(ctx, AuthorizeRequest{Reference: "PAY-1", Amount: kes(1003)})
+
+	result, err := sandbox.Status(ctx, auth.TransactionID)
+	if err != nil || result.Outcome != Approved {
+		t.Errorf("Status() = %+v, %v, want approved", result, err)
+	}
+	if _, err := sandbox.Status(ctx, "sbx_unknown"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Status() of unknown transaction error = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestSandboxLookup(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySandboxStore()
+	auth, _ := NewSandboxWithStore("sandbox", store).Authorize(ctx, AuthorizeRequest{Reference: "PAY-1", Amount: kes(10000)})
+
+	// Another process sharing the store finds the authorization by reference
+	other := NewSandboxWithStore("sandbox", store)
+	result, err := other.Lookup(ctx, "PAY-1")
+	if err != nil || result.TransactionID != auth.TransactionID {
+		t.Errorf("Lookup() = %+v, %v, want transaction %s", result, err, auth.TransactionID)
+	}
+	if _, err := other.Lookup(ctx, "PAY-2"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Lookup() of unknown reference error = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestSandboxRefund(t *testing.T) {
+	ctx := context.Background()
+	sandbox := NewSandbox("sandbox")
+	auth, _ := sandbox.Authorize(ctx, AuthorizeRequest{Reference: "PAY-1", Amount: kes(10000)})
+	sandbox.Capture(ctx, auth.TransactionID, kes(8000))
+
+	first, err := sandbox.Refund(ctx, auth.TransactionID, "REF-1", kes(5000))
+	if err != nil || first.Outcome != Approved {
+		t.Fatalf("Refund() = %+v, %v, want approved", first, err)
+	}
+	if first.TransactionID == auth.TransactionID {
+		t.Error("refund has the payment's transaction ID, want a transaction of its own")
+	}
+	if result, _ := sandbox.Refund(ctx, auth.TransactionID, "REF-2", kes(5000)); result.Outcome != Declined {
+		t.Errorf("refunding more than captured = %s, want declined", result.Outcome)
+	}
+
+	// Retrying a refund returns its result without refunding again
+	retry, err := sandbox.Refund(ctx, auth.TransactionID, "REF-1", kes(5000))
+	if err != nil || retry.TransactionID != first.TransactionID || retry.Outcome != Approved {
+		t.Errorf("retried Refund() = %+v, %v, want %+v", retry, err, first)
+	}
+	if result, _ := sandbox.Refund(ctx, auth.TransactionID, "REF-3", kes(3000)); result.Outcome != Approved {
+		t.Errorf("refunding the rest = %s, want approved", result.Outcome)
+	}
+}
+
+func TestSandboxRefundTimeoutNeverReachesSandbox(t *testing.T) {
+	ctx := context.Background()
+	sandbox := NewSandbox("sandbox")
+	auth, _ := sandbox.Authorize(ctx, AuthorizeRequest{Reference: "PAY-1", Amount: kes(10000)})
+	sandbox.Capture(ctx, auth.TransactionID, kes(10000))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := sandbox.Refund(timeoutCtx, auth.TransactionID, "REF-1", kes(1004)); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Refund() error = %v, want ErrTimeout", err)
+	}
+	if _, err := sandbox.Lookup(ctx, "REF-1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Lookup() of timed-out refund error = %v, want ErrTransactionNotFound", err)
+	}
+}
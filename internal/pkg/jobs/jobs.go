@@ -0,0 +1,96 @@
+// Package jobs is a durable job queue stored in Postgres. Jobs are enqueued
+// in the caller's transaction, so a job exists exactly when the change that
+// needs it was committed, and are claimed by workers with FOR UPDATE SKIP
+// LOCKED so any number of worker processes can share the queue.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMaxAttempts is how often a job is attempted unless enqueued with MaxAttempts.
+const DefaultMaxAttempts = 5
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed" // Gave up after the maximum number of attempts or a permanent error
+)
+
+// Job is a unit of background work of a registered type.
+type Job struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	Type        string          `gorm:"size:100;not null" json:"type"`
+	Payload     json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	Status      Status          `gorm:"size:20;not null;index:idx_jobs_due,priority:1" json:"status"`
+	Attempts    int             `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int             `gorm:"not null" json:"max_attempts"`
+	RunAt       time.Time       `gorm:"not null;index:idx_jobs_due,priority:2" json:"run_at"` // Earliest time of the next attempt
+	LockedAt    *time.Time      `json:"locked_at,omitempty"`                                  // When the running attempt started
+	LockedBy    string          `gorm:"size:100" json:"locked_by,omitempty"`                  // Worker running the job
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Decode unmarshals the job's payload into v.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Option adjusts a job being enqueued.
+type Option func(job *Job)
+
+// RunAt delays the first attempt of a job until t.
+func RunAt(t time.Time) Option {
+	return func(job *Job) { job.RunAt = t }
+}
+
+// MaxAttempts overrides the queue's default number of attempts for a job.
+func MaxAttempts(n int) Option {
+	return func(job *Job) { job.MaxAttempts = n }
+}
+
+// Enqueue stores a job of the given type, to be run as soon as a worker is
+// free. It is meant to run in the transaction of the change that needs the job.
+func Enqueue(tx *gorm.DB, jobType string, payload interface{}, opts ...Option) (*Job, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{Type: jobType, Payload: encoded, Status: StatusQueued, MaxAttempts: DefaultMaxAttempts, RunAt: time.Now()}
+	for _, opt := range opts {
+		opt(job)
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that the job fails without further attempts.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Handler runs a job. Returning an error retries the job with exponential
+// backoff until it has been attempted MaxAttempts times, unless the error is
+// wrapped with Permanent. The context is cancelled when the job times out or
+// the worker shuts down.
+type Handler func(ctx context.Context, job *Job) error
+
+// Queue runs jobs with a pool of workers.
+type Queue struct {
+	db       *gorm.DB
+	logger   *slog.Logger
+	config   config.JobsConfig
+	name     string
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewQueue creates a queue whose workers run the jobs of registered types.
+func NewQueue(db *gorm.DB, logger *slog.Logger, conf config.JobsConfig) *Queue {
+	host, _ := os.Hostname()
+	return &Queue{
+		db:       db,
+		logger:   logger,
+		config:   conf,
+		name:     fmt.Sprintf("%s:%d", host, os.Getpid()),
+		handlers: map[string]Handler{},
+	}
+}
+
+// Register sets the handler of a job type.
+func (q *Queue) Register(jobType string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Run starts the configured number of workers and blocks until ctx is
+// cancelled and every worker has finished or released its current job.
+func (q *Queue) Run(ctx context.Context) {
+	q.logger.Info("Job workers starting", "workers", q.config.Workers, "worker", q.name)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= q.config.Workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			q.work(ctx, fmt.Sprintf("%s/%d", q.name, id))
+		}(i)
+	}
+	wg.Wait()
+
+	q.logger.Info("Job workers stopped", "worker", q.name)
+}
+
+// work runs jobs one after the other, polling when the queue is empty.
+func (q *Queue) work(ctx context.Context, worker string) {
+	for ctx.Err() == nil {
+		job, err := q.claim(worker)
+		if err != nil {
+			q.logger.Error("Error claiming job", "worker", worker, "error", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.config.PollInterval):
+			}
+			continue
+		}
+		q.run(ctx, job)
+	}
+}
+
+// claim locks the next due job for worker. Jobs left running by a worker
+// that died are claimed again once twice their timeout has passed.
+func (q *Queue) claim(worker string) (*Job, error) {
+	q.mu.RLock()
+	types := make([]string, 0, len(q.handlers))
+	for jobType := range q.handlers {
+		types = append(types, jobType)
+	}
+	q.mu.RUnlock()
+
+	var job Job
+	now := time.Now()
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("type IN ?", types).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_at < ?)",
+				StatusQueued, now, StatusRunning, now.Add(-2*q.config.Timeout)).
+			Order("run_at").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+
+		job.Status = StatusRunning
+		job.Attempts++
+		job.LockedAt = &now
+		job.LockedBy = worker
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":    job.Status,
+			"attempts":  job.Attempts,
+			"locked_at": job.LockedAt,
+			"locked_by": job.LockedBy,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run calls the job's handler and records the outcome.
+func (q *Queue) run(ctx context.Context, job *Job) {
+	q.mu.RLock()
+	handler := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	jobCtx, cancel := context.WithTimeout(ctx, q.config.Timeout)
+	err := q.call(jobCtx, handler, job)
+	cancel()
+
+	updates := map[string]interface{}{"locked_at": nil, "locked_by": ""}
+	switch {
+	case err == nil:
+		updates["status"] = StatusSucceeded
+		updates["last_error"] = ""
+		q.logger.Info("Job succeeded", "jobID", job.ID, "type", job.Type, "attempt", job.Attempts)
+	case ctx.Err() != nil:
+		// Shutting down: put the job back without counting the interrupted attempt
+		updates["status"] = StatusQueued
+		updates["attempts"] = job.Attempts - 1
+		updates["run_at"] = time.Now()
+		q.logger.Info("Job released on shutdown", "jobID", job.ID, "type", job.Type)
+	case IsPermanent(err) || job.Attempts >= job.MaxAttempts:
+		updates["status"] = StatusFailed
+		updates["last_error"] = err.Error()
+		q.logger.Error("Job failed", "jobID", job.ID, "type", job.Type, "attempt", job.Attempts, "error", err)
+	default:
+		runAt := time.Now().Add(q.backoff(job.Attempts))
+		updates["status"] = StatusQueued
+		updates["last_error"] = err.Error()
+		updates["run_at"] = runAt
+		q.logger.Warn("Job will be retried", "jobID", job.ID, "type", job.Type, "attempt", job.Attempts, "runAt", runAt, "error", err)
+	}
+
+	// The job's own context may be gone, but its outcome must still be saved
+	if err := q.db.Model(job).Updates(updates).Error; err != nil {
+		q.logger.Error("Error recording job outcome", "jobID", job.ID, "error", err)
+	}
+}
+
+// call runs handler, turning a panic into an error so one bad job cannot
+// take the worker down.
+func (q *Queue) call(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns how long to wait before the attempt after the given one.
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.config.RetryBaseDelay
+	for i := 1; i < attempts && delay < q.config.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.config.RetryMaxDelay {
+		delay = q.config.RetryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mamlaka/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	q := &Queue{config: config.JobsConfig{RetryBaseDelay: time.Second, RetryMaxDelay: 10 * time.Second}}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := q.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestCallRecoversPanics(t *testing.T) {
+	q := &Queue{}
+
+	err := q.call(context.Background(), func(context.Context, *Job) error {
+		panic("boom")
+	}, &Job{})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("call() error = %v, want the panic as an error", err)
+	}
+
+	want := errors.New("failed")
+	if err := q.call(context.Background(), func(context.Context, *Job) error { return want }, &Job{}); err != want {
+		t.Errorf("call() error = %v, want %v", err, want)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("invalid payload")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"permanent", Permanent(cause), true},
+		{"wrapped permanent", fmt.Errorf("sending email: %w", Permanent(cause)), true},
+		{"plain", cause, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsPermanent(tt.err); got != tt.want {
+			t.Errorf("IsPermanent(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if err := Permanent(cause); !errors.Is(err, cause) || err.Error() != cause.Error() {
+		t.Errorf("Permanent() = %v, want it to wrap %v", err, cause)
+	}
+}
+
+func TestOptionsAndDecode(t *testing.T) {
+	runAt := time.Now().Add(time.Hour)
+	job := &Job{Payload: []byte(`{"payment_id":12}`), MaxAttempts: DefaultMaxAttempts}
+	for _, opt := range []Option{RunAt(runAt), MaxAttempts(1)} {
+		opt(job)
+	}
+
+	if !job.RunAt.Equal(runAt) || job.MaxAttempts != 1 {
+		t.Errorf("job = %+v, want run at %v with 1 attempt", job, runAt)
+	}
+	var payload struct {
+		PaymentID uint `json:"payment_id"`
+	}
+	if err := job.Decode(&payload); err != nil || payload.PaymentID != 12 {
+		t.Errorf("Decode() = %+v, %v, want payment 12", payload, err)
+	}
+}
@@ -0,0 +1,167 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount       = errors.New("amount must be a plain decimal number such as 100 or 100.50")
+	ErrNonPositiveAmount   = errors.New("amount must be greater than zero")
+	ErrTooManyDecimals     = errors.New("amount has more decimal places than the currency allows")
+	ErrAmountOutOfRange    = errors.New("amount is too large")
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrCurrencyMismatch    = errors.New("currency mismatch")
+)
+
+// exponents maps supported ISO 4217 currency codes to the number of minor
+// units in one major unit (e.g. 2 for KES, where 1 KES = 100 cents).
+var exponents = map[string]int{
+	"KES": 2,
+	"UGX": 0,
+	"TZS": 2,
+	"RWF": 0,
+	"ETB": 2,
+	"NGN": 2,
+	"ZAR": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+// Money is an amount expressed in the minor units of its currency.
+type Money struct {
+	Amount   int64  `json:"minor_units" gorm:"column:amount;not null"`
+	Currency string `json:"currency" gorm:"column:currency;size:3;not null"`
+}
+
+// Exponent returns the number of minor-unit digits for a currency code.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	return exp, nil
+}
+
+// New builds a Money value from a minor-unit amount and currency code.
+func New(amount int64, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if _, err := Exponent(currency); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Parse converts a decimal string such as "1000" or "10.50" into Money.
+// Signs, thousands separators, exponents and whitespace are rejected, as
+// are zero amounts and amounts with more decimals than the currency allows.
+func Parse(amount, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	if strings.HasPrefix(amount, "-") {
+		return Money{}, ErrNonPositiveAmount
+	}
+
+	whole, frac, hasPoint := strings.Cut(amount, ".")
+	if whole == "" || !isDigits(whole) || (hasPoint && (frac == "" || !isDigits(frac))) {
+		return Money{}, ErrInvalidAmount
+	}
+	if len(frac) > exp {
+		return Money{}, ErrTooManyDecimals
+	}
+
+	var minor int64
+	for _, r := range whole + frac + strings.Repeat("0", exp-len(frac)) {
+		d := int64(r - '0')
+		if minor > (math.MaxInt64-d)/10 {
+			return Money{}, ErrAmountOutOfRange
+		}
+		minor = minor*10 + d
+	}
+	if minor == 0 {
+		return Money{}, ErrNonPositiveAmount
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// IsZero reports whether m holds no amount.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsPositive reports whether m holds an amount greater than zero.
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Add returns m + o. Both values must share a currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) || (o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrAmountOutOfRange
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o. Both values must share a currency.
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Decimal formats the amount in major units, e.g. 1050 KES -> "10.50".
+func (m Money) Decimal() string {
+	exp := exponents[m.Currency]
+	sign := ""
+	abs := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		abs = uint64(-(m.Amount + 1)) + 1
+	}
+	digits := fmt.Sprintf("%0*d", exp+1, abs)
+	if exp == 0 {
+		return sign + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// String formats m as "<decimal> <currency>", e.g. "10.50 KES".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// MarshalJSON adds the formatted decimal value alongside the minor units so
+// API consumers never have to know the currency exponent.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Value      string `json:"value"`
+		MinorUnits int64  `json:"minor_units"`
+		Currency   string `json:"currency"`
+	}{
+		Value:      m.Decimal(),
+		MinorUnits: m.Amount,
+		Currency:   m.Currency,
+	})
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{"whole amount", "1000", "KES", Money{100000, "KES"}, nil},
+		{"two decimals", "10.50", "KES", Money{1050, "KES"}, nil},
+		{"one decimal", "10.5", "KES", Money{1050, "KES"}, nil},
+		{"lower case currency", "10", " kes ", Money{1000, "KES"}, nil},
+		{"zero exponent currency", "100", "UGX", Money{100, "UGX"}, nil},
+		{"three decimal currency", "1.234", "BHD", Money{1234, "BHD"}, nil},
+		{"largest amount", "92233720368547758.07", "KES", Money{math.MaxInt64, "KES"}, nil},
+		{"too many decimals", "10.505", "KES", Money{}, ErrTooManyDecimals},
+		{"decimals on zero exponent currency", "100.5", "UGX", Money{}, ErrTooManyDecimals},
+		{"negative", "-5", "KES", Money{}, ErrNonPositiveAmount},
+		{"zero", "0", "KES", Money{}, ErrNonPositiveAmount},
+		{"zero with decimals", "0.00", "KES", Money{}, ErrNonPositiveAmount},
+		{"thousands separator", "1,000", "KES", Money{}, ErrInvalidAmount},
+		{"exponent", "1e3", "KES", Money{}, ErrInvalidAmount},
+		{"plus sign", "+10", "KES", Money{}, ErrInvalidAmount},
+		{"whitespace", " 10", "KES", Money{}, ErrInvalidAmount},
+		{"trailing point", "10.", "KES", Money{}, ErrInvalidAmount},
+		{"leading point", ".5", "KES", Money{}, ErrInvalidAmount},
+		{"empty", "", "KES", Money{}, ErrInvalidAmount},
+		{"out of range", "92233720368547758.08", "KES", Money{}, ErrAmountOutOfRange},
+		{"unsupported currency", "10", "XXX", Money{}, ErrUnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.amount, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q, %q) error = %v, want %v", tt.amount, tt.currency, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q, %q) = %+v, want %+v", tt.amount, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{1050, "KES"}, "10.50 KES"},
+		{Money{5, "KES"}, "0.05 KES"},
+		{Money{0, "KES"}, "0.00 KES"},
+		{Money{100, "UGX"}, "100 UGX"},
+		{Money{1234, "BHD"}, "1.234 BHD"},
+		{Money{-1050, "KES"}, "-10.50 KES"},
+		{Money{math.MinInt64, "KES"}, "-92233720368547758.08 KES"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestParseStringRoundTrip(t *testing.T) {
+	for _, amount := range []string{"1.00", "10.50", "999999.99"} {
+		m, err := Parse(amount, "KES")
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", amount, err)
+		}
+		if got := m.String(); got != amount+" KES" {
+			t.Errorf("Parse(%q).String() = %q", amount, got)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// AMQPSink publishes messages to a durable topic exchange, routed by event
+// type. Publishes are confirmed by the broker before Publish returns, and
+// the message ID is the event ID so consumers can discard redeliveries.
+type AMQPSink struct {
+	url      string
+	exchange string
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+// NewAMQPSink creates a sink publishing to exchange on the broker at url.
+// It connects on first use and reconnects after the connection fails.
+func NewAMQPSink(url, exchange string) *AMQPSink {
+	return &AMQPSink{url: url, exchange: exchange}
+}
+
+func (a *AMQPSink) Name() string {
+	return "amqp"
+}
+
+func (a *AMQPSink) Publish(ctx context.Context, message Message) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	err := a.channel.Publish(a.exchange, message.Type, false, false, amqp.Publishing{
+		MessageId:    message.EventID,
+		Type:         message.Type,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    message.OccurredAt,
+		Headers: amqp.Table{
+			"aggregate_type": message.AggregateType,
+			"aggregate_id":   int64(message.AggregateID),
+		},
+		Body: message.Payload,
+	})
+	if err != nil {
+		a.reset()
+		return err
+	}
+
+	select {
+	case confirmation, ok := <-a.confirms:
+		if !ok {
+			a.reset()
+			return errors.New("amqp channel closed before the publish was confirmed")
+		}
+		if !confirmation.Ack {
+			return fmt.Errorf("amqp broker rejected event %s", message.EventID)
+		}
+		return nil
+	case <-ctx.Done():
+		// The confirmation may still arrive; a fresh channel keeps later ones in step
+		a.reset()
+		return ctx.Err()
+	}
+}
+
+// connect opens a connection and a channel in confirm mode unless one is
+// already open, and declares the exchange. The caller must hold a.mu.
+func (a *AMQPSink) connect() error {
+	if a.conn != nil && !a.conn.IsClosed() {
+		return nil
+	}
+	a.reset()
+
+	conn, err := amqp.Dial(a.url)
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := channel.ExchangeDeclare(a.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+
+	a.conn = conn
+	a.channel = channel
+	a.confirms = channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+// reset closes the connection so the next publish reconnects. The caller must hold a.mu.
+func (a *AMQPSink) reset() {
+	if a.conn != nil {
+		a.conn.Close()
+	}
+	a.conn, a.channel, a.confirms = nil, nil, nil
+}
+
+// Close closes the connection to the broker.
+func (a *AMQPSink) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reset()
+	return nil
+}
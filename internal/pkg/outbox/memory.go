@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"context"
+	"mamlaka/internal/pkg/pubsub"
+)
+
+// MemoryTopicPrefix prefixes the event type to form the topic outbox
+// messages are published to on an in-memory bus, e.g. "outbox.PaymentCaptured".
+const MemoryTopicPrefix = "outbox."
+
+// MemorySink publishes messages to an in-process broker, for consumers
+// running in the same process as the relay.
+type MemorySink struct {
+	broker *pubsub.Broker
+}
+
+// NewMemorySink creates a sink publishing to broker.
+func NewMemorySink(broker *pubsub.Broker) *MemorySink {
+	return &MemorySink{broker: broker}
+}
+
+func (m *MemorySink) Name() string {
+	return "memory"
+}
+
+// Publish hands the message to the broker's current subscribers. Subscribers
+// that are not listening when it is published miss it.
+func (m *MemorySink) Publish(_ context.Context, message Message) error {
+	m.broker.Publish(MemoryTopicPrefix+message.Type, message)
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package outbox implements the transactional outbox pattern. Domain events
+// are recorded in the outbox table in the same transaction as the change
+// they describe, and a relay publishes them to sinks afterwards, so an event
+// is published if and only if its change was committed.
+//
+// Delivery is at least once: a relay that dies between publishing and
+// marking a message published sends it again. Every event carries an ID
+// derived from the change it describes, which consumers use to discard
+// duplicates.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Message is a domain event waiting in, or published from, the outbox.
+type Message struct {
+	ID            uint            `gorm:"primaryKey" json:"-"`                           // Publication order
+	EventID       string          `gorm:"size:100;not null;uniqueIndex" json:"event_id"` // Deduplication ID
+	Type          string          `gorm:"size:100;not null" json:"type"`                 // e.g. PaymentCaptured
+	AggregateType string          `gorm:"size:50;not null" json:"aggregate_type"`        // e.g. payment
+	AggregateID   uint            `gorm:"not null" json:"aggregate_id"`
+	Payload       json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	OccurredAt    time.Time       `gorm:"not null" json:"occurred_at"`
+	PublishedAt   *time.Time      `gorm:"index" json:"-"`
+	Attempts      int             `gorm:"not null;default:0" json:"-"`
+	LastError     string          `json:"-"`
+}
+
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Event is a domain event to record.
+type Event struct {
+	ID            string // Identifies the change, so recording it twice has no effect
+	Type          string
+	AggregateType string
+	AggregateID   uint
+	Payload       interface{}
+}
+
+// Record writes event to the outbox. It must run in the transaction of the
+// change the event describes. An event whose ID is already in the outbox is
+// skipped.
+func Record(tx *gorm.DB, event Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).
+		Create(&Message{
+			EventID:       event.ID,
+			Type:          event.Type,
+			AggregateType: event.AggregateType,
+			AggregateID:   event.AggregateID,
+			Payload:       payload,
+			OccurredAt:    time.Now(),
+		}).Error
+}
@@ -0,0 +1,145 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sink is somewhere outbox messages are published to.
+type Sink interface {
+	Name() string
+	// Publish returns once the sink has accepted the message.
+	Publish(ctx context.Context, message Message) error
+}
+
+// Relay publishes outbox messages to every sink, in the order they were recorded.
+type Relay struct {
+	db     *gorm.DB
+	logger *slog.Logger
+	config config.OutboxConfig
+	sinks  []Sink
+}
+
+// NewRelay creates a relay publishing to sinks.
+func NewRelay(db *gorm.DB, logger *slog.Logger, conf config.OutboxConfig, sinks ...Sink) *Relay {
+	return &Relay{db: db, logger: logger, config: conf, sinks: sinks}
+}
+
+// pruneInterval is how often published messages past their retention are deleted.
+const pruneInterval = time.Hour
+
+// Run relays messages every interval, and prunes published ones every
+// pruneInterval, until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.RelayInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(pruneInterval)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Error("Error relaying outbox messages", "error", err)
+			}
+		case <-pruneTicker.C:
+			if err := r.PrunePublished(time.Now().Add(-r.config.Retention)); err != nil {
+				r.logger.Error("Error pruning published outbox messages", "error", err)
+			}
+		}
+	}
+}
+
+// PrunePublished deletes messages published before publishedBefore, so the
+// outbox only holds messages awaiting publication and recent ones for
+// troubleshooting.
+func (r *Relay) PrunePublished(publishedBefore time.Time) error {
+	result := r.db.Where("published_at < ?", publishedBefore).Delete(&Message{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		r.logger.Info("Pruned published outbox messages", "count", result.RowsAffected)
+	}
+	return nil
+}
+
+// RelayPending publishes unpublished messages in batches until none are
+// left or one fails. A message that fails stops its batch, so later messages
+// are not published before it. The batch being published stays locked, so
+// several relays can run without publishing the same message at once,
+// although messages are then only in order within each relay's batches.
+func (r *Relay) RelayPending(ctx context.Context) error {
+	for {
+		published, err := r.relayBatch(ctx)
+		if err != nil || published < r.config.BatchSize {
+			return err
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	published := 0
+	var failure error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var messages []Message
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL").
+			Order("id").
+			Limit(r.config.BatchSize).
+			Find(&messages).Error; err != nil {
+			return err
+		}
+
+		for i := range messages {
+			message := &messages[i]
+			if failure = r.publish(ctx, message); failure != nil {
+				return tx.Model(message).Updates(map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": failure.Error(),
+				}).Error
+			}
+
+			now := time.Now()
+			if err := tx.Model(message).Updates(map[string]interface{}{
+				"published_at": now,
+				"attempts":     gorm.Expr("attempts + 1"),
+				"last_error":   "",
+			}).Error; err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	if err != nil {
+		return published, err
+	}
+	return published, failure
+}
+
+// publish sends message to every sink. A sink that already accepted the
+// message receives it again if another sink fails; consumers deduplicate by
+// EventID.
+func (r *Relay) publish(ctx context.Context, message *Message) error {
+	var errs []error
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, *message); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		r.logger.Warn("Error publishing outbox message", "eventID", message.EventID, "type", message.Type, "error", err)
+		return err
+	}
+	return nil
+}
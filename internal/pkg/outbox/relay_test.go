@@ -0,0 +1,88 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"mamlaka/internal/pkg/pubsub"
+	"strings"
+	"testing"
+)
+
+// recordingSink remembers the messages published to it, failing with err.
+type recordingSink struct {
+	name     string
+	err      error
+	messages []Message
+}
+
+func (s *recordingSink) Name() string {
+	return s.name
+}
+
+func (s *recordingSink) Publish(_ context.Context, message Message) error {
+	s.messages = append(s.messages, message)
+	return s.err
+}
+
+func newTestRelay(sinks ...Sink) *Relay {
+	return NewRelay(nil, slog.New(slog.NewTextHandler(io.Discard, nil)), config.OutboxConfig{}, sinks...)
+}
+
+func TestPublishReachesEverySink(t *testing.T) {
+	memory, amqp := &recordingSink{name: "memory"}, &recordingSink{name: "amqp"}
+	relay := newTestRelay(memory, amqp)
+
+	if err := relay.publish(context.Background(), &Message{EventID: "payment:1:captured", Type: "PaymentCaptured"}); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+	for _, sink := range []*recordingSink{memory, amqp} {
+		if len(sink.messages) != 1 || sink.messages[0].EventID != "payment:1:captured" {
+			t.Errorf("%s sink received %+v, want the message once", sink.name, sink.messages)
+		}
+	}
+}
+
+func TestPublishReportsFailingSinks(t *testing.T) {
+	unavailable := errors.New("connection refused")
+	memory := &recordingSink{name: "memory"}
+	amqp := &recordingSink{name: "amqp", err: unavailable}
+	relay := newTestRelay(amqp, memory)
+
+	err := relay.publish(context.Background(), &Message{EventID: "payment:1:captured"})
+	if !errors.Is(err, unavailable) || !strings.Contains(err.Error(), "amqp") {
+		t.Errorf("publish() error = %v, want the amqp sink's error", err)
+	}
+	if len(memory.messages) != 1 {
+		t.Errorf("memory sink received %d messages, want the message despite the other sink failing", len(memory.messages))
+	}
+}
+
+func TestMemorySinkPublishesByType(t *testing.T) {
+	broker := pubsub.NewBroker(1)
+	captured := broker.Subscribe(MemoryTopicPrefix + "PaymentCaptured")
+	defer captured.Close()
+	refunded := broker.Subscribe(MemoryTopicPrefix + "PaymentRefunded")
+	defer refunded.Close()
+
+	sink := NewMemorySink(broker)
+	if err := sink.Publish(context.Background(), Message{EventID: "payment:1:captured", Type: "PaymentCaptured"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case received := <-captured.C:
+		if message, ok := received.(Message); !ok || message.EventID != "payment:1:captured" {
+			t.Errorf("subscriber received %+v, want the published message", received)
+		}
+	default:
+		t.Error("subscriber to the message type received nothing")
+	}
+	select {
+	case received := <-refunded.C:
+		t.Errorf("subscriber to another type received %+v", received)
+	default:
+	}
+}
@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// PostgresChannel is the Postgres NOTIFY channel messages are relayed over.
+const PostgresChannel = "mamlaka_events"
+
+const listenRetryDelay = 5 * time.Second
+
+// envelope is the NOTIFY payload of a relayed message.
+type envelope struct {
+	Topic   string          `json:"topic"`
+	Message json.RawMessage `json:"message"`
+}
+
+// Notify publishes message to topic on every broker listening with
+// ListenPostgres, in any process. It is meant to run in the transaction of
+// the change the message reports: Postgres only delivers the notification
+// if the transaction commits. Payloads are limited to 8000 bytes.
+func Notify(tx *gorm.DB, topic string, message interface{}) error {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(envelope{Topic: topic, Message: encoded})
+	if err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", PostgresChannel, string(payload)).Error
+}
+
+// ListenPostgres publishes the messages sent with Notify to the broker's
+// subscribers, as json.RawMessage, until ctx is cancelled. The connection is
+// re-established if it fails; messages notified while it is down are lost.
+func (b *Broker) ListenPostgres(ctx context.Context, logger *slog.Logger, dsn string) {
+	for ctx.Err() == nil {
+		err := b.listen(ctx, dsn)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("Postgres event listener failed, reconnecting", "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context, dsn string) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+PostgresChannel); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var message envelope
+		if err := json.Unmarshal([]byte(notification.Payload), &message); err != nil {
+			continue
+		}
+		b.Publish(message.Topic, message.Message)
+	}
+}
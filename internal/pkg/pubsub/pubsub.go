@@ -0,0 +1,85 @@
+// Package pubsub is an in-process publish/subscribe broker. Messages
+// published with Publish only reach subscribers in the same process; Notify
+// and ListenPostgres relay messages between processes through Postgres.
+package pubsub
+
+import "sync"
+
+// DefaultBuffer is the number of messages a subscription holds before the
+// subscriber is considered too slow.
+const DefaultBuffer = 64
+
+// Broker fans messages published to a topic out to its subscribers.
+// Publishing never blocks: a subscriber whose buffer is full is dropped and
+// its channel closed, so one stalled client cannot hold up the publisher.
+type Broker struct {
+	mu          sync.Mutex
+	buffer      int
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+// Subscription receives the messages published to one topic.
+type Subscription struct {
+	C <-chan interface{} // Closed when the subscription ends
+
+	broker *Broker
+	topic  string
+	ch     chan interface{}
+	once   sync.Once
+}
+
+// NewBroker creates a broker whose subscriptions buffer up to buffer messages.
+func NewBroker(buffer int) *Broker {
+	return &Broker{buffer: buffer, subscribers: map[string]map[*Subscription]struct{}{}}
+}
+
+// Subscribe starts receiving the messages published to topic.
+func (b *Broker) Subscribe(topic string) *Subscription {
+	ch := make(chan interface{}, b.buffer)
+	sub := &Subscription{C: ch, broker: b, topic: topic, ch: ch}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = map[*Subscription]struct{}{}
+	}
+	b.subscribers[topic][sub] = struct{}{}
+	return sub
+}
+
+// Publish sends message to every subscriber of topic. A nil broker discards
+// the message, so publishers need not check whether anyone is listening.
+func (b *Broker) Publish(topic string, message interface{}) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers[topic] {
+		select {
+		case sub.ch <- message:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Close ends the subscription and closes its channel. It is safe to call
+// more than once, including after the broker dropped the subscription.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+// remove unsubscribes sub. The caller must hold b.mu.
+func (b *Broker) remove(sub *Subscription) {
+	sub.once.Do(func() {
+		delete(b.subscribers[sub.topic], sub)
+		if len(b.subscribers[sub.topic]) == 0 {
+			delete(b.subscribers, sub.topic)
+		}
+		close(sub.ch)
+	})
+}
@@ -6,57 +6,57 @@ import (
 	"time"
 )
 
-var (
-	accessSecret  = []byte("access_token_secret")
-	refreshSecret = []byte("refresh_token_secret")
-)
-
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID      string   `json:"user_id"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions,omitempty"` // Everything the user may do, from their role and direct grants
 	jwt.RegisteredClaims
 }
 
-// GenerateAccessToken generates a new JWT access token.
-func GenerateAccessToken(userID string, expiry time.Duration) (string, error) {
-	claims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// HasPermission reports whether the claims carry permission.
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
 	}
-
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return accessToken.SignedString(accessSecret)
+	return false
 }
 
-// GenerateRefreshToken generates a new JWT refresh token.
-func GenerateRefreshToken(userID string, expiry time.Duration) (string, error) {
+// GenerateAccessToken generates a new JWT access token, signed with the
+// signing key loaded by LoadKeys.
+func GenerateAccessToken(userID, role string, permissions []string, expiry time.Duration) (string, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID: userID,
+		UserID:      userID,
+		Role:        role,
+		Permissions: permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(refreshSecret)
+	return set.sign(claims)
 }
 
-// ValidateToken validates a JWT token and returns the claims.
-func ValidateToken(tokenStr string, isRefreshToken bool) (*Claims, error) {
-	var secret []byte
-	if isRefreshToken {
-		secret = refreshSecret
-	} else {
-		secret = accessSecret
+// ValidateToken validates a JWT access token against the keys loaded by
+// LoadKeys and returns the claims.
+func ValidateToken(tokenStr string) (*Claims, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return nil, err
 	}
 
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
+	options := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if set.issuer != "" {
+		options = append(options, jwt.WithIssuer(set.issuer))
+	}
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, set.keyFunc, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,13 +68,3 @@ func ValidateToken(tokenStr string, isRefreshToken bool) (*Claims, error) {
 
 	return claims, nil
 }
-
-// RefreshAccessToken takes a refresh token and generates a new access token.
-func RefreshAccessToken(refreshToken string) (string, error) {
-	claims, err := ValidateToken(refreshToken, true)
-	if err != nil {
-		return "", err
-	}
-
-	return GenerateAccessToken(claims.UserID, time.Hour)
-}
@@ -0,0 +1,278 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mamlaka/config"
+	"math/big"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA key accepted for signing or verification.
+const minRSABits = 2048
+
+// Key is a public key access tokens are verified with. Its ID, sent in the
+// kid header of the tokens it signed, is its RFC 7638 thumbprint.
+type Key struct {
+	ID        string
+	Algorithm string // RS256 or EdDSA
+	Public    crypto.PublicKey
+}
+
+// KeySet holds the key access tokens are signed with and every key they are
+// verified with, the signing key included.
+type KeySet struct {
+	signer  crypto.Signer
+	signing *Key
+	keys    map[string]*Key
+	issuer  string
+}
+
+// keys is the key set GenerateAccessToken and ValidateToken use.
+var keys atomic.Pointer[KeySet]
+
+// LoadKeys loads the keys in conf and makes them the keys access tokens are
+// signed and verified with. A signing key must be configured unless
+// conf.AllowEphemeralKey is set, as it is in development: then a random
+// Ed25519 key is generated, so tokens only remain valid until restart and
+// only on this process.
+func LoadKeys(logger *slog.Logger, conf config.JWTConfig) error {
+	var signer crypto.Signer
+	if conf.SigningKeyFile == "" {
+		if !conf.AllowEphemeralKey {
+			return errors.New("JWT_SIGNING_KEY_FILE must be set outside development")
+		}
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("cannot generate ephemeral signing key: %w", err)
+		}
+		logger.Warn("JWT signing key not configured, using an ephemeral key")
+		signer = key
+	} else {
+		key, err := readPrivateKey(conf.SigningKeyFile)
+		if err != nil {
+			return err
+		}
+		signer = key
+	}
+
+	signing, err := newKey(signer.Public())
+	if err != nil {
+		return fmt.Errorf("%s: %w", conf.SigningKeyFile, err)
+	}
+	set := &KeySet{
+		signer:  signer,
+		signing: signing,
+		keys:    map[string]*Key{signing.ID: signing},
+		issuer:  conf.Issuer,
+	}
+	for _, path := range conf.VerificationKeyFiles {
+		public, err := readPublicKey(path)
+		if err != nil {
+			return err
+		}
+		key, err := newKey(public)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		set.keys[key.ID] = key
+	}
+
+	keys.Store(set)
+	logger.Info("JWT keys loaded", "signingKey", signing.ID, "algorithm", signing.Algorithm, "verificationKeys", len(set.keys))
+	return nil
+}
+
+// currentKeys returns the loaded key set.
+func currentKeys() (*KeySet, error) {
+	set := keys.Load()
+	if set == nil {
+		return nil, errors.New("JWT keys not loaded")
+	}
+	return set, nil
+}
+
+// sign signs claims with the signing key, naming it in the kid header.
+func (s *KeySet) sign(claims *Claims) (string, error) {
+	claims.Issuer = s.issuer
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(s.signing.Algorithm), claims)
+	token.Header["kid"] = s.signing.ID
+	return token.SignedString(s.signer)
+}
+
+// keyFunc returns the verification key named by a token's kid header,
+// refusing tokens signed with any other algorithm than the key's.
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing algorithm %q", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // Ed25519
+	X         string `json:"x,omitempty"`   // Ed25519 public key
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns every key access tokens are verified with, for other
+// services to verify them with.
+func PublicKeys() (JWKS, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return JWKS{}, err
+	}
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range set.keys {
+		jwk, _ := toJWK(key.Public)
+		jwk.KeyID = key.ID
+		jwk.Use = "sig"
+		jwk.Algorithm = key.Algorithm
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+	return jwks, nil
+}
+
+// newKey identifies a supported public key and its algorithm.
+func newKey(public crypto.PublicKey) (*Key, error) {
+	jwk, err := toJWK(public)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := jwt.SigningMethodRS256.Alg()
+	if jwk.KeyType == "OKP" {
+		algorithm = jwt.SigningMethodEdDSA.Alg()
+	}
+	return &Key{ID: thumbprint(jwk), Algorithm: algorithm, Public: public}, nil
+}
+
+// toJWK returns the key parameters of a supported public key.
+func toJWK(public crypto.PublicKey) (JWK, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return JWK{}, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+		}
+		return JWK{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported key type %T; use an RSA or Ed25519 key", public)
+}
+
+// thumbprint returns the RFC 7638 thumbprint of a key: the hash of its
+// required members, in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members string
+	if jwk.KeyType == "OKP" {
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Curve, jwk.X)
+	} else {
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// readPrivateKey reads a PKCS #8 or PKCS #1 private key from a PEM file.
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: expected a private key, found %s", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	return signer, nil
+}
+
+// readPublicKey reads a public key from a PEM file. A private key is accepted
+// too, and its public key used.
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	}
+	signer, err := readPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// readPEM reads the first PEM block of a file.
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
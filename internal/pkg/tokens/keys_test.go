@@ -0,0 +1,19 @@
+package tokens
+
+import (
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"testing"
+)
+
+func TestLoadKeysRequiresSigningKeyOutsideDevelopment(t *testing.T) {
+	before := keys.Load()
+	err := LoadKeys(slog.New(slog.NewTextHandler(io.Discard, nil)), config.JWTConfig{})
+	if err == nil {
+		t.Fatal("LoadKeys() without a signing key = nil, want an error")
+	}
+	if keys.Load() != before {
+		t.Error("LoadKeys() replaced the loaded keys after failing")
+	}
+}
@@ -0,0 +1,177 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"mamlaka/config"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+)
+
+// Reasons recorded when refresh tokens are revoked.
+const (
+	RevokedLogout        = "logout"
+	RevokedLogoutAll     = "logout_all"
+	RevokedPasswordReset = "password_reset"
+	RevokedReuse         = "reuse_detected"
+)
+
+// RefreshToken is a persisted refresh token. Only the SHA-256 hash of the
+// token is stored. A login starts a family of tokens, one session: using a
+// token replaces it with the next token in its family, and using a replaced
+// token again revokes the whole family.
+type RefreshToken struct {
+	ID              uint       `gorm:"primaryKey"`
+	UserID          uint       `gorm:"not null;index"`
+	FamilyID        string     `gorm:"size:32;not null;index"`
+	TokenHash       string     `gorm:"size:64;not null;uniqueIndex"`
+	AuthenticatedAt time.Time  `gorm:"not null"` // When the user logged in to start the family
+	ExpiresAt       time.Time  `gorm:"not null"`
+	UsedAt          *time.Time // Set when the token is exchanged for the next one
+	RevokedAt       *time.Time `gorm:"index"`
+	RevokedReason   string     `gorm:"size:20"`
+	CreatedAt       time.Time  `gorm:"not null"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// RefreshStore persists refresh tokens.
+type RefreshStore interface {
+	CreateRefreshToken(token *RefreshToken) error
+	// GetRefreshToken returns the token with the given hash, or nil if there is none.
+	GetRefreshToken(tokenHash string) (*RefreshToken, error)
+	// RotateRefreshToken marks current used and saves next in one
+	// transaction. It returns ErrRefreshTokenReused if current was used or
+	// revoked in the meantime.
+	RotateRefreshToken(current, next *RefreshToken) error
+	RevokeRefreshTokenFamily(familyID, reason string) error
+	RevokeUserRefreshTokens(userID uint, reason string) error
+}
+
+// Subject is who tokens are issued to, and what they may do.
+type Subject struct {
+	UserID      uint
+	Role        string
+	Permissions []string
+}
+
+// Pair is an access token and the refresh token that renews it.
+type Pair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// IssueTokens starts a new session for subject.
+func IssueTokens(store RefreshStore, subject Subject, conf config.AuthConfig) (*Pair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return issuePair(subject, conf, func(next *RefreshToken) error {
+		next.FamilyID = familyID
+		next.AuthenticatedAt = next.CreatedAt
+		return store.CreateRefreshToken(next)
+	})
+}
+
+// RefreshAccessToken exchanges a refresh token for a new access token and the
+// next refresh token of its session. lookup returns the current subject of
+// the token's session, or an error if it may no longer be renewed, e.g.
+// because the user was deactivated. A token that was already exchanged is
+// treated as stolen: the whole session is revoked.
+func RefreshAccessToken(store RefreshStore, refreshToken string, conf config.AuthConfig, lookup func(token *RefreshToken) (*Subject, error)) (*Pair, error) {
+	current, err := store.GetRefreshToken(HashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.UsedAt != nil {
+		return nil, revokeReused(store, current)
+	}
+
+	subject, err := lookup(current)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := issuePair(*subject, conf, func(next *RefreshToken) error {
+		next.FamilyID = current.FamilyID
+		next.AuthenticatedAt = current.AuthenticatedAt
+		return store.RotateRefreshToken(current, next)
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, revokeReused(store, current)
+	}
+	return pair, err
+}
+
+// RevokeSession revokes the session of a refresh token. Unknown tokens are
+// ignored, so logging out twice is not an error.
+func RevokeSession(store RefreshStore, refreshToken string) error {
+	token, err := store.GetRefreshToken(HashRefreshToken(refreshToken))
+	if err != nil || token == nil {
+		return err
+	}
+	return store.RevokeRefreshTokenFamily(token.FamilyID, RevokedLogout)
+}
+
+// HashRefreshToken returns the hash under which a refresh token is stored.
+// Refresh tokens are random, so a fast hash is enough.
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// issuePair generates an access token and a refresh token for subject and
+// saves the refresh token with save, which completes its family fields.
+func issuePair(subject Subject, conf config.AuthConfig, save func(next *RefreshToken) error) (*Pair, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := GenerateAccessToken(strconv.FormatUint(uint64(subject.UserID), 10), subject.Role, subject.Permissions, conf.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next := &RefreshToken{
+		UserID:    subject.UserID,
+		TokenHash: HashRefreshToken(refreshToken),
+		ExpiresAt: now.Add(conf.RefreshTokenTTL),
+		CreatedAt: now,
+	}
+	if err := save(next); err != nil {
+		return nil, err
+	}
+	return &Pair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// revokeReused revokes the family of a refresh token presented after it was
+// exchanged and returns ErrRefreshTokenReused.
+func revokeReused(store RefreshStore, token *RefreshToken) error {
+	if err := store.RevokeRefreshTokenFamily(token.FamilyID, RevokedReuse); err != nil {
+		return errors.Join(ErrRefreshTokenReused, err)
+	}
+	return ErrRefreshTokenReused
+}
+
+// randomToken returns n random bytes, URL-safe base64-encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,262 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"mamlaka/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// memoryStore is a RefreshStore keeping tokens in memory.
+type memoryStore struct {
+	tokens    map[string]*RefreshToken
+	nextID    uint
+	rotateErr error // Returned by RotateRefreshToken instead of rotating, if set
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{tokens: make(map[string]*RefreshToken)}
+}
+
+func (m *memoryStore) CreateRefreshToken(token *RefreshToken) error {
+	m.nextID++
+	token.ID = m.nextID
+	saved := *token
+	m.tokens[token.TokenHash] = &saved
+	return nil
+}
+
+func (m *memoryStore) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	token, ok := m.tokens[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	found := *token
+	return &found, nil
+}
+
+func (m *memoryStore) RotateRefreshToken(current, next *RefreshToken) error {
+	if m.rotateErr != nil {
+		return m.rotateErr
+	}
+	stored := m.tokens[current.TokenHash]
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		return ErrRefreshTokenReused
+	}
+	now := time.Now()
+	stored.UsedAt = &now
+	return m.CreateRefreshToken(next)
+}
+
+func (m *memoryStore) RevokeRefreshTokenFamily(familyID, reason string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			token.RevokedReason = reason
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) RevokeUserRefreshTokens(userID uint, reason string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			token.RevokedReason = reason
+		}
+	}
+	return nil
+}
+
+// family returns the stored tokens of the session of refreshToken.
+func (m *memoryStore) family(refreshToken string) []*RefreshToken {
+	familyID := m.tokens[HashRefreshToken(refreshToken)].FamilyID
+	var family []*RefreshToken
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID {
+			family = append(family, token)
+		}
+	}
+	return family
+}
+
+var testAuthConfig = config.AuthConfig{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "tokens")
+	if err != nil {
+		panic(err)
+	}
+	keyFile := filepath.Join(dir, "signing.pem")
+	if err := writeTestKey(keyFile); err != nil {
+		panic(err)
+	}
+	if err := LoadKeys(slog.New(slog.NewTextHandler(io.Discard, nil)), config.JWTConfig{SigningKeyFile: keyFile}); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func writeTestKey(path string) error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+}
+
+func subjectLookup(token *RefreshToken) (*Subject, error) {
+	return &Subject{UserID: token.UserID, Role: "customer"}, nil
+}
+
+func TestRefreshAccessTokenRotates(t *testing.T) {
+	store := newMemoryStore()
+	first, err := IssueTokens(store, Subject{UserID: 7, Role: "customer"}, testAuthConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := RefreshAccessToken(store, first.RefreshToken, testAuthConfig, subjectLookup)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	if claims, err := ValidateToken(second.AccessToken); err != nil || claims.UserID != "7" {
+		t.Errorf("ValidateToken() = %+v, %v", claims, err)
+	}
+	if family := store.family(first.RefreshToken); len(family) != 2 {
+		t.Errorf("session has %d tokens, want 2", len(family))
+	}
+	if _, err := RefreshAccessToken(store, second.RefreshToken, testAuthConfig, subjectLookup); err != nil {
+		t.Errorf("RefreshAccessToken() with the rotated token error = %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	tests := []struct {
+		name  string
+		reuse func(t *testing.T, store *memoryStore, used string)
+	}{
+		{
+			name: "used token presented again",
+			reuse: func(t *testing.T, store *memoryStore, used string) {
+				_, err := RefreshAccessToken(store, used, testAuthConfig, subjectLookup)
+				if !errors.Is(err, ErrRefreshTokenReused) {
+					t.Fatalf("RefreshAccessToken() error = %v, want %v", err, ErrRefreshTokenReused)
+				}
+			},
+		},
+		{
+			name: "token used concurrently",
+			reuse: func(t *testing.T, store *memoryStore, used string) {
+				// The token was read before another request used it
+				store.tokens[HashRefreshToken(used)].UsedAt = nil
+				store.rotateErr = ErrRefreshTokenReused
+				_, err := RefreshAccessToken(store, used, testAuthConfig, subjectLookup)
+				if !errors.Is(err, ErrRefreshTokenReused) {
+					t.Fatalf("RefreshAccessToken() error = %v, want %v", err, ErrRefreshTokenReused)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			first, err := IssueTokens(store, Subject{UserID: 7}, testAuthConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := IssueTokens(store, Subject{UserID: 7}, testAuthConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := RefreshAccessToken(store, first.RefreshToken, testAuthConfig, subjectLookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.reuse(t, store, first.RefreshToken)
+
+			for _, token := range store.family(first.RefreshToken) {
+				if token.RevokedAt == nil || token.RevokedReason != RevokedReuse {
+					t.Errorf("token %d of the session not revoked for reuse: %+v", token.ID, token)
+				}
+			}
+			store.rotateErr = nil
+			if _, err := RefreshAccessToken(store, second.RefreshToken, testAuthConfig, subjectLookup); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("RefreshAccessToken() with the latest token error = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+			if _, err := RefreshAccessToken(store, other.RefreshToken, testAuthConfig, subjectLookup); err != nil {
+				t.Errorf("RefreshAccessToken() in another session error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshAccessTokenRejects(t *testing.T) {
+	lookupErr := errors.New("user deactivated")
+
+	tests := []struct {
+		name    string
+		change  func(token *RefreshToken)
+		lookup  func(token *RefreshToken) (*Subject, error)
+		token   string // Presented instead of the issued token, if set
+		wantErr error
+	}{
+		{name: "unknown token", token: "not-a-token", wantErr: ErrInvalidRefreshToken},
+		{name: "expired token", change: func(token *RefreshToken) { token.ExpiresAt = time.Now().Add(-time.Second) }, wantErr: ErrInvalidRefreshToken},
+		{name: "revoked token", change: func(token *RefreshToken) {
+			now := time.Now()
+			token.RevokedAt = &now
+		}, wantErr: ErrInvalidRefreshToken},
+		{name: "subject no longer allowed", lookup: func(*RefreshToken) (*Subject, error) { return nil, lookupErr }, wantErr: lookupErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			pair, err := IssueTokens(store, Subject{UserID: 7}, testAuthConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				tt.change(store.tokens[HashRefreshToken(pair.RefreshToken)])
+			}
+			token := pair.RefreshToken
+			if tt.token != "" {
+				token = tt.token
+			}
+			lookup := subjectLookup
+			if tt.lookup != nil {
+				lookup = tt.lookup
+			}
+
+			if _, err := RefreshAccessToken(store, token, testAuthConfig, lookup); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RefreshAccessToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(store.tokens) != 1 {
+				t.Errorf("store has %d tokens, want the token not to be rotated", len(store.tokens))
+			}
+		})
+	}
+}
@@ -1,13 +1,21 @@
 package server
 
 import (
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"mamlaka/cmd/web"
 	_ "mamlaka/docs"
+	"mamlaka/internal/app/ledger"
 	"mamlaka/internal/app/payment"
+	"mamlaka/internal/app/risk"
+	"mamlaka/internal/app/transfer"
 	"mamlaka/internal/app/user"
+	"mamlaka/internal/app/wallet"
+	"mamlaka/internal/app/webhook"
+	"mamlaka/internal/pkg/tokens"
+	"net"
 	"net/http"
 )
 
@@ -24,6 +32,11 @@ import (
 // @BasePath /api/v1
 func (s *Server) RegisterRoutes() http.Handler {
 	e := echo.New()
+	ipExtractor, err := newIPExtractor(s.config.TrustedProxies)
+	if err != nil {
+		panic(fmt.Sprintf("invalid TRUSTED_PROXIES: %s", err))
+	}
+	e.IPExtractor = ipExtractor
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	fileServer := http.FileServer(http.FS(web.Files))
@@ -32,15 +45,55 @@ func (s *Server) RegisterRoutes() http.Handler {
 	// Swagger route
 	e.GET("/docs/swagger/*", echoSwagger.WrapHandler)
 	e.GET("/health", s.healthHandler)
+	// Public keys for other services to verify access tokens with
+	e.GET("/.well-known/jwks.json", s.jwksHandler)
 
 	api := e.Group("/api/v1")
 	{
-		user.RegisterUserRoutes(api, s.logger, s.db.GetDB())
-		payment.RegisterPaymentRoutes(api, s.logger, s.db.GetDB())
+		user.RegisterUserRoutes(api, s.logger, s.db.GetDB(), s.config, s.hermes)
+		payment.RegisterPaymentRoutes(api, s.logger, s.db.GetDB(), s.config, s.events, s.risk)
+		ledger.RegisterLedgerRoutes(api, s.logger, s.db.GetDB())
+		wallet.RegisterWalletRoutes(api, s.logger, s.db.GetDB())
+		transfer.RegisterTransferRoutes(api, s.logger, s.db.GetDB(), s.config, s.hermes)
+		webhook.RegisterWebhookRoutes(api, s.logger, s.db.GetDB(), s.config)
+		risk.RegisterRiskRoutes(api, s.logger, s.db.GetDB(), s.risk)
 	}
 	return e
 }
 
+// newIPExtractor returns how the client IP of a request is found, for risk
+// rules and logs. X-Forwarded-For and X-Real-IP can be set by any client, so
+// without trusted proxies the client IP is the address of the connection.
+// Behind load balancers, whose ranges are listed in TRUSTED_PROXIES, it is
+// the last X-Forwarded-For address that is not one of them.
+func newIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR range", cidr)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
 func (s *Server) healthHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, s.db.Health())
 }
+
+// jwksHandler serves the keys access tokens are verified with, for other
+// services to verify them without sharing a secret. Verifiers may cache them
+// for a few minutes.
+func (s *Server) jwksHandler(c echo.Context) error {
+	jwks, err := tokens.PublicKeys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, jwks)
+}
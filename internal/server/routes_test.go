@@ -0,0 +1,99 @@
+package server
+
+import (
+	"mamlaka/internal/app/risk"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestIPRulesIgnoreSpoofedHeaders screens requests the way payments are
+// screened, with the client IP echo reports, against a denylisted IP.
+func TestIPRulesIgnoreSpoofedHeaders(t *testing.T) {
+	const denied = "203.0.113.7"
+	rules := risk.Rules{
+		BlockScore: 100,
+		Denylists:  []risk.DenylistRule{{Name: "denied-ips", Key: risk.KeyIP, Values: []string{denied}, Score: 100}},
+	}
+	noAttempts := func(risk.Key, string, time.Time) (int64, error) { return 0, nil }
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		headers        map[string]string
+		wantIP         string
+	}{
+		{
+			name:       "spoofed X-Forwarded-For",
+			remoteAddr: denied + ":52000",
+			headers:    map[string]string{echo.HeaderXForwardedFor: "198.51.100.1"},
+			wantIP:     denied,
+		},
+		{
+			name:       "spoofed X-Real-IP",
+			remoteAddr: denied + ":52000",
+			headers:    map[string]string{echo.HeaderXRealIP: "198.51.100.1"},
+			wantIP:     denied,
+		},
+		{
+			name:           "client behind trusted proxy",
+			trustedProxies: []string{"10.0.0.0/24"},
+			remoteAddr:     "10.0.0.5:52000",
+			headers:        map[string]string{echo.HeaderXForwardedFor: denied},
+			wantIP:         denied,
+		},
+		{
+			name:           "spoofed address before the proxy's",
+			trustedProxies: []string{"10.0.0.0/24"},
+			remoteAddr:     "10.0.0.5:52000",
+			headers:        map[string]string{echo.HeaderXForwardedFor: "198.51.100.1, " + denied},
+			wantIP:         denied,
+		},
+		{
+			name:           "spoofed header from untrusted address",
+			trustedProxies: []string{"10.0.0.0/24"},
+			remoteAddr:     denied + ":52000",
+			headers:        map[string]string{echo.HeaderXForwardedFor: "198.51.100.1"},
+			wantIP:         denied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, err := newIPExtractor(tt.trustedProxies)
+			if err != nil {
+				t.Fatalf("newIPExtractor() error = %v", err)
+			}
+			e := echo.New()
+			e.IPExtractor = extractor
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			if ip := c.RealIP(); ip != tt.wantIP {
+				t.Errorf("RealIP() = %q, want %q", ip, tt.wantIP)
+			}
+			hits, err := rules.Evaluate(risk.Attempt{IP: c.RealIP()}, noAttempts)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if len(hits) != 1 || hits[0].Rule != "denied-ips" {
+				t.Errorf("Evaluate() = %+v, want the denied-ips rule to hit", hits)
+			}
+		})
+	}
+}
+
+func TestNewIPExtractorRejectsInvalidRanges(t *testing.T) {
+	if _, err := newIPExtractor([]string{"10.0.0.1"}); err == nil {
+		t.Error("newIPExtractor() accepted an address without a prefix length")
+	}
+}
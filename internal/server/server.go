@@ -1,11 +1,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"mamlaka/config"
+	"mamlaka/internal/app/risk"
 	"mamlaka/internal/pkg/database"
+	"mamlaka/internal/pkg/pubsub"
 	"mamlaka/internal/pkg/templates"
+	"mamlaka/internal/pkg/tokens"
 	"net/http"
 	"os"
 	"strconv"
@@ -22,20 +26,35 @@ type Server struct {
 	logger *slog.Logger
 	config config.Config
 	hermes *hermes.Hermes
+	events *pubsub.Broker // In-process events, e.g. payment status changes for the payment stream
+	risk   *risk.Engine   // Screens new payments
 }
 
 func NewServer() *http.Server {
 	conf := config.ReadConfigFromEnv()
 
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	db := database.New(conf)
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	if err := tokens.LoadKeys(logger, conf.JWT); err != nil {
+		panic(fmt.Sprintf("cannot load JWT keys: %s", err))
+	}
 	NewServer := &Server{
 		port:   port,
-		db:     database.New(conf),
-		logger: slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+		db:     db,
+		logger: logger,
 		config: conf,
 		hermes: templates.InitializeHermes(),
+		events: pubsub.NewBroker(pubsub.DefaultBuffer),
+		risk:   risk.NewEngine(logger, risk.NewRiskRepository(db.GetDB(), logger), conf.Risk),
 	}
 
+	// Pick up risk rules saved by other servers or changed in the rules file
+	go NewServer.risk.Run(context.Background())
+
+	// Relay events committed by any process, e.g. payment status changes made by the worker
+	go NewServer.events.ListenPostgres(context.Background(), NewServer.logger, database.DSN(conf))
+
 	// Declare Server config
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", NewServer.port),